@@ -2,6 +2,7 @@ package client
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"sudatas/internal/protocol"
+	"sudatas/internal/security"
 	"sudatas/internal/storage"
 )
 
@@ -20,7 +22,14 @@ type Client struct {
 	addr     string
 	username string
 	password string
+	token    string
 	timeout  time.Duration
+
+	tlsConfig *tls.Config // 不为 nil 时使用 TLS 连接
+	serverKey string      // 不为空时使用国密会话模式，为服务端 SM2 公钥的十六进制形式
+
+	name         string              // 握手时发送的客户端名称
+	capabilities protocol.Capability // 握手协商出的功能
 }
 
 // ClientOption 客户端配置选项
@@ -33,6 +42,35 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
+// WithToken 使用访问令牌代替口令登录，password 参数被忽略
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithClientName 设置握手时发送的客户端名称，便于在服务端日志中区分应用
+func WithClientName(name string) ClientOption {
+	return func(c *Client) {
+		c.name = name
+	}
+}
+
+// WithTLS 使用 TLS 连接，config 中配置信任的证书和服务器名称
+func WithTLS(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithSM2Session 使用国密会话模式：连接后先用 SM2 密钥交换协商 SM4 会话密钥。
+// serverPublicKey 为服务端 SM2 公钥的十六进制形式，见服务端启动日志或 SHOW KEYS
+func WithSM2Session(serverPublicKey string) ClientOption {
+	return func(c *Client) {
+		c.serverKey = serverPublicKey
+	}
+}
+
 // NewClient 创建新的客户端
 func NewClient(addr, username, password string, options ...ClientOption) *Client {
 	client := &Client{
@@ -40,6 +78,7 @@ func NewClient(addr, username, password string, options ...ClientOption) *Client
 		username: username,
 		password: password,
 		timeout:  time.Second * 30, // 默认超时时间
+		name:     "sudatas-client",
 	}
 
 	for _, opt := range options {
@@ -58,8 +97,18 @@ func (c *Client) Connect() error {
 	}
 	c.mu.Unlock()
 
+	if c.tlsConfig != nil && c.serverKey != "" {
+		return fmt.Errorf("不能同时使用 TLS 和国密会话模式")
+	}
+
 	// 建立TCP连接
-	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: c.timeout}, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", c.addr, c.timeout)
+	}
 	if err != nil {
 		return fmt.Errorf("连接服务器失败: %w", err)
 	}
@@ -68,6 +117,20 @@ func (c *Client) Connect() error {
 	c.conn = conn
 	c.mu.Unlock()
 
+	// 握手协商协议版本和功能
+	if err := c.hello(); err != nil {
+		c.Close()
+		return err
+	}
+
+	// 国密会话模式先协商会话密钥，之后的认证和查询都经会话密钥加密
+	if c.serverKey != "" {
+		if err := c.keyExchange(); err != nil {
+			c.Close()
+			return err
+		}
+	}
+
 	// 进行身份认证
 	if err := c.authenticate(); err != nil {
 		c.mu.Lock()
@@ -95,41 +158,169 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// authenticate 进行身份认证
-func (c *Client) authenticate() error {
-	// 准备认证数据
-	auth := struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}{
-		Username: c.username,
-		Password: c.password,
+// hello 握手协商协议版本和功能。旧版本的服务端不认识握手消息，返回错误时按第 1 版协议继续，不启用可选功能
+func (c *Client) hello() error {
+	data, err := json.Marshal(protocol.Hello{
+		Magic:        protocol.HelloMagic,
+		Version:      protocol.ProtocolVersion,
+		MinVersion:   protocol.MinProtocolVersion,
+		ClientName:   c.name,
+		Capabilities: protocol.CapEncryption,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化握手数据失败: %w", err)
 	}
 
-	// 序列化认证数据
-	data, err := json.Marshal(auth)
+	response, err := c.sendMessage(&protocol.Message{
+		Type:    protocol.HelloMessage,
+		Payload: data,
+	})
 	if err != nil {
-		return fmt.Errorf("序列化认证数据失败: %w", err)
+		return err
 	}
 
-	// 发送认证消息（不加密）
-	msg := &protocol.Message{
-		Type:    protocol.AuthMessage,
-		Payload: data,
+	switch response.Type {
+	case protocol.HelloMessage:
+		var resp protocol.HelloResponse
+		if err := json.Unmarshal(response.Payload, &resp); err != nil {
+			return fmt.Errorf("解析握手响应失败: %w", err)
+		}
+		c.capabilities = resp.Capabilities
+	case protocol.IncompatibleMessage:
+		var resp protocol.Incompatible
+		if err := json.Unmarshal(response.Payload, &resp); err != nil {
+			return fmt.Errorf("协议版本不兼容: %s", string(response.Payload))
+		}
+		return fmt.Errorf("协议版本不兼容: %s", resp.Message)
+	case protocol.ErrorMessage:
+		c.capabilities = 0
+	default:
+		return fmt.Errorf("意外的握手响应类型: %d", response.Type)
 	}
 
-	response, err := c.sendMessage(msg)
+	if c.serverKey != "" && !c.capabilities.Has(protocol.CapEncryption) {
+		return fmt.Errorf("服务器不支持国密会话模式")
+	}
+	return nil
+}
+
+// keyExchange 与服务端协商会话密钥，把连接替换为加密连接
+func (c *Client) keyExchange() error {
+	initiator, err := security.NewSessionInitiator(c.serverKey)
 	if err != nil {
 		return err
 	}
+	public, ephemeral := initiator.PublicKeys()
+	data, err := json.Marshal(protocol.KeyExchangeRequest{PublicKey: public, Ephemeral: ephemeral})
+	if err != nil {
+		return fmt.Errorf("序列化密钥协商数据失败: %w", err)
+	}
 
+	response, err := c.sendMessage(&protocol.Message{
+		Type:    protocol.KeyExchangeMessage,
+		Payload: data,
+	})
+	if err != nil {
+		return err
+	}
 	if response.Type == protocol.ErrorMessage {
-		return fmt.Errorf("认证失败: %s", string(response.Payload))
+		return fmt.Errorf("密钥协商失败: %s", string(response.Payload))
+	}
+	if response.Type != protocol.KeyExchangeMessage {
+		return fmt.Errorf("意外的密钥协商响应类型: %d", response.Type)
+	}
+	var resp protocol.KeyExchangeResponse
+	if err := json.Unmarshal(response.Payload, &resp); err != nil {
+		return fmt.Errorf("解析密钥协商响应失败: %w", err)
+	}
+	keys, err := initiator.Finish(resp.Ephemeral, resp.Confirm)
+	if err != nil {
+		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, err := security.NewSessionConn(c.conn, nil, keys, true)
+	if err != nil {
+		return err
+	}
+	c.conn = session
 	return nil
 }
 
+// authenticate 进行挑战-应答认证，口令不在网络上传输。配置了访问令牌时直接发送令牌
+func (c *Client) authenticate() error {
+	// 访问令牌只需一轮
+	if c.token != "" {
+		response, err := c.sendAuth(protocol.AuthRequest{Username: c.username, Token: c.token})
+		if err != nil {
+			return err
+		}
+		if response.Type != protocol.ResultMessage {
+			return fmt.Errorf("意外的认证响应类型: %d", response.Type)
+		}
+		return nil
+	}
+
+	nonce, err := security.RandomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	// 第一轮：发送用户名和客户端随机数，获取挑战
+	response, err := c.sendAuth(protocol.AuthRequest{Username: c.username, Nonce: nonce})
+	if err != nil {
+		return err
+	}
+	if response.Type != protocol.ChallengeMessage {
+		return fmt.Errorf("意外的认证响应类型: %d", response.Type)
+	}
+	var challenge protocol.AuthChallenge
+	if err := json.Unmarshal(response.Payload, &challenge); err != nil {
+		return fmt.Errorf("解析认证挑战失败: %w", err)
+	}
+	if challenge.KDF != security.KDFPBKDF2SM3 {
+		return fmt.Errorf("不支持的口令算法: %s", challenge.KDF)
+	}
+
+	// 第二轮：发送应答
+	authMessage := security.PasswordAuthMessage(c.username, nonce, challenge.Nonce, challenge.Salt, challenge.Iterations)
+	proof, err := security.PasswordProof(c.password, challenge.Salt, challenge.Iterations, authMessage)
+	if err != nil {
+		return err
+	}
+	response, err = c.sendAuth(protocol.AuthRequest{Username: c.username, Proof: proof})
+	if err != nil {
+		return err
+	}
+	if response.Type != protocol.ResultMessage {
+		return fmt.Errorf("意外的认证响应类型: %d", response.Type)
+	}
+
+	return nil
+}
+
+// sendAuth 发送一轮认证消息
+func (c *Client) sendAuth(req protocol.AuthRequest) (*protocol.Message, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化认证数据失败: %w", err)
+	}
+
+	response, err := c.sendMessage(&protocol.Message{
+		Type:    protocol.AuthMessage,
+		Payload: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Type == protocol.ErrorMessage {
+		return nil, fmt.Errorf("认证失败: %s", string(response.Payload))
+	}
+	return response, nil
+}
+
 // Query 执行查询
 func (c *Client) Query(sql string) ([]map[string]interface{}, error) {
 	msg := &protocol.Message{
@@ -235,33 +426,38 @@ func (c *Client) Find(collection, database string, filter map[string]interface{}
 	return c.Query(sql)
 }
 
-// Update 更新数据
+// Update 更新数据。update 为更新文档：普通字段直接赋值，也可以使用 $inc、$mul、$unset、$push、$pull、$setIfMissing 等运算符
 func (c *Client) Update(collection, database string, filter, update map[string]interface{}) error {
-	jsonFilter, err := json.Marshal(filter)
-	if err != nil {
-		return err
-	}
-
 	jsonUpdate, err := json.Marshal(update)
 	if err != nil {
 		return err
 	}
 
-	sql := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s",
-		collection, database, string(jsonUpdate), string(jsonFilter))
+	sql := fmt.Sprintf("UPDATE %s.%s SET %s", collection, database, string(jsonUpdate))
+	if filter != nil {
+		jsonFilter, err := json.Marshal(filter)
+		if err != nil {
+			return err
+		}
+		sql += " WHERE " + string(jsonFilter)
+	}
 	_, err = c.Query(sql)
 	return err
 }
 
 // Delete 删除数据
 func (c *Client) Delete(collection, database string, filter map[string]interface{}) error {
-	jsonFilter, err := json.Marshal(filter)
-	if err != nil {
-		return err
+	var sql string
+	if filter == nil {
+		sql = fmt.Sprintf("DELETE FROM %s.%s", collection, database)
+	} else {
+		jsonFilter, err := json.Marshal(filter)
+		if err != nil {
+			return err
+		}
+		sql = fmt.Sprintf("DELETE FROM %s.%s WHERE %s", collection, database, string(jsonFilter))
 	}
-
-	sql := fmt.Sprintf("DELETE FROM %s.%s WHERE %s", collection, database, string(jsonFilter))
-	_, err = c.Query(sql)
+	_, err := c.Query(sql)
 	return err
 }
 
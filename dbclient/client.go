@@ -2,12 +2,14 @@ package dbclient
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"net"
-	"strings"
 	"time"
+
+	"sudatas/internal/security"
 )
 
 // MessageType 消息类型
@@ -18,6 +20,18 @@ const (
 	QueryMessage
 	ResultMessage
 	ErrorMessage
+	ChallengeMessage
+	KeyExchangeMessage
+	HelloMessage
+	IncompatibleMessage
+)
+
+// 握手使用的协议版本和功能位，与服务端的 protocol 包一致
+const (
+	helloMagic      = "SUDATAS"
+	protocolVersion = 1
+
+	capEncryption = 1 << 0 // 国密会话模式
 )
 
 // Message 消息结构
@@ -28,12 +42,17 @@ type Message struct {
 
 // Client 数据库客户端
 type Client struct {
-	conn        net.Conn
-	addr        string
-	username    string
-	password    string
-	timeout     time.Duration
-	isConnected bool
+	conn         net.Conn
+	addr         string
+	username     string
+	password     string
+	token        string
+	timeout      time.Duration
+	tlsConfig    *tls.Config // 不为 nil 时使用 TLS 连接
+	serverKey    string      // 不为空时使用国密会话模式，为服务端 SM2 公钥的十六进制形式
+	name         string      // 握手时发送的客户端名称
+	capabilities uint32      // 握手协商出的功能
+	isConnected  bool
 }
 
 // ClientOption 客户端配置选项
@@ -46,6 +65,35 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
+// WithToken 使用访问令牌代替口令登录，password 参数被忽略
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithClientName 设置握手时发送的客户端名称，便于在服务端日志中区分应用
+func WithClientName(name string) ClientOption {
+	return func(c *Client) {
+		c.name = name
+	}
+}
+
+// WithTLS 使用 TLS 连接，config 中配置信任的证书和服务器名称
+func WithTLS(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithSM2Session 使用国密会话模式：连接后先用 SM2 密钥交换协商 SM4 会话密钥。
+// serverPublicKey 为服务端 SM2 公钥的十六进制形式，见服务端启动日志或 SHOW KEYS
+func WithSM2Session(serverPublicKey string) ClientOption {
+	return func(c *Client) {
+		c.serverKey = serverPublicKey
+	}
+}
+
 // NewClient 创建新的客户端实例
 func NewClient(addr, username, password string, options ...ClientOption) *Client {
 	client := &Client{
@@ -53,6 +101,7 @@ func NewClient(addr, username, password string, options ...ClientOption) *Client
 		username: username,
 		password: password,
 		timeout:  time.Second * 30, // 默认超时时间
+		name:     "sudatas-dbclient",
 	}
 
 	for _, opt := range options {
@@ -68,13 +117,39 @@ func (c *Client) Connect() error {
 		return nil // 已经连接
 	}
 
+	if c.tlsConfig != nil && c.serverKey != "" {
+		return fmt.Errorf("不能同时使用 TLS 和国密会话模式")
+	}
+
 	// 建立TCP连接
-	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: c.timeout}, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", c.addr, c.timeout)
+	}
 	if err != nil {
 		return fmt.Errorf("连接服务器失败: %w", err)
 	}
 	c.conn = conn
 
+	// 握手协商协议版本和功能
+	if err := c.hello(); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+
+	// 国密会话模式先协商会话密钥，之后的认证和查询都经会话密钥加密
+	if c.serverKey != "" {
+		if err := c.keyExchange(); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+
 	// 进行身份认证
 	if err := c.authenticate(); err != nil {
 		c.conn.Close()
@@ -161,33 +236,21 @@ func (c *Client) Update(collection, database string, updates map[string]interfac
 		return err
 	}
 
-	// 构造 SET 子句
-	var setParts []string
-	for key, value := range updates {
-		// 根据值的类型添加适当的引号
-		var valueStr string
-		switch v := value.(type) {
-		case string:
-			valueStr = fmt.Sprintf("'%s'", v)
-		default:
-			valueStr = fmt.Sprintf("%v", v)
-		}
-		setParts = append(setParts, fmt.Sprintf("%s = %s", key, valueStr))
-	}
-
-	// 构造 WHERE 子句
-	whereJson, err := json.Marshal(where)
+	// 构造 SET 子句（JSON更新文档，保留值的类型）
+	setJson, err := json.Marshal(updates)
 	if err != nil {
-		return fmt.Errorf("序列化WHERE条件失败: %w", err)
+		return fmt.Errorf("序列化SET内容失败: %w", err)
 	}
 
-	// 构造完整的 UPDATE 语句
-	sql := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s",
-		collection,
-		database,
-		strings.Join(setParts, ", "),
-		string(whereJson),
-	)
+	// 构造完整的 UPDATE 语句，没有条件时更新所有记录
+	sql := fmt.Sprintf("UPDATE %s.%s SET %s", collection, database, string(setJson))
+	if where != nil {
+		whereJson, err := json.Marshal(where)
+		if err != nil {
+			return fmt.Errorf("序列化WHERE条件失败: %w", err)
+		}
+		sql += " WHERE " + string(whereJson)
+	}
 
 	_, err = c.Query(sql)
 	return err
@@ -195,37 +258,190 @@ func (c *Client) Update(collection, database string, updates map[string]interfac
 
 // 内部方法
 
-func (c *Client) authenticate() error {
-	auth := struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}{
-		Username: c.username,
-		Password: c.password,
+// hello 握手协商协议版本和功能。旧版本的服务端不认识握手消息，返回错误时按第 1 版协议继续，不启用可选功能
+func (c *Client) hello() error {
+	data, err := json.Marshal(map[string]interface{}{
+		"magic":        helloMagic,
+		"version":      protocolVersion,
+		"min_version":  protocolVersion,
+		"client_name":  c.name,
+		"capabilities": capEncryption,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化握手数据失败: %w", err)
 	}
 
-	data, err := json.Marshal(auth)
+	response, err := c.sendMessage(&Message{
+		Type:    HelloMessage,
+		Payload: data,
+	})
 	if err != nil {
-		return fmt.Errorf("序列化认证数据失败: %w", err)
+		return err
 	}
 
-	msg := &Message{
-		Type:    AuthMessage,
-		Payload: data,
+	switch response.Type {
+	case HelloMessage:
+		var resp struct {
+			Capabilities uint32 `json:"capabilities"`
+		}
+		if err := json.Unmarshal(response.Payload, &resp); err != nil {
+			return fmt.Errorf("解析握手响应失败: %w", err)
+		}
+		c.capabilities = resp.Capabilities
+	case IncompatibleMessage:
+		var resp struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(response.Payload, &resp); err != nil {
+			return fmt.Errorf("协议版本不兼容: %s", string(response.Payload))
+		}
+		return fmt.Errorf("协议版本不兼容: %s", resp.Message)
+	case ErrorMessage:
+		c.capabilities = 0
+	default:
+		return fmt.Errorf("意外的握手响应类型: %d", response.Type)
 	}
 
-	response, err := c.sendMessage(msg)
+	if c.serverKey != "" && c.capabilities&capEncryption == 0 {
+		return fmt.Errorf("服务器不支持国密会话模式")
+	}
+	return nil
+}
+
+// keyExchange 与服务端协商会话密钥，把连接替换为加密连接
+func (c *Client) keyExchange() error {
+	initiator, err := security.NewSessionInitiator(c.serverKey)
 	if err != nil {
 		return err
 	}
+	public, ephemeral := initiator.PublicKeys()
+	data, err := json.Marshal(map[string]interface{}{
+		"public_key": public,
+		"ephemeral":  ephemeral,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化密钥协商数据失败: %w", err)
+	}
 
+	response, err := c.sendMessage(&Message{
+		Type:    KeyExchangeMessage,
+		Payload: data,
+	})
+	if err != nil {
+		return err
+	}
 	if response.Type == ErrorMessage {
-		return fmt.Errorf("认证失败: %s", string(response.Payload))
+		return fmt.Errorf("密钥协商失败: %s", string(response.Payload))
+	}
+	if response.Type != KeyExchangeMessage {
+		return fmt.Errorf("意外的密钥协商响应类型: %d", response.Type)
+	}
+	var resp struct {
+		Ephemeral []byte `json:"ephemeral"`
+		Confirm   []byte `json:"confirm"`
+	}
+	if err := json.Unmarshal(response.Payload, &resp); err != nil {
+		return fmt.Errorf("解析密钥协商响应失败: %w", err)
+	}
+	keys, err := initiator.Finish(resp.Ephemeral, resp.Confirm)
+	if err != nil {
+		return err
+	}
+
+	session, err := security.NewSessionConn(c.conn, nil, keys, true)
+	if err != nil {
+		return err
+	}
+	c.conn = session
+	return nil
+}
+
+// authenticate 进行挑战-应答认证，口令不在网络上传输。配置了访问令牌时直接发送令牌
+func (c *Client) authenticate() error {
+	// 访问令牌只需一轮
+	if c.token != "" {
+		response, err := c.sendAuth(map[string]interface{}{
+			"username": c.username,
+			"token":    c.token,
+		})
+		if err != nil {
+			return err
+		}
+		if response.Type != ResultMessage {
+			return fmt.Errorf("意外的认证响应类型: %d", response.Type)
+		}
+		return nil
+	}
+
+	nonce, err := security.RandomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	// 第一轮：发送用户名和客户端随机数，获取挑战
+	response, err := c.sendAuth(map[string]interface{}{
+		"username": c.username,
+		"nonce":    nonce,
+	})
+	if err != nil {
+		return err
+	}
+	if response.Type != ChallengeMessage {
+		return fmt.Errorf("意外的认证响应类型: %d", response.Type)
+	}
+	var challenge struct {
+		Nonce      []byte `json:"nonce"`
+		KDF        string `json:"kdf"`
+		Salt       []byte `json:"salt"`
+		Iterations int    `json:"iterations"`
+	}
+	if err := json.Unmarshal(response.Payload, &challenge); err != nil {
+		return fmt.Errorf("解析认证挑战失败: %w", err)
+	}
+	if challenge.KDF != security.KDFPBKDF2SM3 {
+		return fmt.Errorf("不支持的口令算法: %s", challenge.KDF)
+	}
+
+	// 第二轮：发送应答
+	authMessage := security.PasswordAuthMessage(c.username, nonce, challenge.Nonce, challenge.Salt, challenge.Iterations)
+	proof, err := security.PasswordProof(c.password, challenge.Salt, challenge.Iterations, authMessage)
+	if err != nil {
+		return err
+	}
+	response, err = c.sendAuth(map[string]interface{}{
+		"username": c.username,
+		"proof":    proof,
+	})
+	if err != nil {
+		return err
+	}
+	if response.Type != ResultMessage {
+		return fmt.Errorf("意外的认证响应类型: %d", response.Type)
 	}
 
 	return nil
 }
 
+func (c *Client) sendAuth(auth map[string]interface{}) (*Message, error) {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return nil, fmt.Errorf("序列化认证数据失败: %w", err)
+	}
+
+	response, err := c.sendMessage(&Message{
+		Type:    AuthMessage,
+		Payload: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Type == ErrorMessage {
+		return nil, fmt.Errorf("认证失败: %s", string(response.Payload))
+	}
+	return response, nil
+}
+
 func (c *Client) sendMessage(msg *Message) (*Message, error) {
 	// 设置读写超时
 	deadline := time.Now().Add(c.timeout)
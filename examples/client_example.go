@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -12,11 +13,11 @@ import (
 )
 
 func main() {
-	// 创建客户端
+	// 创建客户端，root 口令为服务器首次启动时设置的口令
 	c := client.NewClient(
 		"localhost:5432",
 		"root",
-		"123456",
+		os.Getenv("SUDATAS_PASSWORD"),
 		client.WithTimeout(time.Second*10),
 	)
 
@@ -2,8 +2,10 @@ package audit
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -55,6 +57,11 @@ func NewAuditLogger(dir string, crypto *security.CryptoManager, maxSize int64) (
 		maxSize: maxSize,
 	}
 
+	// 将旧格式的日志重新加密
+	if err := logger.reencryptLogs(); err != nil {
+		return nil, err
+	}
+
 	if err := logger.rotateLog(); err != nil {
 		return nil, err
 	}
@@ -86,8 +93,13 @@ func (l *AuditLogger) Log(entry *LogEntry) error {
 		return fmt.Errorf("加密日志失败: %w", err)
 	}
 
+	// 密文按 base64 编码后按行写入，避免密文中的换行符破坏分行
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(encrypted))+1)
+	base64.StdEncoding.Encode(line, encrypted)
+	line[len(line)-1] = '\n'
+
 	// 写入日志文件
-	n, err := l.file.Write(append(encrypted, '\n'))
+	n, err := l.file.Write(line)
 	if err != nil {
 		return fmt.Errorf("写入日志失败: %w", err)
 	}
@@ -157,7 +169,7 @@ func (l *AuditLogger) ReadLogs(start, end time.Time) ([]*LogEntry, error) {
 			}
 
 			// 解密日志行
-			decrypted, err := l.crypto.DecryptSM4(line)
+			decrypted, err := l.decryptLine(line)
 			if err != nil {
 				continue // 跳过无法解密的行
 			}
@@ -183,3 +195,111 @@ func (l *AuditLogger) ReadLogs(start, end time.Time) ([]*LogEntry, error) {
 
 	return entries, nil
 }
+
+// decryptLine 解码并解密一行日志
+func (l *AuditLogger) decryptLine(line []byte) ([]byte, error) {
+	encrypted := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(encrypted, line)
+	if err != nil {
+		return nil, err
+	}
+	return l.crypto.DecryptSM4(encrypted[:n])
+}
+
+// Reencrypt 用当前密钥重新加密所有日志文件，之后的日志写入新文件
+func (l *AuditLogger) Reencrypt() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.reencryptLogs(); err != nil {
+		return err
+	}
+	// 当前文件可能已被替换，重新打开
+	return l.rotateLog()
+}
+
+// quarantineSuffix 无法解密的日志行原样移入的隔离文件后缀
+const quarantineSuffix = ".quarantine"
+
+// reencryptLogs 将不是用当前密钥加密的日志行重新加密，包括旧格式（按块加密的密文直接按行写入）的日志。
+// 无法解密的行（旧格式只加密了第一个分组，或密文中的换行符把一行拆开）不会被删除，
+// 而是先原样追加到 <日志文件>.quarantine 中，写入隔离文件失败时停止迁移、日志文件保持不变
+func (l *AuditLogger) reencryptLogs() error {
+	files, err := filepath.Glob(filepath.Join(l.dir, "*.log"))
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取日志文件失败: %w", err)
+		}
+
+		var out, quarantined bytes.Buffer
+		rewritten, unreadable := 0, 0
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+
+			var encrypted []byte
+			if decoded, err := base64.StdEncoding.DecodeString(string(line)); err == nil && !security.IsLegacySM4(decoded) {
+				if !l.crypto.NeedsReencrypt(decoded) {
+					out.Write(line)
+					out.WriteByte('\n')
+					continue
+				}
+				encrypted, _, err = l.crypto.ReencryptSM4(decoded)
+				if err != nil {
+					return fmt.Errorf("重新加密日志失败 [%s]: %w", path, err)
+				}
+			} else {
+				plaintext, err := l.crypto.DecryptLegacySM4(line)
+				if err != nil {
+					quarantined.Write(line)
+					quarantined.WriteByte('\n')
+					unreadable++
+					continue
+				}
+				if encrypted, err = l.crypto.EncryptSM4(plaintext); err != nil {
+					return fmt.Errorf("加密日志失败: %w", err)
+				}
+			}
+			out.WriteString(base64.StdEncoding.EncodeToString(encrypted))
+			out.WriteByte('\n')
+			rewritten++
+		}
+
+		if rewritten == 0 && unreadable == 0 {
+			continue
+		}
+		if unreadable > 0 {
+			if err := appendQuarantine(path+quarantineSuffix, quarantined.Bytes()); err != nil {
+				return fmt.Errorf("隔离无法解密的日志失败 [%s]: %w", path, err)
+			}
+		}
+		if err := security.WriteFileAtomic(path, out.Bytes(), 0600); err != nil {
+			return fmt.Errorf("重写日志文件失败: %w", err)
+		}
+		log.Printf("已重新加密审计日志 %s: %d 条，无法解密的 %d 条已移入 %s", path, rewritten, unreadable, path+quarantineSuffix)
+	}
+	return nil
+}
+
+// appendQuarantine 将无法解密的日志行追加到隔离文件并落盘
+func appendQuarantine(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
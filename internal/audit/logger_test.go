@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm4"
+
+	"sudatas/internal/security"
+)
+
+// newLegacyCrypto 按旧版本的明文密钥文件创建密钥管理器，返回其 SM4 密钥用于构造旧格式日志
+func newLegacyCrypto(t *testing.T) (*security.CryptoManager, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	priv, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key.pri"), priv.D.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key.sm4"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cm := &security.CryptoManager{}
+	if err := cm.LoadKeys(filepath.Join(dir, "key"), []byte("master-secret")); err != nil {
+		t.Fatal(err)
+	}
+	return cm, key
+}
+
+// legacyLine 按旧版本的方式加密一条日志：只加密第一个分组，密文直接按行写入
+func legacyLine(t *testing.T, key []byte, entry *LogEntry) []byte {
+	t.Helper()
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(data))
+	block.Encrypt(ciphertext, data)
+	return append(ciphertext, '\n')
+}
+
+func readAll(t *testing.T, l *AuditLogger) []*LogEntry {
+	t.Helper()
+	entries, err := l.ReadLogs(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestLegacyLogsAreQuarantined(t *testing.T) {
+	cm, key := newLegacyCrypto(t)
+	dir := t.TempDir()
+
+	var legacy bytes.Buffer
+	for i := 0; i < 5; i++ {
+		legacy.Write(legacyLine(t, key, &LogEntry{Timestamp: time.Now(), User: "old", Action: "LOGIN"}))
+	}
+	path := filepath.Join(dir, "audit_20200101000000.log")
+	if err := os.WriteFile(path, legacy.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewAuditLogger(dir, cm, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// 无法解密的行原样移入隔离文件，不会丢失
+	quarantined, err := os.ReadFile(path + quarantineSuffix)
+	if err != nil {
+		t.Fatalf("隔离文件不存在: %v", err)
+	}
+	if !bytes.Equal(quarantined, legacy.Bytes()) {
+		t.Fatal("隔离文件的内容与原日志不同")
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("日志文件中仍有 %d 字节无法解密的内容", len(data))
+	}
+
+	if err := l.Log(&LogEntry{Timestamp: time.Now(), User: "new", Action: "LOGIN"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := readAll(t, l); len(entries) != 1 || entries[0].User != "new" {
+		t.Fatalf("读取到 %d 条日志", len(entries))
+	}
+
+	// 再次迁移时隔离文件不会重复追加
+	if err := l.Reencrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path + quarantineSuffix); !bytes.Equal(data, legacy.Bytes()) {
+		t.Fatal("重新加密后隔离文件被改变")
+	}
+}
+
+func TestQuarantineFailureKeepsLog(t *testing.T) {
+	cm, key := newLegacyCrypto(t)
+	dir := t.TempDir()
+
+	line := legacyLine(t, key, &LogEntry{Timestamp: time.Now(), User: "old", Action: "LOGIN"})
+	path := filepath.Join(dir, "audit_20200101000000.log")
+	if err := os.WriteFile(path, line, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 隔离文件的位置被目录占用，写入失败
+	if err := os.Mkdir(path+quarantineSuffix, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewAuditLogger(dir, cm, 1<<20); err == nil {
+		t.Fatal("隔离失败时仍然创建了日志管理器")
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, line) {
+		t.Fatal("隔离失败后日志文件被改写")
+	}
+}
+
+func TestReencryptAfterKeyRotation(t *testing.T) {
+	cm, err := security.NewCryptoManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewAuditLogger(t.TempDir(), cm, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := l.Log(&LogEntry{Timestamp: time.Now(), User: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cm.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Log(&LogEntry{Timestamp: time.Now(), User: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reencrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.RetireKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Log(&LogEntry{Timestamp: time.Now(), User: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := readAll(t, l); len(entries) != 7 {
+		t.Fatalf("读取到 %d 条日志，期望 7 条", len(entries))
+	}
+}
@@ -27,7 +27,10 @@ const (
 
 	// 用户管理权限
 	PermCreateUser Permission = "CREATE_USER"
+	PermAlterUser  Permission = "ALTER_USER"
 	PermDropUser   Permission = "DROP_USER"
+	PermCreateRole Permission = "CREATE_ROLE"
+	PermDropRole   Permission = "DROP_ROLE"
 	PermGrant      Permission = "GRANT"
 	PermRevoke     Permission = "REVOKE"
 
@@ -36,15 +39,19 @@ const (
 	PermRestore     Permission = "RESTORE"
 	PermViewAudit   Permission = "VIEW_AUDIT"
 	PermManageAudit Permission = "MANAGE_AUDIT"
+	PermManageKeys  Permission = "MANAGE_KEYS"
 )
 
 // ResourceType 资源类型
 type ResourceType string
 
+// 数据权限的资源都使用 ResDatabase，名称为 collection.database
 const (
 	ResDatabase ResourceType = "DATABASE"
 	ResTable    ResourceType = "TABLE"
 	ResColumn   ResourceType = "COLUMN"
+	ResUser     ResourceType = "USER"
+	ResRole     ResourceType = "ROLE"
 )
 
 // Resource 资源标识
@@ -58,8 +65,10 @@ type Resource struct {
 type PermissionRule struct {
 	Permission Permission `json:"permission"`
 	Resource   Resource   `json:"resource"`
-	Grant      bool       `json:"grant"`     // 是否可以授权给其他用户
-	Condition  string     `json:"condition"` // 条件表达式
+	Grant      bool       `json:"grant"`          // 是否可以授权给其他用户
+	Condition  string     `json:"condition"`      // 条件表达式
+	Deny       bool       `json:"deny,omitempty"` // 列级限制：隐藏字段
+	Mask       string     `json:"mask,omitempty"` // 列级限制：以该方式脱敏后返回字段
 }
 
 // Role 角色定义
@@ -101,14 +110,20 @@ func (pm *PermissionManager) initPredefinedRoles() {
 		Rules: []PermissionRule{
 			{Permission: PermCreateDB, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermDropDB, Resource: Resource{Type: ResDatabase}},
-			{Permission: PermCreateUser, Resource: Resource{Type: ResDatabase}},
-			{Permission: PermDropUser, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermCreateUser, Resource: Resource{Type: ResUser}},
+			{Permission: PermAlterUser, Resource: Resource{Type: ResUser}},
+			{Permission: PermDropUser, Resource: Resource{Type: ResUser}},
+			{Permission: PermCreateRole, Resource: Resource{Type: ResRole}},
+			{Permission: PermDropRole, Resource: Resource{Type: ResRole}},
 			{Permission: PermGrant, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermRevoke, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermGrant, Resource: Resource{Type: ResRole}},
+			{Permission: PermRevoke, Resource: Resource{Type: ResRole}},
 			{Permission: PermBackup, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermRestore, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermViewAudit, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermManageAudit, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermManageKeys, Resource: Resource{Type: ResDatabase}},
 		},
 	}
 	pm.roles["admin"] = adminRole
@@ -118,7 +133,7 @@ func (pm *PermissionManager) initPredefinedRoles() {
 		Name:        "readonly",
 		Description: "只读用户",
 		Rules: []PermissionRule{
-			{Permission: PermSelect, Resource: Resource{Type: ResTable}},
+			{Permission: PermSelect, Resource: Resource{Type: ResDatabase}},
 		},
 	}
 	pm.roles["readonly"] = readOnlyRole
@@ -128,17 +143,83 @@ func (pm *PermissionManager) initPredefinedRoles() {
 		Name:        "developer",
 		Description: "开发人员",
 		Rules: []PermissionRule{
-			{Permission: PermSelect, Resource: Resource{Type: ResTable}},
-			{Permission: PermInsert, Resource: Resource{Type: ResTable}},
-			{Permission: PermUpdate, Resource: Resource{Type: ResTable}},
-			{Permission: PermDelete, Resource: Resource{Type: ResTable}},
+			{Permission: PermSelect, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermInsert, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermUpdate, Resource: Resource{Type: ResDatabase}},
+			{Permission: PermDelete, Resource: Resource{Type: ResDatabase}},
 			{Permission: PermCreateTable, Resource: Resource{Type: ResDatabase}},
-			{Permission: PermAlterTable, Resource: Resource{Type: ResTable}},
+			{Permission: PermAlterTable, Resource: Resource{Type: ResDatabase}},
 		},
 	}
 	pm.roles["developer"] = developerRole
 }
 
+// predefinedRoles 预定义角色，不能删除或重新定义
+var predefinedRoles = map[string]bool{
+	"admin":     true,
+	"readonly":  true,
+	"developer": true,
+}
+
+// IsPredefinedRole 是否为预定义角色
+func IsPredefinedRole(name string) bool {
+	return predefinedRoles[name]
+}
+
+// CreateRole 创建自定义角色
+func (pm *PermissionManager) CreateRole(role *Role) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if role.Name == "" {
+		return fmt.Errorf("角色名称不能为空")
+	}
+	if _, exists := pm.roles[role.Name]; exists {
+		return fmt.Errorf("角色已存在: %s", role.Name)
+	}
+
+	pm.roles[role.Name] = role
+	return nil
+}
+
+// DropRole 删除自定义角色，同时收回所有用户的该角色，返回原来拥有该角色的用户
+func (pm *PermissionManager) DropRole(name string) ([]string, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if predefinedRoles[name] {
+		return nil, fmt.Errorf("不能删除预定义角色: %s", name)
+	}
+	if _, exists := pm.roles[name]; !exists {
+		return nil, fmt.Errorf("角色不存在: %s", name)
+	}
+
+	delete(pm.roles, name)
+	var affected []string
+	for username, roles := range pm.userRoles {
+		if kept, removed := removeString(roles, name); removed {
+			pm.userRoles[username] = kept
+			affected = append(affected, username)
+		}
+	}
+	return affected, nil
+}
+
+// GetRole 获取角色定义
+func (pm *PermissionManager) GetRole(name string) (*Role, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	role, exists := pm.roles[name]
+	return role, exists
+}
+
+// RoleExists 角色是否存在
+func (pm *PermissionManager) RoleExists(name string) bool {
+	_, exists := pm.GetRole(name)
+	return exists
+}
+
 // AssignRole 为用户分配角色
 func (pm *PermissionManager) AssignRole(username, roleName string) error {
 	pm.mu.Lock()
@@ -162,11 +243,46 @@ func (pm *PermissionManager) AssignRole(username, roleName string) error {
 	return nil
 }
 
+// RevokeRole 收回用户的角色
+func (pm *PermissionManager) RevokeRole(username, roleName string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if kept, removed := removeString(pm.userRoles[username], roleName); removed {
+		pm.userRoles[username] = kept
+	}
+}
+
+// UserRoles 返回用户的角色
+func (pm *PermissionManager) UserRoles(username string) []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return append([]string(nil), pm.userRoles[username]...)
+}
+
+// RemoveUser 删除用户的所有角色和直接权限
+func (pm *PermissionManager) RemoveUser(username string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	delete(pm.userRoles, username)
+	delete(pm.userPermissions, username)
+}
+
 // GrantPermission 为用户直接授予权限
 func (pm *PermissionManager) GrantPermission(username string, rule PermissionRule) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	// 相同的权限只保留一条，再次授予时更新是否可以转授
+	for i, r := range pm.userPermissions[username] {
+		if r.Permission == rule.Permission && r.Resource == rule.Resource {
+			pm.userPermissions[username][i] = rule
+			return nil
+		}
+	}
+
 	if perms, exists := pm.userPermissions[username]; exists {
 		pm.userPermissions[username] = append(perms, rule)
 	} else {
@@ -176,6 +292,118 @@ func (pm *PermissionManager) GrantPermission(username string, rule PermissionRul
 	return nil
 }
 
+// AddPermission 为用户直接授予权限。与 GrantPermission 不同，已有相同权限和资源的规则时报错，
+// 用于转授：转授者不能替换对方已有的、可能更严格的规则
+func (pm *PermissionManager) AddPermission(username string, rule PermissionRule) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if hasRule(pm.userPermissions[username], rule.Permission, rule.Resource) {
+		return fmt.Errorf("用户 %s 已有 %s 权限，不能通过转授修改", username, rule.Permission)
+	}
+	pm.userPermissions[username] = append(pm.userPermissions[username], rule)
+	return nil
+}
+
+// RevokePermission 收回用户直接拥有的、与 perm 和 res 完全相同的权限，返回是否收回
+func (pm *PermissionManager) RevokePermission(username string, perm Permission, res Resource) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	kept, removed := removeRules(pm.userPermissions[username], perm, res)
+	if removed {
+		pm.userPermissions[username] = kept
+	}
+	return removed
+}
+
+// GrantRolePermission 为自定义角色增加权限
+func (pm *PermissionManager) GrantRolePermission(roleName string, rule PermissionRule) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	role, err := pm.modifiableRoleLocked(roleName, rule.ColumnRestriction())
+	if err != nil {
+		return err
+	}
+	for i, r := range role.Rules {
+		if r.Permission == rule.Permission && r.Resource == rule.Resource {
+			role.Rules[i] = rule
+			return nil
+		}
+	}
+	role.Rules = append(role.Rules, rule)
+	return nil
+}
+
+// AddRolePermission 为自定义角色增加权限，已有相同权限和资源的规则时报错，用于转授
+func (pm *PermissionManager) AddRolePermission(roleName string, rule PermissionRule) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	role, err := pm.customRoleLocked(roleName)
+	if err != nil {
+		return err
+	}
+	if hasRule(role.Rules, rule.Permission, rule.Resource) {
+		return fmt.Errorf("角色 %s 已有 %s 权限，不能通过转授修改", roleName, rule.Permission)
+	}
+	role.Rules = append(role.Rules, rule)
+	return nil
+}
+
+// RevokeRolePermission 收回自定义角色的权限，返回是否收回
+func (pm *PermissionManager) RevokeRolePermission(roleName string, perm Permission, res Resource) (bool, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	role, err := pm.modifiableRoleLocked(roleName, res.Type == ResColumn)
+	if err != nil {
+		return false, err
+	}
+	kept, removed := removeRules(role.Rules, perm, res)
+	role.Rules = kept
+	return removed, nil
+}
+
+// modifiableRoleLocked 返回可以修改的角色。预定义角色只能增删列级限制，调用方需持有写锁
+func (pm *PermissionManager) modifiableRoleLocked(roleName string, columnRestriction bool) (*Role, error) {
+	if columnRestriction && predefinedRoles[roleName] {
+		return pm.roles[roleName], nil
+	}
+	return pm.customRoleLocked(roleName)
+}
+
+// customRoleLocked 返回可以修改的自定义角色，调用方需持有写锁
+func (pm *PermissionManager) customRoleLocked(roleName string) (*Role, error) {
+	if predefinedRoles[roleName] {
+		return nil, fmt.Errorf("不能修改预定义角色: %s", roleName)
+	}
+	role, exists := pm.roles[roleName]
+	if !exists {
+		return nil, fmt.Errorf("角色不存在: %s", roleName)
+	}
+	return role, nil
+}
+
+// CanGrant 用户是否拥有可以转授（WITH GRANT OPTION）的特定权限，并返回转授时必须附加的行级条件。
+// 多条可转授规则的条件按“或”合并，只要有一条没有条件，conditions 为空
+func (pm *PermissionManager) CanGrant(username string, perm Permission, res Resource) (conditions []string, ok bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, rule := range pm.userRulesLocked(username) {
+		if !rule.Grant || !pm.matchPermissionRule(rule, perm, res) {
+			continue
+		}
+		if rule.Condition == "" {
+			return nil, true
+		}
+		conditions = append(conditions, rule.Condition)
+	}
+	return conditions, len(conditions) > 0
+}
+
 // CheckPermission 检查用户是否有特定权限
 func (pm *PermissionManager) CheckPermission(username string, perm Permission, res Resource) bool {
 	pm.mu.RLock()
@@ -184,7 +412,7 @@ func (pm *PermissionManager) CheckPermission(username string, perm Permission, r
 	// 检查直接权限
 	if rules, exists := pm.userPermissions[username]; exists {
 		for _, rule := range rules {
-			if pm.matchPermissionRule(rule, perm, res) {
+			if pm.grantsAccess(rule, perm, res) {
 				return true
 			}
 		}
@@ -195,7 +423,7 @@ func (pm *PermissionManager) CheckPermission(username string, perm Permission, r
 		for _, roleName := range roles {
 			if role, exists := pm.roles[roleName]; exists {
 				for _, rule := range role.Rules {
-					if pm.matchPermissionRule(rule, perm, res) {
+					if pm.grantsAccess(rule, perm, res) {
 						return true
 					}
 				}
@@ -206,6 +434,54 @@ func (pm *PermissionManager) CheckPermission(username string, perm Permission, r
 	return false
 }
 
+// RowConditions 返回用户在资源上某个权限的行级安全条件。
+// 直接授予和角色中所有匹配的规则按“或”合并：只要有一条授予整个资源的规则没有条件，
+// 该权限就不受行级限制，restricted 为 false。列级授权只决定可以访问的字段，
+// 没有条件时不解除行级限制，带条件时与其他条件一起合并
+func (pm *PermissionManager) RowConditions(username string, perm Permission, res Resource) (conditions []string, restricted bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, rule := range pm.userRulesLocked(username) {
+		if pm.matchPermissionRule(rule, perm, res) {
+			if rule.Condition == "" {
+				return nil, false
+			}
+			conditions = append(conditions, rule.Condition)
+			continue
+		}
+		if !rule.Deny && matchColumnRule(rule, perm, res) && rule.Condition != "" {
+			conditions = append(conditions, rule.Condition)
+		}
+	}
+	return conditions, len(conditions) > 0
+}
+
+// RowRestrictedInCollection 用户在集合中任一数据库上的 perm 权限是否带行级条件，
+// 用于导入这类一次写入多个数据库、无法逐行检查策略的操作
+func (pm *PermissionManager) RowRestrictedInCollection(username string, perm Permission, collection string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, rule := range pm.userRulesLocked(username) {
+		if rule.Permission != perm || rule.Condition == "" || rule.Deny {
+			continue
+		}
+		if rule.Resource.Type != ResDatabase && rule.Resource.Type != ResColumn {
+			continue
+		}
+		// 资源名为 collection.database，只比较集合部分
+		pattern := rule.Resource.Name
+		if i := strings.Index(pattern, "."); i >= 0 {
+			pattern = pattern[:i]
+		}
+		if pattern == "" || MatchWildcard(pattern, collection) {
+			return true
+		}
+	}
+	return false
+}
+
 // matchPermissionRule 检查权限规则是否匹配
 func (pm *PermissionManager) matchPermissionRule(rule PermissionRule, perm Permission, res Resource) bool {
 	if rule.Permission != perm {
@@ -222,16 +498,24 @@ func (pm *PermissionManager) matchPermissionRule(rule PermissionRule, perm Permi
 		return true
 	}
 
-	// 支持通配符匹配
+	// 支持通配符匹配，* 匹配任意字符
 	if strings.Contains(rule.Resource.Name, "*") {
-		pattern := strings.ReplaceAll(rule.Resource.Name, "*", ".*")
-		matched, _ := regexp.MatchString(pattern, res.Name)
-		return matched
+		return MatchWildcard(rule.Resource.Name, res.Name)
 	}
 
 	return rule.Resource.Name == res.Name
 }
 
+// MatchWildcard 检查名称是否匹配含通配符 * 的模式，* 匹配任意字符（包括空）
+func MatchWildcard(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	matched, _ := regexp.MatchString("^"+strings.Join(parts, ".*")+"$", name)
+	return matched
+}
+
 // ListUserPermissions 列出用户所有权限
 func (pm *PermissionManager) ListUserPermissions(username string) []PermissionRule {
 	pm.mu.RLock()
@@ -255,3 +539,37 @@ func (pm *PermissionManager) ListUserPermissions(username string) []PermissionRu
 
 	return allRules
 }
+
+// removeRules 删除权限和资源都相同的规则，返回新切片和是否删除
+func removeRules(rules []PermissionRule, perm Permission, res Resource) ([]PermissionRule, bool) {
+	var kept []PermissionRule
+	removed := false
+	for _, rule := range rules {
+		if rule.Permission == perm && rule.Resource == res {
+			removed = true
+			continue
+		}
+		kept = append(kept, rule)
+	}
+	return kept, removed
+}
+
+// hasRule 规则列表中是否有与 perm 和 res 完全相同的规则
+func hasRule(rules []PermissionRule, perm Permission, res Resource) bool {
+	for _, rule := range rules {
+		if rule.Permission == perm && rule.Resource == res {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString 从切片中删除指定字符串，返回新切片和是否删除
+func removeString(list []string, s string) ([]string, bool) {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...), true
+		}
+	}
+	return list, false
+}
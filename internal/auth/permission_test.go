@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRowConditions(t *testing.T) {
+	db := Resource{Type: ResDatabase, Name: "shop.orders"}
+	whole := func(name, cond string) PermissionRule {
+		return PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResDatabase, Name: name}, Condition: cond}
+	}
+	column := func(sub, cond string) PermissionRule {
+		return PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResColumn, Name: "shop.orders", Sub: sub}, Condition: cond}
+	}
+
+	tests := []struct {
+		name       string
+		rules      []PermissionRule
+		conditions []string
+		restricted bool
+	}{
+		{"整个资源的授权没有条件", []PermissionRule{whole("shop.*", "")}, nil, false},
+		{"整个资源的授权带条件", []PermissionRule{whole("shop.*", "owner = $user")}, []string{"owner = $user"}, true},
+		{"多条条件按或合并", []PermissionRule{whole("shop.*", "owner = $user"), whole("shop.orders", "public = true")}, []string{"owner = $user", "public = true"}, true},
+		{"没有条件的整个资源授权解除限制", []PermissionRule{whole("shop.*", "owner = $user"), whole("shop.orders", "")}, nil, false},
+		{"没有条件的列级授权不解除限制", []PermissionRule{whole("shop.*", "owner = $user"), column("total", "")}, []string{"owner = $user"}, true},
+		{"列级授权的条件参与合并", []PermissionRule{column("total", "region = 'east'")}, []string{"region = 'east'"}, true},
+		{"列级限制不影响行级条件", []PermissionRule{whole("shop.*", "owner = $user"), {Permission: PermSelect, Resource: Resource{Type: ResColumn, Name: "shop.orders", Sub: "email"}, Deny: true}}, []string{"owner = $user"}, true},
+		{"其他权限的规则不影响", []PermissionRule{whole("shop.*", "owner = $user"), {Permission: PermInsert, Resource: Resource{Type: ResDatabase}}}, []string{"owner = $user"}, true},
+		{"没有匹配的规则", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPermissionManager()
+			for _, rule := range tt.rules {
+				if err := pm.GrantPermission("alice", rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conditions, restricted := pm.RowConditions("alice", PermSelect, db)
+			if restricted != tt.restricted || !reflect.DeepEqual(conditions, tt.conditions) {
+				t.Fatalf("得到 %v, %v，期望 %v, %v", conditions, restricted, tt.conditions, tt.restricted)
+			}
+		})
+	}
+}
+
+func TestRowConditionsFromRole(t *testing.T) {
+	pm := NewPermissionManager()
+	if err := pm.CreateRole(&Role{Name: "sales", Rules: []PermissionRule{
+		{Permission: PermSelect, Resource: Resource{Type: ResDatabase, Name: "shop.*"}, Condition: "owner = $user"},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.AssignRole("alice", "sales"); err != nil {
+		t.Fatal(err)
+	}
+	db := Resource{Type: ResDatabase, Name: "shop.orders"}
+
+	if _, restricted := pm.RowConditions("alice", PermSelect, db); !restricted {
+		t.Fatal("角色中的条件没有生效")
+	}
+
+	// 预定义角色授予整个资源，解除限制
+	if err := pm.AssignRole("alice", "readonly"); err != nil {
+		t.Fatal(err)
+	}
+	if _, restricted := pm.RowConditions("alice", PermSelect, db); restricted {
+		t.Fatal("拥有 readonly 角色后仍受行级限制")
+	}
+}
+
+func TestRowRestrictedInCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		resource   string
+		condition  string
+		collection string
+		restricted bool
+	}{
+		{"数据库上的条件", "shop.orders", "owner = $user", "shop", true},
+		{"通配符上的条件", "sh*.orders", "owner = $user", "shop", true},
+		{"所有数据库上的条件", "", "owner = $user", "shop", true},
+		{"其他集合上的条件", "crm.orders", "owner = $user", "shop", false},
+		{"没有条件", "shop.orders", "", "shop", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPermissionManager()
+			rule := PermissionRule{Permission: PermInsert, Resource: Resource{Type: ResDatabase, Name: tt.resource}, Condition: tt.condition}
+			if err := pm.GrantPermission("alice", rule); err != nil {
+				t.Fatal(err)
+			}
+			if got := pm.RowRestrictedInCollection("alice", PermInsert, tt.collection); got != tt.restricted {
+				t.Fatalf("得到 %v，期望 %v", got, tt.restricted)
+			}
+			if pm.RowRestrictedInCollection("alice", PermSelect, tt.collection) {
+				t.Fatal("其他权限受到限制")
+			}
+		})
+	}
+}
+
+func TestCanGrantConditions(t *testing.T) {
+	db := Resource{Type: ResDatabase, Name: "shop.orders"}
+	rule := func(cond string, grant bool) PermissionRule {
+		return PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResDatabase, Name: "shop.*"}, Condition: cond, Grant: grant}
+	}
+
+	tests := []struct {
+		name       string
+		rules      []PermissionRule
+		conditions []string
+		ok         bool
+	}{
+		{"没有可转授的规则", []PermissionRule{rule("", false)}, nil, false},
+		{"可转授的规则没有条件", []PermissionRule{rule("", true)}, nil, true},
+		{"可转授的规则带条件", []PermissionRule{rule("owner = $user", true)}, []string{"owner = $user"}, true},
+		{"不可转授的规则不解除条件", []PermissionRule{rule("owner = $user", true), {Permission: PermSelect, Resource: db}}, []string{"owner = $user"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewPermissionManager()
+			for _, r := range tt.rules {
+				if err := pm.GrantPermission("alice", r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conditions, ok := pm.CanGrant("alice", PermSelect, db)
+			if ok != tt.ok || !reflect.DeepEqual(conditions, tt.conditions) {
+				t.Fatalf("得到 %v, %v，期望 %v, %v", conditions, ok, tt.conditions, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAddPermissionKeepsExistingRule(t *testing.T) {
+	pm := NewPermissionManager()
+	db := Resource{Type: ResDatabase, Name: "shop.orders"}
+	if err := pm.GrantPermission("bob", PermissionRule{Permission: PermSelect, Resource: db, Condition: "owner = $user"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.AddPermission("bob", PermissionRule{Permission: PermSelect, Resource: db}); err == nil {
+		t.Fatal("替换了已有的规则")
+	}
+	if conditions, restricted := pm.RowConditions("bob", PermSelect, db); !restricted || len(conditions) != 1 {
+		t.Fatalf("已有的规则被修改: %v, %v", conditions, restricted)
+	}
+	if err := pm.AddPermission("bob", PermissionRule{Permission: PermInsert, Resource: db}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+)
+
+// PermissionState 需要持久化的权限数据：自定义角色、用户角色和用户的直接权限。
+// 预定义角色由代码定义，只保存加在它们上面的列级限制
+type PermissionState struct {
+	Roles            map[string]*Role            `json:"roles"`
+	UserRoles        map[string][]string         `json:"user_roles"`
+	UserPermissions  map[string][]PermissionRule `json:"user_permissions"`
+	RoleRestrictions map[string][]PermissionRule `json:"role_restrictions,omitempty"`
+}
+
+// State 导出当前的权限数据
+func (pm *PermissionManager) State() *PermissionState {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	state := &PermissionState{
+		Roles:           make(map[string]*Role),
+		UserRoles:       make(map[string][]string, len(pm.userRoles)),
+		UserPermissions: make(map[string][]PermissionRule, len(pm.userPermissions)),
+	}
+	for name, role := range pm.roles {
+		if !predefinedRoles[name] {
+			state.Roles[name] = role
+			continue
+		}
+		for _, rule := range role.Rules {
+			if rule.ColumnRestriction() {
+				if state.RoleRestrictions == nil {
+					state.RoleRestrictions = make(map[string][]PermissionRule)
+				}
+				state.RoleRestrictions[name] = append(state.RoleRestrictions[name], rule)
+			}
+		}
+	}
+	for username, roles := range pm.userRoles {
+		if len(roles) > 0 {
+			state.UserRoles[username] = append([]string(nil), roles...)
+		}
+	}
+	for username, rules := range pm.userPermissions {
+		if len(rules) > 0 {
+			state.UserPermissions[username] = append([]PermissionRule(nil), rules...)
+		}
+	}
+	return state
+}
+
+// LoadState 用保存的权限数据替换当前的自定义角色、用户角色和直接权限。
+// 引用不存在角色的用户角色会被忽略
+func (pm *PermissionManager) LoadState(state *PermissionState) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	roles := make(map[string]*Role)
+	for name, role := range pm.roles {
+		if predefinedRoles[name] {
+			// 代码定义的规则加上保存的列级限制
+			restored := &Role{Name: role.Name, Description: role.Description}
+			for _, rule := range role.Rules {
+				if !rule.ColumnRestriction() {
+					restored.Rules = append(restored.Rules, rule)
+				}
+			}
+			restored.Rules = append(restored.Rules, state.RoleRestrictions[name]...)
+			roles[name] = restored
+		}
+	}
+	for name, rules := range state.RoleRestrictions {
+		if !predefinedRoles[name] {
+			return fmt.Errorf("列级限制引用的预定义角色不存在: %s", name)
+		}
+		for _, rule := range rules {
+			if !rule.ColumnRestriction() {
+				return fmt.Errorf("预定义角色 %s 只能保存列级限制", name)
+			}
+		}
+	}
+	for name, role := range state.Roles {
+		if predefinedRoles[name] {
+			return fmt.Errorf("自定义角色与预定义角色重名: %s", name)
+		}
+		if role == nil || role.Name != name {
+			return fmt.Errorf("角色数据无效: %s", name)
+		}
+		roles[name] = role
+	}
+
+	userRoles := make(map[string][]string, len(state.UserRoles))
+	for username, names := range state.UserRoles {
+		for _, name := range names {
+			if _, exists := roles[name]; !exists {
+				log.Printf("忽略用户 %s 不存在的角色: %s", username, name)
+				continue
+			}
+			userRoles[username] = append(userRoles[username], name)
+		}
+	}
+
+	userPermissions := make(map[string][]PermissionRule, len(state.UserPermissions))
+	for username, rules := range state.UserPermissions {
+		userPermissions[username] = append([]PermissionRule(nil), rules...)
+	}
+
+	pm.roles = roles
+	pm.userRoles = userRoles
+	pm.userPermissions = userPermissions
+	return nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// reloadState 导出权限数据，经 JSON 序列化后加载到新的权限管理器
+func reloadState(t *testing.T, pm *PermissionManager) *PermissionManager {
+	t.Helper()
+	data, err := json.Marshal(pm.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state PermissionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewPermissionManager()
+	if err := loaded.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestPermissionStateRoundTrip(t *testing.T) {
+	orders := Resource{Type: ResDatabase, Name: "shop.orders"}
+	pm := NewPermissionManager()
+	if err := pm.CreateRole(&Role{Name: "analyst", Description: "分析"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.GrantRolePermission("analyst", PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResDatabase, Name: "shop.*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.GrantRolePermission("readonly", PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResColumn, Name: "shop.orders", Sub: "email"}, Deny: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{"analyst", "readonly"} {
+		if err := pm.AssignRole("bob", role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pm.GrantPermission("bob", PermissionRule{Permission: PermInsert, Resource: orders}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := reloadState(t, pm)
+	roles := loaded.UserRoles("bob")
+	sort.Strings(roles)
+	if !reflect.DeepEqual(roles, []string{"analyst", "readonly"}) {
+		t.Fatalf("用户角色 %v", roles)
+	}
+	if role, ok := loaded.GetRole("analyst"); !ok || role.Description != "分析" || len(role.Rules) != 1 {
+		t.Fatalf("自定义角色 %+v", role)
+	}
+	if !loaded.CheckPermission("bob", PermInsert, orders) || !loaded.CheckPermission("bob", PermSelect, Resource{Type: ResDatabase, Name: "shop.items"}) {
+		t.Fatal("重新加载后缺少权限")
+	}
+	if policy := loaded.ColumnPolicy("bob", PermSelect, orders); policy == nil || len(policy.Exclude) != 1 {
+		t.Fatalf("预定义角色上的列级限制 %+v", policy)
+	}
+
+	// 预定义角色的规则由代码定义，多次加载不会重复
+	if err := loaded.LoadState(pm.State()); err != nil {
+		t.Fatal(err)
+	}
+	if role, _ := loaded.GetRole("readonly"); !reflect.DeepEqual(role.Rules, mustRole(t, pm, "readonly").Rules) {
+		t.Fatalf("重复加载后的预定义角色 %+v", role.Rules)
+	}
+}
+
+func mustRole(t *testing.T, pm *PermissionManager, name string) *Role {
+	t.Helper()
+	role, ok := pm.GetRole(name)
+	if !ok {
+		t.Fatalf("角色 %s 不存在", name)
+	}
+	return role
+}
+
+func TestLoadStateRejectsInvalidRoles(t *testing.T) {
+	deny := PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResColumn, Name: "c.d", Sub: "x"}, Deny: true}
+	grant := PermissionRule{Permission: PermSelect, Resource: Resource{Type: ResDatabase, Name: "c.d"}}
+
+	for name, state := range map[string]*PermissionState{
+		"与预定义角色重名":     {Roles: map[string]*Role{"admin": {Name: "admin"}}},
+		"名称不一致":        {Roles: map[string]*Role{"a": {Name: "b"}}},
+		"空角色":          {Roles: map[string]*Role{"a": nil}},
+		"不存在的预定义角色":    {RoleRestrictions: map[string][]PermissionRule{"analyst": {deny}}},
+		"预定义角色保存了普通授权": {RoleRestrictions: map[string][]PermissionRule{"readonly": {grant}}},
+	} {
+		pm := NewPermissionManager()
+		if err := pm.LoadState(state); err == nil {
+			t.Errorf("%s: 加载成功", name)
+		}
+	}
+}
+
+func TestLoadStateIgnoresUnknownRoles(t *testing.T) {
+	pm := NewPermissionManager()
+	err := pm.LoadState(&PermissionState{
+		UserRoles: map[string][]string{"bob": {"gone", "developer"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := pm.UserRoles("bob"); !reflect.DeepEqual(roles, []string{"developer"}) {
+		t.Fatalf("用户角色 %v", roles)
+	}
+}
+
+func TestDropRole(t *testing.T) {
+	pm := NewPermissionManager()
+	if err := pm.CreateRole(&Role{Name: "analyst"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.CreateRole(&Role{Name: "analyst"}); err == nil {
+		t.Fatal("重复创建角色成功")
+	}
+	for _, user := range []string{"bob", "carol"} {
+		if err := pm.AssignRole(user, "analyst"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pm.AssignRole("bob", "readonly"); err != nil {
+		t.Fatal(err)
+	}
+
+	affected, err := pm.DropRole("analyst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(affected)
+	if !reflect.DeepEqual(affected, []string{"bob", "carol"}) {
+		t.Fatalf("受影响的用户 %v", affected)
+	}
+	if pm.RoleExists("analyst") || !reflect.DeepEqual(pm.UserRoles("bob"), []string{"readonly"}) {
+		t.Fatalf("删除角色后 bob 的角色 %v", pm.UserRoles("bob"))
+	}
+
+	if _, err := pm.DropRole("analyst"); err == nil {
+		t.Fatal("删除不存在的角色成功")
+	}
+	if _, err := pm.DropRole("readonly"); err == nil {
+		t.Fatal("删除预定义角色成功")
+	}
+}
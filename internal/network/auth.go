@@ -0,0 +1,245 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"sudatas/internal/audit"
+	"sudatas/internal/protocol"
+	"sudatas/internal/security"
+)
+
+// 客户端随机数的长度范围
+const (
+	minAuthNonce = 16
+	maxAuthNonce = 64
+)
+
+// authChallenge 已发出的认证挑战，只能应答一次
+type authChallenge struct {
+	username    string
+	authMessage []byte
+	credential  *security.PasswordHash
+	legacy      bool // 凭据由旧版本的明文口令临时生成，登录成功后保存
+	valid       bool // 用户不存在或不能登录时为假挑战，任何应答都会失败
+}
+
+// handleAuth 处理认证请求：第一轮发出挑战，第二轮校验应答
+func (s *Server) handleAuth(client *Client, msg *protocol.Message) (*protocol.Message, error) {
+	if s.requireEncryption && !client.encrypted {
+		return nil, fmt.Errorf("服务器要求加密连接，请使用 TLS 或国密会话模式")
+	}
+
+	var req protocol.AuthRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, fmt.Errorf("无效的认证数据: %w", err)
+	}
+
+	switch {
+	case req.Token != "":
+		return s.verifyToken(client, &req)
+	case len(req.Proof) > 0:
+		return s.verifyAuthProof(client, &req)
+	case len(req.Nonce) > 0:
+		return s.issueAuthChallenge(client, &req)
+	default:
+		return nil, fmt.Errorf("不支持的认证方式，请使用挑战-应答认证的客户端")
+	}
+}
+
+// issueAuthChallenge 为用户生成挑战。不存在或不能登录的用户返回假挑战，避免泄露用户是否存在
+func (s *Server) issueAuthChallenge(client *Client, req *protocol.AuthRequest) (*protocol.Message, error) {
+	if len(req.Nonce) < minAuthNonce || len(req.Nonce) > maxAuthNonce {
+		return nil, fmt.Errorf("无效的客户端随机数")
+	}
+	if err := s.checkLockout(client, req.Username); err != nil {
+		return nil, err
+	}
+
+	credential, legacy, ok := s.userMgr.PasswordCredential(req.Username)
+	if !ok {
+		credential = security.DecoyPasswordHash(req.Username, s.authSecret)
+	}
+
+	serverNonce, err := security.RandomBytes(minAuthNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	client.challenge = &authChallenge{
+		username:    req.Username,
+		authMessage: security.PasswordAuthMessage(req.Username, req.Nonce, serverNonce, credential.Salt, credential.Iterations),
+		credential:  credential,
+		legacy:      legacy,
+		valid:       ok,
+	}
+
+	payload, err := json.Marshal(protocol.AuthChallenge{
+		Nonce:      serverNonce,
+		KDF:        credential.KDF,
+		Salt:       credential.Salt,
+		Iterations: credential.Iterations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化认证挑战失败: %w", err)
+	}
+	return &protocol.Message{
+		Type:    protocol.ChallengeMessage,
+		Payload: payload,
+	}, nil
+}
+
+// verifyAuthProof 校验客户端应答
+func (s *Server) verifyAuthProof(client *Client, req *protocol.AuthRequest) (*protocol.Message, error) {
+	challenge := client.challenge
+	client.challenge = nil
+	if err := s.checkLockout(client, req.Username); err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.username != req.Username {
+		s.authFailed(client, req.Username, "没有待应答的挑战")
+		return nil, fmt.Errorf("认证失败: 没有待应答的挑战")
+	}
+	if !challenge.valid {
+		s.authFailed(client, req.Username, "用户不存在或不能登录")
+		return nil, fmt.Errorf("认证失败")
+	}
+	if !challenge.credential.VerifyProof(challenge.authMessage, req.Proof) {
+		s.authFailed(client, req.Username, "口令错误")
+		return nil, fmt.Errorf("认证失败")
+	}
+	s.lockouts.succeed(req.Username, clientIP(client.conn))
+
+	// 旧版本保存的明文口令在登录成功后替换为口令凭据
+	if challenge.legacy {
+		if err := s.userMgr.UpgradePassword(req.Username, challenge.credential); err != nil {
+			log.Printf("升级用户 %s 的口令凭据失败: %v", req.Username, err)
+		}
+	}
+
+	client.auth = true
+	client.user = req.Username
+	client.token = nil
+	client.passwordExpired = s.userMgr.PasswordExpired(req.Username)
+
+	details, message := "用户登录成功", "认证成功"
+	if client.passwordExpired {
+		details = "用户登录成功，口令已过期，需要修改口令"
+		message = "认证成功，口令已过期，请先修改口令"
+	}
+
+	// 记录审计日志
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.INFO,
+		User:      req.Username,
+		Action:    "AUTH",
+		Object:    "USER",
+		Status:    "SUCCESS",
+		Details:   details,
+		IP:        client.conn.RemoteAddr().String(),
+	})
+
+	return &protocol.Message{
+		Type:    protocol.ResultMessage,
+		Payload: []byte(message),
+	}, nil
+}
+
+// verifyToken 用访问令牌登录。令牌必须属于请求中的用户，登录后的会话受令牌权限范围限制
+func (s *Server) verifyToken(client *Client, req *protocol.AuthRequest) (*protocol.Message, error) {
+	client.challenge = nil
+	if req.Username == "" {
+		return nil, fmt.Errorf("认证失败: 使用令牌登录时需要提供用户名")
+	}
+	if err := s.checkLockout(client, req.Username); err != nil {
+		return nil, err
+	}
+
+	token, err := s.userMgr.ValidateToken(req.Token)
+	if err != nil {
+		s.authFailed(client, req.Username, err.Error())
+		return nil, fmt.Errorf("认证失败")
+	}
+	if token.User != req.Username {
+		s.authFailed(client, req.Username, "令牌不属于该用户")
+		return nil, fmt.Errorf("认证失败")
+	}
+	s.lockouts.succeed(req.Username, clientIP(client.conn))
+
+	// 令牌不能修改口令，口令过期不影响令牌登录
+	client.auth = true
+	client.user = req.Username
+	client.token = token
+	client.passwordExpired = false
+
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.INFO,
+		User:      req.Username,
+		Action:    "AUTH",
+		Object:    fmt.Sprintf("TOKEN:%s", token.Name),
+		Status:    "SUCCESS",
+		Details:   fmt.Sprintf("令牌登录成功: %s", token.Name),
+		IP:        client.conn.RemoteAddr().String(),
+	})
+
+	return &protocol.Message{
+		Type:    protocol.ResultMessage,
+		Payload: []byte("认证成功"),
+	}, nil
+}
+
+// checkLockout 用户或来源 IP 处于锁定中时拒绝登录，并写入审计日志
+func (s *Server) checkLockout(client *Client, username string) error {
+	kind, remaining := s.lockouts.locked(username, clientIP(client.conn))
+	if kind == "" {
+		return nil
+	}
+
+	target := "用户"
+	if kind == LockoutIP {
+		target = "来源地址"
+	}
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.WARN,
+		User:      username,
+		Action:    "AUTH",
+		Object:    "USER",
+		Status:    "DENIED",
+		Details:   fmt.Sprintf("%s因登录失败次数过多被锁定，剩余 %s", target, remaining.Round(time.Second)),
+		IP:        client.conn.RemoteAddr().String(),
+	})
+	return fmt.Errorf("认证失败: 登录失败次数过多，请在 %s 后重试", remaining.Round(time.Second))
+}
+
+// authFailed 记录一次登录失败：每次失败都写入审计日志，达到阈值时锁定用户或来源 IP
+func (s *Server) authFailed(client *Client, username, reason string) {
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.WARN,
+		User:      username,
+		Action:    "AUTH",
+		Object:    "USER",
+		Status:    "FAILED",
+		Details:   fmt.Sprintf("登录失败: %s", reason),
+		IP:        client.conn.RemoteAddr().String(),
+	})
+
+	for _, info := range s.lockouts.fail(username, clientIP(client.conn)) {
+		log.Printf("登录失败次数过多，锁定 %s %s 至 %s", info.Kind, info.Name, info.LockedUntil.Format("2006-01-02 15:04:05"))
+		s.auditLog.Log(&audit.LogEntry{
+			Timestamp: time.Now(),
+			Level:     audit.WARN,
+			User:      username,
+			Action:    "LOCKOUT",
+			Object:    fmt.Sprintf("%s:%s", info.Kind, info.Name),
+			Status:    "LOCKED",
+			Details:   fmt.Sprintf("连续登录失败，第 %d 次锁定，至 %s", info.Lockouts, info.LockedUntil.Format("2006-01-02 15:04:05")),
+			IP:        client.conn.RemoteAddr().String(),
+		})
+	}
+}
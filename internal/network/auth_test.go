@@ -0,0 +1,153 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"sudatas/client"
+	"sudatas/dbclient"
+	"sudatas/internal/protocol"
+	"sudatas/internal/security"
+)
+
+// authConn 直接读写认证消息的连接
+type authConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialAuth(t *testing.T, addr string) *authConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &authConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send 发送一轮认证消息并返回响应
+func (c *authConn) send(t *testing.T, payload interface{}) *protocol.Message {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.WriteMessage(c.conn, &protocol.Message{Type: protocol.AuthMessage, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := protocol.ReadMessage(c.reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// challenge 发送第一轮请求并解析挑战
+func (c *authConn) challenge(t *testing.T, username string, nonce []byte) *protocol.AuthChallenge {
+	t.Helper()
+	msg := c.send(t, protocol.AuthRequest{Username: username, Nonce: nonce})
+	if msg.Type != protocol.ChallengeMessage {
+		t.Fatalf("响应类型 %d: %s", msg.Type, msg.Payload)
+	}
+	var challenge protocol.AuthChallenge
+	if err := json.Unmarshal(msg.Payload, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	return &challenge
+}
+
+// proof 用口令计算对挑战的应答
+func proof(t *testing.T, username, password string, nonce []byte, challenge *protocol.AuthChallenge) []byte {
+	t.Helper()
+	authMessage := security.PasswordAuthMessage(username, nonce, challenge.Nonce, challenge.Salt, challenge.Iterations)
+	p, err := security.PasswordProof(password, challenge.Salt, challenge.Iterations, authMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestChallengeResponseAuth(t *testing.T) {
+	ts := startTestServer(t)
+	nonce := bytes.Repeat([]byte{1}, minAuthNonce)
+
+	c := dialAuth(t, ts.addr)
+	challenge := c.challenge(t, "root", nonce)
+	if challenge.KDF != security.KDFPBKDF2SM3 || challenge.Iterations < security.MinPasswordIterations {
+		t.Fatalf("挑战 %+v", challenge)
+	}
+	p := proof(t, "root", testRootPassword, nonce, challenge)
+	if msg := c.send(t, protocol.AuthRequest{Username: "root", Proof: p}); msg.Type != protocol.ResultMessage {
+		t.Fatalf("登录失败: %s", msg.Payload)
+	}
+
+	// 挑战只能应答一次，截获的应答不能重放到新的连接
+	replay := dialAuth(t, ts.addr)
+	if msg := replay.send(t, protocol.AuthRequest{Username: "root", Proof: p}); msg.Type != protocol.ErrorMessage {
+		t.Fatal("没有挑战的应答登录成功")
+	}
+	replay.challenge(t, "root", nonce)
+	if msg := replay.send(t, protocol.AuthRequest{Username: "root", Proof: p}); msg.Type != protocol.ErrorMessage {
+		t.Fatal("重放的应答登录成功")
+	}
+
+	wrong := dialAuth(t, ts.addr)
+	challenge = wrong.challenge(t, "root", nonce)
+	if msg := wrong.send(t, protocol.AuthRequest{Username: "root", Proof: proof(t, "root", "wrong", nonce, challenge)}); msg.Type != protocol.ErrorMessage {
+		t.Fatal("错误的口令登录成功")
+	}
+}
+
+func TestAuthRejectsPlaintextPassword(t *testing.T) {
+	ts := startTestServer(t)
+	c := dialAuth(t, ts.addr)
+
+	// 旧版本客户端直接发送口令
+	msg := c.send(t, map[string]string{"username": "root", "password": testRootPassword})
+	if msg.Type != protocol.ErrorMessage {
+		t.Fatalf("明文口令登录的响应类型 %d: %s", msg.Type, msg.Payload)
+	}
+
+	msg = c.send(t, protocol.AuthRequest{Username: "root", Nonce: []byte("short")})
+	if msg.Type != protocol.ErrorMessage {
+		t.Fatal("接受了过短的客户端随机数")
+	}
+}
+
+func TestAuthChallengeForUnknownUser(t *testing.T) {
+	ts := startTestServer(t)
+	nonce := bytes.Repeat([]byte{2}, minAuthNonce)
+
+	// 不存在的用户也返回挑战，且同一用户名的挑战参数不变
+	c := dialAuth(t, ts.addr)
+	first := c.challenge(t, "ghost", nonce)
+	second := dialAuth(t, ts.addr).challenge(t, "ghost", nonce)
+	if !bytes.Equal(first.Salt, second.Salt) || first.Iterations != second.Iterations || first.KDF != security.KDFPBKDF2SM3 {
+		t.Fatalf("假挑战 %+v / %+v", first, second)
+	}
+	if msg := c.send(t, protocol.AuthRequest{Username: "ghost", Proof: proof(t, "ghost", "x", nonce, first)}); msg.Type != protocol.ErrorMessage {
+		t.Fatal("不存在的用户登录成功")
+	}
+}
+
+func TestClientsChallengeLogin(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE USER alice PASSWORD 'pass-ecila'")
+
+	if err := client.NewClient(ts.addr, "alice", "wrong").Connect(); err == nil {
+		t.Fatal("client 用错误的口令登录成功")
+	}
+	ts.connect(t, "alice", "pass-ecila")
+
+	if _, err := dbclient.NewClient(ts.addr, "alice", "wrong").Query("SHOW COLLECTIONS"); err == nil {
+		t.Fatal("dbclient 用错误的口令登录成功")
+	}
+	if _, err := dbclient.NewClient(ts.addr, "alice", "pass-ecila").Query("SHOW COLLECTIONS"); err != nil {
+		t.Fatal(err)
+	}
+}
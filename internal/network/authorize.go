@@ -0,0 +1,156 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"sudatas/internal/audit"
+	"sudatas/internal/auth"
+	"sudatas/internal/parser"
+	"sudatas/internal/storage"
+)
+
+// permAuthenticated 表示语句不需要额外权限，所有已认证用户都可以执行
+const permAuthenticated auth.Permission = ""
+
+// databaseResource collection.database 对应的资源
+func databaseResource(collection, database string) auth.Resource {
+	return auth.Resource{
+		Type: auth.ResDatabase,
+		Name: fmt.Sprintf("%s.%s", collection, database),
+	}
+}
+
+// statementAuthorization 将语句映射为执行前需要检查的权限和资源。
+// 每种语句类型都必须在这里登记，未登记的类型一律拒绝
+func statementAuthorization(stmt *parser.Statement) (auth.Permission, auth.Resource, error) {
+	switch stmt.Type {
+	case "INSERT":
+		return auth.PermInsert, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "SELECT":
+		return auth.PermSelect, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "UPDATE":
+		return auth.PermUpdate, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "DELETE":
+		return auth.PermDelete, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "EXPORT":
+		// 导出需要读取权限
+		return auth.PermSelect, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "IMPORT":
+		// 导入会读取服务器上的文件并在目标集合中创建数据库，按恢复数据处理
+		return auth.PermRestore, databaseResource(stmt.Collection, "*"), nil
+
+	case "SHOW_COLLECTIONS", "SHOW_DATABASES":
+		// 允许所有已认证用户查看集合和数据库列表
+		return permAuthenticated, auth.Resource{Type: auth.ResDatabase, Name: stmt.Collection}, nil
+
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		// 事务本身不需要权限，事务中的每条语句单独检查
+		return permAuthenticated, auth.Resource{Type: auth.ResDatabase}, nil
+
+	case "CREATE_COLLECTION":
+		return auth.PermCreateDB, auth.Resource{Type: auth.ResDatabase, Name: stmt.Collection}, nil
+
+	case "CREATE_DATABASE":
+		return auth.PermCreateTable, databaseResource(stmt.Collection, stmt.Database), nil
+
+	case "SHOW_KEYS", "ROTATE_KEY":
+		return auth.PermManageKeys, auth.Resource{Type: auth.ResDatabase}, nil
+
+	case "SHOW_LOCKOUTS", "CLEAR_LOCKOUT":
+		// 查看和解除登录锁定属于用户管理
+		return auth.PermAlterUser, auth.Resource{Type: auth.ResUser, Name: stmt.User}, nil
+
+	case "CREATE_ROLE":
+		return auth.PermCreateRole, auth.Resource{Type: auth.ResRole, Name: stmt.Role}, nil
+
+	case "DROP_ROLE":
+		return auth.PermDropRole, auth.Resource{Type: auth.ResRole, Name: stmt.Role}, nil
+
+	case "CREATE_USER":
+		return auth.PermCreateUser, auth.Resource{Type: auth.ResUser, Name: stmt.User}, nil
+
+	case "ALTER_USER":
+		return auth.PermAlterUser, auth.Resource{Type: auth.ResUser, Name: stmt.User}, nil
+
+	case "DROP_USER":
+		return auth.PermDropUser, auth.Resource{Type: auth.ResUser, Name: stmt.User}, nil
+
+	case "CREATE_TOKEN", "DROP_TOKEN", "SHOW_TOKENS":
+		// 管理其他用户的令牌属于用户管理，管理自己的令牌见 allowedWithoutPermission
+		return auth.PermAlterUser, auth.Resource{Type: auth.ResUser, Name: stmt.User}, nil
+
+	case "GRANT":
+		return auth.PermGrant, grantResource(stmt), nil
+
+	case "REVOKE":
+		return auth.PermRevoke, grantResource(stmt), nil
+	}
+	return "", auth.Resource{}, fmt.Errorf("不支持的操作类型: %s", stmt.Type)
+}
+
+// authorize 检查客户端能否执行语句，返回语句对应的权限和资源。拒绝时写入审计日志
+func (s *Server) authorize(client *Client, stmt *parser.Statement, sql string) (auth.Permission, auth.Resource, error) {
+	perm, res, err := statementAuthorization(stmt)
+	if err != nil {
+		return "", auth.Resource{}, err
+	}
+
+	// 令牌登录的会话先受令牌权限范围限制，root 用户的令牌也不例外
+	if client.token != nil {
+		if reason := tokenDenied(client.token, stmt, perm, res); reason != "" {
+			s.auditDenied(client, stmt, perm, res, fmt.Sprintf("%s: %s", reason, parser.RedactSecrets(sql)))
+			return "", auth.Resource{}, fmt.Errorf("权限不足: %s", reason)
+		}
+	}
+
+	// root 用户跳过权限检查
+	if perm == permAuthenticated || client.user == "root" {
+		return perm, res, nil
+	}
+	if s.userMgr.CheckPermission(client.user, perm, res) || s.allowedWithoutPermission(client, stmt) {
+		return perm, res, nil
+	}
+
+	s.auditDenied(client, stmt, perm, res, fmt.Sprintf("权限不足: %s", parser.RedactSecrets(sql)))
+	return "", auth.Resource{}, fmt.Errorf("权限不足")
+}
+
+// tokenDenied 令牌会话不能执行语句时返回原因。令牌不能签发或吊销令牌，
+// 其他需要权限的语句必须在令牌的权限范围之内
+func tokenDenied(token *storage.APIToken, stmt *parser.Statement, perm auth.Permission, res auth.Resource) string {
+	switch {
+	case stmt.Type == "CREATE_TOKEN" || stmt.Type == "DROP_TOKEN":
+		return "令牌登录的会话不能管理令牌"
+	case perm != permAuthenticated && !token.Allows(perm, res):
+		return fmt.Sprintf("超出令牌 %s 的权限范围", token.Name)
+	}
+	return ""
+}
+
+// auditDenied 记录被拒绝的操作
+func (s *Server) auditDenied(client *Client, stmt *parser.Statement, perm auth.Permission, res auth.Resource, details string) {
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.WARN,
+		User:      client.user,
+		Action:    auditAction(stmt, perm),
+		Object:    fmt.Sprintf("%s:%s", res.Type, res.Name),
+		Status:    "DENIED",
+		Details:   details,
+		IP:        client.conn.RemoteAddr().String(),
+	})
+}
+
+// auditAction 审计日志中的操作名称：需要权限的语句记录权限，其余记录语句类型
+func auditAction(stmt *parser.Statement, perm auth.Permission) string {
+	if perm == permAuthenticated {
+		return stmt.Type
+	}
+	return string(perm)
+}
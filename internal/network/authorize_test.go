@@ -0,0 +1,154 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/parser"
+)
+
+func TestStatementAuthorization(t *testing.T) {
+	ts := startTestServer(t)
+	for _, user := range []string{"admin", "readonly", "developer"} {
+		if err := ts.srv.userMgr.CreateUser("u_"+user, "pass-1", []string{user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 每种语句类型在三个预定义角色下是否允许，以及拒绝时审计日志中记录的操作和对象
+	tests := []struct {
+		sql       string
+		admin     bool
+		readonly  bool
+		developer bool
+		action    string
+		object    string
+	}{
+		{`INSERT INTO c.d VALUES {"a":1}`, true, false, true, "INSERT", "DATABASE:c.d"},
+		{"SELECT * FROM c.d", true, true, true, "SELECT", "DATABASE:c.d"},
+		{"UPDATE c.d SET a = 2", true, false, true, "UPDATE", "DATABASE:c.d"},
+		{"DELETE FROM c.d", true, false, true, "DELETE", "DATABASE:c.d"},
+		{"EXPORT c.d TO /tmp/d.sql", true, true, true, "SELECT", "DATABASE:c.d"},
+		{"IMPORT FROM /tmp/d.sql TO c", true, false, false, "RESTORE", "DATABASE:c.*"},
+		{"SHOW COLLECTIONS", true, true, true, "", ""},
+		{"SHOW DATABASES FROM c", true, true, true, "", ""},
+		{"BEGIN", true, true, true, "", ""},
+		{"COMMIT", true, true, true, "", ""},
+		{"ROLLBACK", true, true, true, "", ""},
+		{"CREATE COLLECTION c2", true, false, false, "CREATE_DATABASE", "DATABASE:c2"},
+		{"CREATE DATABASE c.d2 TYPE json", true, false, true, "CREATE_TABLE", "DATABASE:c.d2"},
+		{"SHOW KEYS", true, false, false, "MANAGE_KEYS", "DATABASE:"},
+		{"ROTATE KEY", true, false, false, "MANAGE_KEYS", "DATABASE:"},
+		{"SHOW LOCKOUTS", true, false, false, "ALTER_USER", "USER:"},
+		{"CLEAR LOCKOUT USER bob", true, false, false, "ALTER_USER", "USER:bob"},
+		{"CREATE ROLE r", true, false, false, "CREATE_ROLE", "ROLE:r"},
+		{"DROP ROLE r", true, false, false, "DROP_ROLE", "ROLE:r"},
+		{"CREATE USER bob PASSWORD 'pass-2'", true, false, false, "CREATE_USER", "USER:bob"},
+		{"ALTER USER bob LOCK", true, false, false, "ALTER_USER", "USER:bob"},
+		{"DROP USER bob", true, false, false, "DROP_USER", "USER:bob"},
+		{"CREATE TOKEN t FOR bob", true, false, false, "ALTER_USER", "USER:bob"},
+		{"SHOW TOKENS FOR bob", true, false, false, "ALTER_USER", "USER:bob"},
+		{"DROP TOKEN t FOR bob", true, false, false, "ALTER_USER", "USER:bob"},
+		{"GRANT SELECT ON c.d TO bob", true, false, false, "GRANT", "DATABASE:c.d"},
+		{"REVOKE SELECT ON c.d FROM bob", true, false, false, "REVOKE", "DATABASE:c.d"},
+		{"GRANT ROLE developer TO bob", true, false, false, "GRANT", "ROLE:developer"},
+	}
+
+	sqlParser := parser.NewSQLParser()
+	for _, tt := range tests {
+		stmt, err := sqlParser.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		for _, role := range []struct {
+			name    string
+			allowed bool
+		}{{"admin", tt.admin}, {"readonly", tt.readonly}, {"developer", tt.developer}} {
+			t.Run(fmt.Sprintf("%s/%s", role.name, tt.sql), func(t *testing.T) {
+				username := "u_" + role.name
+				conn, peer := net.Pipe()
+				defer conn.Close()
+				defer peer.Close()
+				client := &Client{conn: conn, auth: true, user: username}
+
+				before := len(ts.deniedAudits(t, username))
+				_, _, err := ts.srv.authorize(client, stmt, tt.sql)
+				denied := ts.deniedAudits(t, username)
+				if role.allowed {
+					if err != nil {
+						t.Fatalf("期望允许，实际: %v", err)
+					}
+					if len(denied) != before {
+						t.Fatal("允许的语句写入了拒绝的审计记录")
+					}
+					return
+				}
+
+				if err == nil {
+					t.Fatal("期望拒绝，实际允许")
+				}
+				if len(denied) != before+1 {
+					t.Fatalf("拒绝后有 %d 条审计记录，期望 %d 条", len(denied), before+1)
+				}
+				entry := denied[len(denied)-1]
+				if entry.Action != tt.action || entry.Object != tt.object {
+					t.Fatalf("审计记录的操作和对象为 %s %s，期望 %s %s", entry.Action, entry.Object, tt.action, tt.object)
+				}
+			})
+		}
+	}
+}
+
+func TestUnregisteredStatementDenied(t *testing.T) {
+	if _, _, err := statementAuthorization(&parser.Statement{Type: "VACUUM"}); err == nil {
+		t.Fatal("未登记的语句类型没有被拒绝")
+	}
+}
+
+func TestAllowedWithoutPermission(t *testing.T) {
+	ts := startTestServer(t)
+	if err := ts.srv.userMgr.CreateUser("alice", "pass-1", []string{"readonly"}); err != nil {
+		t.Fatal(err)
+	}
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	client := &Client{conn: conn, auth: true, user: "alice"}
+
+	// 修改自己的口令和管理自己的令牌不需要用户管理权限
+	for _, sql := range []string{
+		"ALTER USER alice PASSWORD 'pass-2'",
+		"CREATE TOKEN t",
+		"SHOW TOKENS",
+		"DROP TOKEN t",
+	} {
+		stmt, err := parser.NewSQLParser().Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ts.srv.authorize(client, stmt, sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	// 没有 WITH GRANT OPTION 的权限不能转授
+	stmt, err := parser.NewSQLParser().Parse("GRANT SELECT ON c.d TO bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ts.srv.authorize(client, stmt, ""); err == nil {
+		t.Fatal("没有转授权限的用户可以授权")
+	}
+	if err := ts.srv.userMgr.GrantPermission("alice", auth.PermissionRule{
+		Permission: auth.PermSelect,
+		Resource:   auth.Resource{Type: auth.ResDatabase, Name: "c.*"},
+		Grant:      true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ts.srv.authorize(client, stmt, ""); err != nil {
+		t.Fatalf("有转授权限的用户不能授权: %v", err)
+	}
+}
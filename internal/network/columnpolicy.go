@@ -0,0 +1,126 @@
+package network
+
+import (
+	"fmt"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/parser"
+	"sudatas/internal/security"
+	"sudatas/internal/storage"
+)
+
+// columnHidden 字段是否对用户隐藏：与排除的字段重叠，或不在只能访问的字段之内
+func columnHidden(policy *auth.ColumnPolicy, column string) bool {
+	for _, excluded := range policy.Exclude {
+		if storage.PathsOverlap(column, excluded) {
+			return true
+		}
+	}
+	if len(policy.Include) == 0 {
+		return false
+	}
+	for _, included := range policy.Include {
+		if storage.PathWithin(column, included) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnProtected 字段是否与隐藏或脱敏的字段重叠
+func columnProtected(policy *auth.ColumnPolicy, column string) bool {
+	for masked := range policy.Masks {
+		if storage.PathsOverlap(column, masked) {
+			return true
+		}
+	}
+	for _, excluded := range policy.Exclude {
+		if storage.PathsOverlap(column, excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkColumnAccess 在执行前检查语句引用的字段：
+// 查询不能选择隐藏的字段，条件、分组、排序和聚合不能引用隐藏或脱敏的字段，
+// 更新不能修改受保护的字段。需要在合并行级安全条件之前调用
+func (s *Server) checkColumnAccess(client *Client, stmt *parser.Statement, perm auth.Permission, res auth.Resource, sql string) error {
+	switch stmt.Type {
+	case "SELECT", "UPDATE", "DELETE":
+	default:
+		return nil
+	}
+
+	deny := func(format string, args ...interface{}) error {
+		reason := fmt.Sprintf(format, args...)
+		s.auditDenied(client, stmt, perm, res, fmt.Sprintf("%s: %s", reason, parser.RedactSecrets(sql)))
+		return fmt.Errorf("%s", reason)
+	}
+
+	readPolicy := s.userMgr.ColumnPolicy(client.user, auth.PermSelect, res)
+	if readPolicy != nil {
+		for _, column := range stmt.Columns {
+			if columnHidden(readPolicy, column) {
+				return deny("无权访问字段: %s", column)
+			}
+		}
+
+		aggregates := make(map[string]bool)
+		referenced := stmt.Where.Columns()
+		referenced = append(referenced, stmt.GroupBy...)
+		for _, agg := range stmt.Aggregates {
+			aggregates[agg.Name()] = true
+			if agg.Field != "*" {
+				referenced = append(referenced, agg.Field)
+			}
+		}
+		for _, key := range stmt.OrderBy {
+			if !aggregates[key.Field] {
+				referenced = append(referenced, key.Field)
+			}
+		}
+		for _, column := range referenced {
+			if columnHidden(readPolicy, column) || columnProtected(readPolicy, column) {
+				return deny("不能在条件、分组、排序或聚合中使用受保护的字段: %s", column)
+			}
+		}
+	}
+
+	if stmt.Type != "UPDATE" {
+		return nil
+	}
+	writePolicy := s.userMgr.ColumnPolicy(client.user, auth.PermUpdate, res)
+	if readPolicy == nil && writePolicy == nil {
+		return nil
+	}
+	update, err := storage.ParseUpdate(stmt.Data)
+	if err != nil {
+		return err
+	}
+	for _, op := range update.Ops {
+		// 看不到真实值的字段也不能修改
+		if (readPolicy != nil && columnProtected(readPolicy, op.Field)) ||
+			(writePolicy != nil && (columnHidden(writePolicy, op.Field) || columnProtected(writePolicy, op.Field))) {
+			return deny("不能修改受保护的字段: %s", op.Field)
+		}
+	}
+	return nil
+}
+
+// applyColumnPolicy 返回按列级访问控制处理后的记录副本：只保留可以访问的字段，删除隐藏的字段，脱敏其余受保护的字段
+func applyColumnPolicy(policy *auth.ColumnPolicy, record storage.Row) storage.Row {
+	row := storage.CloneRow(record)
+	if len(policy.Include) > 0 {
+		row = storage.ProjectRow(row, policy.Include)
+	}
+	for _, excluded := range policy.Exclude {
+		storage.DeletePath(row, excluded)
+	}
+	for column, method := range policy.Masks {
+		if value, ok := storage.GetPath(row, column); ok {
+			storage.SetPath(row, column, security.MaskValue(method, value))
+		}
+	}
+	return row
+}
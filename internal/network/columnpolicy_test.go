@@ -0,0 +1,99 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sudatas/client"
+	"sudatas/internal/security"
+)
+
+// queryRow 执行查询并返回唯一的一条记录
+func queryRow(t *testing.T, c *client.Client, sql string) map[string]interface{} {
+	t.Helper()
+	rows, err := c.Query(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("%s: 返回 %d 条记录", sql, len(rows))
+	}
+	return rows[0]
+}
+
+func TestColumnPolicy(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.d TYPE json")
+	mustExec(t, root, `INSERT INTO c.d VALUES {"name":"alice","email":"alice@example.com","ssn":"123456789","age":30,"phone":"13800001111"}`)
+	mustExec(t, root, "DENY SELECT (email) ON c.d TO ROLE readonly")
+	mustExec(t, root, "DENY SELECT (ssn) ON c.d TO ROLE readonly WITH MASK HASH")
+	mustExec(t, root, "DENY SELECT (phone) ON c.d TO ROLE readonly WITH MASK PARTIAL")
+	mustFail(t, root, "DENY SELECT ON c.d TO ROLE readonly")
+	mustExec(t, root, "CREATE USER ro PASSWORD 'pass-or' ROLE readonly")
+	mustExec(t, root, "CREATE USER lim PASSWORD 'pass-mil'")
+	mustExec(t, root, "GRANT SELECT (name, age), UPDATE (age) ON c.d TO lim")
+	ro := ts.connect(t, "ro", "pass-or")
+	lim := ts.connect(t, "lim", "pass-mil")
+
+	// 被拒绝的字段不输出，脱敏的字段输出处理后的值
+	row := queryRow(t, ro, "SELECT * FROM c.d")
+	if _, ok := row["email"]; ok {
+		t.Fatalf("输出了被拒绝的字段: %v", row)
+	}
+	if row["phone"] != "1*********1" || row["ssn"] != security.MaskValue(security.MaskHash, "123456789") {
+		t.Fatalf("脱敏结果 %v", row)
+	}
+	mustFail(t, ro, "SELECT email FROM c.d")
+	// 不能用脱敏字段的原值做条件，否则可以逐个猜测
+	mustFail(t, ro, "SELECT * FROM c.d WHERE ssn = '123456789'")
+	mustExec(t, ro, "SELECT ssn FROM c.d")
+
+	// 只授予部分字段时，其余字段不可见也不可修改
+	row = queryRow(t, lim, "SELECT * FROM c.d")
+	if len(row) != 2 || row["name"] != "alice" {
+		t.Fatalf("部分字段授权的查询结果 %v", row)
+	}
+	mustFail(t, lim, "SELECT email FROM c.d")
+	mustExec(t, lim, "UPDATE c.d SET age = 31")
+	mustFail(t, lim, "UPDATE c.d SET name = 'x'")
+	mustFail(t, lim, "DELETE FROM c.d")
+
+	// 撤销限制后恢复原值
+	mustExec(t, root, "REVOKE SELECT (email) ON c.d FROM ROLE readonly")
+	if row := queryRow(t, ro, "SELECT * FROM c.d"); row["email"] != "alice@example.com" {
+		t.Fatalf("撤销限制后的查询结果 %v", row)
+	}
+}
+
+func TestColumnPolicyAppliesToExportAndGrouping(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.d TYPE json")
+	mustExec(t, root, `INSERT INTO c.d VALUES {"name":"alice","email":"alice@example.com","age":30}`)
+	mustExec(t, root, "CREATE USER dev PASSWORD 'pass-ved' ROLE developer")
+	mustExec(t, root, "DENY UPDATE (name) ON c.d TO dev")
+	mustExec(t, root, "DENY SELECT (email) ON c.d TO dev WITH MASK PARTIAL")
+	dev := ts.connect(t, "dev", "pass-ved")
+
+	mustFail(t, dev, "UPDATE c.d SET name = 'x'")
+	// 脱敏的字段同样不能修改
+	mustFail(t, dev, "UPDATE c.d SET email = 'x'")
+	mustExec(t, dev, "UPDATE c.d SET age = 40")
+	mustExec(t, dev, "SELECT COUNT(*) AS n FROM c.d GROUP BY age ORDER BY n")
+	mustFail(t, dev, "SELECT COUNT(*) AS n FROM c.d GROUP BY email")
+
+	out := filepath.Join(t.TempDir(), "d.sql")
+	mustExec(t, dev, "EXPORT c.d TO "+out)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "alice@example.com") || !strings.Contains(string(data), "a***@example.com") {
+		t.Fatalf("导出文件没有脱敏: %s", data)
+	}
+}
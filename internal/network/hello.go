@@ -0,0 +1,58 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"sudatas/internal/protocol"
+)
+
+// serverName 握手响应中的服务端名称
+const serverName = "sudatas"
+
+// handleHello 处理客户端握手：协商协议版本和功能。版本不兼容时返回 IncompatibleMessage，之后连接会被关闭
+func (s *Server) handleHello(client *Client, msg *protocol.Message) (*protocol.Message, error) {
+	if client.started {
+		return nil, fmt.Errorf("握手必须是连接上的第一条消息")
+	}
+
+	var hello protocol.Hello
+	if err := json.Unmarshal(msg.Payload, &hello); err != nil {
+		return nil, fmt.Errorf("无效的握手数据: %w", err)
+	}
+	version, err := protocol.Negotiate(&hello)
+	if err != nil {
+		log.Printf("拒绝客户端 %s [%s]: %v", hello.ClientName, client.conn.RemoteAddr(), err)
+		payload, merr := json.Marshal(protocol.Incompatible{
+			Message:    err.Error(),
+			MinVersion: protocol.MinProtocolVersion,
+			MaxVersion: protocol.ProtocolVersion,
+		})
+		if merr != nil {
+			return nil, fmt.Errorf("序列化握手响应失败: %w", merr)
+		}
+		return &protocol.Message{
+			Type:    protocol.IncompatibleMessage,
+			Payload: payload,
+		}, nil
+	}
+
+	client.version = version
+	client.clientName = hello.ClientName
+	client.capabilities = hello.Capabilities & protocol.ServerCapabilities
+	log.Printf("客户端握手 [%s]: %s，协议版本 %d", client.conn.RemoteAddr(), hello.ClientName, version)
+
+	payload, err := json.Marshal(protocol.HelloResponse{
+		Version:      version,
+		ServerName:   serverName,
+		Capabilities: client.capabilities,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化握手响应失败: %w", err)
+	}
+	return &protocol.Message{
+		Type:    protocol.HelloMessage,
+		Payload: payload,
+	}, nil
+}
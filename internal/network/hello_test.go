@@ -0,0 +1,94 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"sudatas/client"
+	"sudatas/dbclient"
+	"sudatas/internal/protocol"
+)
+
+// sendHello 建立连接并发送握手，返回服务端的第一条响应
+func sendHello(t *testing.T, addr string, hello protocol.Hello) (*protocol.Message, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	data, err := json.Marshal(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.WriteMessage(conn, &protocol.Message{Type: protocol.HelloMessage, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	msg, err := protocol.ReadMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, reader
+}
+
+func TestHelloNegotiation(t *testing.T) {
+	ts := startTestServer(t)
+
+	msg, _ := sendHello(t, ts.addr, protocol.Hello{
+		Magic:        protocol.HelloMagic,
+		Version:      9,
+		MinVersion:   1,
+		ClientName:   "future-client",
+		Capabilities: protocol.CapEncryption | 1<<7,
+	})
+	if msg.Type != protocol.HelloMessage {
+		t.Fatalf("响应类型 %d: %s", msg.Type, msg.Payload)
+	}
+	var resp protocol.HelloResponse
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 服务端不认识的功能位不会出现在协商结果中
+	if resp.Version != protocol.ProtocolVersion || resp.Capabilities != protocol.CapEncryption {
+		t.Fatalf("协商结果 %+v", resp)
+	}
+}
+
+func TestHelloIncompatible(t *testing.T) {
+	ts := startTestServer(t)
+
+	for _, hello := range []protocol.Hello{
+		{Magic: protocol.HelloMagic, Version: 9, MinVersion: 5},
+		{Magic: "HTTP", Version: 1},
+	} {
+		msg, reader := sendHello(t, ts.addr, hello)
+		if msg.Type != protocol.IncompatibleMessage {
+			t.Fatalf("响应类型 %d: %s", msg.Type, msg.Payload)
+		}
+		// 不兼容时服务端关闭连接
+		if _, err := protocol.ReadMessage(reader); err == nil {
+			t.Fatal("不兼容的连接没有被关闭")
+		}
+	}
+}
+
+func TestClientsHandshake(t *testing.T) {
+	ts := startTestServer(t)
+	serverKey := ts.srv.crypto.SessionPublicKey()
+
+	c := client.NewClient(ts.addr, "root", testRootPassword, client.WithClientName("app"), client.WithSM2Session(serverKey))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	mustExec(t, c, "SHOW COLLECTIONS")
+
+	d := dbclient.NewClient(ts.addr, "root", testRootPassword, dbclient.WithSM2Session(serverKey))
+	if _, err := d.Query("SHOW COLLECTIONS"); err != nil {
+		t.Fatal(err)
+	}
+}
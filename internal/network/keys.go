@@ -0,0 +1,83 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"sudatas/internal/audit"
+)
+
+// startKeyRotation 生成新的数据密钥并在后台重新加密所有数据，返回新密钥的版本
+func (s *Server) startKeyRotation(client *Client) (uint32, error) {
+	s.mu.Lock()
+	if s.rotating {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("密钥轮换正在进行中")
+	}
+	s.rotating = true
+	s.mu.Unlock()
+
+	version, err := s.crypto.RotateKey()
+	if err != nil {
+		s.mu.Lock()
+		s.rotating = false
+		s.mu.Unlock()
+		return 0, fmt.Errorf("生成新密钥失败: %w", err)
+	}
+
+	go s.reencryptAll(client.user, version)
+	return version, nil
+}
+
+// reencryptAll 用新密钥重写集合元数据、记录文件、用户数据和审计日志，全部成功后停用旧密钥。
+// 任何一步失败都保留旧密钥，再次执行 ROTATE KEY 会生成新密钥并重新开始
+func (s *Server) reencryptAll(user string, version uint32) {
+	defer func() {
+		s.mu.Lock()
+		s.rotating = false
+		s.mu.Unlock()
+	}()
+
+	logEntry := &audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.INFO,
+		User:      user,
+		Action:    "ROTATE_KEY",
+		Object:    "KEY",
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"集合元数据和记录文件", s.engine.Reencrypt},
+		{"用户数据", s.userMgr.Reencrypt},
+		{"审计日志", s.auditLog.Reencrypt},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			log.Printf("密钥轮换失败，重新加密%s出错: %v", step.name, err)
+			logEntry.Level = audit.ERROR
+			logEntry.Status = "FAILED"
+			logEntry.Details = fmt.Sprintf("使用第 %d 版密钥重新加密%s失败，旧密钥已保留: %v", version, step.name, err)
+			s.auditLog.Log(logEntry)
+			return
+		}
+	}
+
+	retired, err := s.crypto.RetireKeys()
+	if err != nil {
+		log.Printf("停用旧密钥失败: %v", err)
+		logEntry.Level = audit.ERROR
+		logEntry.Status = "FAILED"
+		logEntry.Details = fmt.Sprintf("数据已使用第 %d 版密钥重新加密，但停用旧密钥失败: %v", version, err)
+		s.auditLog.Log(logEntry)
+		return
+	}
+
+	log.Printf("密钥轮换完成: 当前密钥版本 %d，已停用 %v", version, retired)
+	logEntry.Status = "SUCCESS"
+	logEntry.Details = fmt.Sprintf("已使用第 %d 版密钥重新加密全部数据，停用密钥版本 %v", version, retired)
+	s.auditLog.Log(logEntry)
+}
@@ -0,0 +1,292 @@
+package network
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockoutPolicy 登录失败锁定策略。同一用户或同一来源 IP 在统计窗口内连续失败达到阈值后临时锁定，
+// 锁定期间的登录一律拒绝；解锁后再次被锁定时，锁定时长翻倍直到上限
+type LockoutPolicy struct {
+	MaxUserFailures int           // 同一用户的失败次数阈值，0 表示不按用户锁定
+	MaxIPFailures   int           // 同一来源 IP 的失败次数阈值，0 表示不按 IP 锁定
+	Window          time.Duration // 失败次数的统计窗口，最后一次失败后超过该时长未再失败则清零
+	BaseDuration    time.Duration // 第一次锁定的时长
+	MaxDuration     time.Duration // 锁定时长的上限
+	MaxRecords      int           // 用户和 IP 各自最多保留的失败记录数，0 表示使用默认值
+}
+
+// 默认最多保留的失败记录数，避免大量不同的用户名或 IP 耗尽内存
+const defaultMaxLockoutRecords = 10000
+
+// DefaultLockoutPolicy 默认的登录失败锁定策略
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		Window:          15 * time.Minute,
+		BaseDuration:    time.Minute,
+		MaxDuration:     time.Hour,
+		MaxRecords:      defaultMaxLockoutRecords,
+	}
+}
+
+// 锁定对象的类型
+const (
+	LockoutUser = "USER"
+	LockoutIP   = "IP"
+)
+
+// LockoutInfo 登录失败记录，供管理员查看
+type LockoutInfo struct {
+	Kind        string    `json:"kind"` // USER 或 IP
+	Name        string    `json:"name"`
+	Failures    int       `json:"failures"`     // 当前统计窗口内的失败次数
+	Lockouts    int       `json:"lockouts"`     // 已被锁定的次数
+	LastFailure time.Time `json:"last_failure"` // 最后一次失败的时间
+	LockedUntil time.Time `json:"locked_until"`
+	Locked      bool      `json:"locked"`
+}
+
+// failureRecord 一个用户或 IP 的失败记录
+type failureRecord struct {
+	failures    int
+	lockouts    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// lockoutTracker 在内存中记录登录失败并执行锁定策略
+type lockoutTracker struct {
+	mu      sync.Mutex
+	policy  LockoutPolicy
+	records map[string]map[string]*failureRecord // 类型 -> 名称 -> 记录
+	now     func() time.Time
+}
+
+func newLockoutTracker(policy LockoutPolicy) *lockoutTracker {
+	if policy.MaxDuration < policy.BaseDuration {
+		policy.MaxDuration = policy.BaseDuration
+	}
+	if policy.MaxRecords <= 0 {
+		policy.MaxRecords = defaultMaxLockoutRecords
+	}
+	return &lockoutTracker{
+		policy: policy,
+		records: map[string]map[string]*failureRecord{
+			LockoutUser: make(map[string]*failureRecord),
+			LockoutIP:   make(map[string]*failureRecord),
+		},
+		now: time.Now,
+	}
+}
+
+// clientIP 连接的来源 IP，不含端口
+func clientIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// locked 返回用户或 IP 是否处于锁定中，以及锁定的对象类型和剩余时长
+func (t *lockoutTracker) locked(username, ip string) (string, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for _, target := range []struct{ kind, name string }{{LockoutUser, username}, {LockoutIP, ip}} {
+		rec := t.records[target.kind][target.name]
+		if rec == nil {
+			continue
+		}
+		if now.Before(rec.lockedUntil) {
+			return target.kind, rec.lockedUntil.Sub(now)
+		}
+		if t.staleLocked(rec, now) {
+			delete(t.records[target.kind], target.name)
+		}
+	}
+	return "", 0
+}
+
+// fail 记录一次登录失败，返回因这次失败而被锁定的对象
+func (t *lockoutTracker) fail(username, ip string) []LockoutInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var lockedNow []LockoutInfo
+	for _, target := range []struct {
+		kind, name string
+		max        int
+	}{{LockoutUser, username, t.policy.MaxUserFailures}, {LockoutIP, ip, t.policy.MaxIPFailures}} {
+		if target.max <= 0 {
+			continue
+		}
+		rec := t.records[target.kind][target.name]
+		if rec == nil {
+			t.makeRoomLocked(target.kind, now)
+			rec = &failureRecord{}
+			t.records[target.kind][target.name] = rec
+		}
+		t.expireLocked(rec, now)
+
+		rec.failures++
+		rec.lastFailure = now
+		if rec.failures < target.max {
+			continue
+		}
+
+		// 达到阈值：锁定，时长按已锁定次数翻倍
+		duration := t.policy.BaseDuration
+		for i := 0; i < rec.lockouts && duration < t.policy.MaxDuration; i++ {
+			duration *= 2
+		}
+		if duration > t.policy.MaxDuration {
+			duration = t.policy.MaxDuration
+		}
+		rec.lockouts++
+		rec.failures = 0
+		rec.lockedUntil = now.Add(duration)
+		lockedNow = append(lockedNow, t.infoLocked(target.kind, target.name, rec, now))
+	}
+	return lockedNow
+}
+
+// succeed 登录成功后清除用户的失败记录；IP 只清除失败次数，保留退避的锁定次数
+func (t *lockoutTracker) succeed(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.records[LockoutUser], username)
+	if rec := t.records[LockoutIP][ip]; rec != nil {
+		rec.failures = 0
+	}
+}
+
+// expireLocked 超过统计窗口没有失败、也不在锁定中的记录从头统计，调用方需持有锁
+func (t *lockoutTracker) expireLocked(rec *failureRecord, now time.Time) {
+	if now.Before(rec.lockedUntil) {
+		return
+	}
+	idle := now.Sub(rec.lastFailure)
+	if idle > t.policy.Window {
+		rec.failures = 0
+	}
+	// 长时间没有失败后，锁定时长也不再翻倍
+	if idle > t.policy.Window+t.policy.MaxDuration {
+		rec.lockouts = 0
+	}
+}
+
+// staleLocked 记录是否已经没有作用：不在锁定中，失败次数和锁定次数都已过期清零。调用方需持有锁
+func (t *lockoutTracker) staleLocked(rec *failureRecord, now time.Time) bool {
+	t.expireLocked(rec, now)
+	return rec.failures == 0 && rec.lockouts == 0
+}
+
+// makeRoomLocked 新增记录前确保该类型的记录数低于上限：先删除过期的记录，仍然已满时
+// 淘汰一条未锁定的记录中最久没有失败的；全部在锁定中时淘汰最早解除锁定的。调用方需持有锁
+func (t *lockoutTracker) makeRoomLocked(kind string, now time.Time) {
+	records := t.records[kind]
+	if len(records) < t.policy.MaxRecords {
+		return
+	}
+
+	var victim string
+	var victimRec *failureRecord
+	for name, rec := range records {
+		if t.staleLocked(rec, now) {
+			delete(records, name)
+			continue
+		}
+		if victimRec == nil || evictBefore(rec, victimRec, now) {
+			victim, victimRec = name, rec
+		}
+	}
+	if len(records) >= t.policy.MaxRecords && victimRec != nil {
+		delete(records, victim)
+	}
+}
+
+// evictBefore 记录已满时 a 是否比 b 更应该被淘汰：未锁定的优先，其次是最久没有失败或最早解除锁定的
+func evictBefore(a, b *failureRecord, now time.Time) bool {
+	aLocked, bLocked := now.Before(a.lockedUntil), now.Before(b.lockedUntil)
+	if aLocked != bLocked {
+		return !aLocked
+	}
+	if aLocked {
+		return a.lockedUntil.Before(b.lockedUntil)
+	}
+	return a.lastFailure.Before(b.lastFailure)
+}
+
+// list 列出所有失败记录，锁定中的在前
+func (t *lockoutTracker) list() []LockoutInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var infos []LockoutInfo
+	for kind, records := range t.records {
+		for name, rec := range records {
+			if t.staleLocked(rec, now) {
+				delete(records, name)
+				continue
+			}
+			infos = append(infos, t.infoLocked(kind, name, rec, now))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Locked != infos[j].Locked {
+			return infos[i].Locked
+		}
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind > infos[j].Kind
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// clear 清除失败记录和锁定。kind 为空时清除全部，name 为空时清除该类型的全部，返回清除的记录数
+func (t *lockoutTracker) clear(kind, name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cleared := 0
+	for k, records := range t.records {
+		if kind != "" && k != kind {
+			continue
+		}
+		if name == "" {
+			cleared += len(records)
+			t.records[k] = make(map[string]*failureRecord)
+			continue
+		}
+		if _, exists := records[name]; exists {
+			delete(records, name)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+func (t *lockoutTracker) infoLocked(kind, name string, rec *failureRecord, now time.Time) LockoutInfo {
+	info := LockoutInfo{
+		Kind:        kind,
+		Name:        name,
+		Failures:    rec.failures,
+		Lockouts:    rec.lockouts,
+		LastFailure: rec.lastFailure,
+		Locked:      now.Before(rec.lockedUntil),
+	}
+	if info.Locked {
+		info.LockedUntil = rec.lockedUntil
+	}
+	return info
+}
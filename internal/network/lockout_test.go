@@ -0,0 +1,252 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sudatas/client"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var testLockoutPolicy = LockoutPolicy{
+	MaxUserFailures: 3,
+	MaxIPFailures:   5,
+	Window:          time.Minute,
+	BaseDuration:    time.Minute,
+	MaxDuration:     3 * time.Minute,
+}
+
+func newTestTracker(policy LockoutPolicy) (*lockoutTracker, *fakeClock) {
+	clock := newFakeClock()
+	tracker := newLockoutTracker(policy)
+	tracker.now = clock.Now
+	return tracker, clock
+}
+
+// failN 记录 n 次失败，返回最后一次失败时被锁定的对象类型
+func failN(tracker *lockoutTracker, username, ip string, n int) []string {
+	var kinds []string
+	for i := 0; i < n; i++ {
+		kinds = kinds[:0]
+		for _, info := range tracker.fail(username, ip) {
+			kinds = append(kinds, info.Kind)
+		}
+	}
+	return kinds
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	tracker, clock := newTestTracker(LockoutPolicy{MaxUserFailures: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: 3 * time.Minute})
+
+	// 每次锁定的时长翻倍，直到上限
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if kinds := failN(tracker, "bob", "10.0.0.1", 3); len(kinds) != 1 || kinds[0] != LockoutUser {
+			t.Fatalf("第 %d 次锁定: %v", i+1, kinds)
+		}
+		kind, remaining := tracker.locked("bob", "10.0.0.1")
+		if kind != LockoutUser || remaining != want {
+			t.Fatalf("第 %d 次锁定 %s %s，期望 %s", i+1, kind, remaining, want)
+		}
+		clock.Advance(remaining)
+		if kind, _ := tracker.locked("bob", "10.0.0.1"); kind != "" {
+			t.Fatalf("第 %d 次锁定到期后仍被锁定", i+1)
+		}
+	}
+
+	// 长时间没有失败后重新从基础时长开始
+	clock.Advance(time.Minute + 3*time.Minute + time.Second)
+	failN(tracker, "bob", "10.0.0.1", 3)
+	if _, remaining := tracker.locked("bob", "10.0.0.1"); remaining != time.Minute {
+		t.Fatalf("退避没有重置，锁定 %s", remaining)
+	}
+}
+
+func TestLockoutWindow(t *testing.T) {
+	tracker, clock := newTestTracker(testLockoutPolicy)
+
+	// 超过统计窗口的失败不累计
+	failN(tracker, "bob", "10.0.0.1", 2)
+	clock.Advance(testLockoutPolicy.Window + time.Second)
+	if kinds := failN(tracker, "bob", "10.0.0.1", 2); len(kinds) != 0 {
+		t.Fatalf("窗口外的失败被累计: %v", kinds)
+	}
+
+	// 登录成功清除用户的失败次数
+	tracker.succeed("bob", "10.0.0.1")
+	if kinds := failN(tracker, "bob", "10.0.0.1", 2); len(kinds) != 0 {
+		t.Fatalf("登录成功后失败次数没有清除: %v", kinds)
+	}
+}
+
+func TestLockoutByIP(t *testing.T) {
+	tracker, _ := newTestTracker(testLockoutPolicy)
+
+	// 同一来源尝试不同用户名，按 IP 锁定
+	for i, name := range []string{"a", "b", "c", "d"} {
+		if kinds := failN(tracker, name, "10.0.0.1", 1); len(kinds) != 0 {
+			t.Fatalf("第 %d 次失败就被锁定: %v", i+1, kinds)
+		}
+	}
+	if kinds := failN(tracker, "e", "10.0.0.1", 1); len(kinds) != 1 || kinds[0] != LockoutIP {
+		t.Fatalf("IP 没有被锁定: %v", kinds)
+	}
+	if kind, _ := tracker.locked("other", "10.0.0.1"); kind != LockoutIP {
+		t.Fatal("被锁定的 IP 仍可以登录其他用户")
+	}
+	if kind, _ := tracker.locked("other", "10.0.0.2"); kind != "" {
+		t.Fatal("其他 IP 被锁定")
+	}
+}
+
+func TestLockoutListAndClear(t *testing.T) {
+	tracker, _ := newTestTracker(testLockoutPolicy)
+	failN(tracker, "bob", "10.0.0.1", 3)
+	failN(tracker, "amy", "10.0.0.2", 1)
+
+	infos := tracker.list()
+	if len(infos) != 4 {
+		t.Fatalf("失败记录 %+v", infos)
+	}
+	// 锁定中的在前
+	if first := infos[0]; first.Kind != LockoutUser || first.Name != "bob" || !first.Locked || first.Lockouts != 1 {
+		t.Fatalf("第一条记录 %+v", first)
+	}
+	for _, info := range infos[1:] {
+		if info.Locked {
+			t.Fatalf("没有锁定的记录 %+v", info)
+		}
+	}
+
+	if n := tracker.clear(LockoutUser, "bob"); n != 1 {
+		t.Fatalf("清除了 %d 条记录", n)
+	}
+	if kind, _ := tracker.locked("bob", "10.0.0.3"); kind != "" {
+		t.Fatal("清除后仍被锁定")
+	}
+	if n := tracker.clear(LockoutIP, ""); n != 2 {
+		t.Fatalf("清除 IP 记录 %d 条", n)
+	}
+	if n := tracker.clear("", ""); n != 1 || len(tracker.list()) != 0 {
+		t.Fatalf("清除全部 %d 条，剩余 %+v", n, tracker.list())
+	}
+}
+
+func TestLockoutRecordsBounded(t *testing.T) {
+	policy := testLockoutPolicy
+	policy.MaxRecords = 3
+	tracker, clock := newTestTracker(policy)
+	failN(tracker, "bob", "10.0.0.1", 3)
+
+	// 大量不同的用户名不会让记录无限增长，锁定中的记录不会被淘汰
+	for i := 0; i < 10; i++ {
+		failN(tracker, fmt.Sprintf("u%d", i), fmt.Sprintf("10.0.1.%d", i), 1)
+		clock.Advance(time.Second)
+	}
+	for _, kind := range []string{LockoutUser, LockoutIP} {
+		if n := len(tracker.records[kind]); n > policy.MaxRecords {
+			t.Fatalf("%s 记录 %d 条，超过上限 %d", kind, n, policy.MaxRecords)
+		}
+	}
+	if kind, _ := tracker.locked("bob", "10.0.0.9"); kind != LockoutUser {
+		t.Fatal("锁定中的记录被淘汰")
+	}
+
+	// 过期的记录在检查时删除
+	clock.Advance(policy.Window + policy.MaxDuration + time.Minute)
+	tracker.locked("u9", "10.0.1.9")
+	if _, exists := tracker.records[LockoutUser]["u9"]; exists {
+		t.Fatal("过期的用户记录没有删除")
+	}
+	if _, exists := tracker.records[LockoutIP]["10.0.1.9"]; exists {
+		t.Fatal("过期的 IP 记录没有删除")
+	}
+}
+
+func TestServerLockout(t *testing.T) {
+	ts := startTestServer(t, WithLockoutPolicy(LockoutPolicy{MaxUserFailures: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: time.Hour}))
+	clock := newFakeClock()
+	ts.srv.lockouts.now = clock.Now
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1'")
+
+	for i := 0; i < 3; i++ {
+		if err := client.NewClient(ts.addr, "bob", "wrong").Connect(); err == nil {
+			t.Fatal("错误的口令登录成功")
+		}
+	}
+	// 锁定期间正确的口令也不能登录
+	err := client.NewClient(ts.addr, "bob", "pass-ob1").Connect()
+	if err == nil || !strings.Contains(err.Error(), "登录失败次数过多") {
+		t.Fatalf("锁定期间登录: %v", err)
+	}
+
+	data, err := json.Marshal(mustExec(t, root, "SHOW LOCKOUTS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name":"bob"`) {
+		t.Fatalf("SHOW LOCKOUTS: %s", data)
+	}
+	mustExec(t, root, "CLEAR LOCKOUT USER bob")
+	ts.connect(t, "bob", "pass-ob1")
+
+	// 锁定到期后自动解除
+	for i := 0; i < 3; i++ {
+		client.NewClient(ts.addr, "bob", "wrong").Connect()
+	}
+	clock.Advance(time.Minute)
+	ts.connect(t, "bob", "pass-ob1")
+
+	// 每次失败和每次锁定都写入审计日志
+	entries, err := ts.srv.auditLog.ReadLogs(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, locked, denied := 0, 0, 0
+	for _, entry := range entries {
+		if entry.User != "bob" {
+			continue
+		}
+		switch {
+		case entry.Action == "AUTH" && entry.Status == "FAILED":
+			failed++
+		case entry.Action == "LOCKOUT" && entry.Status == "LOCKED":
+			locked++
+		case entry.Action == "AUTH" && entry.Status == "DENIED":
+			denied++
+		}
+	}
+	if failed != 6 || locked != 2 || denied != 1 {
+		t.Fatalf("审计记录: 失败 %d 次，锁定 %d 次，拒绝 %d 次", failed, locked, denied)
+	}
+
+	// 普通用户不能查看和清除锁定
+	bob := ts.connect(t, "bob", "pass-ob1")
+	mustFail(t, bob, "SHOW LOCKOUTS")
+	mustFail(t, bob, "CLEAR LOCKOUTS")
+}
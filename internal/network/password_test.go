@@ -0,0 +1,54 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"sudatas/internal/security"
+)
+
+func TestBootstrapRoot(t *testing.T) {
+	engine := newTestEngine(t)
+
+	// 首次启动必须提供满足策略的 root 口令
+	if _, err := NewServer(engine, 10); err == nil {
+		t.Fatal("没有 root 口令时启动成功")
+	}
+	if _, err := NewServer(engine, 10, WithRootPassword(func() (string, error) { return "weak", nil })); err == nil {
+		t.Fatal("root 口令不满足策略时启动成功")
+	}
+	if _, err := NewServer(engine, 10, WithRootPassword(func() (string, error) { return testRootPassword, nil })); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已有用户时不再需要 root 口令
+	if _, err := NewServer(engine, 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordExpiryForcesChange(t *testing.T) {
+	policy := security.DefaultPasswordPolicy()
+	policy.HistorySize = 2
+	ts := startTestServer(t, WithPasswordPolicy(policy))
+	root := ts.connect(t, "root", testRootPassword)
+	mustFail(t, root, "CREATE USER bob PASSWORD 'short'")
+	mustFail(t, root, "CREATE USER bob PASSWORD 'Bob-12345'")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'Secret-1'")
+	mustExec(t, root, "CREATE USER amy PASSWORD 'Secret-1'")
+	mustExec(t, root, "ALTER USER bob PASSWORD EXPIRE")
+
+	// 口令过期后仍可登录，但修改口令之前不能执行其他语句
+	bob := ts.connect(t, "bob", "Secret-1")
+	if err := mustFail(t, bob, "SHOW COLLECTIONS"); !strings.Contains(err.Error(), "过期") {
+		t.Fatalf("口令过期时执行语句: %v", err)
+	}
+	mustFail(t, bob, "ALTER USER amy PASSWORD 'Secret-9'")
+	mustFail(t, bob, "ALTER USER bob PASSWORD 'Secret-1'")
+	mustExec(t, bob, "ALTER USER bob PASSWORD 'Secret-2'")
+	mustExec(t, bob, "SHOW COLLECTIONS")
+
+	mustExec(t, bob, "ALTER USER bob PASSWORD 'Secret-3'")
+	mustFail(t, bob, "ALTER USER bob PASSWORD 'Secret-1'")
+	ts.connect(t, "bob", "Secret-3")
+}
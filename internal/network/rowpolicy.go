@@ -0,0 +1,102 @@
+package network
+
+import (
+	"fmt"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/parser"
+	"sudatas/internal/storage"
+)
+
+// rowPolicy 返回用户在资源上某个权限的行级安全过滤条件。
+// 多条授权的条件按“或”合并，restricted 为假时不受行级限制
+func (s *Server) rowPolicy(client *Client, perm auth.Permission, res auth.Resource) (map[string]interface{}, bool, error) {
+	conditions, restricted := s.userMgr.RowConditions(client.user, perm, res)
+	if !restricted {
+		return nil, false, nil
+	}
+
+	vars := map[string]string{"user": client.user}
+	filters := make([]interface{}, 0, len(conditions))
+	for _, cond := range conditions {
+		filter, err := parser.ParsePolicyCondition(cond, vars)
+		if err != nil {
+			return nil, true, fmt.Errorf("无效的行级安全条件 %q: %w", cond, err)
+		}
+		filters = append(filters, filter)
+	}
+	if len(filters) == 1 {
+		return filters[0].(map[string]interface{}), true, nil
+	}
+	return map[string]interface{}{storage.OpOr: filters}, true, nil
+}
+
+// applyRowPolicy 对语句应用行级安全策略：
+// SELECT/UPDATE/DELETE 的条件与策略按“与”合并，INSERT 的数据必须满足策略，
+// UPDATE 不能修改策略引用的字段，受限用户不能导出或导入整个数据库
+func (s *Server) applyRowPolicy(client *Client, stmt *parser.Statement, perm auth.Permission, res auth.Resource, sql string) error {
+	switch stmt.Type {
+	case "SELECT", "UPDATE", "DELETE", "INSERT", "EXPORT", "IMPORT":
+	default:
+		return nil
+	}
+	if client.user == "root" {
+		return nil
+	}
+
+	deny := func(reason string) error {
+		s.auditDenied(client, stmt, perm, res, fmt.Sprintf("%s: %s", reason, parser.RedactSecrets(sql)))
+		return fmt.Errorf("%s", reason)
+	}
+
+	// 导入的数据不经过策略检查，在集合中恢复或插入数据受行级限制的用户都不能导入
+	if stmt.Type == "IMPORT" {
+		for _, p := range []auth.Permission{perm, auth.PermInsert} {
+			if s.userMgr.RowRestrictedInCollection(client.user, p, stmt.Collection) {
+				return deny("受行级安全策略限制，不能导入数据")
+			}
+		}
+		return nil
+	}
+
+	policy, restricted, err := s.rowPolicy(client, perm, res)
+	if err != nil || !restricted {
+		return err
+	}
+	where, err := storage.ParseConditions(policy)
+	if err != nil {
+		return fmt.Errorf("无效的行级安全条件: %w", err)
+	}
+
+	switch stmt.Type {
+	case "INSERT":
+		if !where.Match(stmt.Data) {
+			return deny("插入的数据违反行级安全策略")
+		}
+		return nil
+
+	case "EXPORT":
+		return deny("受行级安全策略限制，不能导出数据库")
+
+	case "UPDATE":
+		update, err := storage.ParseUpdate(stmt.Data)
+		if err != nil {
+			return err
+		}
+		for _, column := range where.Columns() {
+			if update.Touches(column) {
+				return deny(fmt.Sprintf("不能修改行级安全策略引用的字段: %s", column))
+			}
+		}
+	}
+
+	if stmt.Filter != nil {
+		policy = map[string]interface{}{storage.OpAnd: []interface{}{stmt.Filter, policy}}
+		if where, err = storage.ParseConditions(policy); err != nil {
+			return err
+		}
+	}
+	stmt.Filter = policy
+	stmt.Where = where
+	return nil
+}
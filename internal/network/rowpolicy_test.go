@@ -0,0 +1,125 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"sudatas/internal/auth"
+)
+
+func TestRowPolicy(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.posts TYPE json")
+	mustExec(t, root, "CREATE ROLE tenant")
+	mustExec(t, root, "GRANT SELECT, INSERT, UPDATE, DELETE ON c.posts TO ROLE tenant WHERE owner = $user")
+	mustExec(t, root, "CREATE USER alice PASSWORD 'pass-a1' ROLE tenant")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-b1' ROLE tenant")
+	alice := ts.connect(t, "alice", "pass-a1")
+	bob := ts.connect(t, "bob", "pass-b1")
+
+	mustExec(t, alice, `INSERT INTO c.posts VALUES {"owner":"alice","t":1}`)
+	mustFail(t, alice, `INSERT INTO c.posts VALUES {"owner":"bob","t":1}`)
+	mustExec(t, bob, `INSERT INTO c.posts VALUES {"owner":"bob","t":2}`)
+
+	rows, err := alice.Query("SELECT * FROM c.posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["owner"] != "alice" {
+		t.Fatalf("alice 查询到 %v", rows)
+	}
+	if rows, _ := alice.Query("SELECT * FROM c.posts WHERE t = 2"); len(rows) != 0 {
+		t.Fatalf("alice 查询到其他用户的记录: %v", rows)
+	}
+
+	// 不能修改策略引用的字段，其他修改只作用于自己的记录
+	mustFail(t, alice, "UPDATE c.posts SET owner = 'bob'")
+	mustExec(t, alice, "UPDATE c.posts SET t = 5")
+	mustExec(t, alice, "DELETE FROM c.posts")
+	rows, err = bob.Query("SELECT * FROM c.posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || fmt.Sprint(rows[0]["t"]) != "2" {
+		t.Fatalf("bob 的记录被修改: %v", rows)
+	}
+
+	mustFail(t, bob, "EXPORT c.posts TO /tmp/posts.sql")
+}
+
+func TestRowPolicyRejectsImport(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.posts TYPE json")
+	mustExec(t, root, "CREATE ROLE tenant")
+	mustExec(t, root, "GRANT INSERT ON c.posts TO ROLE tenant WHERE owner = $user")
+	// 恢复权限不能用 GRANT 授予，直接加到角色上
+	restore := auth.PermissionRule{Permission: auth.PermRestore, Resource: auth.Resource{Type: auth.ResDatabase, Name: "c.*"}}
+	if err := ts.srv.userMgr.GrantRolePermission("tenant", restore); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, root, "CREATE USER alice PASSWORD 'pass-a1' ROLE tenant")
+	alice := ts.connect(t, "alice", "pass-a1")
+
+	// 导入的数据不经过逐行的策略检查，插入受限的用户即使有恢复权限也不能导入
+	err := mustFail(t, alice, "IMPORT FROM '/tmp/posts.sql' TO c")
+	if !strings.Contains(err.Error(), "行级安全") {
+		t.Fatalf("拒绝原因不是行级安全策略: %v", err)
+	}
+	denied := ts.deniedAudits(t, "alice")
+	if len(denied) != 1 || !strings.Contains(denied[0].Details, "不能导入") {
+		t.Fatalf("审计记录 %+v", denied)
+	}
+}
+
+func TestRowPolicyGrantOption(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.posts TYPE json")
+	mustExec(t, root, `INSERT INTO c.posts VALUES {"owner":"alice","t":1}`)
+	mustExec(t, root, `INSERT INTO c.posts VALUES {"owner":"bob","t":2}`)
+	mustExec(t, root, `INSERT INTO c.posts VALUES {"owner":"carol","t":3}`)
+	mustExec(t, root, "CREATE ROLE tenant")
+	mustExec(t, root, "CREATE ROLE guest")
+	mustExec(t, root, "CREATE USER alice PASSWORD 'pass-a1' ROLE tenant")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-b1'")
+	mustExec(t, root, "CREATE USER carol PASSWORD 'pass-c1' ROLE guest")
+	mustExec(t, root, "GRANT SELECT ON c.posts TO alice WITH GRANT OPTION WHERE owner = $user")
+	alice := ts.connect(t, "alice", "pass-a1")
+
+	// 不能把权限转授给自己或自己的角色来去掉条件
+	mustFail(t, alice, "GRANT SELECT ON c.posts TO alice")
+	mustFail(t, alice, "GRANT SELECT ON c.posts TO ROLE tenant")
+	if rows, err := alice.Query("SELECT * FROM c.posts"); err != nil || len(rows) != 1 {
+		t.Fatalf("alice 查询到 %v, %v", rows, err)
+	}
+
+	// 转授出去的权限带上 alice 自己的条件，$user 指 alice 而不是被授权的用户
+	mustExec(t, alice, "GRANT SELECT ON c.posts TO bob WITH GRANT OPTION")
+	mustExec(t, alice, "GRANT SELECT ON c.posts TO ROLE guest WHERE t > 0")
+	for _, user := range []struct{ name, password string }{{"bob", "pass-b1"}, {"carol", "pass-c1"}} {
+		rows, err := ts.connect(t, user.name, user.password).Query("SELECT * FROM c.posts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0]["owner"] != "alice" {
+			t.Fatalf("%s 查询到 %v", user.name, rows)
+		}
+	}
+
+	// 转授不能替换对方已有的规则
+	mustExec(t, root, "GRANT SELECT ON c.posts TO bob WHERE owner = 'nobody'")
+	mustFail(t, alice, "GRANT SELECT ON c.posts TO bob")
+	rows, err := ts.connect(t, "bob", "pass-b1").Query("SELECT * FROM c.posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Fatalf("bob 的规则被转授替换: %v", rows)
+	}
+}
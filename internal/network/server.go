@@ -3,6 +3,7 @@ package network
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -21,12 +22,6 @@ import (
 	"sudatas/internal/storage"
 )
 
-// 默认认证信息
-const (
-	DefaultUser     = "root"
-	DefaultPassword = "123456"
-)
-
 // Server TCP服务器结构
 type Server struct {
 	engine     *storage.Engine
@@ -38,13 +33,71 @@ type Server struct {
 	auditLog   *audit.AuditLogger
 	parser     *parser.SQLParser
 	clients    map[net.Conn]*Client
+	rotating   bool   // 是否有进行中的密钥轮换，由 mu 保护
+	authSecret []byte // 为不存在的用户生成假挑战
+	lockouts   *lockoutTracker
+
+	passwordPolicy security.PasswordPolicy
+	rootPassword   func() (string, error) // 首次启动时提供 root 口令
+
+	tlsConfig         *tls.Config // 不为 nil 时监听器只接受 TLS 连接
+	requireEncryption bool        // 是否拒绝未加密连接上的认证请求
+}
+
+// ServerOption 服务器配置选项
+type ServerOption func(*Server)
+
+// WithPasswordPolicy 设置口令策略，默认为 security.DefaultPasswordPolicy
+func WithPasswordPolicy(policy security.PasswordPolicy) ServerOption {
+	return func(s *Server) {
+		s.passwordPolicy = policy
+	}
+}
+
+// WithRootPassword 设置首次启动时 root 口令的来源，只在还没有任何用户时调用
+func WithRootPassword(source func() (string, error)) ServerOption {
+	return func(s *Server) {
+		s.rootPassword = source
+	}
+}
+
+// WithTLS 在监听器上启用 TLS，config 中需要配置服务端证书
+func WithTLS(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithRequireEncryption 要求连接使用 TLS 或国密会话模式，明文连接不能认证
+func WithRequireEncryption(required bool) ServerOption {
+	return func(s *Server) {
+		s.requireEncryption = required
+	}
+}
+
+// WithLockoutPolicy 设置登录失败锁定策略，默认为 DefaultLockoutPolicy
+func WithLockoutPolicy(policy LockoutPolicy) ServerOption {
+	return func(s *Server) {
+		s.lockouts = newLockoutTracker(policy)
+	}
 }
 
 // Client 客户端连接
 type Client struct {
-	conn net.Conn
-	auth bool
-	user string
+	conn      net.Conn
+	auth      bool
+	user      string
+	tx        *storage.MemTx // 进行中的事务，nil 表示自动提交
+	challenge *authChallenge // 已发出、等待应答的认证挑战
+
+	passwordExpired bool              // 口令已过期，修改口令之前不能执行其他语句
+	token           *storage.APIToken // 令牌登录时使用的令牌，口令登录时为 nil
+	encrypted       bool              // 连接是否经 TLS 或国密会话模式加密
+
+	started      bool                // 已处理过消息，握手只能是第一条消息
+	version      uint32              // 握手协商出的协议版本，没有握手的旧客户端为 0
+	clientName   string              // 握手中的客户端名称
+	capabilities protocol.Capability // 握手协商出的双方都支持的功能
 }
 
 // Auth 认证信息
@@ -53,12 +106,9 @@ type Auth struct {
 }
 
 // NewServer 创建新的服务器实例
-func NewServer(engine *storage.Engine, maxClients int) (*Server, error) {
-	// 初始化加密管理器
-	crypto, err := security.NewCryptoManager()
-	if err != nil {
-		return nil, err
-	}
+func NewServer(engine *storage.Engine, maxClients int, opts ...ServerOption) (*Server, error) {
+	// 与存储引擎共用加密管理器，保证轮换密钥后所有组件使用同一套密钥
+	crypto := engine.Crypto()
 
 	// 确保 builtin 目录存在
 	builtinDir := "builtin"
@@ -66,12 +116,6 @@ func NewServer(engine *storage.Engine, maxClients int) (*Server, error) {
 		return nil, fmt.Errorf("创建 builtin 目录失败: %w", err)
 	}
 
-	// 加载或创建密钥
-	keyFile := filepath.Join(builtinDir, "key.sudb")
-	if err := crypto.LoadKeys(keyFile); err != nil {
-		return nil, fmt.Errorf("加载密钥失败: %w", err)
-	}
-
 	// 初始化用户管理器
 	userFile := filepath.Join(builtinDir, "user.sudb")
 	userMgr, err := storage.NewUserManager(userFile, crypto)
@@ -96,7 +140,12 @@ func NewServer(engine *storage.Engine, maxClients int) (*Server, error) {
 		return nil, fmt.Errorf("初始化审计日志失败: %w", err)
 	}
 
-	return &Server{
+	authSecret, err := security.RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
 		engine:     engine,
 		pool:       pool,
 		crypto:     crypto,
@@ -105,11 +154,59 @@ func NewServer(engine *storage.Engine, maxClients int) (*Server, error) {
 		auditLog:   auditLog,
 		parser:     parser.NewSQLParser(),
 		clients:    make(map[net.Conn]*Client),
-	}, nil
+		authSecret: authSecret,
+		lockouts:   newLockoutTracker(DefaultLockoutPolicy()),
+
+		passwordPolicy: security.DefaultPasswordPolicy(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// 客户端使用国密会话模式时需要预先配置这个公钥
+	log.Printf("国密会话模式的服务端公钥: %s", crypto.SessionPublicKey())
+
+	userMgr.SetPasswordPolicy(s.passwordPolicy)
+	if userMgr.NeedsBootstrap() {
+		if err := s.bootstrapRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// bootstrapRoot 首次启动时创建 root 用户，口令必须由管理员提供并满足口令策略
+func (s *Server) bootstrapRoot() error {
+	if s.rootPassword == nil {
+		return fmt.Errorf("首次启动需要设置 root 口令")
+	}
+	password, err := s.rootPassword()
+	if err != nil {
+		return err
+	}
+	if err := s.userMgr.BootstrapRoot(password); err != nil {
+		return fmt.Errorf("初始化 root 用户失败: %w", err)
+	}
+
+	log.Printf("首次启动，已创建 root 用户")
+	s.auditLog.Log(&audit.LogEntry{
+		Timestamp: time.Now(),
+		Level:     audit.INFO,
+		User:      "SYSTEM",
+		Action:    "BOOTSTRAP",
+		Object:    "USER:root",
+		Status:    "SUCCESS",
+		Details:   "首次启动，创建 root 用户",
+	})
+	return nil
 }
 
 // Serve 启动服务器
 func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
@@ -128,8 +225,9 @@ func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
 			}
 
 			client := &Client{
-				conn: conn,
-				auth: false,
+				conn:      conn,
+				auth:      false,
+				encrypted: s.tlsConfig != nil,
 			}
 
 			s.mu.Lock()
@@ -147,9 +245,16 @@ func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
 
 // handleConnection 处理客户端连接
 func (s *Server) handleConnection(ctx context.Context, client *Client) {
+	// 建立国密会话后 client.conn 会替换为加密连接，连接表仍以原始连接为键
+	conn := client.conn
 	defer func() {
+		// 连接断开时回滚未提交的事务
+		if client.tx != nil {
+			client.tx.Rollback()
+			client.tx = nil
+		}
 		s.mu.Lock()
-		delete(s.clients, client.conn)
+		delete(s.clients, conn)
 		s.mu.Unlock()
 		client.conn.Close()
 		log.Printf("客户端断开连接: %s", client.conn.RemoteAddr())
@@ -175,8 +280,20 @@ func (s *Server) handleConnection(ctx context.Context, client *Client) {
 				return
 			}
 
-			// 处理消息
-			response, err := s.handleMessage(client, msg)
+			// 处理消息。密钥协商的响应以明文发送，之后改用会话连接读写
+			var response *protocol.Message
+			if msg.Type == protocol.KeyExchangeMessage {
+				var next *bufio.Reader
+				next, err = s.handleKeyExchange(client, reader, msg)
+				client.started = true
+				if err == nil {
+					reader = next
+					continue
+				}
+			} else {
+				response, err = s.handleMessage(client, msg)
+				client.started = true
+			}
 			if err != nil {
 				response = &protocol.Message{
 					Type:    protocol.ErrorMessage,
@@ -191,24 +308,35 @@ func (s *Server) handleConnection(ctx context.Context, client *Client) {
 				}
 				return
 			}
+
+			// 协议版本不兼容时不再处理这个连接上的消息
+			if response.Type == protocol.IncompatibleMessage {
+				return
+			}
 		}
 	}
 }
 
 // handleMessage 处理客户端消息
 func (s *Server) handleMessage(client *Client, msg *protocol.Message) (*protocol.Message, error) {
-	// 如果未认证，只处理认证消息
-	if !client.auth && msg.Type != protocol.AuthMessage {
+	// 如果未认证，只处理握手和认证消息
+	if !client.auth && msg.Type != protocol.AuthMessage && msg.Type != protocol.HelloMessage {
 		return nil, fmt.Errorf("需要认证")
 	}
 
-	// 记录请求日志
-	log.Printf("收到请求 [%s]: %s", client.conn.RemoteAddr(), string(msg.Payload))
+	// 记录请求日志，认证请求可能含令牌，不记录内容
+	if msg.Type == protocol.AuthMessage {
+		log.Printf("收到认证请求 [%s]", client.conn.RemoteAddr())
+	} else {
+		log.Printf("收到请求 [%s]: %s", client.conn.RemoteAddr(), parser.RedactSecrets(string(msg.Payload)))
+	}
 
 	var response *protocol.Message
 	var err error
 
 	switch msg.Type {
+	case protocol.HelloMessage:
+		response, err = s.handleHello(client, msg)
 	case protocol.AuthMessage:
 		response, err = s.handleAuth(client, msg)
 	case protocol.QueryMessage:
@@ -227,152 +355,49 @@ func (s *Server) handleMessage(client *Client, msg *protocol.Message) (*protocol
 	return response, err
 }
 
-// handleAuth 处理认证请求
-func (s *Server) handleAuth(client *Client, msg *protocol.Message) (*protocol.Message, error) {
-	// 直接解析认证数据（不解密）
-	var auth struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	if err := json.Unmarshal(msg.Payload, &auth); err != nil {
-		return nil, fmt.Errorf("无效的认证数据: %w", err)
-	}
-
-	if s.userMgr.ValidateUser(auth.Username, auth.Password) {
-		client.auth = true
-		client.user = auth.Username
-
-		// 记录审计日志
-		s.auditLog.Log(&audit.LogEntry{
-			Timestamp: time.Now(),
-			Level:     audit.INFO,
-			User:      auth.Username,
-			Action:    "AUTH",
-			Object:    "USER",
-			Status:    "SUCCESS",
-			Details:   "用户登录成功",
-			IP:        client.conn.RemoteAddr().String(),
-		})
-
-		// 返回成功消息（不加密）
-		return &protocol.Message{
-			Type:    protocol.ResultMessage,
-			Payload: []byte("认证成功"),
-		}, nil
-	}
-
-	return nil, fmt.Errorf("认证失败")
-}
-
 // handleQuery 处理查询请求
 func (s *Server) handleQuery(client *Client, msg *protocol.Message) (*protocol.Message, error) {
+	// 令牌被吊销、过期或所属用户被锁定后，用它登录的会话立即失效
+	if client.token != nil {
+		if err := s.userMgr.CheckToken(client.token.ID); err != nil {
+			return nil, fmt.Errorf("%v，请重新登录", err)
+		}
+	}
+
 	// 解析SQL语句，获取操作类型和资源信息
 	stmt, err := s.parser.Parse(string(msg.Payload))
 	if err != nil {
 		return nil, err
 	}
 
-	// 检查权限
-	var perm auth.Permission
-	var res auth.Resource
-
-	switch stmt.Type {
-	case "INSERT":
-		perm = auth.PermInsert
-		res = auth.Resource{
-			Type: auth.ResDatabase,
-			Name: fmt.Sprintf("%s.%s", stmt.Collection, stmt.Database),
-		}
-
-	case "SELECT":
-		perm = auth.PermSelect
-		res = auth.Resource{
-			Type: auth.ResDatabase,
-			Name: fmt.Sprintf("%s.%s", stmt.Collection, stmt.Database),
-		}
-
-	case "SHOW_COLLECTIONS":
-		// 允许所有已认证用户查看集合列表
-		perm = auth.PermSelect
-		res = auth.Resource{Type: auth.ResDatabase}
-
-	case "SHOW_DATABASES":
-		// 允许所有已认证用户查看数据库列表
-		perm = auth.PermSelect
-		res = auth.Resource{Type: auth.ResDatabase}
-
-	case "CREATE_COLLECTION":
-		perm = auth.PermCreateDB
-		res = auth.Resource{Type: auth.ResDatabase}
-
-	case "CREATE_DATABASE":
-		perm = auth.PermCreateDB
-		res = auth.Resource{Type: auth.ResDatabase}
-
-	case "IMPORT":
-		// 解析导入路径
-		parts := strings.Fields(string(msg.Payload))
-		if len(parts) < 4 || strings.ToUpper(parts[1]) != "FROM" || strings.ToUpper(parts[3]) != "TO" {
-			return nil, fmt.Errorf("无效的IMPORT语句，格式应为: IMPORT FROM filepath TO collection")
-		}
-		filePath := parts[2]
-		targetCollection := parts[4]
-
-		// 导入数据
-		if err := s.engine.MemStore.ImportFromFile(filePath, targetCollection); err != nil {
-			return nil, fmt.Errorf("导入数据失败: %w", err)
-		}
-
-		result := map[string]interface{}{
-			"message": "导入成功",
-			"path":    filePath,
-			"target":  targetCollection,
-		}
-		resultData, err := json.Marshal(result)
-		if err != nil {
-			return nil, fmt.Errorf("序列化结果失败: %w", err)
-		}
-
-		return &protocol.Message{
-			Type:    protocol.ResultMessage,
-			Payload: resultData,
-		}, nil
-
-	case "EXPORT":
-		perm = auth.PermSelect // 导出需要读取权限
-		res = auth.Resource{
-			Type: auth.ResDatabase,
-			Name: fmt.Sprintf("%s.%s", stmt.Collection, stmt.Database),
-		}
-
-	case "UPDATE":
-		// 更新数据
-		if err := s.engine.MemStore.UpdateRecords(stmt.Collection, stmt.Database, stmt.Data, stmt.Filter); err != nil {
-			return nil, err
-		}
+	// 口令过期的用户只能修改自己的口令
+	if client.passwordExpired && !(stmt.Type == "ALTER_USER" && stmt.UserAction == "PASSWORD" && stmt.User == client.user) {
+		return nil, fmt.Errorf("口令已过期，请先执行 ALTER USER %s PASSWORD '新口令' 修改口令", client.user)
+	}
 
-		result := map[string]interface{}{
-			"message": "更新成功",
-		}
-		resultData, err := json.Marshal(result)
-		if err != nil {
-			return nil, fmt.Errorf("序列化结果失败: %w", err)
-		}
+	// 执行前检查权限，所有语句类型都在 statementAuthorization 中登记
+	perm, res, err := s.authorize(client, stmt, string(msg.Payload))
+	if err != nil {
+		return nil, err
+	}
 
-		return &protocol.Message{
-			Type:    protocol.ResultMessage,
-			Payload: resultData,
-		}, nil
+	// 列级访问控制：检查语句引用的字段，查询结果在执行时脱敏
+	if err := s.checkColumnAccess(client, stmt, perm, res, string(msg.Payload)); err != nil {
+		return nil, err
+	}
 
-	default:
-		return nil, fmt.Errorf("不支持的操作类型: %s", stmt.Type)
+	// 行级安全策略：把授权条件合并到查询条件中，或拒绝违反策略的写入
+	if err := s.applyRowPolicy(client, stmt, perm, res, string(msg.Payload)); err != nil {
+		return nil, err
 	}
 
-	// root 用户跳过权限检查
-	if client.user != "root" {
-		if !s.userMgr.CheckPermission(client.user, perm, res) {
-			return nil, fmt.Errorf("权限不足")
+	switch stmt.Type {
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		return s.handleTransaction(client, stmt)
+	case "INSERT", "SELECT", "UPDATE", "DELETE", "SHOW_COLLECTIONS", "SHOW_DATABASES":
+	default:
+		if client.tx != nil {
+			return nil, fmt.Errorf("事务中不支持 %s 语句，请先提交或回滚", stmt.Type)
 		}
 	}
 
@@ -381,13 +406,13 @@ func (s *Server) handleQuery(client *Client, msg *protocol.Message) (*protocol.M
 		Timestamp: time.Now(),
 		Level:     audit.INFO,
 		User:      client.user,
-		Action:    string(perm),
+		Action:    auditAction(stmt, perm),
 		Object:    fmt.Sprintf("%s:%s", res.Type, res.Name),
 		IP:        client.conn.RemoteAddr().String(),
 	}
 
 	// 执行查询
-	result, err := s.executeQuery(stmt)
+	result, err := s.executeQuery(client, stmt)
 	if err != nil {
 		logEntry.Level = audit.ERROR
 		logEntry.Status = "FAILED"
@@ -397,7 +422,7 @@ func (s *Server) handleQuery(client *Client, msg *protocol.Message) (*protocol.M
 	}
 
 	logEntry.Status = "SUCCESS"
-	logEntry.Details = fmt.Sprintf("操作成功: %s", string(msg.Payload))
+	logEntry.Details = fmt.Sprintf("操作成功: %s", parser.RedactSecrets(string(msg.Payload)))
 	s.auditLog.Log(logEntry)
 
 	return &protocol.Message{
@@ -440,12 +465,79 @@ func (s *Server) Shutdown() error {
 	return nil
 }
 
+// handleTransaction 处理 BEGIN/COMMIT/ROLLBACK
+func (s *Server) handleTransaction(client *Client, stmt *parser.Statement) (*protocol.Message, error) {
+	var message string
+	switch stmt.Type {
+	case "BEGIN":
+		if client.tx != nil {
+			return nil, fmt.Errorf("已经在事务中")
+		}
+		client.tx = s.engine.MemStore.Begin()
+		message = "事务已开始"
+
+	case "COMMIT", "ROLLBACK":
+		if client.tx == nil {
+			return nil, fmt.Errorf("当前没有进行中的事务")
+		}
+		tx := client.tx
+		client.tx = nil
+
+		var err error
+		if stmt.Type == "COMMIT" {
+			err = tx.Commit()
+			message = "事务已提交"
+		} else {
+			err = tx.Rollback()
+			message = "事务已回滚"
+		}
+
+		logEntry := &audit.LogEntry{
+			Timestamp: time.Now(),
+			Level:     audit.INFO,
+			User:      client.user,
+			Action:    stmt.Type,
+			Object:    "TRANSACTION",
+			Status:    "SUCCESS",
+			Details:   message,
+			IP:        client.conn.RemoteAddr().String(),
+		}
+		if err != nil {
+			logEntry.Level = audit.ERROR
+			logEntry.Status = "FAILED"
+			logEntry.Details = err.Error()
+		}
+		s.auditLog.Log(logEntry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resultData, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return nil, fmt.Errorf("序列化结果失败: %w", err)
+	}
+	return &protocol.Message{
+		Type:    protocol.ResultMessage,
+		Payload: resultData,
+	}, nil
+}
+
+// recordStore 返回客户端当前使用的记录存储：事务中为事务本身，否则直接读写内存存储
+func (s *Server) recordStore(client *Client) storage.RecordStore {
+	if client.tx != nil {
+		return client.tx
+	}
+	return s.engine.MemStore
+}
+
 // executeQuery 执行SQL查询
-func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
+func (s *Server) executeQuery(client *Client, stmt *parser.Statement) ([]byte, error) {
+	store := s.recordStore(client)
 	switch stmt.Type {
 	case "INSERT":
 		// 插入数据到内存
-		if err := s.engine.MemStore.InsertRecord(stmt.Collection, stmt.Database, stmt.Data); err != nil {
+		if err := store.InsertRecord(stmt.Collection, stmt.Database, stmt.Data); err != nil {
 			return nil, err
 		}
 
@@ -456,28 +548,51 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 
 	case "SELECT":
 		// 从内存查询数据
-		records, err := s.engine.MemStore.QueryRecords(stmt.Collection, stmt.Database, stmt.Filter)
+		opts := &storage.QueryOptions{
+			GroupBy:    stmt.GroupBy,
+			Aggregates: stmt.Aggregates,
+			Having:     stmt.Having,
+			OrderBy:    stmt.OrderBy,
+			Limit:      stmt.Limit,
+			Offset:     stmt.Offset,
+		}
+		records, err := store.QueryRecords(stmt.Collection, stmt.Database, stmt.Filter, opts)
 		if err != nil {
 			return nil, err
 		}
 
-		// 过滤列
-		if len(stmt.Columns) > 0 {
+		// 按列级访问控制隐藏和脱敏字段（分组查询引用的字段已在执行前检查）
+		policy := s.userMgr.ColumnPolicy(client.user, auth.PermSelect, databaseResource(stmt.Collection, stmt.Database))
+		if policy != nil && !opts.Grouped() {
+			for i, record := range records {
+				records[i] = applyColumnPolicy(policy, record)
+			}
+		}
+
+		// 过滤列（分组查询的结果已经只包含分组字段和聚合结果）
+		if len(stmt.Columns) > 0 && !opts.Grouped() {
 			var filtered []storage.Row
 			for _, record := range records {
-				row := make(storage.Row)
-				for _, col := range stmt.Columns {
-					if val, ok := record[col]; ok {
-						row[col] = val
-					}
-				}
-				filtered = append(filtered, row)
+				filtered = append(filtered, storage.ProjectRow(record, stmt.Columns))
 			}
 			records = filtered
 		}
 
 		return json.Marshal(records)
 
+	case "DELETE":
+		// 从内存删除数据
+		deleted, err := store.DeleteRecords(stmt.Collection, stmt.Database, stmt.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		result := map[string]interface{}{
+			"message": "删除成功",
+			"deleted": deleted,
+		}
+		return json.Marshal(result)
+
 	case "SHOW_COLLECTIONS":
 		collections := s.engine.ListCollections()
 		result := make([]map[string]interface{}, len(collections))
@@ -507,6 +622,14 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 		return json.Marshal(result)
 
 	case "CREATE_COLLECTION":
+		if stmt.IfNotExists {
+			if _, err := s.engine.GetCollection(stmt.Collection); err == nil {
+				return json.Marshal(map[string]interface{}{
+					"message": "集合已存在",
+					"name":    stmt.Collection,
+				})
+			}
+		}
 		if err := s.engine.CreateCollection(stmt.Collection, stmt.Owner); err != nil {
 			return nil, err
 		}
@@ -517,6 +640,17 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 		return json.Marshal(result)
 
 	case "CREATE_DATABASE":
+		if stmt.IfNotExists {
+			if collection, err := s.engine.GetCollection(stmt.Collection); err == nil {
+				if _, exists := collection.Databases[stmt.Database]; exists {
+					return json.Marshal(map[string]interface{}{
+						"message":    "数据库已存在",
+						"collection": stmt.Collection,
+						"database":   stmt.Database,
+					})
+				}
+			}
+		}
 		if err := s.engine.CreateDatabase(stmt.Collection, stmt.Database, stmt.DBType, stmt.Description); err != nil {
 			return nil, err
 		}
@@ -528,6 +662,19 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 		}
 		return json.Marshal(result)
 
+	case "IMPORT":
+		// 导入数据
+		if err := s.engine.MemStore.ImportFromFile(stmt.FilePath, stmt.Collection); err != nil {
+			return nil, fmt.Errorf("导入数据失败: %w", err)
+		}
+
+		result := map[string]interface{}{
+			"message": "导入成功",
+			"path":    stmt.FilePath,
+			"target":  stmt.Collection,
+		}
+		return json.Marshal(result)
+
 	case "EXPORT":
 		// 获取数据库
 		collection, err := s.engine.GetCollection(stmt.Collection)
@@ -551,6 +698,11 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 			Directory:     dir,
 			Filename:      filename,
 		}
+		if policy := s.userMgr.ColumnPolicy(client.user, auth.PermSelect, databaseResource(stmt.Collection, stmt.Database)); policy != nil {
+			opts.Transform = func(record storage.Row) storage.Row {
+				return applyColumnPolicy(policy, record)
+			}
+		}
 		if err := s.engine.MemStore.ExportDatabase(stmt.Collection, stmt.Database, opts); err != nil {
 			return nil, fmt.Errorf("导出失败: %w", err)
 		}
@@ -561,14 +713,89 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 		}
 		return json.Marshal(result)
 
+	case "CREATE_ROLE":
+		if stmt.IfNotExists && s.userMgr.RoleExists(stmt.Role) {
+			return json.Marshal(map[string]interface{}{
+				"message": "角色已存在",
+				"name":    stmt.Role,
+			})
+		}
+		if err := s.userMgr.CreateRole(stmt.Role, stmt.Description); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "角色创建成功",
+			"name":    stmt.Role,
+		})
+
+	case "DROP_ROLE":
+		if stmt.IfExists && !s.userMgr.RoleExists(stmt.Role) {
+			return json.Marshal(map[string]interface{}{
+				"message": "角色不存在",
+				"name":    stmt.Role,
+			})
+		}
+		if err := s.userMgr.DropRole(stmt.Role); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "角色删除成功",
+			"name":    stmt.Role,
+		})
+
+	case "CREATE_USER", "ALTER_USER", "DROP_USER", "GRANT", "REVOKE":
+		return s.executeUserStatement(client, stmt)
+
+	case "CREATE_TOKEN", "DROP_TOKEN", "SHOW_TOKENS":
+		return s.executeTokenStatement(client, stmt)
+
+	case "SHOW_KEYS":
+		s.mu.RLock()
+		rotating := s.rotating
+		s.mu.RUnlock()
+		return json.Marshal(map[string]interface{}{
+			"keys":               s.crypto.KeyInfos(),
+			"rotating":           rotating,
+			"session_public_key": s.crypto.SessionPublicKey(),
+		})
+
+	case "SHOW_LOCKOUTS":
+		return json.Marshal(map[string]interface{}{
+			"lockouts": s.lockouts.list(),
+		})
+
+	case "CLEAR_LOCKOUT":
+		name := stmt.User
+		if stmt.Lockout == LockoutIP {
+			name = stmt.Address
+		}
+		cleared := s.lockouts.clear(stmt.Lockout, name)
+		return json.Marshal(map[string]interface{}{
+			"message": "登录锁定已解除",
+			"cleared": cleared,
+		})
+
+	case "ROTATE_KEY":
+		version, err := s.startKeyRotation(client)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message":     "密钥轮换已开始，正在后台重新加密数据",
+			"key_version": version,
+		})
+
 	case "UPDATE":
 		// 更新数据
-		if err := s.engine.MemStore.UpdateRecords(stmt.Collection, stmt.Database, stmt.Data, stmt.Filter); err != nil {
+		updated, err := store.UpdateRecords(stmt.Collection, stmt.Database, stmt.Data, stmt.Filter)
+		if err != nil {
 			return nil, err
 		}
 
 		result := map[string]interface{}{
-			"message": "更新成功",
+			"message":  "更新成功",
+			"matched":  updated.Matched,
+			"modified": updated.Modified,
 		}
 		return json.Marshal(result)
 
@@ -578,57 +805,3 @@ func (s *Server) executeQuery(stmt *parser.Statement) ([]byte, error) {
 
 	return nil, fmt.Errorf("SQL语句执行失败")
 }
-
-// matchCondition 检查记录是否匹配条件
-func matchCondition(record storage.Row, cond *storage.Condition) bool {
-	val, exists := record[cond.Column]
-	if !exists {
-		return false
-	}
-
-	switch cond.Operator {
-	case "=":
-		return val == cond.Value
-	case ">":
-		return compareValues(val, cond.Value) > 0
-	case "<":
-		return compareValues(val, cond.Value) < 0
-	case ">=":
-		return compareValues(val, cond.Value) >= 0
-	case "<=":
-		return compareValues(val, cond.Value) <= 0
-	case "!=":
-		return val != cond.Value
-	}
-
-	return false
-}
-
-// compareValues 比较两个值
-func compareValues(a, b interface{}) int {
-	switch v1 := a.(type) {
-	case string:
-		if v2, ok := b.(string); ok {
-			switch {
-			case v1 < v2:
-				return -1
-			case v1 > v2:
-				return 1
-			default:
-				return 0
-			}
-		}
-	case float64:
-		if v2, ok := b.(float64); ok {
-			switch {
-			case v1 < v2:
-				return -1
-			case v1 > v2:
-				return 1
-			default:
-				return 0
-			}
-		}
-	}
-	return 0
-}
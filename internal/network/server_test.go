@@ -0,0 +1,122 @@
+package network
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sudatas/client"
+	"sudatas/internal/audit"
+	"sudatas/internal/security"
+	"sudatas/internal/storage"
+)
+
+const testRootPassword = "Admin-pass-1"
+
+// testServer 在临时目录中启动的服务器
+type testServer struct {
+	srv  *Server
+	addr string
+}
+
+// newTestEngine 在临时目录中创建存储引擎，并把工作目录切换到该目录
+func newTestEngine(t *testing.T) *storage.Engine {
+	t.Helper()
+	dir := t.TempDir()
+
+	// 审计日志等写入工作目录
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cm := &security.CryptoManager{}
+	if err := cm.LoadKeys(filepath.Join(dir, "builtin", "key.sudb"), []byte("master-secret")); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := storage.NewEngine(filepath.Join(dir, "data"), filepath.Join(dir, "builtin"), cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+// startTestServer 启动服务器，测试结束时自动关闭。口令策略只要求非空口令
+func startTestServer(t *testing.T, options ...ServerOption) *testServer {
+	t.Helper()
+	engine := newTestEngine(t)
+	options = append([]ServerOption{
+		WithPasswordPolicy(security.PasswordPolicy{MinLength: 1}),
+		WithRootPassword(func() (string, error) { return testRootPassword, nil }),
+	}, options...)
+	srv, err := NewServer(engine, 10, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.Serve(ctx, ln)
+	t.Cleanup(func() {
+		cancel()
+		ln.Close()
+	})
+	return &testServer{srv: srv, addr: ln.Addr().String()}
+}
+
+// connect 以指定用户登录，测试结束时断开
+func (ts *testServer) connect(t *testing.T, username, password string) *client.Client {
+	t.Helper()
+	c := client.NewClient(ts.addr, username, password)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("%s 登录失败: %v", username, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// mustExec 执行语句，失败时终止测试
+func mustExec(t *testing.T, c *client.Client, sql string) interface{} {
+	t.Helper()
+	result, err := c.Query(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return result
+}
+
+// mustFail 执行语句，成功时终止测试
+func mustFail(t *testing.T, c *client.Client, sql string) error {
+	t.Helper()
+	_, err := c.Query(sql)
+	if err == nil {
+		t.Fatalf("%s: 期望失败", sql)
+	}
+	return err
+}
+
+// deniedAudits 返回用户被拒绝的审计记录
+func (ts *testServer) deniedAudits(t *testing.T, username string) []*audit.LogEntry {
+	t.Helper()
+	entries, err := ts.srv.auditLog.ReadLogs(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denied []*audit.LogEntry
+	for _, entry := range entries {
+		if entry.User == username && entry.Status == "DENIED" {
+			denied = append(denied, entry)
+		}
+	}
+	return denied
+}
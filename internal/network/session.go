@@ -0,0 +1,50 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"sudatas/internal/protocol"
+	"sudatas/internal/security"
+)
+
+// handleKeyExchange 处理国密会话模式的密钥协商：以明文返回协商响应后，
+// 把连接替换为用会话密钥加密的连接，返回新连接上的读取器
+func (s *Server) handleKeyExchange(client *Client, reader *bufio.Reader, msg *protocol.Message) (*bufio.Reader, error) {
+	if client.encrypted || client.auth {
+		return nil, fmt.Errorf("密钥协商只能在未加密的连接上认证之前进行")
+	}
+
+	var req protocol.KeyExchangeRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, fmt.Errorf("无效的密钥协商数据: %w", err)
+	}
+	ephemeral, confirm, keys, err := s.crypto.AcceptSession(req.PublicKey, req.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(protocol.KeyExchangeResponse{
+		Ephemeral: ephemeral,
+		Confirm:   confirm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化密钥协商响应失败: %w", err)
+	}
+	session, err := security.NewSessionConn(client.conn, reader, keys, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := protocol.WriteMessage(client.conn, &protocol.Message{
+		Type:    protocol.KeyExchangeMessage,
+		Payload: payload,
+	}); err != nil {
+		return nil, err
+	}
+	client.conn = session
+	client.encrypted = true
+	log.Printf("已建立国密会话 [%s]", client.conn.RemoteAddr())
+	return bufio.NewReader(session), nil
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"sudatas/client"
+	"sudatas/dbclient"
+	"sudatas/internal/security"
+)
+
+// selfSignedCert 生成 127.0.0.1 的自签名证书，返回证书和信任该证书的证书池
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSM2Session(t *testing.T) {
+	ts := startTestServer(t, WithRequireEncryption(true))
+	serverKey := ts.srv.crypto.SessionPublicKey()
+
+	// 要求加密时明文连接不能认证
+	err := client.NewClient(ts.addr, "root", testRootPassword).Connect()
+	if err == nil || !strings.Contains(err.Error(), "加密") {
+		t.Fatalf("明文连接登录: %v", err)
+	}
+
+	c := client.NewClient(ts.addr, "root", testRootPassword, client.WithSM2Session(serverKey))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	mustExec(t, c, "CREATE COLLECTION c")
+	mustExec(t, c, "CREATE DATABASE c.d TYPE json")
+
+	// 超过一个会话记录的请求和响应
+	large := strings.Repeat("x", 3<<20)
+	mustExec(t, c, `INSERT INTO c.d VALUES {"v":"`+large+`"}`)
+	if row := queryRow(t, c, "SELECT * FROM c.d"); row["v"] != large {
+		t.Fatal("大记录读取结果不同")
+	}
+
+	d := dbclient.NewClient(ts.addr, "root", testRootPassword, dbclient.WithSM2Session(serverKey))
+	if _, err := d.Query("SHOW COLLECTIONS"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 客户端配置的公钥不是服务端的公钥时拒绝连接
+	other, err := security.NewCryptoManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{other.SessionPublicKey(), "zz"} {
+		if err := client.NewClient(ts.addr, "root", testRootPassword, client.WithSM2Session(key)).Connect(); err == nil {
+			t.Errorf("服务端公钥 %.16s 连接成功", key)
+		}
+		if _, err := dbclient.NewClient(ts.addr, "root", testRootPassword, dbclient.WithSM2Session(key)).Query("SHOW COLLECTIONS"); err == nil {
+			t.Errorf("dbclient 用服务端公钥 %.16s 连接成功", key)
+		}
+	}
+}
+
+func TestTLSTransport(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	ts := startTestServer(t, WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}}), WithRequireEncryption(true))
+	config := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+
+	c := client.NewClient(ts.addr, "root", testRootPassword, client.WithTLS(config))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	mustExec(t, c, "SHOW COLLECTIONS")
+
+	d := dbclient.NewClient(ts.addr, "root", testRootPassword, dbclient.WithTLS(config))
+	if _, err := d.Query("SHOW COLLECTIONS"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 明文客户端、不信任证书的客户端和同时配置两种模式的客户端都不能连接
+	untrusted := &tls.Config{RootCAs: x509.NewCertPool(), ServerName: "127.0.0.1"}
+	for name, options := range map[string][]client.ClientOption{
+		"明文":    nil,
+		"不信任证书": {client.WithTLS(untrusted)},
+		"两种模式":  {client.WithTLS(config), client.WithSM2Session(ts.srv.crypto.SessionPublicKey())},
+	} {
+		if err := client.NewClient(ts.addr, "root", testRootPassword, append(options, client.WithTimeout(2*time.Second))...).Connect(); err == nil {
+			t.Errorf("%s的客户端连接成功", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"sudatas/client"
+	"sudatas/dbclient"
+)
+
+// createToken 执行 CREATE TOKEN 并返回令牌明文
+func createToken(t *testing.T, c *client.Client, sql string) string {
+	t.Helper()
+	token, ok := queryRow(t, c, sql)["token"].(string)
+	if !ok || !strings.HasPrefix(token, "sdt_") {
+		t.Fatalf("%s: 没有返回令牌", sql)
+	}
+	return token
+}
+
+// connectToken 用令牌登录，测试结束时断开
+func (ts *testServer) connectToken(t *testing.T, username, token string) *client.Client {
+	t.Helper()
+	c := client.NewClient(ts.addr, username, "", client.WithToken(token))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("%s 用令牌登录失败: %v", username, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestTokenScope(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.a TYPE json")
+	mustExec(t, root, "CREATE DATABASE c.b TYPE json")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1'")
+	mustExec(t, root, "GRANT SELECT, INSERT ON c.* TO bob")
+	bob := ts.connect(t, "bob", "pass-ob1")
+
+	token := createToken(t, bob, "CREATE TOKEN ci SCOPE SELECT ON c.a EXPIRES IN 1 DAYS")
+	ci := ts.connectToken(t, "bob", token)
+	mustExec(t, ci, "SELECT * FROM c.a")
+
+	// 令牌的权限不超过范围，也不能管理令牌或修改口令
+	mustFail(t, ci, "SELECT * FROM c.b")
+	mustFail(t, ci, `INSERT INTO c.a VALUES {"x":1}`)
+	mustFail(t, ci, "CREATE TOKEN other")
+	mustFail(t, ci, "ALTER USER bob PASSWORD 'pass-ob2'")
+
+	// 没有范围的令牌有用户的全部权限，但不超过用户的权限
+	full := ts.connectToken(t, "bob", createToken(t, bob, "CREATE TOKEN full"))
+	mustExec(t, full, `INSERT INTO c.b VALUES {"x":1}`)
+	mustFail(t, full, "DELETE FROM c.b")
+
+	d := dbclient.NewClient(ts.addr, "bob", "", dbclient.WithToken(token))
+	if _, err := d.Query("SELECT * FROM c.a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenLogin(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1'")
+	mustExec(t, root, "CREATE USER eve PASSWORD 'pass-ev1'")
+	token := createToken(t, root, "CREATE TOKEN ci FOR USER bob")
+
+	// 令牌只能用于所属用户
+	for _, tt := range []struct{ user, token string }{
+		{"root", token},
+		{"eve", token},
+		{"bob", token + "x"},
+		{"", token},
+	} {
+		if err := client.NewClient(ts.addr, tt.user, "", client.WithToken(tt.token)).Connect(); err == nil {
+			t.Errorf("%s 用令牌 %s 登录成功", tt.user, tt.token)
+		}
+	}
+	ci := ts.connectToken(t, "bob", token)
+
+	// 令牌信息不含摘要，其他用户不能管理
+	data, err := json.Marshal(mustExec(t, root, "SHOW TOKENS FOR USER bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hash") || !strings.Contains(string(data), `"name":"ci"`) {
+		t.Fatalf("SHOW TOKENS: %s", data)
+	}
+	eve := ts.connect(t, "eve", "pass-ev1")
+	mustFail(t, eve, "SHOW TOKENS FOR USER bob")
+	mustFail(t, eve, "DROP TOKEN ci FOR USER bob")
+
+	// 吊销后已登录的会话立即失效
+	mustExec(t, root, "DROP TOKEN ci FOR USER bob")
+	mustFail(t, ci, "SHOW COLLECTIONS")
+	mustFail(t, root, "DROP TOKEN ci FOR USER bob")
+	mustExec(t, root, "DROP TOKEN IF EXISTS ci FOR USER bob")
+	if err := client.NewClient(ts.addr, "bob", "", client.WithToken(token)).Connect(); err == nil {
+		t.Fatal("吊销的令牌登录成功")
+	}
+
+	// 删除用户同时删除其令牌
+	createToken(t, root, "CREATE TOKEN other FOR USER bob")
+	mustExec(t, root, "DROP USER bob")
+	if n := len(ts.srv.userMgr.ListTokens("bob")); n != 0 {
+		t.Fatalf("删除用户后剩余 %d 个令牌", n)
+	}
+}
+
+func TestRootTokenProtected(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE USER ops PASSWORD 'pass-op1' ROLE admin")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1'")
+	ops := ts.connect(t, "ops", "pass-op1")
+
+	// 管理员可以为其他用户签发令牌，但不能为 root 签发或吊销
+	createToken(t, ops, "CREATE TOKEN ci FOR USER bob")
+	mustFail(t, ops, "CREATE TOKEN ci FOR USER root")
+	createToken(t, root, "CREATE TOKEN ci")
+	mustFail(t, ops, "DROP TOKEN ci FOR root")
+	mustExec(t, root, "DROP TOKEN ci")
+}
@@ -0,0 +1,401 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/parser"
+)
+
+// grantResource GRANT/REVOKE 语句检查权限的资源：授予角色时为角色，否则为数据库
+func grantResource(stmt *parser.Statement) auth.Resource {
+	if len(stmt.Roles) > 0 {
+		return auth.Resource{Type: auth.ResRole, Name: strings.Join(stmt.Roles, ",")}
+	}
+	return auth.Resource{Type: auth.ResDatabase, Name: stmt.Resource}
+}
+
+// privilegeResources GRANT/DENY/REVOKE 中权限作用的资源：列出字段时每个字段一个列级资源，否则为整个数据库
+func privilegeResources(stmt *parser.Statement, privilege string) []auth.Resource {
+	columns := stmt.PrivColumns[privilege]
+	if len(columns) == 0 {
+		return []auth.Resource{{Type: auth.ResDatabase, Name: stmt.Resource}}
+	}
+	resources := make([]auth.Resource, 0, len(columns))
+	for _, column := range columns {
+		resources = append(resources, auth.Resource{Type: auth.ResColumn, Name: stmt.Resource, Sub: column})
+	}
+	return resources
+}
+
+// allowedWithoutPermission 没有语句对应的管理权限时仍然允许的操作：
+// 修改自己的口令，管理自己的令牌，以及把以 WITH GRANT OPTION 获得的权限转授给他人。
+// 令牌登录的会话不能修改口令
+func (s *Server) allowedWithoutPermission(client *Client, stmt *parser.Statement) bool {
+	switch stmt.Type {
+	case "ALTER_USER":
+		return stmt.UserAction == "PASSWORD" && stmt.User == client.user && client.token == nil
+
+	case "CREATE_TOKEN", "DROP_TOKEN", "SHOW_TOKENS":
+		return stmt.User == "" || stmt.User == client.user
+
+	case "GRANT":
+		// 字段限制会影响其他用户，只能由有授权权限的用户设置
+		if len(stmt.Privileges) == 0 || stmt.Deny || s.grantsToSelf(client, stmt) {
+			return false
+		}
+		res := auth.Resource{Type: auth.ResDatabase, Name: stmt.Resource}
+		for _, privilege := range stmt.Privileges {
+			if _, ok := s.userMgr.CanGrant(client.user, auth.Permission(privilege), res); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// grantsToSelf 授权对象是否为当前用户自己或当前用户拥有的角色
+func (s *Server) grantsToSelf(client *Client, stmt *parser.Statement) bool {
+	if !stmt.ToRole {
+		return stmt.User == client.user
+	}
+	for _, role := range s.userMgr.UserRoles(client.user) {
+		if role == stmt.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// delegated 授权语句是否依靠 WITH GRANT OPTION 执行：当前用户没有授权权限
+func (s *Server) delegated(client *Client, stmt *parser.Statement) bool {
+	return client.user != "root" && !s.userMgr.CheckPermission(client.user, auth.PermGrant, grantResource(stmt))
+}
+
+// delegatedCondition 转授时规则的行级条件：语句中的条件与转授者可转授规则的条件按“与”合并，
+// 转授出去的权限不会比转授者自己的更宽。转授者条件中的 $user 指转授者本人，合并前替换为其用户名
+func delegatedCondition(granter, cond string, granterConds []string) (string, error) {
+	if len(granterConds) == 0 {
+		return cond, nil
+	}
+	parts := make([]string, 0, len(granterConds))
+	for _, c := range granterConds {
+		bound, err := parser.BindPolicyVariables(c, map[string]string{"user": granter})
+		if err != nil {
+			return "", fmt.Errorf("无效的行级安全条件 %q: %w", c, err)
+		}
+		parts = append(parts, "("+bound+")")
+	}
+	combined := strings.Join(parts, " OR ")
+	if cond != "" {
+		combined = "(" + cond + ") AND (" + combined + ")"
+	}
+	return combined, nil
+}
+
+// executeUserStatement 执行用户和授权管理语句
+func (s *Server) executeUserStatement(client *Client, stmt *parser.Statement) ([]byte, error) {
+	switch stmt.Type {
+	case "CREATE_USER":
+		if stmt.IfNotExists && s.userMgr.UserExists(stmt.User) {
+			return json.Marshal(map[string]interface{}{
+				"message": "用户已存在",
+				"name":    stmt.User,
+			})
+		}
+		if err := s.userMgr.CreateUser(stmt.User, stmt.Password, stmt.Roles); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "用户创建成功",
+			"name":    stmt.User,
+		})
+
+	case "ALTER_USER":
+		var err error
+		var message string
+		switch stmt.UserAction {
+		case "PASSWORD":
+			if err = checkRootCredential(client, stmt.User); err == nil {
+				err = s.userMgr.ChangePassword(stmt.User, stmt.Password)
+			}
+			if err == nil && stmt.User == client.user {
+				client.passwordExpired = false
+			}
+			message = "口令修改成功"
+		case "EXPIRE":
+			if err = checkRootCredential(client, stmt.User); err == nil {
+				err = s.userMgr.ExpirePassword(stmt.User)
+			}
+			message = "口令已设为过期，用户下次登录后必须修改口令"
+		case "LOCK":
+			if err = checkManageableUser(client, stmt.User); err == nil {
+				err = s.userMgr.LockUser(stmt.User)
+			}
+			message = "用户已锁定"
+		case "UNLOCK":
+			// 同时解除登录失败造成的临时锁定
+			if err = s.userMgr.UnlockUser(stmt.User); err == nil {
+				s.lockouts.clear(LockoutUser, stmt.User)
+			}
+			message = "用户已解锁"
+		default:
+			err = fmt.Errorf("不支持的 ALTER USER 操作: %s", stmt.UserAction)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": message,
+			"name":    stmt.User,
+		})
+
+	case "DROP_USER":
+		if stmt.IfExists && !s.userMgr.UserExists(stmt.User) {
+			return json.Marshal(map[string]interface{}{
+				"message": "用户不存在",
+				"name":    stmt.User,
+			})
+		}
+		if err := checkManageableUser(client, stmt.User); err != nil {
+			return nil, err
+		}
+		if err := s.userMgr.DropUser(stmt.User); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "用户删除成功",
+			"name":    stmt.User,
+		})
+
+	case "GRANT":
+		return s.executeGrant(client, stmt)
+
+	case "REVOKE":
+		return s.executeRevoke(stmt)
+	}
+	return nil, fmt.Errorf("不支持的操作类型: %s", stmt.Type)
+}
+
+// executeTokenStatement 签发、吊销和列出访问令牌，没有指定用户时为当前用户
+func (s *Server) executeTokenStatement(client *Client, stmt *parser.Statement) ([]byte, error) {
+	owner := stmt.User
+	if owner == "" {
+		owner = client.user
+	}
+
+	switch stmt.Type {
+	case "CREATE_TOKEN":
+		if err := checkRootCredential(client, owner); err != nil {
+			return nil, err
+		}
+		var scope []auth.PermissionRule
+		for _, item := range stmt.TokenScope {
+			for _, privilege := range item.Privileges {
+				scope = append(scope, auth.PermissionRule{
+					Permission: auth.Permission(privilege),
+					Resource:   auth.Resource{Type: auth.ResDatabase, Name: item.Resource},
+				})
+			}
+		}
+		plain, info, err := s.userMgr.CreateToken(owner, stmt.Token, scope, stmt.TokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{
+			"message": "令牌创建成功，令牌只显示这一次，请妥善保存",
+			"name":    info.Name,
+			"user":    info.User,
+			"token":   plain,
+		}
+		if len(info.Scope) > 0 {
+			result["scope"] = info.Scope
+		}
+		if !info.ExpiresAt.IsZero() {
+			result["expires_at"] = info.ExpiresAt
+		}
+		return json.Marshal(result)
+
+	case "DROP_TOKEN":
+		if err := checkRootCredential(client, owner); err != nil {
+			return nil, err
+		}
+		if stmt.IfExists && !s.userMgr.TokenExists(owner, stmt.Token) {
+			return json.Marshal(map[string]interface{}{
+				"message": "令牌不存在",
+				"name":    stmt.Token,
+				"user":    owner,
+			})
+		}
+		if err := s.userMgr.RevokeToken(owner, stmt.Token); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "令牌已吊销",
+			"name":    stmt.Token,
+			"user":    owner,
+		})
+
+	case "SHOW_TOKENS":
+		return json.Marshal(map[string]interface{}{
+			"user":   owner,
+			"tokens": s.userMgr.ListTokens(owner),
+		})
+	}
+	return nil, fmt.Errorf("不支持的操作类型: %s", stmt.Type)
+}
+
+// checkManageableUser root 用户和当前用户自己不能被锁定或删除
+func checkManageableUser(client *Client, username string) error {
+	if username == "root" {
+		return fmt.Errorf("不能锁定或删除 root 用户")
+	}
+	if username == client.user {
+		return fmt.Errorf("不能锁定或删除当前登录的用户")
+	}
+	return nil
+}
+
+// checkRootCredential root 用户的口令和令牌只能由 root 自己管理
+func checkRootCredential(client *Client, username string) error {
+	if username == "root" && client.user != "root" {
+		return fmt.Errorf("只有 root 用户自己可以管理 root 的口令和令牌")
+	}
+	return nil
+}
+
+// executeGrant 授予角色或权限。依靠 WITH GRANT OPTION 转授时，规则附加转授者的行级条件，
+// 并且不替换对方已有的同一权限
+func (s *Server) executeGrant(client *Client, stmt *parser.Statement) ([]byte, error) {
+	if len(stmt.Roles) > 0 {
+		if err := s.userMgr.GrantRoles(stmt.User, stmt.Roles); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "角色授予成功",
+			"user":    stmt.User,
+			"roles":   stmt.Roles,
+		})
+	}
+
+	delegated := s.delegated(client, stmt)
+	for _, privilege := range stmt.Privileges {
+		condition := stmt.Condition
+		if delegated {
+			res := auth.Resource{Type: auth.ResDatabase, Name: stmt.Resource}
+			granterConds, ok := s.userMgr.CanGrant(client.user, auth.Permission(privilege), res)
+			if !ok {
+				return nil, fmt.Errorf("权限不足: 不能转授 %s 权限", privilege)
+			}
+			var err error
+			if condition, err = delegatedCondition(client.user, condition, granterConds); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, res := range privilegeResources(stmt, privilege) {
+			rule := auth.PermissionRule{
+				Permission: auth.Permission(privilege),
+				Resource:   res,
+				Grant:      stmt.GrantOption,
+				Condition:  condition,
+				Deny:       stmt.Deny,
+				Mask:       stmt.Mask,
+			}
+			var err error
+			switch {
+			case stmt.ToRole && delegated:
+				err = s.userMgr.AddRolePermission(stmt.Role, rule)
+			case stmt.ToRole:
+				err = s.userMgr.GrantRolePermission(stmt.Role, rule)
+			case delegated:
+				err = s.userMgr.AddPermission(stmt.User, rule)
+			default:
+				err = s.userMgr.GrantPermission(stmt.User, rule)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"message":    "授权成功",
+		"privileges": stmt.Privileges,
+		"resource":   stmt.Resource,
+	}
+	if stmt.Deny {
+		result["message"] = "字段限制设置成功"
+	}
+	if len(stmt.PrivColumns) > 0 {
+		result["columns"] = stmt.PrivColumns
+	}
+	if stmt.Mask != "" {
+		result["mask"] = stmt.Mask
+	}
+	if stmt.Condition != "" {
+		result["condition"] = stmt.Condition
+	}
+	if stmt.ToRole {
+		result["role"] = stmt.Role
+	} else {
+		result["user"] = stmt.User
+	}
+	return json.Marshal(result)
+}
+
+// executeRevoke 收回角色或权限
+func (s *Server) executeRevoke(stmt *parser.Statement) ([]byte, error) {
+	if len(stmt.Roles) > 0 {
+		if err := s.userMgr.RevokeRoles(stmt.User, stmt.Roles); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"message": "角色收回成功",
+			"user":    stmt.User,
+			"roles":   stmt.Roles,
+		})
+	}
+
+	var revoked []string
+	for _, privilege := range stmt.Privileges {
+		for _, res := range privilegeResources(stmt, privilege) {
+			var removed bool
+			var err error
+			if stmt.ToRole {
+				removed, err = s.userMgr.RevokeRolePermission(stmt.Role, auth.Permission(privilege), res)
+			} else {
+				removed, err = s.userMgr.RevokePermission(stmt.User, auth.Permission(privilege), res)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !removed {
+				continue
+			}
+			if res.Sub != "" {
+				revoked = append(revoked, fmt.Sprintf("%s(%s)", privilege, res.Sub))
+			} else {
+				revoked = append(revoked, privilege)
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"message":    "权限收回成功",
+		"privileges": revoked,
+		"resource":   stmt.Resource,
+	}
+	if len(revoked) == 0 {
+		result["message"] = "没有可收回的权限"
+	}
+	if stmt.ToRole {
+		result["role"] = stmt.Role
+	} else {
+		result["user"] = stmt.User
+	}
+	return json.Marshal(result)
+}
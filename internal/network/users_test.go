@@ -0,0 +1,52 @@
+package network
+
+import (
+	"testing"
+)
+
+func TestCustomRoles(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE COLLECTION c")
+	mustExec(t, root, "CREATE DATABASE c.d TYPE json")
+	mustExec(t, root, `INSERT INTO c.d VALUES {"id":1}`)
+
+	mustExec(t, root, "CREATE ROLE analyst DESCRIPTION '分析'")
+	mustFail(t, root, "CREATE ROLE analyst")
+	mustExec(t, root, "CREATE ROLE IF NOT EXISTS analyst")
+	mustFail(t, root, "CREATE ROLE admin")
+	mustExec(t, root, "GRANT SELECT ON c.* TO ROLE analyst")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1' ROLE analyst")
+	mustFail(t, root, "CREATE USER eve PASSWORD 'pass-ev1' ROLE missing")
+
+	bob := ts.connect(t, "bob", "pass-ob1")
+	mustExec(t, bob, "SELECT * FROM c.d")
+	mustFail(t, bob, `INSERT INTO c.d VALUES {"id":2}`)
+	// 普通用户不能管理角色
+	mustFail(t, bob, "CREATE ROLE mine")
+
+	// 删除角色后其权限立即失效
+	mustFail(t, root, "DROP ROLE readonly")
+	mustExec(t, root, "DROP ROLE analyst")
+	mustFail(t, bob, "SELECT * FROM c.d")
+	mustFail(t, root, "DROP ROLE analyst")
+	mustExec(t, root, "DROP ROLE IF EXISTS analyst")
+}
+
+func TestRootPasswordProtected(t *testing.T) {
+	ts := startTestServer(t)
+	root := ts.connect(t, "root", testRootPassword)
+	mustExec(t, root, "CREATE USER ops PASSWORD 'pass-op1' ROLE admin")
+	mustExec(t, root, "CREATE USER bob PASSWORD 'pass-ob1'")
+	ops := ts.connect(t, "ops", "pass-op1")
+
+	// 有用户管理权限的管理员可以修改其他用户的口令，但不能修改 root 的口令或使其过期
+	mustExec(t, ops, "ALTER USER bob PASSWORD 'pass-ob2'")
+	mustExec(t, ops, "ALTER USER bob PASSWORD EXPIRE")
+	mustFail(t, ops, "ALTER USER root PASSWORD 'pass-rt2'")
+	mustFail(t, ops, "ALTER USER root PASSWORD EXPIRE")
+	ts.connect(t, "root", testRootPassword)
+
+	mustExec(t, root, "ALTER USER root PASSWORD 'Admin-pass-2'")
+	ts.connect(t, "root", "Admin-pass-2")
+}
@@ -0,0 +1,288 @@
+package parser
+
+import "time"
+
+// Pos 源文本中的位置（行列号从1开始）
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Position 返回节点位置
+func (p Pos) Position() Pos {
+	return p
+}
+
+// Node 语法树节点
+type Node interface {
+	Position() Pos
+}
+
+// Expr 表达式节点
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// TableName 形如 collection.database 的数据库引用
+type TableName struct {
+	Pos
+	Collection string
+	Database   string
+}
+
+// Literal 字面量：字符串、数字、布尔、NULL 或 JSON 文档
+type Literal struct {
+	Pos
+	Value interface{}
+}
+
+// ColumnRef 字段引用
+type ColumnRef struct {
+	Pos
+	Name string
+}
+
+// BinaryExpr 二元表达式：比较运算或 AND/OR 组合
+type BinaryExpr struct {
+	Pos
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// UnaryExpr 一元表达式：NOT
+type UnaryExpr struct {
+	Pos
+	Op string
+	X  Expr
+}
+
+// PredicateExpr 字段谓词：IN、LIKE、ILIKE、REGEXP、BETWEEN、CONTAINS、IS NULL、EXISTS 及其取反形式
+type PredicateExpr struct {
+	Pos
+	Op     string // 存储层运算符，如 "NOT IN"、"IS NULL"
+	Column *ColumnRef
+	Args   []Expr // IS NULL 和 EXISTS 没有参数
+}
+
+// FuncCall 聚合函数调用，如 COUNT(*)、SUM(DISTINCT likes) AS total
+type FuncCall struct {
+	Pos
+	Name     string // 大写函数名
+	Arg      string // 字段名或 *
+	Distinct bool
+	Alias    string
+}
+
+func (*Literal) exprNode()       {}
+func (*ColumnRef) exprNode()     {}
+func (*BinaryExpr) exprNode()    {}
+func (*UnaryExpr) exprNode()     {}
+func (*PredicateExpr) exprNode() {}
+func (*FuncCall) exprNode()      {}
+
+// Assignment UPDATE 中对单个字段的修改，如 field = value、field = field + 1、UNSET field
+type Assignment struct {
+	Pos
+	Column string
+	Op     string // 存储层更新运算符，如 $set、$inc
+	Value  Expr   // UNSET 时为 nil
+}
+
+// InsertStmt INSERT INTO c.d VALUES {...}
+type InsertStmt struct {
+	Pos
+	Table  TableName
+	Values map[string]interface{}
+}
+
+// OrderItem ORDER BY 中的一项
+type OrderItem struct {
+	Pos
+	Column string
+	Desc   bool
+}
+
+// SelectStmt SELECT cols FROM c.d [WHERE ...] [GROUP BY ... [HAVING ...]] [ORDER BY ...] [LIMIT n] [OFFSET m]
+type SelectStmt struct {
+	Pos
+	Columns    []string // nil 表示 *
+	Aggregates []*FuncCall
+	From       TableName
+	Where      Expr
+	GroupBy    []string
+	Having     Expr
+	OrderBy    []*OrderItem
+	Limit      int // 0 表示未指定
+	Offset     int
+}
+
+// UpdateStmt UPDATE c.d SET ... [WHERE ...]，SET 之后可以是赋值列表或JSON更新文档
+type UpdateStmt struct {
+	Pos
+	Table TableName
+	Set   []*Assignment
+	Doc   *Literal
+	Where Expr
+}
+
+// DeleteStmt DELETE FROM c.d [WHERE ...]
+type DeleteStmt struct {
+	Pos
+	Table TableName
+	Where Expr
+}
+
+// CreateCollectionStmt CREATE COLLECTION [IF NOT EXISTS] name
+type CreateCollectionStmt struct {
+	Pos
+	Name        string
+	IfNotExists bool
+}
+
+// CreateDatabaseStmt CREATE DATABASE [IF NOT EXISTS] c.d [TYPE t] [DESCRIPTION '...']
+type CreateDatabaseStmt struct {
+	Pos
+	Name        TableName
+	IfNotExists bool
+	Type        string
+	Description string
+}
+
+// ShowCollectionsStmt SHOW COLLECTIONS
+type ShowCollectionsStmt struct {
+	Pos
+}
+
+// ShowDatabasesStmt SHOW DATABASES FROM c
+type ShowDatabasesStmt struct {
+	Pos
+	Collection string
+}
+
+// ImportStmt IMPORT FROM path TO collection
+type ImportStmt struct {
+	Pos
+	Path   string
+	Target string
+}
+
+// ExportStmt EXPORT c.d TO path
+type ExportStmt struct {
+	Pos
+	Table TableName
+	Path  string
+}
+
+// CreateRoleStmt CREATE ROLE [IF NOT EXISTS] name [DESCRIPTION '...']
+type CreateRoleStmt struct {
+	Pos
+	Name        string
+	IfNotExists bool
+	Description string
+}
+
+// DropRoleStmt DROP ROLE [IF EXISTS] name
+type DropRoleStmt struct {
+	Pos
+	Name     string
+	IfExists bool
+}
+
+// CreateUserStmt CREATE USER [IF NOT EXISTS] name PASSWORD '...' [ROLE r1, r2]
+type CreateUserStmt struct {
+	Pos
+	Name        string
+	IfNotExists bool
+	Password    string
+	Roles       []string
+}
+
+// AlterUserStmt ALTER USER name PASSWORD '...' | PASSWORD EXPIRE | LOCK | UNLOCK
+type AlterUserStmt struct {
+	Pos
+	Name     string
+	Action   string // PASSWORD、EXPIRE、LOCK 或 UNLOCK
+	Password string
+}
+
+// DropUserStmt DROP USER [IF EXISTS] name
+type DropUserStmt struct {
+	Pos
+	Name     string
+	IfExists bool
+}
+
+// GrantStmt GRANT/DENY/REVOKE 权限[(字段)] ON 资源 TO/FROM [USER|ROLE] name [WHERE 条件]，或 GRANT/REVOKE ROLE 角色 TO/FROM [USER] name
+type GrantStmt struct {
+	Pos
+	Revoke      bool
+	Privileges  []string // 大写权限名，如 SELECT
+	Resource    string   // collection.database，可以含通配符 *
+	Roles       []string // 授予或收回的角色，与 Privileges 二选一
+	Grantee     string
+	ToRole      bool                // 对象是角色而不是用户
+	GrantOption bool                // WITH GRANT OPTION
+	Condition   string              // WHERE 之后的行级安全条件原文，可以引用 $user
+	Columns     map[string][]string // 权限名 -> 括号中列出的字段，没有列出字段的权限作用于整个数据库
+	Deny        bool                // DENY 权限(字段) ON 资源 TO name [WITH MASK 方式]
+	Mask        string              // 脱敏方式：PARTIAL 或 HASH
+}
+
+// ShowKeysStmt SHOW KEYS
+type ShowKeysStmt struct {
+	Pos
+}
+
+// RotateKeyStmt ROTATE KEY
+type RotateKeyStmt struct {
+	Pos
+}
+
+// ShowLockoutsStmt SHOW LOCKOUTS
+type ShowLockoutsStmt struct {
+	Pos
+}
+
+// ClearLockoutStmt CLEAR LOCKOUT[S] [USER name | IP 'address']
+type ClearLockoutStmt struct {
+	Pos
+	Kind string // USER、IP 或空（全部）
+	Name string
+}
+
+// TokenScope 令牌权限范围中的一项
+type TokenScope struct {
+	Privileges []string // 大写权限名，如 SELECT
+	Resource   string   // collection.database，可以含通配符 *
+}
+
+// CreateTokenStmt CREATE TOKEN name [FOR [USER] u] [SCOPE 权限 ON 资源[, ...]] [EXPIRES IN n MINUTES|HOURS|DAYS]
+type CreateTokenStmt struct {
+	Pos
+	Name  string
+	User  string // 令牌所属用户，为空表示当前用户
+	Scope []TokenScope
+	TTL   time.Duration // 有效期，0 表示不过期
+}
+
+// DropTokenStmt DROP TOKEN [IF EXISTS] name [FOR [USER] u]
+type DropTokenStmt struct {
+	Pos
+	Name     string
+	User     string
+	IfExists bool
+}
+
+// ShowTokensStmt SHOW TOKENS [FOR [USER] u]
+type ShowTokensStmt struct {
+	Pos
+	User string
+}
+
+// TransactionStmt BEGIN / COMMIT / ROLLBACK
+type TransactionStmt struct {
+	Pos
+	Action string // BEGIN、COMMIT 或 ROLLBACK
+}
@@ -0,0 +1,348 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenType 词法单元类型
+type TokenType int
+
+const (
+	TokEOF         TokenType = iota
+	TokIdent                 // 标识符或关键字
+	TokQuotedIdent           // 引号标识符："name" 或 `name`
+	TokString                // 字符串字面量：'text'
+	TokNumber                // 数字字面量
+	TokSymbol                // 运算符和标点
+	TokSemicolon             // 语句分隔符
+)
+
+// String 返回词法单元类型名称
+func (t TokenType) String() string {
+	switch t {
+	case TokEOF:
+		return "语句结尾"
+	case TokIdent:
+		return "标识符"
+	case TokQuotedIdent:
+		return "引号标识符"
+	case TokString:
+		return "字符串"
+	case TokNumber:
+		return "数字"
+	case TokSymbol:
+		return "符号"
+	case TokSemicolon:
+		return "分号"
+	}
+	return "未知"
+}
+
+// Token 词法单元
+type Token struct {
+	Type   TokenType
+	Value  string // 解码后的值（字符串去引号、标识符原样）
+	Pos    Pos
+	Offset int // 在源文本中的起始字节偏移
+	End    int // 在源文本中的结束字节偏移
+}
+
+// ParseError 带位置信息的解析错误
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("第%d行第%d列: %s", e.Line, e.Column, e.Msg)
+}
+
+// errorAt 构造指定位置的解析错误
+func errorAt(pos Pos, format string, args ...interface{}) error {
+	return &ParseError{Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Lexer SQL词法分析器
+type Lexer struct {
+	src    string
+	offset int
+	line   int
+	column int
+}
+
+// NewLexer 创建词法分析器
+func NewLexer(src string) *Lexer {
+	return &Lexer{src: src, line: 1, column: 1}
+}
+
+// Tokenize 将整个输入切分为词法单元，结尾总是一个 TokEOF
+func (l *Lexer) Tokenize() ([]Token, error) {
+	var tokens []Token
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Type == TokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// Next 读取下一个词法单元
+func (l *Lexer) Next() (Token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return Token{}, err
+	}
+
+	start := l.offset
+	pos := Pos{Line: l.line, Column: l.column}
+	if start >= len(l.src) {
+		return Token{Type: TokEOF, Pos: pos, Offset: start, End: start}, nil
+	}
+
+	ch, _ := l.peek()
+	tok := Token{Pos: pos, Offset: start}
+
+	switch {
+	case ch == '\'':
+		value, err := l.readString()
+		if err != nil {
+			return Token{}, err
+		}
+		tok.Type = TokString
+		tok.Value = value
+
+	case ch == '"' || ch == '`':
+		value, err := l.readQuotedIdent(ch)
+		if err != nil {
+			return Token{}, err
+		}
+		tok.Type = TokQuotedIdent
+		tok.Value = value
+
+	case ch < utf8.RuneSelf && isDigit(byte(ch)):
+		tok.Type = l.readNumber()
+		tok.Value = l.src[start:l.offset]
+
+	case isIdentStart(ch):
+		for l.offset < len(l.src) {
+			r, _ := l.peek()
+			if !isIdentPart(r) {
+				break
+			}
+			l.advance()
+		}
+		tok.Type = TokIdent
+		tok.Value = l.src[start:l.offset]
+
+	case ch == ';':
+		l.advance()
+		tok.Type = TokSemicolon
+		tok.Value = ";"
+
+	default:
+		tok.Type = TokSymbol
+		tok.Value = l.readSymbol()
+		if tok.Value == "" {
+			return Token{}, errorAt(pos, "无法识别的字符 %q", ch)
+		}
+	}
+
+	tok.End = l.offset
+	return tok, nil
+}
+
+// peek 查看当前字符
+func (l *Lexer) peek() (rune, int) {
+	if l.offset >= len(l.src) {
+		return 0, 0
+	}
+	return utf8.DecodeRuneInString(l.src[l.offset:])
+}
+
+// peekAt 查看当前位置之后第 n 个字节
+func (l *Lexer) peekAt(n int) byte {
+	if l.offset+n >= len(l.src) {
+		return 0
+	}
+	return l.src[l.offset+n]
+}
+
+// advance 前进一个字符并维护行列号
+func (l *Lexer) advance() rune {
+	r, size := l.peek()
+	l.offset += size
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return r
+}
+
+// skipSpaceAndComments 跳过空白、-- 行注释和 /* */ 块注释
+func (l *Lexer) skipSpaceAndComments() error {
+	for l.offset < len(l.src) {
+		r, _ := l.peek()
+		switch {
+		case unicode.IsSpace(r):
+			l.advance()
+		case r == '-' && l.peekAt(1) == '-':
+			for l.offset < len(l.src) {
+				if l.advance() == '\n' {
+					break
+				}
+			}
+		case r == '/' && l.peekAt(1) == '*':
+			pos := Pos{Line: l.line, Column: l.column}
+			l.advance()
+			l.advance()
+			closed := false
+			for l.offset < len(l.src) {
+				if l.src[l.offset] == '*' && l.peekAt(1) == '/' {
+					l.advance()
+					l.advance()
+					closed = true
+					break
+				}
+				l.advance()
+			}
+			if !closed {
+				return errorAt(pos, "注释未结束")
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// readString 读取单引号字符串，两个连续的单引号表示一个单引号
+func (l *Lexer) readString() (string, error) {
+	pos := Pos{Line: l.line, Column: l.column}
+	l.advance() // 开头的引号
+
+	var sb strings.Builder
+	for l.offset < len(l.src) {
+		r := l.advance()
+		if r == '\'' {
+			if l.peekAt(0) == '\'' {
+				l.advance()
+				sb.WriteRune('\'')
+				continue
+			}
+			return sb.String(), nil
+		}
+		sb.WriteRune(r)
+	}
+	return "", errorAt(pos, "字符串未结束")
+}
+
+// readQuotedIdent 读取引号标识符，双引号内支持 JSON 风格的反斜杠转义
+func (l *Lexer) readQuotedIdent(quote rune) (string, error) {
+	pos := Pos{Line: l.line, Column: l.column}
+	start := l.offset
+	l.advance() // 开头的引号
+
+	escaped := false
+	for l.offset < len(l.src) {
+		r := l.advance()
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case r == quote:
+			raw := l.src[start:l.offset]
+			if quote == '`' {
+				return raw[1 : len(raw)-1], nil
+			}
+			var value string
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				return "", errorAt(pos, "无效的引号标识符 %s", raw)
+			}
+			return value, nil
+		}
+	}
+	return "", errorAt(pos, "引号标识符未结束")
+}
+
+// readNumber 读取数字；以数字开头但后接字母的单词按标识符处理（如数据库名 3d）
+func (l *Lexer) readNumber() TokenType {
+	for isDigit(l.peekAt(0)) {
+		l.advance()
+	}
+	if r, _ := l.peek(); isIdentStart(r) && r != 'e' && r != 'E' {
+		for l.offset < len(l.src) {
+			r, _ := l.peek()
+			if !isIdentPart(r) {
+				break
+			}
+			l.advance()
+		}
+		return TokIdent
+	}
+	if l.peekAt(0) == '.' && isDigit(l.peekAt(1)) {
+		l.advance()
+		for isDigit(l.peekAt(0)) {
+			l.advance()
+		}
+	}
+	if c := l.peekAt(0); c == 'e' || c == 'E' {
+		n := 1
+		if s := l.peekAt(1); s == '+' || s == '-' {
+			n = 2
+		}
+		if isDigit(l.peekAt(n)) {
+			for i := 0; i < n; i++ {
+				l.advance()
+			}
+			for isDigit(l.peekAt(0)) {
+				l.advance()
+			}
+		}
+	}
+	return TokNumber
+}
+
+// twoCharSymbols 由两个字符组成的运算符
+var twoCharSymbols = []string{"<=", ">=", "!=", "<>"}
+
+// readSymbol 读取运算符或标点
+func (l *Lexer) readSymbol() string {
+	rest := l.src[l.offset:]
+	for _, sym := range twoCharSymbols {
+		if strings.HasPrefix(rest, sym) {
+			l.advance()
+			l.advance()
+			return sym
+		}
+	}
+
+	r, _ := l.peek()
+	if r < utf8.RuneSelf && (unicode.IsPunct(r) || unicode.IsSymbol(r)) {
+		l.advance()
+		return string(r)
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"sudatas/internal/security"
 	"sudatas/internal/storage"
 )
 
@@ -21,11 +23,38 @@ type Statement struct {
 	DBType      storage.StorageType
 	Owner       string
 	Description string
+	IfNotExists bool
+	IfExists    bool
+	Role        string
+	User        string
+	Password    string   // CREATE USER / ALTER USER 的口令，不能写入日志
+	UserAction  string   // ALTER USER 的操作：PASSWORD、EXPIRE、LOCK 或 UNLOCK
+	Roles       []string // CREATE USER 或 GRANT/REVOKE ROLE 的角色
+	Privileges  []string // GRANT/REVOKE 的权限
+	Resource    string   // GRANT/REVOKE 的资源，形如 collection.database，可以含通配符 *
+	ToRole      bool     // GRANT/REVOKE 的对象是角色
+	GrantOption bool
+	Condition   string              // GRANT 的行级安全条件
+	PrivColumns map[string][]string // GRANT/DENY/REVOKE 中只作用于部分字段的权限及其字段
+	Deny        bool                // DENY：对字段的限制而不是授权
+	Mask        string              // DENY ... WITH MASK 的脱敏方式
+	Lockout     string              // CLEAR LOCKOUT 的对象类型：USER、IP 或空（全部）
+	Address     string              // CLEAR LOCKOUT IP 的地址
+	Token       string              // CREATE/DROP TOKEN 的令牌名称
+	TokenScope  []TokenScope        // CREATE TOKEN 的权限范围，为空表示用户的全部权限
+	TokenTTL    time.Duration       // CREATE TOKEN 的有效期，0 表示不过期
 	Columns     []string
 	Data        storage.Row
 	Filter      map[string]interface{}
-	Where       *storage.Condition
+	GroupBy     []string
+	Aggregates  []storage.Aggregate
+	Having      map[string]interface{}
+	OrderBy     []storage.SortKey
+	Limit       int
+	Offset      int
+	Where       *storage.Conditions // 由 Filter 解析出的条件树
 	FilePath    string
+	AST         Node // 语句对应的语法树
 }
 
 // NewSQLParser 创建新的SQL解析器
@@ -33,295 +62,2130 @@ func NewSQLParser() *SQLParser {
 	return &SQLParser{}
 }
 
-// Parse 解析SQL语句
+// Parse 解析单条SQL语句，末尾的分号可选
 func (p *SQLParser) Parse(sql string) (*Statement, error) {
-	// 简单的SQL解析实现
-	parts := strings.Fields(sql)
-	if len(parts) == 0 {
+	stmts, err := p.ParseAll(sql)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) == 0 {
 		return nil, fmt.Errorf("空SQL语句")
 	}
+	if len(stmts) > 1 {
+		return nil, errorAt(stmts[1].AST.Position(), "一次只能执行一条SQL语句")
+	}
+	return stmts[0], nil
+}
 
-	stmt := &Statement{}
-	stmt.Type = strings.ToUpper(parts[0])
+// ParseAll 解析以分号分隔的多条SQL语句
+func (p *SQLParser) ParseAll(sql string) ([]*Statement, error) {
+	tokens, err := NewLexer(sql).Tokenize()
+	if err != nil {
+		return nil, err
+	}
 
-	switch stmt.Type {
-	case "INSERT":
-		// INSERT INTO collection.database VALUES {...}
-		if len(parts) < 4 {
-			return nil, fmt.Errorf("无效的INSERT语句")
+	ps := &parser{src: sql, tokens: tokens}
+	var stmts []*Statement
+	for {
+		for ps.peek().Type == TokSemicolon {
+			ps.next()
 		}
-		if strings.ToUpper(parts[1]) != "INTO" {
-			return nil, fmt.Errorf("INSERT语句缺少INTO关键字")
+		if ps.peek().Type == TokEOF {
+			return stmts, nil
 		}
 
-		// 解析集合和数据库名称
-		names := strings.Split(parts[2], ".")
-		if len(names) != 2 {
-			return nil, fmt.Errorf("无效的数据库名称格式，应为: collection.database")
+		node, err := ps.parseStatement()
+		if err != nil {
+			return nil, err
 		}
-		stmt.Collection = names[0]
-		stmt.Database = names[1]
-
-		// 解析VALUES关键字
-		if strings.ToUpper(parts[3]) != "VALUES" {
-			return nil, fmt.Errorf("INSERT语句缺少VALUES关键字")
+		if tok := ps.peek(); tok.Type != TokSemicolon && tok.Type != TokEOF {
+			return nil, ps.unexpected(tok, "语句结尾")
 		}
 
-		// 解析JSON数据
-		jsonData := strings.Join(parts[4:], " ")
-		var data storage.Row
-		if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
-			return nil, fmt.Errorf("解析JSON数据失败: %w", err)
+		stmt, err := buildStatement(node)
+		if err != nil {
+			return nil, err
 		}
-		stmt.Data = data
+		stmts = append(stmts, stmt)
+	}
+}
 
-		return stmt, nil
+// parser 递归下降语法分析器
+type parser struct {
+	src    string
+	tokens []Token
+	pos    int
+
+	// 当前 SELECT 中聚合函数的结果字段名，用于解析 HAVING/ORDER BY 中的聚合引用
+	aggNames map[string]string
+	// HAVING/ORDER BY 中引用但未出现在选择列表中的聚合函数
+	extraAggs []*FuncCall
+}
+
+// peek 查看当前词法单元
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+// lookahead 查看当前位置之后第 n 个词法单元
+func (p *parser) lookahead(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+// next 读取当前词法单元并前进
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Type != TokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword 当前词法单元是否为指定关键字（不区分大小写）
+func (p *parser) isKeyword(kw string) bool {
+	tok := p.peek()
+	return tok.Type == TokIdent && strings.EqualFold(tok.Value, kw)
+}
+
+// acceptKeyword 如果当前词法单元是指定关键字则消费它
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectKeyword 消费指定关键字，否则报错
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.unexpected(p.peek(), kw)
+	}
+	return nil
+}
+
+// isSymbol 当前词法单元是否为指定符号
+func (p *parser) isSymbol(sym string) bool {
+	tok := p.peek()
+	return tok.Type == TokSymbol && tok.Value == sym
+}
+
+// expectSymbol 消费指定符号，否则报错
+func (p *parser) expectSymbol(sym string) error {
+	if !p.isSymbol(sym) {
+		return p.unexpected(p.peek(), fmt.Sprintf("%q", sym))
+	}
+	p.next()
+	return nil
+}
+
+// unexpected 构造"期望X，实际为Y"的错误
+func (p *parser) unexpected(tok Token, want string) error {
+	if tok.Type == TokEOF {
+		return errorAt(tok.Pos, "期望%s，但语句已结束", want)
+	}
+	return errorAt(tok.Pos, "期望%s，实际为%s %q", want, tok.Type, tok.Value)
+}
 
+// parseStatement 解析一条语句
+func (p *parser) parseStatement() (Node, error) {
+	tok := p.peek()
+	if tok.Type != TokIdent {
+		return nil, p.unexpected(tok, "SQL关键字")
+	}
+
+	switch strings.ToUpper(tok.Value) {
+	case "INSERT":
+		return p.parseInsert()
 	case "SELECT":
-		// SELECT * FROM collection.database WHERE {...}
-		if len(parts) < 4 {
-			return nil, fmt.Errorf("无效的SELECT语句")
+		return p.parseSelect()
+	case "UPDATE":
+		return p.parseUpdate()
+	case "DELETE":
+		return p.parseDelete()
+	case "CREATE":
+		return p.parseCreate()
+	case "DROP":
+		return p.parseDrop()
+	case "ALTER":
+		return p.parseAlter()
+	case "GRANT", "REVOKE", "DENY":
+		return p.parseGrant()
+	case "SHOW":
+		return p.parseShow()
+	case "IMPORT":
+		return p.parseImport()
+	case "EXPORT":
+		return p.parseExport()
+	case "BEGIN", "START", "COMMIT", "ROLLBACK":
+		return p.parseTransaction()
+	case "ROTATE":
+		return p.parseRotate()
+	case "CLEAR":
+		return p.parseClearLockout()
+	default:
+		return nil, errorAt(tok.Pos, "不支持的SQL语句: %s", tok.Value)
+	}
+}
+
+// parseInsert INSERT INTO collection.database VALUES {...}
+func (p *parser) parseInsert() (Node, error) {
+	stmt := &InsertStmt{Pos: p.next().Pos}
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+
+	pos := p.peek().Pos
+	value, err := p.parseJSON()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errorAt(pos, "VALUES 必须是JSON对象")
+	}
+	stmt.Values = data
+	return stmt, nil
+}
+
+// parseSelect SELECT * | item, ... FROM collection.database [WHERE ...]
+// [GROUP BY ... [HAVING ...]] [ORDER BY ...] [LIMIT n] [OFFSET m]
+func (p *parser) parseSelect() (Node, error) {
+	stmt := &SelectStmt{Pos: p.next().Pos}
+	p.aggNames = make(map[string]string)
+	p.extraAggs = nil
+	defer func() { p.aggNames = nil }()
+
+	if p.isSymbol("*") {
+		p.next()
+	} else {
+		for {
+			if p.isAggregateCall() {
+				fc, err := p.parseFuncCall()
+				if err != nil {
+					return nil, err
+				}
+				if p.acceptKeyword("AS") {
+					if fc.Alias, _, err = p.parseName("别名"); err != nil {
+						return nil, err
+					}
+				}
+				stmt.Aggregates = append(stmt.Aggregates, fc)
+				p.aggNames[aggregateOf(fc).Name()] = fc.Alias
+			} else {
+				name, _, err := p.parseField("字段名")
+				if err != nil {
+					return nil, err
+				}
+				stmt.Columns = append(stmt.Columns, name)
+			}
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
 		}
-		if strings.ToUpper(parts[2]) != "FROM" {
-			return nil, fmt.Errorf("SELECT语句缺少FROM关键字")
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.From = table
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseWhere(); err != nil {
+			return nil, err
 		}
+	}
 
-		// 解析列
-		if parts[1] == "*" {
-			stmt.Columns = nil // 表示所有列
-		} else {
-			stmt.Columns = strings.Split(parts[1], ",")
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			name, _, err := p.parseField("分组字段")
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, name)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
 		}
+	}
 
-		// 解析集合和数据库名称
-		names := strings.Split(parts[3], ".")
-		if len(names) != 2 {
-			return nil, fmt.Errorf("无效的数据库名称格式，应为: collection.database")
+	if p.isKeyword("HAVING") {
+		pos := p.next().Pos
+		if len(stmt.GroupBy) == 0 && len(stmt.Aggregates) == 0 {
+			return nil, errorAt(pos, "HAVING 只能用于分组或聚合查询")
+		}
+		if stmt.Having, err = p.parseWhere(); err != nil {
+			return nil, err
 		}
-		stmt.Collection = names[0]
-		stmt.Database = names[1]
+	}
 
-		// 解析WHERE子句
-		if len(parts) > 4 {
-			if strings.ToUpper(parts[4]) != "WHERE" {
-				return nil, fmt.Errorf("SELECT语句的WHERE子句无效")
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			pos := p.peek().Pos
+			name, err := p.parseResultField("排序字段")
+			if err != nil {
+				return nil, err
+			}
+			item := &OrderItem{Pos: pos, Column: name}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
 			}
-			// 解析JSON条件
-			jsonFilter := strings.Join(parts[5:], " ")
-			var filter map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonFilter), &filter); err != nil {
-				return nil, fmt.Errorf("解析WHERE条件失败: %w", err)
+			stmt.OrderBy = append(stmt.OrderBy, item)
+
+			if !p.isSymbol(",") {
+				break
 			}
-			stmt.Filter = filter
+			p.next()
 		}
+	}
 
-		return stmt, nil
+	if p.acceptKeyword("LIMIT") {
+		pos := p.peek().Pos
+		if stmt.Limit, err = p.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+		if stmt.Limit == 0 {
+			return nil, errorAt(pos, "LIMIT 必须大于0")
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.parseCount("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
 
-	case "CREATE":
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("无效的CREATE语句")
-		}
-		objectType := strings.ToUpper(parts[1])
-		switch objectType {
-		case "COLLECTION":
-			if len(parts) < 3 {
-				return nil, fmt.Errorf("缺少集合名称")
-			}
-			stmt.Type = "CREATE_COLLECTION"
-			stmt.Collection = parts[2]
-			stmt.Owner = "root" // 暂时使用默认用户
-			return stmt, nil
+	// HAVING/ORDER BY 引用的聚合函数也需要计算
+	stmt.Aggregates = append(stmt.Aggregates, p.extraAggs...)
+	return stmt, nil
+}
 
-		case "DATABASE":
-			if len(parts) < 3 {
-				return nil, fmt.Errorf("缺少数据库名称")
-			}
-			stmt.Type = "CREATE_DATABASE"
-			names := strings.Split(parts[2], ".")
-			if len(names) != 2 {
-				return nil, fmt.Errorf("无效的数据库名称格式，应为: collection.database")
-			}
-			stmt.Collection = names[0]
-			stmt.Database = names[1]
-
-			// 解析类型和描述
-			for i := 3; i < len(parts); i++ {
-				switch strings.ToUpper(parts[i]) {
-				case "TYPE":
-					if i+1 < len(parts) {
-						stmt.DBType = storage.StorageType(parts[i+1])
-						i++
-					}
-				case "DESCRIPTION":
-					if i+1 < len(parts) {
-						stmt.Description = strings.Trim(parts[i+1], "'")
-						i++
-					}
-				}
-			}
-			return stmt, nil
+// aggregateFuncs 支持的聚合函数名
+var aggregateFuncs = map[string]bool{
+	storage.AggCount: true,
+	storage.AggSum:   true,
+	storage.AggAvg:   true,
+	storage.AggMin:   true,
+	storage.AggMax:   true,
+}
 
-		default:
-			return nil, fmt.Errorf("不支持的CREATE类型: %s", objectType)
+// isAggregateCall 当前位置是否为聚合函数调用
+func (p *parser) isAggregateCall() bool {
+	tok := p.peek()
+	next := p.lookahead(1)
+	return tok.Type == TokIdent && aggregateFuncs[strings.ToUpper(tok.Value)] &&
+		next.Type == TokSymbol && next.Value == "("
+}
+
+// parseFuncCall 解析 FUNC([DISTINCT] field | *)
+func (p *parser) parseFuncCall() (*FuncCall, error) {
+	tok := p.next()
+	fc := &FuncCall{Pos: tok.Pos, Name: strings.ToUpper(tok.Value)}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	fc.Distinct = p.acceptKeyword("DISTINCT")
+	if p.isSymbol("*") {
+		p.next()
+		fc.Arg = "*"
+	} else {
+		name, _, err := p.parseField("字段名")
+		if err != nil {
+			return nil, err
 		}
+		fc.Arg = name
+	}
 
-	case "SHOW":
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("无效的SHOW语句")
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if err := aggregateOf(fc).Validate(); err != nil {
+		return nil, errorAt(fc.Pos, "%v", err)
+	}
+	return fc, nil
+}
+
+// parseResultField 解析引用查询结果的字段：普通字段或聚合函数（返回其结果字段名）
+func (p *parser) parseResultField(what string) (string, error) {
+	if !p.isAggregateCall() {
+		name, _, err := p.parseField(what)
+		return name, err
+	}
+
+	fc, err := p.parseFuncCall()
+	if err != nil {
+		return "", err
+	}
+	if p.aggNames == nil {
+		return "", errorAt(fc.Pos, "聚合函数只能用于 SELECT 语句")
+	}
+
+	name := aggregateOf(fc).Name()
+	alias, exists := p.aggNames[name]
+	if !exists {
+		// 未出现在选择列表中，作为额外的聚合结果计算
+		p.aggNames[name] = ""
+		p.extraAggs = append(p.extraAggs, fc)
+	}
+	if alias != "" {
+		return alias, nil
+	}
+	return name, nil
+}
+
+// aggregateOf 将聚合函数调用转换为存储层的聚合定义
+func aggregateOf(fc *FuncCall) storage.Aggregate {
+	return storage.Aggregate{
+		Func:     fc.Name,
+		Field:    fc.Arg,
+		Distinct: fc.Distinct,
+		Alias:    fc.Alias,
+	}
+}
+
+// parseCount 解析 LIMIT/OFFSET 后的非负整数
+func (p *parser) parseCount(clause string) (int, error) {
+	tok := p.next()
+	if tok.Type != TokNumber {
+		return 0, p.unexpected(tok, clause+" 数量")
+	}
+	n, err := strconv.Atoi(tok.Value)
+	if err != nil || n < 0 {
+		return 0, errorAt(tok.Pos, "%s 必须是非负整数: %s", clause, tok.Value)
+	}
+	return n, nil
+}
+
+// parseUpdate UPDATE collection.database SET field = value, ... [WHERE ...]
+func (p *parser) parseUpdate() (Node, error) {
+	stmt := &UpdateStmt{Pos: p.next().Pos}
+
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	if p.isSymbol("{") {
+		if stmt.Doc, err = p.parseLiteral(); err != nil {
+			return nil, err
 		}
-		switch strings.ToUpper(parts[1]) {
-		case "COLLECTIONS":
-			stmt.Type = "SHOW_COLLECTIONS"
-			return stmt, nil
-		case "DATABASES":
-			if len(parts) < 4 || strings.ToUpper(parts[2]) != "FROM" {
-				return nil, fmt.Errorf("无效的SHOW DATABASES语句")
+	} else {
+		for {
+			a, err := p.parseAssignment()
+			if err != nil {
+				return nil, err
 			}
-			stmt.Type = "SHOW_DATABASES"
-			stmt.Collection = parts[3]
-			return stmt, nil
-		default:
-			return nil, fmt.Errorf("不支持的SHOW类型: %s", parts[1])
+			stmt.Set = append(stmt.Set, a)
+
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
 		}
+	}
 
-	case "IMPORT":
-		// IMPORT FROM filepath
-		if len(parts) < 3 || strings.ToUpper(parts[1]) != "FROM" {
-			return nil, fmt.Errorf("无效的IMPORT语句")
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseWhere(); err != nil {
+			return nil, err
 		}
-		stmt.Type = "IMPORT"
-		stmt.FilePath = strings.Join(parts[2:], " ")
-		return stmt, nil
+	}
+	return stmt, nil
+}
 
-	case "EXPORT":
-		// EXPORT collection.database TO filepath
-		if len(parts) < 4 || strings.ToUpper(parts[2]) != "TO" {
-			return nil, fmt.Errorf("无效的EXPORT语句")
+// updateFuncs SET 中可用的函数及对应的更新运算符，第一个参数必须是被更新的字段
+var updateFuncs = map[string]string{
+	"APPEND":   storage.UpdPush,
+	"REMOVE":   storage.UpdPull,
+	"COALESCE": storage.UpdSetIfMissing,
+}
+
+// parseAssignment 解析 SET 中的一项：
+//
+//	field = value
+//	field = field + n | field - n | field * n
+//	field = APPEND(field, value) | REMOVE(field, value) | COALESCE(field, value)
+//	UNSET field
+func (p *parser) parseAssignment() (*Assignment, error) {
+	if p.isKeyword("UNSET") {
+		p.next()
+		name, pos, err := p.parseField("字段名")
+		if err != nil {
+			return nil, err
 		}
+		return &Assignment{Pos: pos, Column: name, Op: storage.UpdUnset}, nil
+	}
+
+	name, pos, err := p.parseField("字段名")
+	if err != nil {
+		return nil, err
+	}
+	a := &Assignment{Pos: pos, Column: name, Op: storage.UpdSet}
+	if err := p.expectSymbol("="); err != nil {
+		return nil, err
+	}
 
-		// 解析集合和数据库名称
-		names := strings.Split(parts[1], ".")
-		if len(names) != 2 {
-			return nil, fmt.Errorf("无效的数据库名称格式，应为: collection.database")
+	tok := p.peek()
+	if tok.Type != TokIdent && tok.Type != TokQuotedIdent {
+		a.Value, err = p.parseLiteral()
+		return a, err
+	}
+	switch strings.ToUpper(tok.Value) {
+	case "TRUE", "FALSE", "NULL":
+		if tok.Type == TokIdent {
+			a.Value, err = p.parseLiteral()
+			return a, err
 		}
-		stmt.Collection = names[0]
-		stmt.Database = names[1]
-		stmt.FilePath = strings.Join(parts[3:], " ")
-		return stmt, nil
+	}
 
-	case "UPDATE":
-		// UPDATE collection.database SET field = value WHERE {...}
-		if len(parts) < 4 {
-			return nil, fmt.Errorf("无效的UPDATE语句")
-		}
-
-		// 解析集合和数据库名称
-		names := strings.Split(parts[1], ".")
-		if len(names) != 2 {
-			return nil, fmt.Errorf("无效的数据库名称格式，应为: collection.database")
-		}
-		stmt.Collection = names[0]
-		stmt.Database = names[1]
-
-		// 查找 SET 和 WHERE 关键字的位置
-		setIndex := -1
-		whereIndex := -1
-		for i, part := range parts {
-			if strings.ToUpper(part) == "SET" {
-				setIndex = i
-			} else if strings.ToUpper(part) == "WHERE" {
-				whereIndex = i
-				break
-			}
+	// 函数形式
+	if op, ok := updateFuncs[strings.ToUpper(tok.Value)]; ok && tok.Type == TokIdent && p.lookahead(1).Value == "(" {
+		p.next()
+		p.next()
+		if err := p.expectSelfRef(name); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+		if a.Value, err = p.parseLiteral(); err != nil {
+			return nil, err
 		}
+		a.Op = op
+		return a, p.expectSymbol(")")
+	}
+
+	// 算术形式
+	if err := p.expectSelfRef(name); err != nil {
+		return nil, err
+	}
+	opTok := p.next()
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	n, ok := lit.Value.(float64)
+	if !ok {
+		return nil, errorAt(lit.Pos, "算术运算的操作数必须是数字")
+	}
+	switch {
+	case opTok.Type == TokSymbol && opTok.Value == "+":
+		a.Op = storage.UpdInc
+	case opTok.Type == TokSymbol && opTok.Value == "-":
+		a.Op = storage.UpdInc
+		lit.Value = -n
+	case opTok.Type == TokSymbol && opTok.Value == "*":
+		a.Op = storage.UpdMul
+	default:
+		return nil, p.unexpected(opTok, "+、- 或 *")
+	}
+	a.Value = lit
+	return a, nil
+}
+
+// expectSelfRef 解析SET右侧引用的字段，只能是被更新的字段本身
+func (p *parser) expectSelfRef(target string) error {
+	name, pos, err := p.parseField("字段名")
+	if err != nil {
+		return err
+	}
+	if name != target {
+		return errorAt(pos, "只能引用被更新的字段 %s，实际为 %s", target, name)
+	}
+	return nil
+}
+
+// parseDelete DELETE FROM collection.database [WHERE ...]
+func (p *parser) parseDelete() (Node, error) {
+	stmt := &DeleteStmt{Pos: p.next().Pos}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
 
-		if setIndex == -1 {
-			return nil, fmt.Errorf("UPDATE语句缺少SET子句")
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseWhere(); err != nil {
+			return nil, err
 		}
+	}
+	return stmt, nil
+}
 
-		// 解析SET子句
-		var updates = make(map[string]interface{})
-		setStr := strings.Join(parts[setIndex+1:whereIndex], " ")
+// parseCreate CREATE COLLECTION ... | CREATE DATABASE ... | CREATE ROLE ... | CREATE USER ...
+func (p *parser) parseCreate() (Node, error) {
+	pos := p.next().Pos
 
-		// 使用状态机解析SET子句
-		var key, value string
-		var inQuote bool
-		var current strings.Builder
+	switch {
+	case p.acceptKeyword("COLLECTION"):
+		stmt := &CreateCollectionStmt{Pos: pos}
+		ifNotExists, err := p.parseIfNotExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = ifNotExists
+		if stmt.Name, _, err = p.parseName("集合名称"); err != nil {
+			return nil, err
+		}
+		return stmt, nil
 
-		for i := 0; i < len(setStr); i++ {
-			ch := setStr[i]
+	case p.acceptKeyword("DATABASE"):
+		stmt := &CreateDatabaseStmt{Pos: pos}
+		ifNotExists, err := p.parseIfNotExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = ifNotExists
+		if stmt.Name, err = p.parseTableName(); err != nil {
+			return nil, err
+		}
 
-			switch ch {
-			case '\'':
-				inQuote = !inQuote
-				current.WriteByte(ch)
-			case '=':
-				if !inQuote {
-					key = strings.TrimSpace(current.String())
-					current.Reset()
-					continue
+		// TYPE 和 DESCRIPTION 顺序任意
+		for {
+			switch {
+			case p.acceptKeyword("TYPE"):
+				if stmt.Type, _, err = p.parseName("存储类型"); err != nil {
+					return nil, err
 				}
-				current.WriteByte(ch)
-			case ',':
-				if !inQuote {
-					value = strings.TrimSpace(current.String())
-					// 处理键值对
-					if key != "" {
-						// 处理字符串值（去除引号）
-						if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
-							value = value[1 : len(value)-1]
-						}
-						updates[key] = value
-					}
-					key = ""
-					current.Reset()
-					continue
+			case p.acceptKeyword("DESCRIPTION"):
+				tok := p.next()
+				if tok.Type != TokString {
+					return nil, p.unexpected(tok, "描述字符串")
 				}
-				current.WriteByte(ch)
+				stmt.Description = tok.Value
 			default:
-				current.WriteByte(ch)
+				return stmt, nil
 			}
 		}
 
-		// 处理最后一个键值对
-		if key != "" {
-			value = strings.TrimSpace(current.String())
-			if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
-				value = value[1 : len(value)-1]
+	case p.acceptKeyword("ROLE"):
+		stmt := &CreateRoleStmt{Pos: pos}
+		ifNotExists, err := p.parseIfNotExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = ifNotExists
+		if stmt.Name, _, err = p.parseName("角色名称"); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("DESCRIPTION") {
+			tok := p.next()
+			if tok.Type != TokString {
+				return nil, p.unexpected(tok, "描述字符串")
+			}
+			stmt.Description = tok.Value
+		}
+		return stmt, nil
+
+	case p.acceptKeyword("USER"):
+		stmt := &CreateUserStmt{Pos: pos}
+		ifNotExists, err := p.parseIfNotExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = ifNotExists
+		if stmt.Name, _, err = p.parseName("用户名称"); err != nil {
+			return nil, err
+		}
+		if stmt.Password, err = p.parsePassword(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("ROLE") {
+			if stmt.Roles, err = p.parseNameList("角色名称"); err != nil {
+				return nil, err
 			}
-			updates[key] = value
 		}
+		return stmt, nil
+
+	case p.acceptKeyword("TOKEN"):
+		return p.parseCreateToken(pos)
+
+	default:
+		tok := p.peek()
+		if tok.Type == TokEOF {
+			return nil, errorAt(tok.Pos, "无效的CREATE语句")
+		}
+		return nil, errorAt(tok.Pos, "不支持的CREATE类型: %s", tok.Value)
+	}
+}
+
+// parseDrop DROP ROLE [IF EXISTS] name | DROP USER [IF EXISTS] name
+func (p *parser) parseDrop() (Node, error) {
+	pos := p.next().Pos
+
+	switch {
+	case p.acceptKeyword("USER"):
+		stmt := &DropUserStmt{Pos: pos}
+		ifExists, err := p.parseIfExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfExists = ifExists
+		if stmt.Name, _, err = p.parseName("用户名称"); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+
+	case p.acceptKeyword("ROLE"):
+		stmt := &DropRoleStmt{Pos: pos}
+		ifExists, err := p.parseIfExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfExists = ifExists
+		if stmt.Name, _, err = p.parseName("角色名称"); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+
+	case p.acceptKeyword("TOKEN"):
+		stmt := &DropTokenStmt{Pos: pos}
+		ifExists, err := p.parseIfExists()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IfExists = ifExists
+		if stmt.Name, _, err = p.parseName("令牌名称"); err != nil {
+			return nil, err
+		}
+		if stmt.User, err = p.parseTokenOwner(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+
+	default:
+		tok := p.peek()
+		if tok.Type == TokEOF {
+			return nil, errorAt(tok.Pos, "无效的DROP语句")
+		}
+		return nil, errorAt(tok.Pos, "不支持的DROP类型: %s", tok.Value)
+	}
+}
+
+// parseIfNotExists 解析可选的 IF NOT EXISTS
+func (p *parser) parseIfNotExists() (bool, error) {
+	if !p.acceptKeyword("IF") {
+		return false, nil
+	}
+	if err := p.expectKeyword("NOT"); err != nil {
+		return false, err
+	}
+	if err := p.expectKeyword("EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseAlter ALTER USER name PASSWORD '...' | PASSWORD EXPIRE | LOCK | UNLOCK
+func (p *parser) parseAlter() (Node, error) {
+	pos := p.next().Pos
+	if err := p.expectKeyword("USER"); err != nil {
+		return nil, err
+	}
+
+	stmt := &AlterUserStmt{Pos: pos}
+	var err error
+	if stmt.Name, _, err = p.parseName("用户名称"); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isKeyword("PASSWORD") && strings.EqualFold(p.lookahead(1).Value, "EXPIRE") && p.lookahead(1).Type == TokIdent:
+		// 口令立即过期，用户下次登录后必须先修改口令
+		p.next()
+		p.next()
+		stmt.Action = "EXPIRE"
+	case p.isKeyword("PASSWORD"):
+		stmt.Action = "PASSWORD"
+		if stmt.Password, err = p.parsePassword(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("LOCK"):
+		stmt.Action = "LOCK"
+	case p.acceptKeyword("UNLOCK"):
+		stmt.Action = "UNLOCK"
+	default:
+		return nil, p.unexpected(p.peek(), "PASSWORD、PASSWORD EXPIRE、LOCK 或 UNLOCK")
+	}
+	return stmt, nil
+}
 
-		stmt.Data = updates
+// parseGrant 解析授权语句：
+//
+//	GRANT 权限[(字段, ...)][, ...] ON 资源 TO [USER|ROLE] name [WITH GRANT OPTION] [WHERE 条件]
+//	GRANT ROLE 角色[, ...] TO [USER] name
+//	DENY 权限(字段, ...)[, ...] ON 资源 TO [USER|ROLE] name [WITH MASK PARTIAL|HASH]
+//	REVOKE 权限[(字段, ...)][, ...] ON 资源 FROM [USER|ROLE] name
+//	REVOKE ROLE 角色[, ...] FROM [USER] name
+func (p *parser) parseGrant() (Node, error) {
+	tok := p.next()
+	stmt := &GrantStmt{
+		Pos:    tok.Pos,
+		Revoke: strings.EqualFold(tok.Value, "REVOKE"),
+		Deny:   strings.EqualFold(tok.Value, "DENY"),
+	}
+	target := "TO"
+	if stmt.Revoke {
+		target = "FROM"
+	}
 
-		// 解析WHERE子句
-		if whereIndex != -1 {
-			whereStr := strings.Join(parts[whereIndex+1:], " ")
-			// 构造简单的条件映射
-			filter := make(map[string]interface{})
-			// 解析 key = value 格式
-			whereParts := strings.Split(whereStr, "=")
-			if len(whereParts) != 2 {
-				return nil, fmt.Errorf("无效的WHERE子句格式")
+	var err error
+	if !stmt.Deny && p.acceptKeyword("ROLE") {
+		if stmt.Roles, err = p.parseNameList("角色名称"); err != nil {
+			return nil, err
+		}
+	} else {
+		if stmt.Privileges, stmt.Columns, err = p.parsePrivileges(); err != nil {
+			return nil, err
+		}
+		// DENY 只用于字段，每个权限都要列出字段
+		if stmt.Deny {
+			for _, privilege := range stmt.Privileges {
+				if len(stmt.Columns[privilege]) == 0 {
+					return nil, errorAt(tok.Pos, "DENY 只支持字段级限制，请在 %s 后列出字段", privilege)
+				}
 			}
-			key := strings.TrimSpace(whereParts[0])
-			value := strings.TrimSpace(whereParts[1])
+		}
+		if err := p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		if stmt.Resource, err = p.parseResourcePattern(); err != nil {
+			return nil, err
+		}
+	}
 
-			// 尝试将值转换为数字
-			if numVal, err := strconv.ParseFloat(value, 64); err == nil {
-				filter[key] = numVal
-			} else {
-				// 否则作为字符串处理
-				filter[key] = value
+	if err := p.expectKeyword(target); err != nil {
+		return nil, err
+	}
+	// USER/ROLE 后面还有名称时才是关键字，否则是用户名本身（如 TO user WITH GRANT OPTION）
+	next := p.lookahead(1)
+	isName := next.Type == TokIdent || next.Type == TokQuotedIdent || next.Type == TokNumber
+	if next.Type == TokIdent && strings.EqualFold(next.Value, "WITH") {
+		after := p.lookahead(2).Value
+		isName = !strings.EqualFold(after, "GRANT") && !strings.EqualFold(after, "MASK")
+	}
+	if isName {
+		switch {
+		case p.isKeyword("ROLE"):
+			if len(stmt.Roles) > 0 {
+				return nil, errorAt(p.peek().Pos, "不能把角色授予角色")
 			}
-			stmt.Filter = filter
+			p.next()
+			stmt.ToRole = true
+		case p.isKeyword("USER"):
+			p.next()
 		}
+	}
+	if stmt.Grantee, _, err = p.parseName("用户或角色名称"); err != nil {
+		return nil, err
+	}
 
+	// 字段脱敏，如 DENY SELECT (email) ON c.d TO ROLE readonly WITH MASK PARTIAL
+	if stmt.Deny {
+		if p.acceptKeyword("WITH") {
+			if err := p.expectKeyword("MASK"); err != nil {
+				return nil, err
+			}
+			tok := p.next()
+			stmt.Mask = strings.ToUpper(tok.Value)
+			if tok.Type != TokIdent || !security.ValidMask(stmt.Mask) {
+				return nil, p.unexpected(tok, "脱敏方式 PARTIAL 或 HASH")
+			}
+		}
 		return stmt, nil
+	}
 
-	default:
-		return nil, fmt.Errorf("不支持的SQL语句: %s", sql)
+	if !stmt.Revoke && len(stmt.Privileges) > 0 && p.acceptKeyword("WITH") {
+		if err := p.expectKeyword("GRANT"); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("OPTION"); err != nil {
+			return nil, err
+		}
+		stmt.GrantOption = true
 	}
 
-	return nil, fmt.Errorf("SQL语句解析失败")
+	// 行级安全条件，如 WHERE owner = $user
+	if !stmt.Revoke && len(stmt.Privileges) > 0 && p.acceptKeyword("WHERE") {
+		if stmt.Condition, err = p.parsePolicyText(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// dataPrivileges 可以通过 GRANT 授予的数据权限，ALL 表示全部
+var dataPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+
+// parsePrivileges 解析逗号分隔的权限列表：SELECT、INSERT、UPDATE、DELETE 或 ALL [PRIVILEGES]，
+// 每个权限后面可以用括号列出字段，表示只作用于这些字段
+func (p *parser) parsePrivileges() ([]string, map[string][]string, error) {
+	var privileges []string
+	var columns map[string][]string
+	for {
+		tok := p.next()
+		if tok.Type != TokIdent {
+			return nil, nil, p.unexpected(tok, "权限名称")
+		}
+		name := strings.ToUpper(tok.Value)
+		var names []string
+		switch name {
+		case "ALL":
+			p.acceptKeyword("PRIVILEGES")
+			names = dataPrivileges
+		case "SELECT", "INSERT", "UPDATE", "DELETE":
+			names = []string{name}
+		default:
+			return nil, nil, errorAt(tok.Pos, "不支持的权限: %s", tok.Value)
+		}
+		for _, name := range names {
+			for _, existing := range privileges {
+				if existing == name {
+					return nil, nil, errorAt(tok.Pos, "重复的权限: %s", name)
+				}
+			}
+		}
+		privileges = append(privileges, names...)
+
+		if p.isSymbol("(") {
+			fields, err := p.parseColumnList()
+			if err != nil {
+				return nil, nil, err
+			}
+			if columns == nil {
+				columns = make(map[string][]string)
+			}
+			for _, name := range names {
+				columns[name] = fields
+			}
+		}
+
+		if !p.isSymbol(",") {
+			return privileges, columns, nil
+		}
+		p.next()
+	}
+}
+
+// parseColumnList 解析括号中逗号分隔的字段列表
+func (p *parser) parseColumnList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var fields []string
+	for {
+		field, _, err := p.parseField("字段名")
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		if !p.isSymbol(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseResourcePattern 解析授权的资源 collection.database，两部分都可以含通配符 *，单独的 * 表示所有数据库
+func (p *parser) parseResourcePattern() (string, error) {
+	collection, pos, err := p.parsePatternPart("collection.database")
+	if err != nil {
+		return "", err
+	}
+	if !p.isSymbol(".") {
+		if collection == "*" {
+			return "*.*", nil
+		}
+		return "", errorAt(pos, "无效的资源名称格式，应为: collection.database")
+	}
+	p.next()
+	database, _, err := p.parsePatternPart("数据库名称")
+	if err != nil {
+		return "", err
+	}
+	return collection + "." + database, nil
+}
+
+// parsePatternPart 解析可以含通配符 * 的名称，名称和 * 之间不能有空白
+func (p *parser) parsePatternPart(what string) (string, Pos, error) {
+	first := p.peek()
+	var sb strings.Builder
+	end := -1
+	for {
+		tok := p.peek()
+		if end >= 0 && tok.Offset != end {
+			break
+		}
+		isName := tok.Type == TokIdent || tok.Type == TokQuotedIdent || tok.Type == TokNumber
+		if !isName && !(tok.Type == TokSymbol && tok.Value == "*") {
+			break
+		}
+		p.next()
+		sb.WriteString(tok.Value)
+		end = tok.End
+	}
+	if sb.Len() == 0 {
+		return "", first.Pos, p.unexpected(first, what)
+	}
+	return sb.String(), first.Pos, nil
+}
+
+// parsePassword 解析 PASSWORD '...'
+func (p *parser) parsePassword() (string, error) {
+	if err := p.expectKeyword("PASSWORD"); err != nil {
+		return "", err
+	}
+	tok := p.next()
+	if tok.Type != TokString {
+		return "", p.unexpected(tok, "口令字符串")
+	}
+	if tok.Value == "" {
+		return "", errorAt(tok.Pos, "口令不能为空")
+	}
+	return tok.Value, nil
+}
+
+// parseNameList 解析逗号分隔的名称列表
+func (p *parser) parseNameList(what string) ([]string, error) {
+	var names []string
+	for {
+		name, _, err := p.parseName(what)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.isSymbol(",") {
+			return names, nil
+		}
+		p.next()
+	}
+}
+
+// parseIfExists 解析可选的 IF EXISTS
+func (p *parser) parseIfExists() (bool, error) {
+	if !p.acceptKeyword("IF") {
+		return false, nil
+	}
+	if err := p.expectKeyword("EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseCreateToken CREATE TOKEN name [FOR [USER] u] [SCOPE 权限[, ...] ON 资源[, ...]] [EXPIRES IN n MINUTES|HOURS|DAYS]，
+// SCOPE 和 EXPIRES 顺序任意
+func (p *parser) parseCreateToken(pos Pos) (Node, error) {
+	stmt := &CreateTokenStmt{Pos: pos}
+	var err error
+	if stmt.Name, _, err = p.parseName("令牌名称"); err != nil {
+		return nil, err
+	}
+	if stmt.User, err = p.parseTokenOwner(); err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.isKeyword("SCOPE"):
+			tok := p.next()
+			if len(stmt.Scope) > 0 {
+				return nil, errorAt(tok.Pos, "重复的 SCOPE")
+			}
+			if stmt.Scope, err = p.parseTokenScope(); err != nil {
+				return nil, err
+			}
+		case p.isKeyword("EXPIRES"):
+			tok := p.next()
+			if stmt.TTL > 0 {
+				return nil, errorAt(tok.Pos, "重复的 EXPIRES")
+			}
+			if stmt.TTL, err = p.parseTokenTTL(); err != nil {
+				return nil, err
+			}
+		default:
+			return stmt, nil
+		}
+	}
+}
+
+// parseTokenOwner 解析可选的 FOR [USER] name，没有时返回空字符串
+func (p *parser) parseTokenOwner() (string, error) {
+	if !p.acceptKeyword("FOR") {
+		return "", nil
+	}
+	// USER 后面还有名称时才是关键字，否则是用户名本身
+	if p.isKeyword("USER") {
+		next := p.lookahead(1)
+		if next.Type == TokIdent || next.Type == TokQuotedIdent || next.Type == TokNumber {
+			p.next()
+		}
+	}
+	name, _, err := p.parseName("用户名称")
+	return name, err
+}
+
+// parseTokenScope 解析逗号分隔的 权限[, ...] ON 资源。令牌的权限范围只支持整个数据库
+func (p *parser) parseTokenScope() ([]TokenScope, error) {
+	var scope []TokenScope
+	for {
+		start := p.peek()
+		privileges, columns, err := p.parsePrivileges()
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) > 0 {
+			return nil, errorAt(start.Pos, "令牌的权限范围不支持字段")
+		}
+		if err := p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		resource, err := p.parseResourcePattern()
+		if err != nil {
+			return nil, err
+		}
+		scope = append(scope, TokenScope{Privileges: privileges, Resource: resource})
+
+		if !p.isSymbol(",") {
+			return scope, nil
+		}
+		p.next()
+	}
+}
+
+// parseTokenTTL 解析 IN n MINUTES|HOURS|DAYS
+func (p *parser) parseTokenTTL() (time.Duration, error) {
+	if err := p.expectKeyword("IN"); err != nil {
+		return 0, err
+	}
+	tok := p.next()
+	if tok.Type != TokNumber {
+		return 0, p.unexpected(tok, "有效期")
+	}
+	n, err := strconv.Atoi(tok.Value)
+	if err != nil || n <= 0 {
+		return 0, errorAt(tok.Pos, "无效的有效期: %s", tok.Value)
+	}
+
+	unit := p.next()
+	if unit.Type == TokIdent {
+		switch strings.ToUpper(unit.Value) {
+		case "MINUTE", "MINUTES":
+			return time.Duration(n) * time.Minute, nil
+		case "HOUR", "HOURS":
+			return time.Duration(n) * time.Hour, nil
+		case "DAY", "DAYS":
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	return 0, p.unexpected(unit, "MINUTES、HOURS 或 DAYS")
+}
+
+// parseShow SHOW COLLECTIONS | SHOW DATABASES FROM collection | SHOW KEYS | SHOW LOCKOUTS | SHOW TOKENS [FOR [USER] name]
+func (p *parser) parseShow() (Node, error) {
+	pos := p.next().Pos
+
+	switch {
+	case p.acceptKeyword("COLLECTIONS"):
+		return &ShowCollectionsStmt{Pos: pos}, nil
+
+	case p.acceptKeyword("KEYS"):
+		return &ShowKeysStmt{Pos: pos}, nil
+
+	case p.acceptKeyword("LOCKOUTS"):
+		return &ShowLockoutsStmt{Pos: pos}, nil
+
+	case p.acceptKeyword("TOKENS"):
+		user, err := p.parseTokenOwner()
+		if err != nil {
+			return nil, err
+		}
+		return &ShowTokensStmt{Pos: pos, User: user}, nil
+
+	case p.acceptKeyword("DATABASES"):
+		if err := p.expectKeyword("FROM"); err != nil {
+			return nil, err
+		}
+		name, _, err := p.parseName("集合名称")
+		if err != nil {
+			return nil, err
+		}
+		return &ShowDatabasesStmt{Pos: pos, Collection: name}, nil
+
+	default:
+		tok := p.peek()
+		if tok.Type == TokEOF {
+			return nil, errorAt(tok.Pos, "无效的SHOW语句")
+		}
+		return nil, errorAt(tok.Pos, "不支持的SHOW类型: %s", tok.Value)
+	}
+}
+
+// parseRotate ROTATE KEY
+func (p *parser) parseRotate() (Node, error) {
+	pos := p.next().Pos
+	if err := p.expectKeyword("KEY"); err != nil {
+		return nil, err
+	}
+	return &RotateKeyStmt{Pos: pos}, nil
+}
+
+// parseClearLockout CLEAR LOCKOUT[S] [USER name | IP 'address']，不指定对象时清除全部
+func (p *parser) parseClearLockout() (Node, error) {
+	pos := p.next().Pos
+	if !p.acceptKeyword("LOCKOUT") && !p.acceptKeyword("LOCKOUTS") {
+		return nil, p.unexpected(p.peek(), "LOCKOUT")
+	}
+
+	stmt := &ClearLockoutStmt{Pos: pos}
+	switch {
+	case p.acceptKeyword("USER"):
+		stmt.Kind = "USER"
+		name, _, err := p.parseName("用户名")
+		if err != nil {
+			return nil, err
+		}
+		stmt.Name = name
+	case p.acceptKeyword("IP"):
+		stmt.Kind = "IP"
+		tok := p.next()
+		if tok.Type != TokString || tok.Value == "" {
+			return nil, p.unexpected(tok, "用引号括起的 IP 地址")
+		}
+		stmt.Name = tok.Value
+	}
+	return stmt, nil
+}
+
+// parseImport IMPORT FROM filepath TO collection
+func (p *parser) parseImport() (Node, error) {
+	stmt := &ImportStmt{Pos: p.next().Pos}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+
+	path, err := p.parsePath(true)
+	if err != nil {
+		return nil, err
+	}
+	stmt.Path = path
+
+	if err := p.expectKeyword("TO"); err != nil {
+		return nil, err
+	}
+	if stmt.Target, _, err = p.parseName("目标集合名称"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseExport EXPORT collection.database TO filepath
+func (p *parser) parseExport() (Node, error) {
+	stmt := &ExportStmt{Pos: p.next().Pos}
+
+	table, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+
+	if err := p.expectKeyword("TO"); err != nil {
+		return nil, err
+	}
+	if stmt.Path, err = p.parsePath(false); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseTransaction 解析 BEGIN [TRANSACTION|WORK]、START TRANSACTION、COMMIT [WORK]、ROLLBACK [WORK]
+func (p *parser) parseTransaction() (Node, error) {
+	tok := p.next()
+	stmt := &TransactionStmt{Pos: tok.Pos, Action: strings.ToUpper(tok.Value)}
+
+	switch stmt.Action {
+	case "START":
+		stmt.Action = "BEGIN"
+		if err := p.expectKeyword("TRANSACTION"); err != nil {
+			return nil, err
+		}
+	case "BEGIN":
+		if !p.acceptKeyword("TRANSACTION") {
+			p.acceptKeyword("WORK")
+		}
+	default:
+		p.acceptKeyword("WORK")
+	}
+	return stmt, nil
+}
+
+// parseName 解析名称：标识符、引号标识符或纯数字（如数据库名 0）
+func (p *parser) parseName(what string) (string, Pos, error) {
+	tok := p.peek()
+	switch tok.Type {
+	case TokIdent, TokQuotedIdent, TokNumber:
+		p.next()
+		return tok.Value, tok.Pos, nil
+	}
+	return "", tok.Pos, p.unexpected(tok, what)
+}
+
+// parseField 解析字段路径：名称之后可以跟 .name 或 [n]，如 author.name、tags[0]
+func (p *parser) parseField(what string) (string, Pos, error) {
+	name, pos, err := p.parseName(what)
+	if err != nil {
+		return "", pos, err
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	for {
+		switch {
+		case p.isSymbol("."):
+			p.next()
+			key, _, err := p.parseName("字段名")
+			if err != nil {
+				return "", pos, err
+			}
+			b.WriteString("." + key)
+			continue
+
+		case p.isSymbol("["):
+			p.next()
+			index := p.next()
+			if index.Type != TokNumber {
+				return "", pos, p.unexpected(index, "数组下标")
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return "", pos, err
+			}
+			b.WriteString("[" + index.Value + "]")
+			continue
+		}
+		break
+	}
+
+	if b.Len() == len(name) {
+		return name, pos, nil
+	}
+	path, err := storage.ParsePath(b.String())
+	if err != nil {
+		return "", pos, errorAt(pos, "%v", err)
+	}
+	return path.String(), pos, nil
+}
+
+// parseTableName 解析 collection.database
+func (p *parser) parseTableName() (TableName, error) {
+	collection, pos, err := p.parseName("collection.database")
+	if err != nil {
+		return TableName{}, err
+	}
+	if !p.isSymbol(".") {
+		return TableName{}, errorAt(pos, "无效的数据库名称格式，应为: collection.database")
+	}
+	p.next()
+	database, _, err := p.parseName("数据库名称")
+	if err != nil {
+		return TableName{}, err
+	}
+	return TableName{Pos: pos, Collection: collection, Database: database}, nil
+}
+
+// parsePath 解析文件路径：字符串字面量，或直到 TO/语句结尾的原始文本
+func (p *parser) parsePath(stopAtTo bool) (string, error) {
+	first := p.peek()
+	if first.Type == TokString {
+		p.next()
+		return first.Value, nil
+	}
+
+	var last *Token
+	for {
+		tok := p.peek()
+		if tok.Type == TokEOF || tok.Type == TokSemicolon || (stopAtTo && p.isKeyword("TO")) {
+			break
+		}
+		tok = p.next()
+		last = &tok
+	}
+	if last == nil {
+		return "", p.unexpected(first, "文件路径")
+	}
+	return p.src[first.Offset:last.End], nil
+}
+
+// parseJSON 解析 {...} 或 [...] 形式的JSON文档
+func (p *parser) parseJSON() (interface{}, error) {
+	start := p.peek()
+	if start.Type != TokSymbol || (start.Value != "{" && start.Value != "[") {
+		return nil, p.unexpected(start, "JSON数据")
+	}
+
+	depth := 0
+	for {
+		tok := p.next()
+		if tok.Type == TokEOF {
+			return nil, errorAt(start.Pos, "JSON数据未结束")
+		}
+		if tok.Type != TokSymbol {
+			continue
+		}
+		switch tok.Value {
+		case "{", "[":
+			depth++
+		case "}", "]":
+			depth--
+		}
+		if depth == 0 {
+			var value interface{}
+			if err := json.Unmarshal([]byte(p.src[start.Offset:tok.End]), &value); err != nil {
+				return nil, errorAt(start.Pos, "解析JSON数据失败: %v", err)
+			}
+			return value, nil
+		}
+	}
+}
+
+// parseLiteral 解析字面量：字符串、数字、TRUE/FALSE/NULL 或 JSON
+func (p *parser) parseLiteral() (*Literal, error) {
+	tok := p.peek()
+	lit := &Literal{Pos: tok.Pos}
+
+	switch tok.Type {
+	case TokString:
+		p.next()
+		lit.Value = tok.Value
+		return lit, nil
+
+	case TokNumber:
+		p.next()
+		return lit, p.parseNumber(tok, lit, false)
+
+	case TokIdent:
+		switch strings.ToUpper(tok.Value) {
+		case "TRUE":
+			lit.Value = true
+		case "FALSE":
+			lit.Value = false
+		case "NULL":
+			lit.Value = nil
+		default:
+			return nil, p.unexpected(tok, "字面量")
+		}
+		p.next()
+		return lit, nil
+
+	case TokSymbol:
+		switch tok.Value {
+		case "-":
+			p.next()
+			num := p.next()
+			if num.Type != TokNumber {
+				return nil, p.unexpected(num, "数字")
+			}
+			return lit, p.parseNumber(num, lit, true)
+		case "{", "[":
+			value, err := p.parseJSON()
+			if err != nil {
+				return nil, err
+			}
+			lit.Value = value
+			return lit, nil
+		}
+	}
+	return nil, p.unexpected(tok, "字面量")
+}
+
+// parseNumber 将数字词法单元转换为 float64（与JSON解码后的数字类型一致）
+func (p *parser) parseNumber(tok Token, lit *Literal, negative bool) error {
+	f, err := strconv.ParseFloat(tok.Value, 64)
+	if err != nil {
+		return errorAt(tok.Pos, "无效的数字: %s", tok.Value)
+	}
+	if negative {
+		f = -f
+	}
+	lit.Value = f
+	return nil
+}
+
+// parseWhere 解析WHERE条件，优先级从低到高为 OR、AND、NOT：
+//
+//	orExpr  := andExpr { OR andExpr }
+//	andExpr := notExpr { AND notExpr }
+//	notExpr := NOT notExpr | [NOT] EXISTS field | '(' orExpr ')' | JSON对象 | 比较表达式
+func (p *parser) parseWhere() (Expr, error) {
+	left, err := p.parseAndExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		pos := p.next().Pos
+		right, err := p.parseAndExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: pos, Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAndExpr 解析以 AND 连接的条件
+func (p *parser) parseAndExpr() (Expr, error) {
+	left, err := p.parseNotExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		pos := p.next().Pos
+		right, err := p.parseNotExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Pos: pos, Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseNotExpr 解析 NOT、EXISTS、括号分组、JSON过滤器或单个比较
+func (p *parser) parseNotExpr() (Expr, error) {
+	switch {
+	case p.isKeyword("NOT") && strings.EqualFold(p.lookahead(1).Value, "EXISTS"):
+		pos := p.next().Pos
+		p.next()
+		return p.parseExists(pos, storage.OpNotExists)
+
+	case p.isKeyword("EXISTS"):
+		return p.parseExists(p.next().Pos, storage.OpExists)
+
+	case p.isKeyword("NOT"):
+		pos := p.next().Pos
+		x, err := p.parseNotExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Pos: pos, Op: "NOT", X: x}, nil
+
+	case p.isSymbol("("):
+		p.next()
+		x, err := p.parseWhere()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	case p.isSymbol("{"):
+		return p.parseLiteral()
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps 支持的比较运算符
+var comparisonOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	">":  ">",
+	"<=": "<=",
+	">=": ">=",
+}
+
+// parseExists 解析 EXISTS 之后的字段名，字段名两侧的括号可以省略
+func (p *parser) parseExists(pos Pos, op string) (Expr, error) {
+	paren := p.isSymbol("(")
+	if paren {
+		p.next()
+	}
+	tok := p.peek()
+	name, _, err := p.parseField("字段名")
+	if err != nil {
+		return nil, err
+	}
+	if paren {
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	return &PredicateExpr{Pos: pos, Op: op, Column: &ColumnRef{Pos: tok.Pos, Name: name}}, nil
+}
+
+// parseComparison 解析 operand op operand 或 field [NOT] IN/LIKE/ILIKE/REGEXP/BETWEEN/CONTAINS ...、field IS [NOT] NULL
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Type == TokIdent {
+		return p.parsePredicate(left)
+	}
+	op, ok := comparisonOps[tok.Value]
+	if tok.Type != TokSymbol || !ok {
+		return nil, p.unexpected(tok, "比较运算符")
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Pos: tok.Pos, Op: op, Left: left, Right: right}, nil
+}
+
+// parsePredicate 解析字段之后以关键字开头的谓词
+func (p *parser) parsePredicate(left Expr) (Expr, error) {
+	col, ok := left.(*ColumnRef)
+	if !ok {
+		return nil, errorAt(left.Position(), "谓词的左侧必须是字段")
+	}
+
+	tok := p.next()
+	pred := &PredicateExpr{Pos: tok.Pos, Column: col}
+	keyword := strings.ToUpper(tok.Value)
+
+	if keyword == "IS" {
+		pred.Op = storage.OpIsNull
+		if p.acceptKeyword("NOT") {
+			pred.Op = storage.OpIsNotNull
+		}
+		return pred, p.expectKeyword("NULL")
+	}
+
+	negated := false
+	if keyword == "NOT" {
+		negated = true
+		tok = p.next()
+		keyword = strings.ToUpper(tok.Value)
+	}
+
+	switch keyword {
+	case "IN":
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		for {
+			lit, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			pred.Args = append(pred.Args, lit)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+
+	case "LIKE", "ILIKE", "REGEXP":
+		pattern := p.peek()
+		if pattern.Type != TokString {
+			return nil, p.unexpected(pattern, "字符串模式")
+		}
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		pred.Args = []Expr{lit}
+
+	case "BETWEEN":
+		low, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		pred.Args = []Expr{low, high}
+
+	case "CONTAINS":
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		pred.Args = []Expr{lit}
+
+	default:
+		return nil, p.unexpected(tok, "比较运算符")
+	}
+
+	pred.Op = keyword
+	if negated {
+		pred.Op = "NOT " + keyword
+	}
+	return pred, nil
+}
+
+// parseOperand 解析比较运算的操作数：字段引用或字面量
+func (p *parser) parseOperand() (Expr, error) {
+	tok := p.peek()
+	switch tok.Type {
+	case TokQuotedIdent:
+		p.next()
+		return &ColumnRef{Pos: tok.Pos, Name: tok.Value}, nil
+	case TokIdent:
+		switch strings.ToUpper(tok.Value) {
+		case "TRUE", "FALSE", "NULL":
+			return p.parseLiteral()
+		}
+		name, err := p.parseResultField("字段名")
+		if err != nil {
+			return nil, err
+		}
+		return &ColumnRef{Pos: tok.Pos, Name: name}, nil
+	}
+	return p.parseLiteral()
+}
+
+// buildStatement 由语法树构造执行用的 Statement
+func buildStatement(node Node) (*Statement, error) {
+	stmt := &Statement{AST: node}
+
+	switch n := node.(type) {
+	case *InsertStmt:
+		stmt.Type = "INSERT"
+		stmt.Collection = n.Table.Collection
+		stmt.Database = n.Table.Database
+		stmt.Data = n.Values
+
+	case *SelectStmt:
+		stmt.Type = "SELECT"
+		stmt.Collection = n.From.Collection
+		stmt.Database = n.From.Database
+		stmt.Columns = n.Columns
+		filter, err := whereToFilter(n.Where)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Filter = filter
+		if err := buildGrouping(stmt, n); err != nil {
+			return nil, err
+		}
+		for _, item := range n.OrderBy {
+			stmt.OrderBy = append(stmt.OrderBy, storage.SortKey{Field: item.Column, Desc: item.Desc})
+		}
+		stmt.Limit = n.Limit
+		stmt.Offset = n.Offset
+
+	case *UpdateStmt:
+		stmt.Type = "UPDATE"
+		stmt.Collection = n.Table.Collection
+		stmt.Database = n.Table.Database
+		data, err := updateDocument(n)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Data = data
+		filter, err := whereToFilter(n.Where)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Filter = filter
+
+	case *DeleteStmt:
+		stmt.Type = "DELETE"
+		stmt.Collection = n.Table.Collection
+		stmt.Database = n.Table.Database
+		filter, err := whereToFilter(n.Where)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Filter = filter
+
+	case *CreateCollectionStmt:
+		stmt.Type = "CREATE_COLLECTION"
+		stmt.Collection = n.Name
+		stmt.IfNotExists = n.IfNotExists
+		stmt.Owner = "root" // 暂时使用默认用户
+
+	case *CreateDatabaseStmt:
+		stmt.Type = "CREATE_DATABASE"
+		stmt.Collection = n.Name.Collection
+		stmt.Database = n.Name.Database
+		stmt.IfNotExists = n.IfNotExists
+		stmt.DBType = storage.StorageType(n.Type)
+		stmt.Description = n.Description
+
+	case *CreateRoleStmt:
+		stmt.Type = "CREATE_ROLE"
+		stmt.Role = n.Name
+		stmt.IfNotExists = n.IfNotExists
+		stmt.Description = n.Description
+
+	case *DropRoleStmt:
+		stmt.Type = "DROP_ROLE"
+		stmt.Role = n.Name
+		stmt.IfExists = n.IfExists
+
+	case *CreateUserStmt:
+		stmt.Type = "CREATE_USER"
+		stmt.User = n.Name
+		stmt.IfNotExists = n.IfNotExists
+		stmt.Password = n.Password
+		stmt.Roles = n.Roles
+
+	case *AlterUserStmt:
+		stmt.Type = "ALTER_USER"
+		stmt.User = n.Name
+		stmt.UserAction = n.Action
+		stmt.Password = n.Password
+
+	case *DropUserStmt:
+		stmt.Type = "DROP_USER"
+		stmt.User = n.Name
+		stmt.IfExists = n.IfExists
+
+	case *GrantStmt:
+		stmt.Type = "GRANT"
+		if n.Revoke {
+			stmt.Type = "REVOKE"
+		}
+		stmt.Privileges = n.Privileges
+		stmt.Resource = n.Resource
+		stmt.Roles = n.Roles
+		stmt.ToRole = n.ToRole
+		stmt.GrantOption = n.GrantOption
+		stmt.Condition = n.Condition
+		stmt.PrivColumns = n.Columns
+		stmt.Deny = n.Deny
+		stmt.Mask = n.Mask
+		if n.ToRole {
+			stmt.Role = n.Grantee
+		} else {
+			stmt.User = n.Grantee
+		}
+
+	case *ShowCollectionsStmt:
+		stmt.Type = "SHOW_COLLECTIONS"
+
+	case *ShowDatabasesStmt:
+		stmt.Type = "SHOW_DATABASES"
+		stmt.Collection = n.Collection
+
+	case *ShowKeysStmt:
+		stmt.Type = "SHOW_KEYS"
+
+	case *RotateKeyStmt:
+		stmt.Type = "ROTATE_KEY"
+
+	case *ShowLockoutsStmt:
+		stmt.Type = "SHOW_LOCKOUTS"
+
+	case *ClearLockoutStmt:
+		stmt.Type = "CLEAR_LOCKOUT"
+		stmt.Lockout = n.Kind
+		if n.Kind == "USER" {
+			stmt.User = n.Name
+		} else {
+			stmt.Address = n.Name
+		}
+
+	case *CreateTokenStmt:
+		stmt.Type = "CREATE_TOKEN"
+		stmt.Token = n.Name
+		stmt.User = n.User
+		stmt.TokenScope = n.Scope
+		stmt.TokenTTL = n.TTL
+
+	case *DropTokenStmt:
+		stmt.Type = "DROP_TOKEN"
+		stmt.Token = n.Name
+		stmt.User = n.User
+		stmt.IfExists = n.IfExists
+
+	case *ShowTokensStmt:
+		stmt.Type = "SHOW_TOKENS"
+		stmt.User = n.User
+
+	case *TransactionStmt:
+		stmt.Type = n.Action
+
+	case *ImportStmt:
+		stmt.Type = "IMPORT"
+		stmt.FilePath = n.Path
+		stmt.Collection = n.Target
+
+	case *ExportStmt:
+		stmt.Type = "EXPORT"
+		stmt.Collection = n.Table.Collection
+		stmt.Database = n.Table.Database
+		stmt.FilePath = n.Path
+
+	default:
+		return nil, fmt.Errorf("不支持的语法树节点: %T", node)
+	}
+
+	if stmt.Filter != nil {
+		where, err := storage.ParseConditions(stmt.Filter)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+
+	return stmt, nil
+}
+
+// updateDocument 将 SET 子句转换为存储层的更新文档：直接赋值的字段放在顶层，其余按运算符分组
+func updateDocument(n *UpdateStmt) (storage.Row, error) {
+	doc := make(storage.Row)
+	if n.Doc != nil {
+		obj, ok := n.Doc.Value.(map[string]interface{})
+		if !ok {
+			return nil, errorAt(n.Doc.Pos, "SET 之后的JSON必须是对象")
+		}
+		doc = obj
+	} else {
+		seen := make(map[string]bool)
+		for _, a := range n.Set {
+			if seen[a.Column] {
+				return nil, errorAt(a.Pos, "字段 %s 在 SET 中出现了多次", a.Column)
+			}
+			seen[a.Column] = true
+
+			var value interface{}
+			if a.Value != nil {
+				value = a.Value.(*Literal).Value
+			}
+			if a.Op == storage.UpdSet {
+				doc[a.Column] = value
+				continue
+			}
+			fields, _ := doc[a.Op].(map[string]interface{})
+			if fields == nil {
+				fields = make(map[string]interface{})
+				doc[a.Op] = fields
+			}
+			fields[a.Column] = value
+		}
+	}
+
+	if _, err := storage.ParseUpdate(doc); err != nil {
+		return nil, errorAt(n.Pos, "%v", err)
+	}
+	return doc, nil
+}
+
+// buildGrouping 填充分组聚合相关字段，并检查非聚合字段是否都出现在 GROUP BY 中
+func buildGrouping(stmt *Statement, n *SelectStmt) error {
+	if len(n.GroupBy) == 0 && len(n.Aggregates) == 0 {
+		return nil
+	}
+
+	grouped := make(map[string]bool)
+	for _, field := range n.GroupBy {
+		grouped[field] = true
+	}
+	for _, col := range n.Columns {
+		if !grouped[col] {
+			return errorAt(n.Pos, "字段 %s 必须出现在 GROUP BY 中或用于聚合函数", col)
+		}
+	}
+
+	stmt.GroupBy = n.GroupBy
+	for _, fc := range n.Aggregates {
+		stmt.Aggregates = append(stmt.Aggregates, aggregateOf(fc))
+	}
+
+	having, err := whereToFilter(n.Having)
+	if err != nil {
+		return err
+	}
+	stmt.Having = having
+	return nil
+}
+
+// whereToFilter 将WHERE表达式转换为存储层使用的过滤条件。
+// AND 连接的条件在字段互不重复时合并为一个过滤器，否则使用 $and；OR 和 NOT 分别转换为 $or 和 $not。
+func whereToFilter(expr Expr) (map[string]interface{}, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	switch e := expr.(type) {
+	case *Literal:
+		filter, ok := e.Value.(map[string]interface{})
+		if !ok {
+			return nil, errorAt(e.Pos, "WHERE条件必须是JSON对象或比较表达式")
+		}
+		if _, err := storage.ParseConditions(filter); err != nil {
+			return nil, errorAt(e.Pos, "%v", err)
+		}
+		return filter, nil
+
+	case *PredicateExpr:
+		return predicateToFilter(e)
+
+	case *UnaryExpr:
+		x, err := whereToFilter(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{storage.OpNot: x}, nil
+
+	case *BinaryExpr:
+		switch e.Op {
+		case "AND":
+			return logicalToFilter(e, storage.OpAnd)
+		case "OR":
+			return logicalToFilter(e, storage.OpOr)
+		}
+		return comparisonToFilter(e)
+	}
+
+	return nil, errorAt(expr.Position(), "无效的WHERE条件")
+}
+
+// logicalToFilter 将同一运算符连接的一串条件转换为过滤器
+func logicalToFilter(e *BinaryExpr, op string) (map[string]interface{}, error) {
+	var operands []Expr
+	flattenLogical(e, e.Op, &operands)
+
+	subs := make([]interface{}, 0, len(operands))
+	for _, operand := range operands {
+		sub, err := whereToFilter(operand)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	if op == storage.OpAnd {
+		// 字段互不重复时直接合并，保持过滤器简洁
+		merged := make(map[string]interface{})
+		for _, sub := range subs {
+			for k, v := range sub.(map[string]interface{}) {
+				if _, exists := merged[k]; exists {
+					return map[string]interface{}{storage.OpAnd: subs}, nil
+				}
+				merged[k] = v
+			}
+		}
+		return merged, nil
+	}
+	return map[string]interface{}{op: subs}, nil
+}
+
+// flattenLogical 将左结合的 a op b op c 展开为操作数列表
+func flattenLogical(expr Expr, op string, out *[]Expr) {
+	if b, ok := expr.(*BinaryExpr); ok && b.Op == op {
+		flattenLogical(b.Left, op, out)
+		flattenLogical(b.Right, op, out)
+		return
+	}
+	*out = append(*out, expr)
+}
+
+// flippedOps 交换操作数位置后对应的运算符
+var flippedOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  ">",
+	">":  "<",
+	"<=": ">=",
+	">=": "<=",
+}
+
+// comparisonToFilter 将 field op value 转换为过滤条件
+func comparisonToFilter(e *BinaryExpr) (map[string]interface{}, error) {
+	col, colOK := e.Left.(*ColumnRef)
+	lit, litOK := e.Right.(*Literal)
+	op := e.Op
+	if !colOK || !litOK {
+		// 支持 value op field 的写法
+		col, colOK = e.Right.(*ColumnRef)
+		lit, litOK = e.Left.(*Literal)
+		op = flippedOps[e.Op]
+	}
+	if !colOK || !litOK {
+		return nil, errorAt(e.Pos, "比较运算必须是字段与字面量之间")
+	}
+
+	// 对象值要写成完整形式，以免被当作 {"operator", "value"} 条件
+	if _, isObject := lit.Value.(map[string]interface{}); op == "=" && !isObject {
+		return map[string]interface{}{col.Name: lit.Value}, nil
+	}
+	return map[string]interface{}{
+		col.Name: map[string]interface{}{
+			"operator": op,
+			"value":    lit.Value,
+		},
+	}, nil
+}
+
+// predicateToFilter 将谓词转换为 {"operator": op, "value": v} 形式的过滤条件
+func predicateToFilter(e *PredicateExpr) (map[string]interface{}, error) {
+	args := make([]interface{}, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.(*Literal).Value
+	}
+
+	var value interface{}
+	switch e.Op {
+	case storage.OpIn, storage.OpNotIn, storage.OpBetween, "NOT " + storage.OpBetween:
+		value = args
+	default:
+		if len(args) == 1 {
+			value = args[0]
+		}
+	}
+
+	// 提前检查模式等参数，错误信息带上位置
+	if _, err := storage.NewCondition(e.Column.Name, e.Op, value); err != nil {
+		return nil, errorAt(e.Pos, "%v", err)
+	}
+
+	cond := map[string]interface{}{"operator": e.Op}
+	if value != nil || len(args) > 0 {
+		cond["value"] = value
+	}
+	return map[string]interface{}{e.Column.Name: cond}, nil
 }
@@ -0,0 +1,642 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"sudatas/internal/storage"
+)
+
+// mustParse 解析语句并清除语法树和条件树，便于与期望结果直接比较
+func mustParse(t *testing.T, sql string) *Statement {
+	t.Helper()
+	stmt, err := NewSQLParser().Parse(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	stmt.AST = nil
+	stmt.Where = nil
+	return stmt
+}
+
+func TestLexer(t *testing.T) {
+	tokens, err := NewLexer("SELECT `a b`, 'O''Brien' -- 注释\n/* 块注释 */ FROM c.d WHERE x >= 1.5e2;").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		typ   TokenType
+		value string
+		line  int
+	}{
+		{TokIdent, "SELECT", 1},
+		{TokQuotedIdent, "a b", 1},
+		{TokSymbol, ",", 1},
+		{TokString, "O'Brien", 1},
+		{TokIdent, "FROM", 2},
+		{TokIdent, "c", 2},
+		{TokSymbol, ".", 2},
+		{TokIdent, "d", 2},
+		{TokIdent, "WHERE", 2},
+		{TokIdent, "x", 2},
+		{TokSymbol, ">=", 2},
+		{TokNumber, "1.5e2", 2},
+		{TokSemicolon, ";", 2},
+		{TokEOF, "", 2},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("得到 %d 个词法单元: %+v", len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.Type != want[i].typ || tok.Value != want[i].value || tok.Pos.Line != want[i].line {
+			t.Errorf("第 %d 个词法单元为 %s %q（第%d行），期望 %s %q（第%d行）",
+				i, tok.Type, tok.Value, tok.Pos.Line, want[i].typ, want[i].value, want[i].line)
+		}
+	}
+}
+
+func TestParseStatements(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{
+			`INSERT INTO myapp.users VALUES {"name": "A B", "n": [1, {"x": "y z"}]};`,
+			Statement{Type: "INSERT", Collection: "myapp", Database: "users", Data: storage.Row{
+				"name": "A B",
+				"n":    []interface{}{1.0, map[string]interface{}{"x": "y z"}},
+			}},
+		},
+		{
+			`SELECT name, age FROM posts.0 WHERE {"location": "Bei jing"}`,
+			Statement{Type: "SELECT", Collection: "posts", Database: "0", Columns: []string{"name", "age"},
+				Filter: map[string]interface{}{"location": "Bei jing"}},
+		},
+		{
+			"select * from c.d where age >= 25 and name = 'O''Brien' -- 注释",
+			Statement{Type: "SELECT", Collection: "c", Database: "d", Filter: map[string]interface{}{
+				"age":  map[string]interface{}{"operator": ">=", "value": 25.0},
+				"name": "O'Brien",
+			}},
+		},
+		{
+			"SELECT * FROM c.d WHERE 5 < age",
+			Statement{Type: "SELECT", Collection: "c", Database: "d", Filter: map[string]interface{}{
+				"age": map[string]interface{}{"operator": ">", "value": 5.0},
+			}},
+		},
+		{
+			"SELECT * FROM c.d ORDER BY a DESC, b.c ASC, d LIMIT 10 OFFSET 5",
+			Statement{Type: "SELECT", Collection: "c", Database: "d", OrderBy: []storage.SortKey{
+				{Field: "a", Desc: true}, {Field: "b.c"}, {Field: "d"},
+			}, Limit: 10, Offset: 5},
+		},
+		{"SELECT * FROM c.d OFFSET 2", Statement{Type: "SELECT", Collection: "c", Database: "d", Offset: 2}},
+		{
+			"SELECT category, COUNT(*) AS n, AVG(likes), COUNT(DISTINCT likes) FROM c.d GROUP BY category HAVING n > 1 ORDER BY SUM(likes) DESC",
+			Statement{Type: "SELECT", Collection: "c", Database: "d", Columns: []string{"category"},
+				GroupBy: []string{"category"},
+				Aggregates: []storage.Aggregate{
+					{Func: storage.AggCount, Field: "*", Alias: "n"},
+					{Func: storage.AggAvg, Field: "likes"},
+					{Func: storage.AggCount, Field: "likes", Distinct: true},
+					{Func: storage.AggSum, Field: "likes"},
+				},
+				Having:  map[string]interface{}{"n": map[string]interface{}{"operator": ">", "value": 1.0}},
+				OrderBy: []storage.SortKey{{Field: "SUM(likes)", Desc: true}},
+			},
+		},
+		{
+			"CREATE DATABASE IF NOT EXISTS myapp.users TYPE json DESCRIPTION '导出的 数据库';",
+			Statement{Type: "CREATE_DATABASE", Collection: "myapp", Database: "users", DBType: storage.JsonStorage,
+				Description: "导出的 数据库", IfNotExists: true},
+		},
+		{"DELETE FROM c.d", Statement{Type: "DELETE", Collection: "c", Database: "d"}},
+		{
+			"DELETE FROM c.d WHERE id = 'post_001'",
+			Statement{Type: "DELETE", Collection: "c", Database: "d", Filter: map[string]interface{}{"id": "post_001"}},
+		},
+		{"CREATE COLLECTION myapp", Statement{Type: "CREATE_COLLECTION", Collection: "myapp", Owner: "root"}},
+		{"/* 注释 */ SHOW COLLECTIONS", Statement{Type: "SHOW_COLLECTIONS"}},
+		{"SHOW DATABASES FROM myapp", Statement{Type: "SHOW_DATABASES", Collection: "myapp"}},
+		{
+			"IMPORT FROM ./export/users_export.suql TO imported_app",
+			Statement{Type: "IMPORT", Collection: "imported_app", FilePath: "./export/users_export.suql"},
+		},
+		{
+			"EXPORT myapp.users TO ./export/users export.suql",
+			Statement{Type: "EXPORT", Collection: "myapp", Database: "users", FilePath: "./export/users export.suql"},
+		},
+		{
+			`EXPORT myapp.users TO 'C:\data\x.suql'`,
+			Statement{Type: "EXPORT", Collection: "myapp", Database: "users", FilePath: `C:\data\x.suql`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := mustParse(t, tt.sql); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("得到 %+v\n期望 %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		sql          string
+		line, column int
+	}{
+		{"SELECT * FROM c.d WHERE", 1, 24},
+		{"SELECT * FROM c WHERE a = 1", 1, 15},
+		{`INSERT INTO c.d VALUES {"a": 1`, 1, 24},
+		{"SELECT * FROM c.d\nWHERE a = 'x", 2, 11},
+		{"SELECT * FROM c.d WHERE a = b", 1, 27},
+		{"SELECT * FROM c.d SELECT", 1, 19},
+		{"FROB c.d", 1, 1},
+		{"SELECT * FROM c.d ORDER a", 1, 25},
+		{"SELECT * FROM c.d LIMIT 0", 1, 25},
+		{"SELECT * FROM c.d LIMIT -1", 1, 25},
+		{"SELECT * FROM c.d LIMIT 1.5", 1, 25},
+		{"SELECT * FROM c.d OFFSET 1 LIMIT 2", 1, 28},
+		{"SELECT category, likes FROM c.d GROUP BY category", 1, 1},
+		{"SELECT SUM(*) FROM c.d", 1, 8},
+		{"SELECT * FROM c.d HAVING a > 1", 1, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			_, err := NewSQLParser().Parse(tt.sql)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("期望解析错误，实际为 %v", err)
+			}
+			if perr.Line != tt.line || perr.Column != tt.column {
+				t.Fatalf("错误位置为第%d行第%d列，期望第%d行第%d列: %v", perr.Line, perr.Column, tt.line, tt.column, err)
+			}
+		})
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	stmts, err := NewSQLParser().ParseAll("BEGIN; DELETE FROM c.d;; COMMIT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, stmt := range stmts {
+		types = append(types, stmt.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"BEGIN", "DELETE", "COMMIT"}) {
+		t.Fatalf("解析出 %v", types)
+	}
+
+	if _, err := NewSQLParser().Parse("SHOW COLLECTIONS; SHOW COLLECTIONS"); err == nil {
+		t.Fatal("Parse 接受了多条语句")
+	}
+	if _, err := NewSQLParser().Parse(" ; "); err == nil {
+		t.Fatal("Parse 接受了空语句")
+	}
+}
+
+// parseWhere 解析 SELECT 语句的 WHERE 条件并返回转换后的过滤器
+func parseWhere(t *testing.T, where string) map[string]interface{} {
+	t.Helper()
+	return mustParse(t, "SELECT * FROM c.d WHERE "+where).Filter
+}
+
+func cmp(operator string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"operator": operator, "value": value}
+}
+
+func TestParseBooleanWhere(t *testing.T) {
+	tests := []struct {
+		where string
+		want  map[string]interface{}
+	}{
+		// AND 的优先级高于 OR
+		{"a = 1 OR b = 2 AND c = 3", map[string]interface{}{
+			storage.OpOr: []interface{}{
+				map[string]interface{}{"a": 1.0},
+				map[string]interface{}{"b": 2.0, "c": 3.0},
+			},
+		}},
+		{"(a = 1 OR b = 2) AND c = 3", map[string]interface{}{
+			storage.OpOr: []interface{}{map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": 2.0}},
+			"c":          3.0,
+		}},
+		{"a = 1 OR b = 2 OR c = 3", map[string]interface{}{
+			storage.OpOr: []interface{}{
+				map[string]interface{}{"a": 1.0},
+				map[string]interface{}{"b": 2.0},
+				map[string]interface{}{"c": 3.0},
+			},
+		}},
+		{"NOT a = 1", map[string]interface{}{storage.OpNot: map[string]interface{}{"a": 1.0}}},
+		{"NOT (a = 1 OR a = 2)", map[string]interface{}{
+			storage.OpNot: map[string]interface{}{
+				storage.OpOr: []interface{}{map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 2.0}},
+			},
+		}},
+		{"a = 1 AND NOT b = 2", map[string]interface{}{"a": 1.0, storage.OpNot: map[string]interface{}{"b": 2.0}}},
+		// 同一字段出现多次时不能合并，使用 $and
+		{"a > 1 AND a < 5", map[string]interface{}{
+			storage.OpAnd: []interface{}{
+				map[string]interface{}{"a": cmp(">", 1.0)},
+				map[string]interface{}{"a": cmp("<", 5.0)},
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			if got := parseWhere(t, tt.where); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("得到 %v\n期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, where := range []string{"(a = 1", "a = 1 OR", "NOT", "a = 1 AND (b = 2 OR)"} {
+		if _, err := NewSQLParser().Parse("SELECT * FROM c.d WHERE " + where); err == nil {
+			t.Errorf("接受了无效的条件 %s", where)
+		}
+	}
+}
+
+func TestParseBooleanWhereMatches(t *testing.T) {
+	stmt, err := NewSQLParser().Parse("SELECT * FROM c.d WHERE NOT (a = 1 OR b = 2) AND c = 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		row  storage.Row
+		want bool
+	}{
+		{storage.Row{"a": 2.0, "b": 1.0, "c": 3.0}, true},
+		{storage.Row{"a": 1.0, "b": 1.0, "c": 3.0}, false},
+		{storage.Row{"a": 2.0, "b": 2.0, "c": 3.0}, false},
+		{storage.Row{"a": 2.0, "b": 1.0, "c": 4.0}, false},
+	}
+	for _, tt := range tests {
+		if got := stmt.Where.Match(tt.row); got != tt.want {
+			t.Errorf("记录 %v 的匹配结果为 %v", tt.row, got)
+		}
+	}
+}
+
+func TestParsePredicates(t *testing.T) {
+	tests := []struct {
+		where string
+		want  map[string]interface{}
+	}{
+		{"id IN (1, 3)", map[string]interface{}{"id": cmp("IN", []interface{}{1.0, 3.0})}},
+		{"id NOT IN (1,3)", map[string]interface{}{"id": cmp("NOT IN", []interface{}{1.0, 3.0})}},
+		{"name LIKE 'a%'", map[string]interface{}{"name": cmp("LIKE", "a%")}},
+		{"name ILIKE 'a%'", map[string]interface{}{"name": cmp("ILIKE", "a%")}},
+		{"name NOT LIKE '%o%'", map[string]interface{}{"name": cmp("NOT LIKE", "%o%")}},
+		{"name REGEXP '^[A-Z]'", map[string]interface{}{"name": cmp("REGEXP", "^[A-Z]")}},
+		{"id BETWEEN 2 AND 3", map[string]interface{}{"id": cmp("BETWEEN", []interface{}{2.0, 3.0})}},
+		{"id NOT BETWEEN 2 AND 3", map[string]interface{}{"id": cmp("NOT BETWEEN", []interface{}{2.0, 3.0})}},
+		{"EXISTS meta", map[string]interface{}{"meta": map[string]interface{}{"operator": "EXISTS"}}},
+		{"NOT EXISTS(meta)", map[string]interface{}{"meta": map[string]interface{}{"operator": "NOT EXISTS"}}},
+		{"x IS NULL", map[string]interface{}{"x": map[string]interface{}{"operator": "IS NULL"}}},
+		{"x IS NOT NULL", map[string]interface{}{"x": map[string]interface{}{"operator": "IS NOT NULL"}}},
+		{"tags CONTAINS 'go'", map[string]interface{}{"tags": cmp("CONTAINS", "go")}},
+		{"tags NOT CONTAINS 'go'", map[string]interface{}{"tags": cmp("NOT CONTAINS", "go")}},
+		{"a <> 1", map[string]interface{}{"a": cmp("!=", 1.0)}},
+		{`tags = ["rust"]`, map[string]interface{}{"tags": []interface{}{"rust"}}},
+		// 对象值写成完整形式，以免被当作运算符条件
+		{`meta = {"k": 2}`, map[string]interface{}{"meta": cmp("=", map[string]interface{}{"k": 2.0})}},
+		// BETWEEN 中的 AND 不是逻辑运算符
+		{"id BETWEEN 1 AND 2 AND name LIKE 'a%'", map[string]interface{}{
+			"id":   cmp("BETWEEN", []interface{}{1.0, 2.0}),
+			"name": cmp("LIKE", "a%"),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			if got := parseWhere(t, tt.where); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("得到 %v\n期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePredicateErrors(t *testing.T) {
+	tests := []struct {
+		where  string
+		column int
+	}{
+		{"name REGEXP '('", 30},
+		{`name LIKE 'a\'`, 30},
+		{"id IN ()", 32},
+		{"1 IN (1)", 25},
+		{`{"id": {"operator": "in", "value": 1}}`, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			_, err := NewSQLParser().Parse("SELECT * FROM c.d WHERE " + tt.where)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("期望解析错误，实际为 %v", err)
+			}
+			if perr.Column != tt.column {
+				t.Fatalf("错误位置为第%d列，期望第%d列: %v", perr.Column, tt.column, err)
+			}
+		})
+	}
+}
+
+func TestParsePaths(t *testing.T) {
+	stmt := mustParse(t, "SELECT id, author.name, tags[0] FROM c.d WHERE stats.likes > 4 AND EXISTS author.name ORDER BY author.age")
+	want := Statement{
+		Type:       "SELECT",
+		Collection: "c",
+		Database:   "d",
+		Columns:    []string{"id", "author.name", "tags[0]"},
+		Filter: map[string]interface{}{
+			"stats.likes": cmp(">", 4.0),
+			"author.name": map[string]interface{}{"operator": "EXISTS"},
+		},
+		OrderBy: []storage.SortKey{{Field: "author.age"}},
+	}
+	if !reflect.DeepEqual(*stmt, want) {
+		t.Fatalf("得到 %+v\n期望 %+v", *stmt, want)
+	}
+
+	// 引号标识符中的 . 是字段名的一部分
+	if got := parseWhere(t, `"a.b" = 7`); !reflect.DeepEqual(got, map[string]interface{}{"a.b": 7.0}) {
+		t.Fatalf("引号字段名的过滤器 %v", got)
+	}
+
+	for _, sql := range []string{
+		"SELECT id FROM c.d WHERE tags[x] = 1",
+		"SELECT a[1 FROM c.d",
+		"SELECT a. FROM c.d",
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的字段路径: %s", sql)
+		}
+	}
+}
+
+func TestParseUpdateSet(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want storage.Row
+	}{
+		{"UPDATE c.d SET likes = 5, ok = true, title = 'a b', n = NULL, neg = -2",
+			storage.Row{"likes": 5.0, "ok": true, "title": "a b", "n": nil, "neg": -2.0}},
+		{"UPDATE c.d SET likes = likes + 2, score = score * 1.5, neg = neg - 3", storage.Row{
+			storage.UpdInc: map[string]interface{}{"likes": 2.0, "neg": -3.0},
+			storage.UpdMul: map[string]interface{}{"score": 1.5},
+		}},
+		{"UPDATE c.d SET tags = APPEND(tags, 'x'), old = REMOVE(old, 1), d = COALESCE(d, 'def'), UNSET draft, author.name = 'Z'", storage.Row{
+			storage.UpdPush:         map[string]interface{}{"tags": "x"},
+			storage.UpdPull:         map[string]interface{}{"old": 1.0},
+			storage.UpdSetIfMissing: map[string]interface{}{"d": "def"},
+			storage.UpdUnset:        map[string]interface{}{"draft": nil},
+			"author.name":           "Z",
+		}},
+		{`UPDATE c.d SET {"title": "t", "$inc": {"likes": 1}}`, storage.Row{
+			"title":        "t",
+			storage.UpdInc: map[string]interface{}{"likes": 1.0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := mustParse(t, tt.sql).Data; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("得到 %v\n期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		"UPDATE c.d SET likes = other + 1",
+		"UPDATE c.d SET a = 1, a = 2",
+		"UPDATE c.d SET a = 1, UNSET a.b",
+		"UPDATE c.d SET likes = likes / 2",
+		`UPDATE c.d SET {"$inc": {"a": "x"}}`,
+		`UPDATE c.d SET {"$bogus": {"a": 1}}`,
+		`UPDATE c.d SET [1]`,
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的更新: %s", sql)
+		}
+	}
+}
+
+func TestParseUserStatements(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{"CREATE USER IF NOT EXISTS u PASSWORD 'p' ROLE readonly, developer",
+			Statement{Type: "CREATE_USER", User: "u", IfNotExists: true, Password: "p", Roles: []string{"readonly", "developer"}}},
+		{"ALTER USER u PASSWORD 'x'", Statement{Type: "ALTER_USER", User: "u", UserAction: "PASSWORD", Password: "x"}},
+		{"ALTER USER u LOCK", Statement{Type: "ALTER_USER", User: "u", UserAction: "LOCK"}},
+		{"ALTER USER u UNLOCK", Statement{Type: "ALTER_USER", User: "u", UserAction: "UNLOCK"}},
+		{"ALTER USER u PASSWORD EXPIRE", Statement{Type: "ALTER_USER", User: "u", UserAction: "EXPIRE"}},
+		{"DROP USER IF EXISTS u", Statement{Type: "DROP_USER", User: "u", IfExists: true}},
+		{"CREATE ROLE IF NOT EXISTS r DESCRIPTION 'x'", Statement{Type: "CREATE_ROLE", Role: "r", IfNotExists: true, Description: "x"}},
+		{"DROP ROLE r", Statement{Type: "DROP_ROLE", Role: "r"}},
+		{"GRANT select, INSERT ON c.log_* TO user WITH GRANT OPTION",
+			Statement{Type: "GRANT", User: "user", Privileges: []string{"SELECT", "INSERT"}, Resource: "c.log_*", GrantOption: true}},
+		{"GRANT ALL PRIVILEGES ON * TO ROLE r",
+			Statement{Type: "GRANT", Role: "r", ToRole: true, Privileges: []string{"SELECT", "INSERT", "UPDATE", "DELETE"}, Resource: "*.*"}},
+		{"REVOKE SELECT ON c.d FROM bob", Statement{Type: "REVOKE", User: "bob", Privileges: []string{"SELECT"}, Resource: "c.d"}},
+		{"GRANT ROLE developer TO bob", Statement{Type: "GRANT", User: "bob", Roles: []string{"developer"}}},
+		{"REVOKE ROLE a, b FROM USER u", Statement{Type: "REVOKE", User: "u", Roles: []string{"a", "b"}}},
+		{"SHOW LOCKOUTS", Statement{Type: "SHOW_LOCKOUTS"}},
+		{"CLEAR LOCKOUT USER bob", Statement{Type: "CLEAR_LOCKOUT", Lockout: "USER", User: "bob"}},
+		{"CLEAR LOCKOUT IP '10.0.0.1'", Statement{Type: "CLEAR_LOCKOUT", Lockout: "IP", Address: "10.0.0.1"}},
+		{"CLEAR LOCKOUTS", Statement{Type: "CLEAR_LOCKOUT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := mustParse(t, tt.sql); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("得到 %+v\n期望 %+v", *got, tt.want)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		"CREATE USER u",
+		"ALTER USER u EXPIRE",
+		"ALTER USER u PASSWORD 'x' EXPIRE",
+		"GRANT SELECT ON c.d * TO u",
+		"GRANT ROLE a TO ROLE b",
+		"GRANT FLY ON c.d TO u",
+		"CLEAR LOCKOUT USER",
+		"CLEAR LOCKOUT IP 10",
+		"CLEAR USER bob",
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的语句: %s", sql)
+		}
+	}
+}
+
+func TestParseTokenStatements(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{"CREATE TOKEN ci FOR USER bob SCOPE SELECT, INSERT ON c.*, DELETE ON d.x EXPIRES IN 2 HOURS",
+			Statement{Type: "CREATE_TOKEN", Token: "ci", User: "bob", TokenTTL: 2 * time.Hour, TokenScope: []TokenScope{
+				{Privileges: []string{"SELECT", "INSERT"}, Resource: "c.*"},
+				{Privileges: []string{"DELETE"}, Resource: "d.x"},
+			}}},
+		{"CREATE TOKEN ci EXPIRES IN 3 DAYS SCOPE ALL ON *",
+			Statement{Type: "CREATE_TOKEN", Token: "ci", TokenTTL: 72 * time.Hour, TokenScope: []TokenScope{
+				{Privileges: []string{"SELECT", "INSERT", "UPDATE", "DELETE"}, Resource: "*.*"},
+			}}},
+		{"CREATE TOKEN t EXPIRES IN 30 MINUTES", Statement{Type: "CREATE_TOKEN", Token: "t", TokenTTL: 30 * time.Minute}},
+		{"DROP TOKEN IF EXISTS ci FOR bob", Statement{Type: "DROP_TOKEN", Token: "ci", User: "bob", IfExists: true}},
+		{"SHOW TOKENS", Statement{Type: "SHOW_TOKENS"}},
+		{"SHOW TOKENS FOR USER user", Statement{Type: "SHOW_TOKENS", User: "user"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := mustParse(t, tt.sql); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("得到 %+v\n期望 %+v", *got, tt.want)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		"CREATE TOKEN",
+		"CREATE TOKEN a SCOPE SELECT(x) ON c.d",
+		"CREATE TOKEN a SCOPE SELECT ON c.d SCOPE INSERT ON c.d",
+		"CREATE TOKEN a EXPIRES IN 0 DAYS",
+		"CREATE TOKEN a EXPIRES IN 3 WEEKS",
+		"DROP TOKEN",
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的语句: %s", sql)
+		}
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		sql, want string
+	}{
+		{"CREATE USER bob PASSWORD 'secret' ROLE r", "CREATE USER bob PASSWORD '******' ROLE r"},
+		{"ALTER USER bob password 'a''b'", "ALTER USER bob password '******'"},
+		// 只隐藏紧跟在 PASSWORD 之后的字符串
+		{"SELECT * FROM c.d WHERE password = 'x'", "SELECT * FROM c.d WHERE password = 'x'"},
+		{"CREATE USER bob PASSWORD 'unterminated", "[已隐藏可能含口令的语句]"},
+		{"SELECT 'x", "SELECT 'x"},
+	}
+	for _, tt := range tests {
+		if got := RedactSecrets(tt.sql); got != tt.want {
+			t.Errorf("RedactSecrets(%q) = %q，期望 %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestParsePolicyCondition(t *testing.T) {
+	vars := map[string]string{"user": "O'Neil"}
+	tests := []struct {
+		cond string
+		want map[string]interface{}
+	}{
+		// 变量值作为字符串字面量代入，其中的引号不会破坏条件
+		{"owner = $user", map[string]interface{}{"owner": "O'Neil"}},
+		{"owner = $USER AND (a = 1 OR b IN ('x', 'y'))", map[string]interface{}{
+			"owner": "O'Neil",
+			storage.OpOr: []interface{}{
+				map[string]interface{}{"a": 1.0},
+				map[string]interface{}{"b": cmp("IN", []interface{}{"x", "y"})},
+			},
+		}},
+		// 字符串中的 $user 不是变量
+		{"owner = '$user'", map[string]interface{}{"owner": "$user"}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicyCondition(tt.cond, vars)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.cond, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 得到 %v，期望 %v", tt.cond, got, tt.want)
+		}
+	}
+
+	for _, cond := range []string{"", "owner = $ user", "owner = $role", "owner = $user LIMIT 1", "owner = 'x' OR"} {
+		if _, err := ParsePolicyCondition(cond, vars); err == nil {
+			t.Errorf("接受了无效的条件 %q", cond)
+		}
+	}
+}
+
+func TestParseGrantWhere(t *testing.T) {
+	stmt := mustParse(t, "GRANT SELECT, UPDATE ON c.posts TO ROLE tenant WHERE owner = $user AND (a = 1 OR b = 'x');")
+	want := Statement{
+		Type:       "GRANT",
+		Role:       "tenant",
+		ToRole:     true,
+		Privileges: []string{"SELECT", "UPDATE"},
+		Resource:   "c.posts",
+		Condition:  "owner = $user AND (a = 1 OR b = 'x')",
+	}
+	if !reflect.DeepEqual(*stmt, want) {
+		t.Fatalf("得到 %+v\n期望 %+v", *stmt, want)
+	}
+
+	for _, sql := range []string{
+		"GRANT SELECT ON c.d TO u WHERE",
+		"GRANT SELECT ON c.d TO u WHERE owner = $nobody",
+		"GRANT SELECT ON c.d TO u WHERE owner =",
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的行级安全条件: %s", sql)
+		}
+	}
+}
+
+func TestParseColumnGrants(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{"GRANT SELECT(name, email), UPDATE(name) ON c.users TO u", Statement{
+			Type: "GRANT", User: "u", Privileges: []string{"SELECT", "UPDATE"}, Resource: "c.users",
+			PrivColumns: map[string][]string{"SELECT": {"name", "email"}, "UPDATE": {"name"}},
+		}},
+		{"DENY SELECT(email) ON c.users TO u WITH MASK PARTIAL", Statement{
+			Type: "GRANT", User: "u", Privileges: []string{"SELECT"}, Resource: "c.users",
+			PrivColumns: map[string][]string{"SELECT": {"email"}}, Deny: true, Mask: "PARTIAL",
+		}},
+		{"DENY SELECT(email) ON c.users TO ROLE r", Statement{
+			Type: "GRANT", Role: "r", ToRole: true, Privileges: []string{"SELECT"}, Resource: "c.users",
+			PrivColumns: map[string][]string{"SELECT": {"email"}}, Deny: true,
+		}},
+		{"REVOKE SELECT(email) ON c.users FROM u", Statement{
+			Type: "REVOKE", User: "u", Privileges: []string{"SELECT"}, Resource: "c.users",
+			PrivColumns: map[string][]string{"SELECT": {"email"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			if got := mustParse(t, tt.sql); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("得到 %+v\n期望 %+v", *got, tt.want)
+			}
+		})
+	}
+
+	for _, sql := range []string{
+		"DENY SELECT ON c.d TO u",
+		"DENY SELECT(email) ON c.users TO u WITH MASK 'partial'",
+		"DENY SELECT(email) ON c.users TO u WITH MASK BLUR",
+	} {
+		if _, err := NewSQLParser().Parse(sql); err == nil {
+			t.Errorf("接受了无效的语句: %s", sql)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"strings"
+
+	"sudatas/internal/storage"
+)
+
+// ParsePolicyCondition 解析行级安全策略的条件，语法与 WHERE 子句相同，例如 owner = $user。
+// 条件中的 $name 用 vars 中的值替换为字符串字面量，未知的变量报错
+func ParsePolicyCondition(cond string, vars map[string]string) (map[string]interface{}, error) {
+	src, err := BindPolicyVariables(cond, vars)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	ps := &parser{src: src, tokens: tokens}
+	if ps.peek().Type == TokEOF {
+		return nil, errorAt(ps.peek().Pos, "条件不能为空")
+	}
+	expr, err := ps.parseWhere()
+	if err != nil {
+		return nil, err
+	}
+	if tok := ps.peek(); tok.Type != TokEOF {
+		return nil, ps.unexpected(tok, "条件结尾")
+	}
+
+	filter, err := whereToFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storage.ParseConditions(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// BindPolicyVariables 把条件中的 $name 替换为 vars 中对应值的字符串字面量，未知的变量报错
+func BindPolicyVariables(cond string, vars map[string]string) (string, error) {
+	tokens, err := NewLexer(cond).Tokenize()
+	if err != nil {
+		return "", err
+	}
+
+	// 替换变量：$ 和紧跟的标识符
+	var sb strings.Builder
+	last := 0
+	for i := 0; i+1 < len(tokens); i++ {
+		tok, name := tokens[i], tokens[i+1]
+		if tok.Type != TokSymbol || tok.Value != "$" {
+			continue
+		}
+		if name.Type != TokIdent || name.Offset != tok.End {
+			return "", errorAt(tok.Pos, "无效的变量引用")
+		}
+		value, ok := vars[strings.ToLower(name.Value)]
+		if !ok {
+			return "", errorAt(tok.Pos, "未知的变量: $%s", name.Value)
+		}
+		sb.WriteString(cond[last:tok.Offset])
+		sb.WriteString("'" + strings.ReplaceAll(value, "'", "''") + "'")
+		last = name.End
+		i++
+	}
+	sb.WriteString(cond[last:])
+	return sb.String(), nil
+}
+
+// parsePolicyText 读取 WHERE 之后到语句结尾的条件原文，并用占位变量检查语法
+func (p *parser) parsePolicyText() (string, error) {
+	first := p.peek()
+	end := first.Offset
+	for tok := p.peek(); tok.Type != TokEOF && tok.Type != TokSemicolon; tok = p.peek() {
+		end = p.next().End
+	}
+	text := strings.TrimSpace(p.src[first.Offset:end])
+	if text == "" {
+		return "", p.unexpected(first, "行级安全条件")
+	}
+
+	if _, err := ParsePolicyCondition(text, map[string]string{"user": ""}); err != nil {
+		return "", errorAt(first.Pos, "无效的行级安全条件: %v", err)
+	}
+	return text, nil
+}
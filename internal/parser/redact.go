@@ -0,0 +1,35 @@
+package parser
+
+import "strings"
+
+// redactedPassword 日志中代替口令的文本
+const redactedPassword = "'******'"
+
+// RedactSecrets 隐藏 SQL 文本中 PASSWORD 之后的口令，用于写入日志和审计记录。
+// 无法切分词法单元但可能含口令的文本整体隐藏
+func RedactSecrets(sql string) string {
+	tokens, err := NewLexer(sql).Tokenize()
+	if err != nil {
+		if strings.Contains(strings.ToUpper(sql), "PASSWORD") {
+			return "[已隐藏可能含口令的语句]"
+		}
+		return sql
+	}
+
+	var sb strings.Builder
+	last := 0
+	for i := 1; i < len(tokens); i++ {
+		prev, tok := tokens[i-1], tokens[i]
+		if tok.Type != TokString || prev.Type != TokIdent || !strings.EqualFold(prev.Value, "PASSWORD") {
+			continue
+		}
+		sb.WriteString(sql[last:tok.Offset])
+		sb.WriteString(redactedPassword)
+		last = tok.End
+	}
+	if last == 0 {
+		return sql
+	}
+	sb.WriteString(sql[last:])
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import "fmt"
+
+// 连接建立后客户端先发送 HelloMessage，内容为 Hello：
+//
+//   - 服务端支持客户端的版本范围时返回 HelloMessage，内容为 HelloResponse，其中是协商出的版本和双方都支持的功能
+//   - 版本范围没有交集时返回 IncompatibleMessage，内容为 Incompatible，然后关闭连接
+//
+// 握手必须在密钥协商和认证之前进行。不发送 Hello 的旧客户端按第 1 版协议处理，不启用任何可选功能。
+//
+// 魔数和版本只在握手消息的内容中，MessageHeader（长度和类型）保持不变，
+// 这样旧客户端的消息仍能按原来的格式解析，服务端据此区分是否做过握手
+const (
+	// HelloMagic 标识 sudatas 协议的握手
+	HelloMagic = "SUDATAS"
+
+	// ProtocolVersion 当前的协议版本
+	ProtocolVersion uint32 = 1
+
+	// MinProtocolVersion 仍然支持的最低协议版本
+	MinProtocolVersion uint32 = 1
+)
+
+// Capability 可选功能位
+type Capability uint32
+
+// 只登记已经实现的功能，新增功能时在末尾追加
+const (
+	CapEncryption Capability = 1 << iota // 国密会话模式
+)
+
+// ServerCapabilities 当前服务端实现的功能
+const ServerCapabilities = CapEncryption
+
+// Has 是否包含 flag 中的全部功能
+func (c Capability) Has(flag Capability) bool {
+	return c&flag == flag
+}
+
+// Hello 客户端握手
+type Hello struct {
+	Magic        string     `json:"magic"`
+	Version      uint32     `json:"version"`               // 客户端支持的最高版本
+	MinVersion   uint32     `json:"min_version,omitempty"` // 客户端支持的最低版本，为 0 时与 Version 相同
+	ClientName   string     `json:"client_name"`
+	Capabilities Capability `json:"capabilities"`
+}
+
+// HelloResponse 服务端握手
+type HelloResponse struct {
+	Version      uint32     `json:"version"` // 协商出的协议版本
+	ServerName   string     `json:"server_name"`
+	Capabilities Capability `json:"capabilities"` // 双方都支持的功能
+}
+
+// Incompatible 协议版本不兼容的原因和服务端支持的版本范围
+type Incompatible struct {
+	Message    string `json:"message"`
+	MinVersion uint32 `json:"min_version"`
+	MaxVersion uint32 `json:"max_version"`
+}
+
+// Negotiate 在客户端和服务端的版本范围中选出双方都支持的最高版本
+func Negotiate(hello *Hello) (uint32, error) {
+	if hello.Magic != HelloMagic {
+		return 0, fmt.Errorf("不是 sudatas 协议的握手")
+	}
+	minVersion := hello.MinVersion
+	if minVersion == 0 || minVersion > hello.Version {
+		minVersion = hello.Version
+	}
+
+	version := hello.Version
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	if version < minVersion || version < MinProtocolVersion {
+		return 0, fmt.Errorf("客户端协议版本 %d-%d 与服务端支持的版本 %d-%d 不兼容",
+			minVersion, hello.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	return version, nil
+}
@@ -0,0 +1,36 @@
+package protocol
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hello   Hello
+		version uint32
+		ok      bool
+	}{
+		{"相同版本", Hello{Magic: HelloMagic, Version: 1}, 1, true},
+		{"客户端版本更高", Hello{Magic: HelloMagic, Version: 9, MinVersion: 1}, 1, true},
+		{"客户端最低版本高于服务端", Hello{Magic: HelloMagic, Version: 9, MinVersion: 5}, 0, false},
+		{"客户端版本低于服务端最低版本", Hello{Magic: HelloMagic, Version: 0}, 0, false},
+		{"最低版本大于最高版本时按最高版本处理", Hello{Magic: HelloMagic, Version: 1, MinVersion: 3}, 1, true},
+		{"魔数不符", Hello{Magic: "HTTP", Version: 1}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := Negotiate(&tt.hello)
+			if (err == nil) != tt.ok || version != tt.version {
+				t.Fatalf("得到 %d, %v，期望 %d", version, err, tt.version)
+			}
+		})
+	}
+}
+
+func TestServerCapabilities(t *testing.T) {
+	if !ServerCapabilities.Has(CapEncryption) {
+		t.Fatal("服务端没有声明国密会话模式")
+	}
+	if Capability(0).Has(CapEncryption) {
+		t.Fatal("空的功能位包含国密会话模式")
+	}
+}
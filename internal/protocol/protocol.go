@@ -20,9 +20,59 @@ const (
 	QueryMessage
 	ResultMessage
 	ErrorMessage
+	ChallengeMessage    // 服务端对认证请求的挑战
+	KeyExchangeMessage  // 国密会话模式的 SM2 密钥协商
+	HelloMessage        // 连接建立后的握手，协商协议版本和功能
+	IncompatibleMessage // 协议版本不兼容，服务端发送后关闭连接
 )
 
-// 消息头部结构
+// 口令认证为两轮挑战-应答，口令本身不在网络上传输：
+//
+//  1. 客户端发送 AuthMessage，内容为只含 Username 和 Nonce 的 AuthRequest
+//  2. 服务端返回 ChallengeMessage，内容为 AuthChallenge
+//  3. 客户端用 security.PasswordProof 计算应答，发送只含 Username 和 Proof 的 AuthRequest
+//  4. 服务端校验通过后返回 ResultMessage，否则返回 ErrorMessage
+//
+// 使用访问令牌时只有一轮：客户端发送只含 Username 和 Token 的 AuthRequest，
+// 服务端校验令牌后返回 ResultMessage 或 ErrorMessage。令牌本身在消息中传输，应在 TLS 或国密会话模式的连接上使用
+
+// AuthRequest 认证请求
+type AuthRequest struct {
+	Username string `json:"username"`
+	Nonce    []byte `json:"nonce,omitempty"` // 第一轮：客户端随机数
+	Proof    []byte `json:"proof,omitempty"` // 第二轮：客户端应答
+	Token    string `json:"token,omitempty"` // 访问令牌，代替口令的挑战-应答
+}
+
+// 国密会话模式在认证之前协商会话密钥，见 security.SessionInitiator：
+//
+//  1. 客户端发送 KeyExchangeMessage，内容为 KeyExchangeRequest
+//  2. 服务端返回 KeyExchangeMessage，内容为 KeyExchangeResponse；出错时返回 ErrorMessage
+//  3. 之后双方的所有消息都经 security.SessionConn 用会话密钥加密
+//
+// 使用 TLS 连接时不需要协商
+
+// KeyExchangeRequest 客户端的密钥协商请求
+type KeyExchangeRequest struct {
+	PublicKey []byte `json:"public_key"` // 客户端本次连接的 SM2 公钥
+	Ephemeral []byte `json:"ephemeral"`  // 客户端临时公钥
+}
+
+// KeyExchangeResponse 服务端的密钥协商响应
+type KeyExchangeResponse struct {
+	Ephemeral []byte `json:"ephemeral"` // 服务端临时公钥
+	Confirm   []byte `json:"confirm"`   // 服务端的确认值，证明服务端持有配置的 SM2 私钥
+}
+
+// AuthChallenge 认证挑战
+type AuthChallenge struct {
+	Nonce      []byte `json:"nonce"` // 服务端随机数
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+}
+
+// 消息头部结构。握手不改变消息头，协议魔数和版本在 Hello 消息的内容中（见 hello.go）
 type MessageHeader struct {
 	Length uint32 // 消息体长度
 	Type   uint32 // 消息类型，使用固定大小的类型
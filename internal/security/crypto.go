@@ -2,12 +2,16 @@ package security
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/tjfoc/gmsm/sm2"
 	"github.com/tjfoc/gmsm/sm4"
@@ -22,7 +26,26 @@ type KeyPair struct {
 // CryptoManager 加密管理器
 type CryptoManager struct {
 	keyPair *KeyPair
-	sm4Key  []byte
+
+	// SM4 数据密钥按版本保存：加密总是使用当前版本，解密按密文头中的版本选择密钥
+	mu         sync.RWMutex
+	sm4Keys    map[uint32]*dataKey
+	currentKey uint32
+	keyFile    string            // SaveKeys/LoadKeys 使用的密钥文件，轮换密钥后写回
+	kek        *keyEncryptionKey // 由主密钥派生，用于加密密钥文件
+}
+
+// dataKey 一个版本的SM4数据密钥
+type dataKey struct {
+	key     []byte
+	created time.Time
+}
+
+// KeyInfo 数据密钥的版本信息
+type KeyInfo struct {
+	Version uint32    `json:"version"`
+	Created time.Time `json:"created"`
+	Current bool      `json:"current"`
 }
 
 // NewCryptoManager 创建新的加密管理器
@@ -34,9 +57,9 @@ func NewCryptoManager() (*CryptoManager, error) {
 	}
 
 	// 生成SM4密钥（确保是16字节）
-	sm4Key := make([]byte, 16)
-	if _, err := io.ReadFull(rand.Reader, sm4Key); err != nil {
-		return nil, fmt.Errorf("生成SM4密钥失败: %w", err)
+	sm4Key, err := generateSM4Key()
+	if err != nil {
+		return nil, err
 	}
 
 	return &CryptoManager{
@@ -44,10 +67,20 @@ func NewCryptoManager() (*CryptoManager, error) {
 			PrivateKey: privateKey,
 			PublicKey:  &privateKey.PublicKey,
 		},
-		sm4Key: sm4Key,
+		sm4Keys:    map[uint32]*dataKey{1: {key: sm4Key, created: time.Now()}},
+		currentKey: 1,
 	}, nil
 }
 
+// generateSM4Key 生成随机的SM4密钥
+func generateSM4Key() ([]byte, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("生成SM4密钥失败: %w", err)
+	}
+	return key, nil
+}
+
 // EncryptSM2 使用SM2加密
 func (cm *CryptoManager) EncryptSM2(data []byte) ([]byte, error) {
 	// 使用 sm2.EncryptAsn1 的正确方式，添加随机数生成器
@@ -60,102 +93,318 @@ func (cm *CryptoManager) DecryptSM2(ciphertext []byte) ([]byte, error) {
 	return sm2.DecryptAsn1(cm.keyPair.PrivateKey, ciphertext)
 }
 
-// EncryptSM4 使用SM4加密
+// SM4 密文格式：
+//
+//	"SM4" | 格式版本(1字节) | 密钥版本(4字节) | 随机数(12字节) | 密文 | 认证标签(16字节)
+//
+// 没有 "SM4" 前缀的是旧版本按块加密（无随机数、无完整性校验）的密文，只能通过迁移接口读取。
+const (
+	sm4Magic = "SM4"
+
+	sm4VersionGCM byte = 1 // SM4-GCM，带密钥版本
+
+	sm4HeaderSize = len(sm4Magic) + 1
+)
+
+// ErrLegacyCiphertext 密文是旧格式，需要先迁移
+var ErrLegacyCiphertext = errors.New("旧格式的SM4密文，需要迁移后才能读取")
+
+// ErrLegacyUnrecoverable 旧格式的密文超过一个分组，第一个分组之后的内容没有被加密保存，无法恢复
+var ErrLegacyUnrecoverable = errors.New("旧格式的SM4密文只加密了第一个分组，其余内容已丢失，无法恢复")
+
+// newSM4GCM 创建 SM4-GCM 的 AEAD
+func newSM4GCM(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sm4Key 返回指定版本的数据密钥
+func (cm *CryptoManager) sm4Key(version uint32) ([]byte, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	k, ok := cm.sm4Keys[version]
+	if !ok {
+		return nil, fmt.Errorf("第 %d 版数据密钥不存在或已停用", version)
+	}
+	return k.key, nil
+}
+
+// EncryptSM4 使用当前版本的数据密钥进行SM4-GCM加密，每次加密使用新的随机数
 func (cm *CryptoManager) EncryptSM4(data []byte) ([]byte, error) {
-	block, err := sm4.NewCipher(cm.sm4Key)
+	return cm.SealSM4(data, nil)
+}
+
+// SealSM4 与 EncryptSM4 相同，additional 作为附加数据参与认证但不写入密文，
+// 用于保护密文外部的文件头等明文字段。解密时必须用 OpenSM4 并传入相同的 additional
+func (cm *CryptoManager) SealSM4(data, additional []byte) ([]byte, error) {
+	cm.mu.RLock()
+	version := cm.currentKey
+	key := cm.sm4Keys[version].key
+	cm.mu.RUnlock()
+
+	aead, err := newSM4GCM(key)
 	if err != nil {
 		return nil, err
 	}
 
-	// 添加填充
-	padding := block.BlockSize() - len(data)%block.BlockSize()
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	data = append(data, padtext...)
+	headerSize := sm4HeaderSize + 4
+	out := make([]byte, headerSize+aead.NonceSize(), headerSize+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, sm4Magic)
+	out[len(sm4Magic)] = sm4VersionGCM
+	binary.BigEndian.PutUint32(out[sm4HeaderSize:], version)
+	nonce := out[headerSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
 
-	// 加密
-	ciphertext := make([]byte, len(data))
-	block.Encrypt(ciphertext, data)
-	return ciphertext, nil
+	// 文件头和调用方的附加数据参与认证
+	return aead.Seal(out, nonce, data, sm4AdditionalData(out[:headerSize], additional)), nil
 }
 
-// DecryptSM4 使用SM4解密
+// DecryptSM4 解密并校验 EncryptSM4 生成的密文。旧格式的密文返回 ErrLegacyCiphertext
 func (cm *CryptoManager) DecryptSM4(ciphertext []byte) ([]byte, error) {
-	block, err := sm4.NewCipher(cm.sm4Key)
+	return cm.OpenSM4(ciphertext, nil)
+}
+
+// OpenSM4 解密并校验 SealSM4 生成的密文，additional 与加密时不同则校验失败
+func (cm *CryptoManager) OpenSM4(ciphertext, additional []byte) ([]byte, error) {
+	version, headerSize, err := parseSM4Header(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	key, err := cm.sm4Key(version)
 	if err != nil {
 		return nil, err
 	}
 
-	// 解密
-	plaintext := make([]byte, len(ciphertext))
-	block.Decrypt(plaintext, ciphertext)
+	aead, err := newSM4GCM(key)
+	if err != nil {
+		return nil, err
+	}
+	body := ciphertext[headerSize:]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("密文长度无效: %d", len(ciphertext))
+	}
 
-	// 去除填充
-	padding := int(plaintext[len(plaintext)-1])
-	return plaintext[:len(plaintext)-padding], nil
+	plaintext, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], sm4AdditionalData(ciphertext[:headerSize], additional))
+	if err != nil {
+		return nil, fmt.Errorf("密文校验失败，数据可能已被篡改")
+	}
+	return plaintext, nil
 }
 
-// SaveKeys 保存密钥到文件
-func (cm *CryptoManager) SaveKeys(filename string) error {
-	// 创建密钥目录
-	dir := filepath.Dir(filename)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("创建密钥目录失败: %w", err)
+// sm4AdditionalData GCM 认证的附加数据：密文头之后接调用方的附加数据
+func sm4AdditionalData(header, additional []byte) []byte {
+	if len(additional) == 0 {
+		return header
 	}
+	return append(append([]byte(nil), header...), additional...)
+}
 
-	// 保存私钥文件
-	privateKeyFile := filename + ".pri"
-	if err := os.WriteFile(privateKeyFile, cm.keyPair.PrivateKey.D.Bytes(), 0600); err != nil {
-		return fmt.Errorf("保存私钥失败: %w", err)
+// parseSM4Header 解析密文头，返回密钥版本和密文头长度
+func parseSM4Header(ciphertext []byte) (uint32, int, error) {
+	if len(ciphertext) < sm4HeaderSize {
+		return 0, 0, fmt.Errorf("密文长度无效: %d", len(ciphertext))
+	}
+	if IsLegacySM4(ciphertext) {
+		return 0, 0, ErrLegacyCiphertext
 	}
 
-	// 保存SM4密钥文件
-	sm4KeyFile := filename + ".sm4"
-	if err := os.WriteFile(sm4KeyFile, cm.sm4Key, 0600); err != nil {
-		return fmt.Errorf("保存SM4密钥失败: %w", err)
+	switch format := ciphertext[len(sm4Magic)]; format {
+	case sm4VersionGCM:
+		if len(ciphertext) < sm4HeaderSize+4 {
+			return 0, 0, fmt.Errorf("密文长度无效: %d", len(ciphertext))
+		}
+		return binary.BigEndian.Uint32(ciphertext[sm4HeaderSize:]), sm4HeaderSize + 4, nil
+	default:
+		return 0, 0, fmt.Errorf("不支持的密文格式版本: %d", format)
 	}
+}
 
-	return nil
+// SM4KeyVersion 返回密文使用的数据密钥版本，旧格式的密文返回 ErrLegacyCiphertext
+func SM4KeyVersion(ciphertext []byte) (uint32, error) {
+	version, _, err := parseSM4Header(ciphertext)
+	return version, err
+}
+
+// NeedsReencrypt 密文是否需要用当前密钥重新加密（旧格式或不是当前版本的密钥）
+func (cm *CryptoManager) NeedsReencrypt(ciphertext []byte) bool {
+	version, err := SM4KeyVersion(ciphertext)
+	return err != nil || version != cm.CurrentKeyVersion()
 }
 
-// LoadKeys 从文件加载密钥
-func (cm *CryptoManager) LoadKeys(filename string) error {
-	// 检查私钥文件
-	privateKeyFile := filename + ".pri"
-	if _, err := os.Stat(privateKeyFile); os.IsNotExist(err) {
-		// 如果文件不存在，创建新的密钥管理器
-		newCrypto, err := NewCryptoManager()
-		if err != nil {
-			return fmt.Errorf("创建新密钥失败: %w", err)
+// ReencryptSM4 用当前密钥重新加密一段密文（支持旧格式），已是当前密钥的密文原样返回
+func (cm *CryptoManager) ReencryptSM4(ciphertext []byte) ([]byte, bool, error) {
+	if !cm.NeedsReencrypt(ciphertext) {
+		return ciphertext, false, nil
+	}
+
+	var plaintext []byte
+	var err error
+	if IsLegacySM4(ciphertext) {
+		plaintext, err = cm.DecryptLegacySM4(ciphertext)
+	} else {
+		plaintext, err = cm.DecryptSM4(ciphertext)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := cm.EncryptSM4(plaintext)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// ReencryptFile 用当前密钥重新加密整个文件内容为一段密文的文件，文件不存在时不做任何事
+func (cm *CryptoManager) ReencryptFile(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
 		}
-		cm.keyPair = newCrypto.keyPair
-		cm.sm4Key = newCrypto.sm4Key
-		return cm.SaveKeys(filename)
+		return false, fmt.Errorf("读取文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return false, nil
+	}
+
+	out, changed, err := cm.ReencryptSM4(data)
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := WriteFileAtomic(filename, out, 0600); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	// 读取私钥
-	privateKeyBytes, err := os.ReadFile(privateKeyFile)
+// IsLegacySM4 密文是否为旧格式
+func IsLegacySM4(ciphertext []byte) bool {
+	return !bytes.HasPrefix(ciphertext, []byte(sm4Magic))
+}
+
+// DecryptLegacySM4 解密旧格式的密文（PKCS#7 填充，使用第 1 版密钥）。
+// 旧版本的加密只处理了第一个分组，之后的分组原样保留为全零，原文已经丢失：
+// 只有密文恰好一个分组（原文不超过 15 字节）时能完整恢复；更长的密文返回第一个分组的明文和 ErrLegacyUnrecoverable。
+// 旧格式没有完整性校验，只应在迁移时使用
+func (cm *CryptoManager) DecryptLegacySM4(ciphertext []byte) ([]byte, error) {
+	key, err := cm.sm4Key(1)
 	if err != nil {
-		return fmt.Errorf("读取私钥失败: %w", err)
+		return nil, err
+	}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
 	}
 
-	// 重新构造私钥
-	privateKey := new(sm2.PrivateKey)
-	privateKey.Curve = sm2.P256Sm2()
-	privateKey.D = new(big.Int).SetBytes(privateKeyBytes)
-	privateKey.PublicKey.X, privateKey.PublicKey.Y = privateKey.Curve.ScalarBaseMult(privateKeyBytes)
+	size := block.BlockSize()
+	if len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, fmt.Errorf("密文长度无效: %d", len(ciphertext))
+	}
 
-	// 读取SM4密钥
-	sm4KeyFile := filename + ".sm4"
-	sm4Key, err := os.ReadFile(sm4KeyFile)
-	if err != nil || len(sm4Key) != 16 {
-		return fmt.Errorf("读取SM4密钥失败: %w", err)
+	// 只有第一个分组是密文
+	plaintext := make([]byte, size)
+	block.Decrypt(plaintext, ciphertext[:size])
+	if len(ciphertext) > size {
+		return plaintext, fmt.Errorf("%w（密文 %d 字节，只能恢复前 %d 字节）", ErrLegacyUnrecoverable, len(ciphertext), size)
 	}
 
-	cm.keyPair = &KeyPair{
-		PrivateKey: privateKey,
-		PublicKey:  &privateKey.PublicKey,
+	// 去除填充
+	padding := int(plaintext[size-1])
+	if padding == 0 || padding > size ||
+		!bytes.Equal(plaintext[size-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("密文填充无效")
 	}
-	cm.sm4Key = sm4Key
+	return plaintext[:size-padding], nil
+}
 
+// MigrateSM4 将旧格式的密文重新加密为当前格式，已是当前格式的密文原样返回。
+// migrated 表示是否做了转换
+func (cm *CryptoManager) MigrateSM4(ciphertext []byte) (out []byte, migrated bool, err error) {
+	if !IsLegacySM4(ciphertext) {
+		return ciphertext, false, nil
+	}
+	plaintext, err := cm.DecryptLegacySM4(ciphertext)
+	if err != nil {
+		return nil, false, fmt.Errorf("解密旧格式密文失败: %w", err)
+	}
+	out, err = cm.EncryptSM4(plaintext)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// MigrateFile 将整个文件内容为一段旧格式密文的文件（元数据、用户数据）重新加密为当前格式。
+// 文件不存在或已是当前格式时不做任何事；内容无法完整恢复时返回错误，文件保持不变
+func (cm *CryptoManager) MigrateFile(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("读取文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return false, nil
+	}
+
+	out, migrated, err := cm.MigrateSM4(data)
+	if err != nil || !migrated {
+		return false, err
+	}
+	if err := WriteFileAtomic(filename, out, 0600); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WriteFileAtomic 先写临时文件再重命名，避免写到一半时留下损坏的文件。
+// 临时文件在重命名前刷盘，重命名后再刷新所在目录，返回时新内容已经持久化
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tempFile := filename + ".tmp"
+	if err := writeFileSync(tempFile, data, perm); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := os.Rename(tempFile, filename); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("重命名文件失败: %w", err)
+	}
+	if err := SyncDir(filepath.Dir(filename)); err != nil {
+		return fmt.Errorf("刷新目录失败: %w", err)
+	}
 	return nil
 }
+
+// writeFileSync 写入文件并刷盘
+func writeFileSync(filename string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SyncDir 刷新目录，使其中新建、重命名或删除的文件项持久化
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
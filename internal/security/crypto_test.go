@@ -0,0 +1,238 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// legacyEncryptSM4 按旧版本 EncryptSM4 的方式加密：PKCS#7 填充后只加密第一个分组，其余分组保持全零
+func legacyEncryptSM4(t *testing.T, cm *CryptoManager, data []byte) []byte {
+	t.Helper()
+	block, err := sm4.NewCipher(cm.sm4Keys[1].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	data = append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(data))
+	block.Encrypt(ciphertext, data)
+	return ciphertext
+}
+
+func newTestCryptoManager(t *testing.T) *CryptoManager {
+	t.Helper()
+	cm, err := NewCryptoManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestSM4RoundTrip(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	for _, plain := range [][]byte{{}, []byte("hello"), bytes.Repeat([]byte("x"), 1000)} {
+		c1, err := cm.EncryptSM4(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c2, err := cm.EncryptSM4(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(c1, c2) {
+			t.Fatal("两次加密的密文相同，随机数被重复使用")
+		}
+
+		got, err := cm.DecryptSM4(c1)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("解密结果 %q, %v，期望 %q", got, err, plain)
+		}
+
+		c1[len(c1)-1] ^= 1
+		if _, err := cm.DecryptSM4(c1); err == nil {
+			t.Fatal("篡改后的密文解密成功")
+		}
+	}
+}
+
+func TestSealSM4AdditionalData(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	ciphertext, err := cm.SealSM4([]byte("hello"), []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cm.OpenSM4(ciphertext, []byte("header")); err != nil || string(got) != "hello" {
+		t.Fatalf("解密结果 %q, %v", got, err)
+	}
+	for _, additional := range [][]byte{nil, []byte("headex")} {
+		if _, err := cm.OpenSM4(ciphertext, additional); err == nil {
+			t.Fatalf("附加数据为 %q 时解密成功", additional)
+		}
+	}
+}
+
+func TestDecryptSM4RejectsInvalidCiphertext(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	for _, bad := range [][]byte{nil, {}, []byte("SM4"), []byte("SM4\x01"), []byte("SM4\x09aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")} {
+		if _, err := cm.DecryptSM4(bad); err == nil {
+			t.Errorf("密文 %q 解密成功", bad)
+		}
+	}
+
+	legacy := legacyEncryptSM4(t, cm, []byte(`{}`))
+	if _, err := cm.DecryptSM4(legacy); !errors.Is(err, ErrLegacyCiphertext) {
+		t.Fatalf("旧格式密文返回 %v，期望 ErrLegacyCiphertext", err)
+	}
+}
+
+func TestDecryptLegacySM4(t *testing.T) {
+	cm := newTestCryptoManager(t)
+
+	// 原文不超过 15 字节时密文只有一个分组，可以完整恢复
+	short := []byte(`{"a":1}`)
+	got, err := cm.DecryptLegacySM4(legacyEncryptSM4(t, cm, short))
+	if err != nil || !bytes.Equal(got, short) {
+		t.Fatalf("解密结果 %q, %v，期望 %q", got, err, short)
+	}
+
+	// 更长的原文只有第一个分组被加密，其余内容无法恢复
+	long := []byte(`{"name":"root","password":"123456"}`)
+	got, err = cm.DecryptLegacySM4(legacyEncryptSM4(t, cm, long))
+	if !errors.Is(err, ErrLegacyUnrecoverable) {
+		t.Fatalf("返回 %v，期望 ErrLegacyUnrecoverable", err)
+	}
+	if !bytes.Equal(got, long[:16]) {
+		t.Fatalf("第一个分组的明文为 %q，期望 %q", got, long[:16])
+	}
+
+	if _, err := cm.DecryptLegacySM4(nil); err == nil {
+		t.Fatal("空密文解密成功")
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	dir := t.TempDir()
+
+	short := filepath.Join(dir, "short.sudb")
+	if err := os.WriteFile(short, legacyEncryptSM4(t, cm, []byte(`{}`)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := cm.MigrateFile(short)
+	if err != nil || !migrated {
+		t.Fatalf("迁移结果 %v, %v", migrated, err)
+	}
+	data, _ := os.ReadFile(short)
+	if plain, err := cm.DecryptSM4(data); err != nil || string(plain) != `{}` {
+		t.Fatalf("迁移后解密结果 %q, %v", plain, err)
+	}
+
+	// 无法完整恢复的文件返回错误且保持不变
+	long := filepath.Join(dir, "long.sudb")
+	original := legacyEncryptSM4(t, cm, []byte(`{"collections":["a","b","c"]}`))
+	if err := os.WriteFile(long, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err = cm.MigrateFile(long)
+	if !errors.Is(err, ErrLegacyUnrecoverable) || migrated {
+		t.Fatalf("迁移结果 %v, %v，期望 ErrLegacyUnrecoverable", migrated, err)
+	}
+	if data, _ := os.ReadFile(long); !bytes.Equal(data, original) {
+		t.Fatal("迁移失败后文件被改写")
+	}
+
+	if migrated, err := cm.MigrateFile(filepath.Join(dir, "missing.sudb")); err != nil || migrated {
+		t.Fatalf("不存在的文件迁移结果 %v, %v", migrated, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	old, err := cm.EncryptSM4([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := cm.RotateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 || cm.CurrentKeyVersion() != 2 || len(cm.KeyInfos()) != 2 {
+		t.Fatalf("轮换后的版本 %d，密钥 %+v", version, cm.KeyInfos())
+	}
+
+	// 新数据用新密钥加密，旧密文仍可解密
+	current, err := cm.EncryptSM4([]byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SM4KeyVersion(current); err != nil || v != 2 {
+		t.Fatalf("新密文的密钥版本 %d, %v", v, err)
+	}
+	if !cm.NeedsReencrypt(old) || cm.NeedsReencrypt(current) {
+		t.Fatal("NeedsReencrypt 的结果不正确")
+	}
+	if plain, err := cm.DecryptSM4(old); err != nil || string(plain) != "hello" {
+		t.Fatalf("轮换后解密旧密文: %q, %v", plain, err)
+	}
+
+	reencrypted, changed, err := cm.ReencryptSM4(old)
+	if err != nil || !changed {
+		t.Fatalf("重新加密: %v, %v", changed, err)
+	}
+	if _, changed, _ := cm.ReencryptSM4(reencrypted); changed {
+		t.Fatal("当前密钥的密文被重新加密")
+	}
+
+	retired, err := cm.RetireKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retired) != 1 || retired[0] != 1 {
+		t.Fatalf("停用的版本 %v", retired)
+	}
+	if _, err := cm.DecryptSM4(old); err == nil {
+		t.Fatal("停用的密钥仍能解密")
+	}
+	if plain, err := cm.DecryptSM4(reencrypted); err != nil || string(plain) != "hello" {
+		t.Fatalf("解密重新加密的密文: %q, %v", plain, err)
+	}
+}
+
+func TestReencryptFile(t *testing.T) {
+	cm := newTestCryptoManager(t)
+	path := filepath.Join(t.TempDir(), "f")
+	if changed, err := cm.ReencryptFile(path); err != nil || changed {
+		t.Fatalf("文件不存在时返回 %v, %v", changed, err)
+	}
+
+	data, err := cm.EncryptSM4([]byte("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := cm.ReencryptFile(path); err != nil || !changed {
+		t.Fatalf("重新加密文件返回 %v, %v", changed, err)
+	}
+	if _, err := cm.RetireKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := cm.DecryptSM4(data); err != nil || string(plain) != "content" {
+		t.Fatalf("解密重新加密的文件: %q, %v", plain, err)
+	}
+}
@@ -0,0 +1,59 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// KDFPBKDF2SM3 以 HMAC-SM3 为伪随机函数的 PBKDF2
+const KDFPBKDF2SM3 = "pbkdf2-hmac-sm3"
+
+// PBKDF2SM3 使用 HMAC-SM3 的 PBKDF2（RFC 8018）派生 keyLen 字节的密钥
+func PBKDF2SM3(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sm3.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	out := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
+
+// RandomBytes 生成 n 字节的随机数
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return b, nil
+}
+
+// SM3Sum 计算 SM3 摘要
+func SM3Sum(data []byte) []byte {
+	return sm3Sum(data)
+}
@@ -0,0 +1,404 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 密钥文件：
+//
+//	<filename>       用密钥加密密钥（由主密钥经 KDF 派生）加密的 SM2 私钥和 SM4 数据密钥环
+//
+// 以下是旧版本明文保存的密钥文件，加载后会转换为加密的密钥文件并删除：
+//
+//	<filename>.pri   SM2 私钥
+//	<filename>.keys  SM4 数据密钥环
+//	<filename>.sm4   单个 SM4 密钥，视为第 1 版
+const (
+	privateKeySuffix = ".pri"
+	keyRingSuffix    = ".keys"
+	legacySM4Suffix  = ".sm4"
+
+	keyFileVersion = 1
+
+	// 派生密钥加密密钥的迭代次数
+	kekIterations = 100000
+)
+
+// keyFileAAD 密钥文件加密时的附加数据
+var keyFileAAD = []byte("sudatas-key-file")
+
+// keyRing 密钥文件加密前的内容
+type keyRing struct {
+	PrivateKey []byte         `json:"private_key,omitempty"`
+	Current    uint32         `json:"current"`
+	Keys       []keyRingEntry `json:"keys"`
+}
+
+type keyRingEntry struct {
+	Version uint32    `json:"version"`
+	Key     []byte    `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+// keyFile 加密的密钥文件
+type keyFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// keyEncryptionKey 由主密钥派生的密钥加密密钥
+type keyEncryptionKey struct {
+	key        []byte
+	salt       []byte
+	iterations int
+}
+
+// deriveKEK 由主密钥派生密钥加密密钥
+func deriveKEK(secret, salt []byte, iterations int) *keyEncryptionKey {
+	return &keyEncryptionKey{
+		key:        PBKDF2SM3(secret, salt, iterations, 16),
+		salt:       salt,
+		iterations: iterations,
+	}
+}
+
+// KeysExist 是否存在任何密钥文件
+func KeysExist(filename string) bool {
+	for _, suffix := range []string{"", privateKeySuffix, keyRingSuffix, legacySM4Suffix} {
+		if _, err := os.Stat(filename + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveKeys 用密钥加密密钥加密后保存密钥，之后轮换或停用密钥时会写回同一位置。
+// 需要先通过 LoadKeys 设置主密钥
+func (cm *CryptoManager) SaveKeys(filename string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.keyFile = filename
+	return cm.saveKeyRingLocked()
+}
+
+// saveKeyRingLocked 加密并写回密钥文件，调用方需持有写锁。未关联密钥文件时不做任何事
+func (cm *CryptoManager) saveKeyRingLocked() error {
+	if cm.keyFile == "" {
+		return nil
+	}
+	if cm.kek == nil {
+		return fmt.Errorf("未设置主密钥，不能保存密钥")
+	}
+
+	ring := keyRing{PrivateKey: cm.keyPair.PrivateKey.D.Bytes(), Current: cm.currentKey}
+	for version, k := range cm.sm4Keys {
+		ring.Keys = append(ring.Keys, keyRingEntry{Version: version, Key: k.key, Created: k.created})
+	}
+	sort.Slice(ring.Keys, func(i, j int) bool {
+		return ring.Keys[i].Version < ring.Keys[j].Version
+	})
+	plaintext, err := json.Marshal(ring)
+	if err != nil {
+		return fmt.Errorf("序列化密钥失败: %w", err)
+	}
+
+	aead, err := newSM4GCM(cm.kek.key)
+	if err != nil {
+		return err
+	}
+	nonce, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(keyFile{
+		Version:    keyFileVersion,
+		KDF:        KDFPBKDF2SM3,
+		Salt:       cm.kek.salt,
+		Iterations: cm.kek.iterations,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, keyFileAAD),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥文件失败: %w", err)
+	}
+
+	// 创建密钥目录
+	if err := os.MkdirAll(filepath.Dir(cm.keyFile), 0755); err != nil {
+		return fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+	if err := WriteFileAtomic(cm.keyFile, data, 0600); err != nil {
+		return fmt.Errorf("保存密钥失败: %w", err)
+	}
+	return nil
+}
+
+// LoadKeys 用主密钥解密并加载密钥。
+// 只有在没有任何密钥文件时（首次启动）才会生成新密钥；密钥文件不完整或无法用主密钥解密时返回错误，
+// 以免生成新密钥后已加密的数据再也无法解密。旧版本明文保存的密钥会转换为加密的密钥文件
+func (cm *CryptoManager) LoadKeys(filename string, masterSecret []byte) error {
+	if len(masterSecret) == 0 {
+		return fmt.Errorf("未提供主密钥")
+	}
+
+	if _, err := os.Stat(filename); err == nil {
+		return cm.loadKeyFile(filename, masterSecret)
+	}
+
+	salt, err := RandomBytes(16)
+	if err != nil {
+		return err
+	}
+	kek := deriveKEK(masterSecret, salt, kekIterations)
+
+	if !KeysExist(filename) {
+		// 首次启动，生成新密钥
+		newCrypto, err := NewCryptoManager()
+		if err != nil {
+			return fmt.Errorf("创建新密钥失败: %w", err)
+		}
+		cm.keyPair = newCrypto.keyPair
+		cm.mu.Lock()
+		cm.sm4Keys = newCrypto.sm4Keys
+		cm.currentKey = newCrypto.currentKey
+		cm.kek = kek
+		cm.mu.Unlock()
+		return cm.SaveKeys(filename)
+	}
+
+	// 旧版本明文保存的密钥：加载后加密保存，再删除明文文件
+	if err := cm.loadPlainKeys(filename); err != nil {
+		return err
+	}
+	cm.mu.Lock()
+	cm.kek = kek
+	cm.mu.Unlock()
+	if err := cm.SaveKeys(filename); err != nil {
+		return err
+	}
+	for _, suffix := range []string{privateKeySuffix, keyRingSuffix, legacySM4Suffix} {
+		if err := os.Remove(filename + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除明文密钥文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadKeyFile 解密并加载密钥文件
+func (cm *CryptoManager) loadKeyFile(filename string, masterSecret []byte) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	if file.Version != keyFileVersion || file.KDF != KDFPBKDF2SM3 {
+		return fmt.Errorf("不支持的密钥文件格式: 版本 %d, KDF %s", file.Version, file.KDF)
+	}
+	if file.Iterations <= 0 || len(file.Salt) == 0 {
+		return fmt.Errorf("密钥文件的 KDF 参数无效")
+	}
+
+	kek := deriveKEK(masterSecret, file.Salt, file.Iterations)
+	aead, err := newSM4GCM(kek.key)
+	if err != nil {
+		return err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return fmt.Errorf("密钥文件损坏")
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, keyFileAAD)
+	if err != nil {
+		return fmt.Errorf("无法解密密钥文件：主密钥错误或密钥文件已损坏")
+	}
+
+	var ring keyRing
+	if err := json.Unmarshal(plaintext, &ring); err != nil {
+		return fmt.Errorf("解析密钥失败: %w", err)
+	}
+	if len(ring.PrivateKey) == 0 {
+		return fmt.Errorf("密钥文件中缺少SM2私钥")
+	}
+	keys, err := ring.dataKeys()
+	if err != nil {
+		return err
+	}
+
+	cm.keyPair = newKeyPair(ring.PrivateKey)
+	cm.mu.Lock()
+	cm.sm4Keys = keys
+	cm.currentKey = ring.Current
+	cm.keyFile = filename
+	cm.kek = kek
+	cm.mu.Unlock()
+	return nil
+}
+
+// loadPlainKeys 加载旧版本明文保存的密钥
+func (cm *CryptoManager) loadPlainKeys(filename string) error {
+	// 读取私钥
+	privateKeyFile := filename + privateKeySuffix
+	privateKeyBytes, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("私钥文件 %s 不存在，但存在其他密钥文件，拒绝生成新密钥", privateKeyFile)
+		}
+		return fmt.Errorf("读取私钥失败: %w", err)
+	}
+
+	// 读取SM4密钥环，不存在时读取单密钥文件
+	var keys map[uint32]*dataKey
+	var current uint32
+	data, err := os.ReadFile(filename + keyRingSuffix)
+	switch {
+	case os.IsNotExist(err):
+		sm4Key, err := os.ReadFile(filename + legacySM4Suffix)
+		if err != nil || len(sm4Key) != 16 {
+			return fmt.Errorf("读取SM4密钥失败: %v", err)
+		}
+		keys = map[uint32]*dataKey{1: {key: sm4Key, created: time.Now()}}
+		current = 1
+
+	case err != nil:
+		return fmt.Errorf("读取SM4密钥失败: %w", err)
+
+	default:
+		var ring keyRing
+		if err := json.Unmarshal(data, &ring); err != nil {
+			return fmt.Errorf("解析密钥环失败: %w", err)
+		}
+		if keys, err = ring.dataKeys(); err != nil {
+			return err
+		}
+		current = ring.Current
+	}
+
+	cm.keyPair = newKeyPair(privateKeyBytes)
+	cm.mu.Lock()
+	cm.sm4Keys = keys
+	cm.currentKey = current
+	cm.mu.Unlock()
+	return nil
+}
+
+// dataKeys 校验并返回密钥环中的数据密钥
+func (ring *keyRing) dataKeys() (map[uint32]*dataKey, error) {
+	keys := make(map[uint32]*dataKey, len(ring.Keys))
+	for _, entry := range ring.Keys {
+		if len(entry.Key) != 16 {
+			return nil, fmt.Errorf("第 %d 版SM4密钥长度无效", entry.Version)
+		}
+		keys[entry.Version] = &dataKey{key: entry.Key, created: entry.Created}
+	}
+	if _, ok := keys[ring.Current]; !ok {
+		return nil, fmt.Errorf("密钥环中缺少当前版本（第 %d 版）的SM4密钥", ring.Current)
+	}
+	return keys, nil
+}
+
+// newKeyPair 由私钥标量重新构造SM2密钥对
+func newKeyPair(d []byte) *KeyPair {
+	privateKey := new(sm2.PrivateKey)
+	privateKey.Curve = sm2.P256Sm2()
+	privateKey.D = new(big.Int).SetBytes(d)
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = privateKey.Curve.ScalarBaseMult(d)
+	return &KeyPair{
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+	}
+}
+
+// CurrentKeyVersion 当前用于加密的数据密钥版本
+func (cm *CryptoManager) CurrentKeyVersion() uint32 {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.currentKey
+}
+
+// KeyInfos 返回所有未停用的数据密钥版本，按版本排序
+func (cm *CryptoManager) KeyInfos() []KeyInfo {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(cm.sm4Keys))
+	for version, k := range cm.sm4Keys {
+		infos = append(infos, KeyInfo{Version: version, Created: k.created, Current: version == cm.currentKey})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Version < infos[j].Version
+	})
+	return infos
+}
+
+// RotateKey 生成新版本的数据密钥并设为当前密钥。
+// 旧密钥继续用于解密，直到所有数据重新加密后调用 RetireKeys
+func (cm *CryptoManager) RotateKey() (uint32, error) {
+	key, err := generateSM4Key()
+	if err != nil {
+		return 0, err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var version uint32
+	for v := range cm.sm4Keys {
+		if v > version {
+			version = v
+		}
+	}
+	version++
+
+	previous := cm.currentKey
+	cm.sm4Keys[version] = &dataKey{key: key, created: time.Now()}
+	cm.currentKey = version
+	if err := cm.saveKeyRingLocked(); err != nil {
+		delete(cm.sm4Keys, version)
+		cm.currentKey = previous
+		return 0, err
+	}
+	return version, nil
+}
+
+// RetireKeys 停用当前版本以外的所有数据密钥，返回停用的版本。
+// 只能在所有数据都已用当前密钥重新加密后调用，停用的密钥无法恢复
+func (cm *CryptoManager) RetireKeys() ([]uint32, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	retired := make(map[uint32]*dataKey)
+	for version, k := range cm.sm4Keys {
+		if version != cm.currentKey {
+			retired[version] = k
+			delete(cm.sm4Keys, version)
+		}
+	}
+	if err := cm.saveKeyRingLocked(); err != nil {
+		for version, k := range retired {
+			cm.sm4Keys[version] = k
+		}
+		return nil, err
+	}
+
+	versions := make([]uint32, 0, len(retired))
+	for version := range retired {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions, nil
+}
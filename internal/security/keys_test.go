@@ -0,0 +1,155 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testMasterSecret = []byte("master-secret")
+
+func loadKeys(filename string, secret []byte) (*CryptoManager, error) {
+	cm := &CryptoManager{}
+	return cm, cm.LoadKeys(filename, secret)
+}
+
+func TestLoadKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "keys", "key.sudb")
+
+	// 首次启动生成密钥并加密保存
+	cm, err := loadKeys(filename, testMasterSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := cm.EncryptSM4([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "private_key") {
+		t.Fatal("密钥文件中有明文的密钥环")
+	}
+
+	// 重新加载后密钥和轮换结果都在
+	loaded, err := loadKeys(filename, testMasterSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.CurrentKeyVersion() != 2 || len(loaded.KeyInfos()) != 2 {
+		t.Fatalf("重新加载的密钥 %+v", loaded.KeyInfos())
+	}
+	if plain, err := loaded.DecryptSM4(ciphertext); err != nil || string(plain) != "hello" {
+		t.Fatalf("重新加载后解密: %q, %v", plain, err)
+	}
+	if loaded.keyPair.PrivateKey.D.Cmp(cm.keyPair.PrivateKey.D) != 0 {
+		t.Fatal("重新加载后SM2密钥不同")
+	}
+
+	if _, err := loadKeys(filename, []byte("wrong-secret")); err == nil {
+		t.Fatal("错误的主密钥加载成功")
+	}
+	if _, err := loadKeys(filename, nil); err == nil {
+		t.Fatal("没有主密钥时加载成功")
+	}
+
+	raw[len(raw)/2] ^= 1
+	if err := os.WriteFile(filename, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKeys(filename, testMasterSecret); err == nil {
+		t.Fatal("篡改的密钥文件加载成功")
+	}
+}
+
+func TestLoadKeysMigratesPlainKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "key.sudb")
+	old := newTestCryptoManager(t)
+	if err := os.WriteFile(filename+privateKeySuffix, old.keyPair.PrivateKey.D.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename+legacySM4Suffix, old.sm4Keys[1].key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := old.EncryptSM4([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := loadKeys(filename, testMasterSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := cm.DecryptSM4(ciphertext); err != nil || string(plain) != "hello" {
+		t.Fatalf("转换后解密: %q, %v", plain, err)
+	}
+	for _, suffix := range []string{privateKeySuffix, keyRingSuffix, legacySM4Suffix} {
+		if _, err := os.Stat(filename + suffix); !os.IsNotExist(err) {
+			t.Fatalf("明文密钥文件 %s 没有删除", suffix)
+		}
+	}
+	if _, err := loadKeys(filename, testMasterSecret); err != nil {
+		t.Fatalf("加载转换后的密钥文件: %v", err)
+	}
+}
+
+func TestLoadKeysRefusesIncompleteKeys(t *testing.T) {
+	// 只有 SM4 密钥而没有私钥时不能生成新密钥，否则已加密的数据无法解密
+	filename := filepath.Join(t.TempDir(), "key.sudb")
+	if err := os.WriteFile(filename+legacySM4Suffix, make([]byte, 16), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKeys(filename, testMasterSecret); err == nil {
+		t.Fatal("缺少私钥时加载成功")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatal("缺少私钥时生成了新的密钥文件")
+	}
+}
+
+func TestMasterKeySource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "master")
+	if err := os.WriteFile(file, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const env = "SUDATAS_TEST_MASTER_KEY"
+	os.Setenv(env, "env-secret")
+	defer os.Unsetenv(env)
+
+	// 文件优先于环境变量，行尾的换行不属于主密钥
+	secret, err := MasterKeySource{File: file, Env: env}.Secret()
+	if err != nil || string(secret) != "file-secret" {
+		t.Fatalf("从文件读取: %q, %v", secret, err)
+	}
+
+	// 读取环境变量后清除
+	secret, err = MasterKeySource{Env: env}.Secret()
+	if err != nil || string(secret) != "env-secret" {
+		t.Fatalf("从环境变量读取: %q, %v", secret, err)
+	}
+	if os.Getenv(env) != "" {
+		t.Fatal("读取后环境变量没有清除")
+	}
+
+	secret, err = MasterKeySource{Env: env, Prompt: strings.NewReader("prompt-secret\r\n")}.Secret()
+	if err != nil || string(secret) != "prompt-secret" {
+		t.Fatalf("从输入读取: %q, %v", secret, err)
+	}
+
+	for _, source := range []MasterKeySource{
+		{Env: env},
+		{Prompt: strings.NewReader("short\n")},
+		{File: filepath.Join(dir, "missing")},
+	} {
+		if _, err := source.Secret(); err == nil {
+			t.Errorf("来源 %+v 读取成功", source)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package security
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 字段脱敏方式
+const (
+	// MaskPartial 部分遮盖：字符串只保留首尾字符，邮箱保留首字符和域名
+	MaskPartial = "PARTIAL"
+
+	// MaskHash 替换为 SM3 摘要的十六进制，相同的值脱敏后仍然相同
+	MaskHash = "HASH"
+)
+
+// ValidMask 是否为支持的脱敏方式
+func ValidMask(method string) bool {
+	return method == MaskPartial || method == MaskHash
+}
+
+// MaskValue 按脱敏方式处理字段值，null 保持不变
+func MaskValue(method string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch method {
+	case MaskHash:
+		data, err := json.Marshal(value)
+		if err != nil {
+			data = []byte(fmt.Sprint(value))
+		}
+		return hex.EncodeToString(sm3Sum(data))
+
+	default:
+		switch v := value.(type) {
+		case string:
+			return maskString(v)
+		case map[string]interface{}, []interface{}:
+			return "****"
+		default:
+			return maskString(fmt.Sprint(v))
+		}
+	}
+}
+
+// maskString 遮盖字符串中间的字符
+func maskString(s string) string {
+	if at := strings.LastIndex(s, "@"); at > 0 {
+		local := []rune(s[:at])
+		return string(local[0]) + "***" + s[at:]
+	}
+
+	runes := []rune(s)
+	if len(runes) <= 2 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-2) + string(runes[len(runes)-1])
+}
@@ -0,0 +1,34 @@
+package security
+
+import "testing"
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		method string
+		value  interface{}
+		want   interface{}
+	}{
+		{MaskPartial, "13800001111", "1*********1"},
+		{MaskPartial, "alice@example.com", "a***@example.com"},
+		{MaskPartial, "张三丰", "张*丰"},
+		{MaskPartial, "ab", "**"},
+		{MaskPartial, 12345.0, "1***5"},
+		{MaskPartial, map[string]interface{}{"a": 1.0}, "****"},
+		{MaskPartial, nil, nil},
+		{MaskHash, nil, nil},
+	}
+	for _, tt := range tests {
+		if got := MaskValue(tt.method, tt.value); got != tt.want {
+			t.Errorf("MaskValue(%s, %v) = %v，期望 %v", tt.method, tt.value, got, tt.want)
+		}
+	}
+
+	// 相同的值摘要相同，不同的值摘要不同
+	a, b := MaskValue(MaskHash, "123456789"), MaskValue(MaskHash, "123456780")
+	if a != MaskValue(MaskHash, "123456789") || a == b || len(a.(string)) != 64 {
+		t.Fatalf("摘要脱敏结果 %v %v", a, b)
+	}
+	if ValidMask("partial") || !ValidMask(MaskPartial) || !ValidMask(MaskHash) {
+		t.Fatal("ValidMask 的结果不正确")
+	}
+}
@@ -0,0 +1,70 @@
+package security
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultMasterKeyEnv 默认保存主密钥的环境变量
+const DefaultMasterKeyEnv = "SUDATAS_MASTER_KEY"
+
+// minMasterKeyLength 主密钥（口令）的最小长度
+const minMasterKeyLength = 8
+
+// MasterKeySource 主密钥的来源。主密钥经 KDF 派生出密钥加密密钥，用于加密保存数据密钥。
+// 按 File、Env、Prompt 的顺序使用第一个配置的来源
+type MasterKeySource struct {
+	File   string    // 主密钥文件，应放在与数据目录分开的挂载点上
+	Env    string    // 保存主密钥的环境变量名，读取后会从进程环境中清除
+	Prompt io.Reader // 从中读取一行口令，通常为终端的标准输入
+}
+
+// Secret 读取主密钥
+func (s MasterKeySource) Secret() ([]byte, error) {
+	secret, configured, err := readSecret(s.File, s.Env, s.Prompt, "主密钥", "主密钥口令")
+	if err != nil {
+		return nil, err
+	}
+	if !configured {
+		env := s.Env
+		if env == "" {
+			env = DefaultMasterKeyEnv
+		}
+		return nil, fmt.Errorf("未配置主密钥：请通过主密钥文件、环境变量 %s 或口令提供", env)
+	}
+
+	if len(secret) < minMasterKeyLength {
+		return nil, fmt.Errorf("主密钥至少需要 %d 个字符", minMasterKeyLength)
+	}
+	return []byte(secret), nil
+}
+
+// readSecret 按文件、环境变量、终端输入的顺序读取第一个配置的来源，configured 表示是否有配置的来源。
+// 从环境变量读取后会清除该变量
+func readSecret(file, env string, prompt io.Reader, what, promptName string) (secret string, configured bool, err error) {
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", true, fmt.Errorf("读取%s文件失败: %w", what, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+
+	case env != "" && os.Getenv(env) != "":
+		secret := os.Getenv(env)
+		os.Unsetenv(env)
+		return secret, true, nil
+
+	case prompt != nil:
+		fmt.Fprintf(os.Stderr, "请输入%s: ", promptName)
+		line, err := bufio.NewReader(prompt).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", true, fmt.Errorf("读取%s失败: %w", promptName, err)
+		}
+		return strings.TrimRight(line, "\r\n"), true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,133 @@
+package security
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// 口令凭据采用类似 SCRAM 的挑战-应答方式：
+//
+//	SaltedPassword = PBKDF2-HMAC-SM3(口令, Salt, Iterations)
+//	ClientKey      = HMAC-SM3(SaltedPassword, "Client Key")
+//	StoredKey      = SM3(ClientKey)
+//	Signature      = HMAC-SM3(StoredKey, 认证消息)
+//	Proof          = ClientKey XOR Signature
+//
+// 服务端只保存 Salt、Iterations 和 StoredKey，口令和 ClientKey 都不会在网络上传输，
+// 泄露的 StoredKey 也不能直接用于登录。
+const (
+	// DefaultPasswordIterations 新建口令凭据的迭代次数
+	DefaultPasswordIterations = 10000
+
+	// MinPasswordIterations 客户端接受的最小迭代次数，防止服务端被冒充时降低强度
+	MinPasswordIterations = 4096
+
+	passwordSaltSize = 16
+	sm3Size          = 32
+)
+
+// PasswordHash 加盐迭代的口令凭据
+type PasswordHash struct {
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	StoredKey  []byte `json:"stored_key"`
+}
+
+// NewPasswordHash 用随机盐生成口令凭据
+func NewPasswordHash(password string) (*PasswordHash, error) {
+	salt, err := RandomBytes(passwordSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	clientKey := passwordClientKey(password, salt, DefaultPasswordIterations)
+	return &PasswordHash{
+		KDF:        KDFPBKDF2SM3,
+		Salt:       salt,
+		Iterations: DefaultPasswordIterations,
+		StoredKey:  sm3Sum(clientKey),
+	}, nil
+}
+
+// DecoyPasswordHash 为不存在的用户生成固定的假凭据，使挑战与真实用户无法区分。
+// secret 应为进程内的随机数
+func DecoyPasswordHash(username string, secret []byte) *PasswordHash {
+	mac := hmac.New(sm3.New, secret)
+	mac.Write([]byte(username))
+	sum := mac.Sum(nil)
+	return &PasswordHash{
+		KDF:        KDFPBKDF2SM3,
+		Salt:       sum[:passwordSaltSize],
+		Iterations: DefaultPasswordIterations,
+		StoredKey:  sm3Sum(sum),
+	}
+}
+
+// Verify 校验口令
+func (h *PasswordHash) Verify(password string) bool {
+	if h.KDF != KDFPBKDF2SM3 || h.Iterations <= 0 {
+		return false
+	}
+	clientKey := passwordClientKey(password, h.Salt, h.Iterations)
+	return subtle.ConstantTimeCompare(sm3Sum(clientKey), h.StoredKey) == 1
+}
+
+// VerifyProof 校验客户端对认证消息的应答
+func (h *PasswordHash) VerifyProof(authMessage, proof []byte) bool {
+	if h.KDF != KDFPBKDF2SM3 || len(proof) != len(h.StoredKey) {
+		return false
+	}
+	signature := hmacSM3(h.StoredKey, authMessage)
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ signature[i]
+	}
+	return subtle.ConstantTimeCompare(sm3Sum(clientKey), h.StoredKey) == 1
+}
+
+// PasswordProof 客户端根据口令和服务端的挑战计算应答
+func PasswordProof(password string, salt []byte, iterations int, authMessage []byte) ([]byte, error) {
+	if iterations < MinPasswordIterations {
+		return nil, fmt.Errorf("服务端要求的迭代次数过低: %d", iterations)
+	}
+	clientKey := passwordClientKey(password, salt, iterations)
+	signature := hmacSM3(sm3Sum(clientKey), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return proof, nil
+}
+
+// PasswordAuthMessage 构造双方签名的认证消息，包含用户名、双方随机数和挑战参数
+func PasswordAuthMessage(username string, clientNonce, serverNonce, salt []byte, iterations int) []byte {
+	var buf bytes.Buffer
+	for _, field := range [][]byte{[]byte(username), clientNonce, serverNonce, salt} {
+		binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(iterations))
+	return buf.Bytes()
+}
+
+func passwordClientKey(password string, salt []byte, iterations int) []byte {
+	salted := PBKDF2SM3([]byte(password), salt, iterations, sm3Size)
+	return hmacSM3(salted, []byte("Client Key"))
+}
+
+func hmacSM3(key, data []byte) []byte {
+	mac := hmac.New(sm3.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func sm3Sum(data []byte) []byte {
+	h := sm3.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPasswordHash(t *testing.T) {
+	h, err := NewPasswordHash("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.KDF != KDFPBKDF2SM3 || h.Iterations != DefaultPasswordIterations || len(h.Salt) != passwordSaltSize {
+		t.Fatalf("口令凭据 %+v", h)
+	}
+	if !h.Verify("s3cret") || h.Verify("s3cre") || h.Verify("") {
+		t.Fatal("口令校验结果错误")
+	}
+
+	// 相同口令每次生成的盐和凭据都不同
+	other, err := NewPasswordHash("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(h.Salt, other.Salt) || bytes.Equal(h.StoredKey, other.StoredKey) {
+		t.Fatal("相同口令生成了相同的凭据")
+	}
+
+	if (&PasswordHash{KDF: "plain", Salt: h.Salt, Iterations: h.Iterations, StoredKey: h.StoredKey}).Verify("s3cret") {
+		t.Fatal("不支持的算法校验成功")
+	}
+}
+
+func TestPasswordProof(t *testing.T) {
+	h, err := NewPasswordHash("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authMessage := PasswordAuthMessage("alice", []byte("client-nonce"), []byte("server-nonce"), h.Salt, h.Iterations)
+
+	proof, err := PasswordProof("s3cret", h.Salt, h.Iterations, authMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.VerifyProof(authMessage, proof) {
+		t.Fatal("正确口令的应答校验失败")
+	}
+	// 应答不能用于另一次挑战
+	otherMessage := PasswordAuthMessage("alice", []byte("client-nonce"), []byte("server-nonce2"), h.Salt, h.Iterations)
+	if h.VerifyProof(otherMessage, proof) {
+		t.Fatal("应答可以重放到另一次挑战")
+	}
+
+	wrong, err := PasswordProof("wrong", h.Salt, h.Iterations, authMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.VerifyProof(authMessage, wrong) || h.VerifyProof(authMessage, proof[:10]) {
+		t.Fatal("错误的应答校验成功")
+	}
+
+	// 服务端要求的迭代次数过低时客户端拒绝计算
+	if _, err := PasswordProof("s3cret", h.Salt, MinPasswordIterations-1, authMessage); err == nil {
+		t.Fatal("接受了过低的迭代次数")
+	}
+}
+
+func TestPasswordAuthMessage(t *testing.T) {
+	// 字段带长度前缀，移动字段边界得到不同的消息
+	a := PasswordAuthMessage("ab", []byte("c"), nil, nil, 1)
+	b := PasswordAuthMessage("a", []byte("bc"), nil, nil, 1)
+	if bytes.Equal(a, b) {
+		t.Fatal("不同字段拼接出相同的认证消息")
+	}
+}
+
+func TestDecoyPasswordHash(t *testing.T) {
+	secret := []byte("process-secret")
+	a := DecoyPasswordHash("ghost", secret)
+	b := DecoyPasswordHash("ghost", secret)
+	// 同一用户名的假挑战保持不变，否则多次请求即可分辨用户是否存在
+	if !bytes.Equal(a.Salt, b.Salt) || a.Iterations != DefaultPasswordIterations || len(a.Salt) != passwordSaltSize {
+		t.Fatalf("假凭据 %+v / %+v", a, b)
+	}
+	if bytes.Equal(a.Salt, DecoyPasswordHash("ghost2", secret).Salt) {
+		t.Fatal("不同用户名的假凭据相同")
+	}
+	if bytes.Equal(a.Salt, DecoyPasswordHash("ghost", []byte("other")).Salt) {
+		t.Fatal("假凭据与进程密钥无关")
+	}
+}
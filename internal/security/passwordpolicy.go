@@ -0,0 +1,94 @@
+package security
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultRootPasswordEnv 首次启动时提供 root 口令的默认环境变量
+const DefaultRootPasswordEnv = "SUDATAS_ROOT_PASSWORD"
+
+// PasswordPolicy 口令策略
+type PasswordPolicy struct {
+	MinLength   int           // 最小长度（字符数）
+	MinClasses  int           // 至少包含的字符类别数：小写字母、大写字母、数字、其他字符
+	MaxAge      time.Duration // 口令有效期，过期后登录必须先修改口令，0 表示不过期
+	HistorySize int           // 新口令不能与当前口令和最近多少个旧口令相同，0 表示不检查
+}
+
+// DefaultPasswordPolicy 默认的口令策略
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   8,
+		MinClasses:  3,
+		MaxAge:      90 * 24 * time.Hour,
+		HistorySize: 5,
+	}
+}
+
+// Validate 检查口令是否满足长度和复杂度要求，口令中不能包含用户名
+func (p PasswordPolicy) Validate(username, password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("口令至少需要 %d 个字符", p.MinLength)
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("口令至少需要包含小写字母、大写字母、数字、其他字符中的 %d 类", p.MinClasses)
+	}
+
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("口令不能包含用户名")
+	}
+	return nil
+}
+
+// Expired 口令自 changedAt 修改后是否已经过期
+func (p PasswordPolicy) Expired(changedAt, now time.Time) bool {
+	return p.MaxAge > 0 && !changedAt.IsZero() && now.Sub(changedAt) > p.MaxAge
+}
+
+// InitialPasswordSource 首次启动时 root 口令的来源，按 File、Env、Prompt 的顺序使用第一个配置的来源
+type InitialPasswordSource struct {
+	File   string
+	Env    string // 读取后会从进程环境中清除
+	Prompt io.Reader
+}
+
+// Password 读取 root 口令
+func (s InitialPasswordSource) Password() (string, error) {
+	password, configured, err := readSecret(s.File, s.Env, s.Prompt, "root 口令", "root 口令")
+	if err != nil {
+		return "", err
+	}
+	if !configured {
+		env := s.Env
+		if env == "" {
+			env = DefaultRootPasswordEnv
+		}
+		return "", fmt.Errorf("首次启动需要设置 root 口令：请通过口令文件、环境变量 %s 或终端输入提供", env)
+	}
+	return password, nil
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	tests := []struct {
+		username string
+		password string
+		valid    bool
+	}{
+		{"bob", "Secret-123", true},
+		{"bob", "secret-123", true}, // 小写、数字、其他字符
+		{"bob", "Secret123", true},  // 小写、大写、数字
+		{"bob", "Sec-12", false},    // 太短
+		{"bob", "secret123", false}, // 只有两类
+		{"bob", "Bob-12345", false}, // 包含用户名，不区分大小写
+		{"al", "al-Secret1", true},  // 过短的用户名不检查
+		{"bob", "密码密码-Ab1", true},   // 按字符计算长度
+		{"bob", "密码-Ab1", false},    // 6 个字符
+		{"root", "Admin-pass-1", true},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.username, tt.password)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s / %s: %v", tt.username, tt.password, err)
+		}
+	}
+
+	if err := (PasswordPolicy{MinLength: 1}).Validate("bob", "x"); err != nil {
+		t.Fatalf("宽松的策略拒绝了口令: %v", err)
+	}
+}
+
+func TestPasswordPolicyExpired(t *testing.T) {
+	now := time.Now()
+	policy := PasswordPolicy{MaxAge: time.Hour}
+	if policy.Expired(now.Add(-time.Minute), now) || !policy.Expired(now.Add(-2*time.Hour), now) {
+		t.Fatal("口令过期判断错误")
+	}
+	// 没有记录修改时间或不限有效期时不过期
+	if policy.Expired(time.Time{}, now) || (PasswordPolicy{}).Expired(now.Add(-1000*time.Hour), now) {
+		t.Fatal("不应过期的口令过期了")
+	}
+}
+
+func TestInitialPasswordSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "root")
+	if err := os.WriteFile(file, []byte("Admin-pass-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := (InitialPasswordSource{File: file}).Password(); err != nil || password != "Admin-pass-1" {
+		t.Fatalf("从文件读取: %q, %v", password, err)
+	}
+
+	const env = "SUDATAS_TEST_ROOT_PASSWORD"
+	os.Setenv(env, "Env-pass-1")
+	defer os.Unsetenv(env)
+	if password, err := (InitialPasswordSource{Env: env}).Password(); err != nil || password != "Env-pass-1" {
+		t.Fatalf("从环境变量读取: %q, %v", password, err)
+	}
+	if os.Getenv(env) != "" {
+		t.Fatal("读取后环境变量没有清除")
+	}
+
+	if password, err := (InitialPasswordSource{Prompt: strings.NewReader("Prompt-pass-1\n")}).Password(); err != nil || password != "Prompt-pass-1" {
+		t.Fatalf("从输入读取: %q, %v", password, err)
+	}
+
+	// 没有任何来源时提示如何设置
+	_, err := (InitialPasswordSource{Env: env}).Password()
+	if err == nil || !strings.Contains(err.Error(), env) {
+		t.Fatalf("没有来源时: %v", err)
+	}
+}
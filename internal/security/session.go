@@ -0,0 +1,143 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 国密会话模式按 SM2 密钥交换协议（GB/T 32918.3）协商每个连接的会话密钥：
+//
+//  1. 客户端为本次连接生成 SM2 密钥和临时密钥，把两个公钥发给服务端
+//  2. 服务端用 CryptoManager 的 SM2 私钥和新的临时密钥完成协商，返回临时公钥和确认值
+//  3. 客户端用预先配置的服务端公钥完成协商并核对确认值，不符说明对方不持有服务端私钥
+//
+// 协商出的 32 字节密钥拆成两个方向的 SM4 会话密钥，连接断开后即丢弃
+const (
+	sessionKeySize       = 16
+	sessionAgreementSize = 2 * sessionKeySize
+)
+
+// 参与协商的双方标识
+var (
+	sessionClientID = []byte("sudatas-client")
+	sessionServerID = []byte("sudatas-server")
+)
+
+// SessionKeys 一个连接两个方向的 SM4 会话密钥
+type SessionKeys struct {
+	ClientWrite []byte // 客户端发往服务端
+	ServerWrite []byte // 服务端发往客户端
+}
+
+// SessionInitiator 客户端一侧的密钥协商
+type SessionInitiator struct {
+	serverKey *sm2.PublicKey
+	key       *sm2.PrivateKey
+	ephemeral *sm2.PrivateKey
+}
+
+// NewSessionInitiator 为一次连接生成客户端的 SM2 密钥。serverKey 是服务端公钥的十六进制形式，用来认证服务端
+func NewSessionInitiator(serverKey string) (*SessionInitiator, error) {
+	raw, err := hex.DecodeString(serverKey)
+	if err != nil {
+		return nil, fmt.Errorf("无效的服务端公钥: %w", err)
+	}
+	pub, err := UnmarshalSM2PublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("无效的服务端公钥: %w", err)
+	}
+
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成SM2密钥对失败: %w", err)
+	}
+	ephemeral, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成SM2临时密钥失败: %w", err)
+	}
+	return &SessionInitiator{serverKey: pub, key: key, ephemeral: ephemeral}, nil
+}
+
+// PublicKeys 发给服务端的客户端公钥和临时公钥
+func (si *SessionInitiator) PublicKeys() (public, ephemeral []byte) {
+	return MarshalSM2PublicKey(&si.key.PublicKey), MarshalSM2PublicKey(&si.ephemeral.PublicKey)
+}
+
+// Finish 用服务端的临时公钥和确认值完成协商
+func (si *SessionInitiator) Finish(serverEphemeral, confirm []byte) (*SessionKeys, error) {
+	rpub, err := UnmarshalSM2PublicKey(serverEphemeral)
+	if err != nil {
+		return nil, fmt.Errorf("无效的服务端临时公钥: %w", err)
+	}
+	k, s1, _, err := sm2.KeyExchangeA(sessionAgreementSize, sessionClientID, sessionServerID, si.key, si.serverKey, si.ephemeral, rpub)
+	if err != nil {
+		return nil, fmt.Errorf("SM2密钥协商失败: %w", err)
+	}
+	if subtle.ConstantTimeCompare(s1, confirm) != 1 {
+		return nil, fmt.Errorf("SM2密钥协商失败: 服务端确认值不符，服务端公钥可能不正确")
+	}
+	return splitSessionKey(k), nil
+}
+
+// SessionPublicKey 服务端用于会话密钥协商的 SM2 公钥，十六进制形式，供客户端配置
+func (cm *CryptoManager) SessionPublicKey() string {
+	return hex.EncodeToString(MarshalSM2PublicKey(cm.keyPair.PublicKey))
+}
+
+// AcceptSession 服务端一侧的密钥协商，返回服务端临时公钥、确认值和会话密钥
+func (cm *CryptoManager) AcceptSession(clientPublic, clientEphemeral []byte) (ephemeral, confirm []byte, keys *SessionKeys, err error) {
+	pub, err := UnmarshalSM2PublicKey(clientPublic)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("无效的客户端公钥: %w", err)
+	}
+	rpub, err := UnmarshalSM2PublicKey(clientEphemeral)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("无效的客户端临时公钥: %w", err)
+	}
+
+	rpri, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("生成SM2临时密钥失败: %w", err)
+	}
+	k, s1, _, err := sm2.KeyExchangeB(sessionAgreementSize, sessionClientID, sessionServerID, cm.keyPair.PrivateKey, pub, rpri, rpub)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("SM2密钥协商失败: %w", err)
+	}
+	return MarshalSM2PublicKey(&rpri.PublicKey), s1, splitSessionKey(k), nil
+}
+
+func splitSessionKey(k []byte) *SessionKeys {
+	return &SessionKeys{
+		ClientWrite: k[:sessionKeySize],
+		ServerWrite: k[sessionKeySize:],
+	}
+}
+
+// MarshalSM2PublicKey 公钥的非压缩形式：0x04 | X(32字节) | Y(32字节)
+func MarshalSM2PublicKey(pub *sm2.PublicKey) []byte {
+	buf := make([]byte, 65)
+	buf[0] = 4
+	pub.X.FillBytes(buf[1:33])
+	pub.Y.FillBytes(buf[33:])
+	return buf
+}
+
+// UnmarshalSM2PublicKey 解析非压缩形式的公钥，并检查点在曲线上
+func UnmarshalSM2PublicKey(data []byte) (*sm2.PublicKey, error) {
+	if len(data) != 65 || data[0] != 4 {
+		return nil, fmt.Errorf("公钥格式错误")
+	}
+	curve := sm2.P256Sm2()
+	x := new(big.Int).SetBytes(data[1:33])
+	y := new(big.Int).SetBytes(data[33:])
+	p := curve.Params().P
+	if x.Cmp(p) >= 0 || y.Cmp(p) >= 0 || !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("公钥不在SM2曲线上")
+	}
+	return &sm2.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -0,0 +1,172 @@
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// exchange 完成一次客户端与服务端的密钥协商
+func exchange(t *testing.T, server *CryptoManager, serverKey string) (client, accepted *SessionKeys, err error) {
+	t.Helper()
+	initiator, err := NewSessionInitiator(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, ephemeral := initiator.PublicKeys()
+	serverEphemeral, confirm, accepted, err := server.AcceptSession(public, ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = initiator.Finish(serverEphemeral, confirm)
+	return client, accepted, err
+}
+
+func TestSessionKeyExchange(t *testing.T) {
+	server := newTestCryptoManager(t)
+	client, accepted, err := exchange(t, server, server.SessionPublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(client.ClientWrite, accepted.ClientWrite) || !bytes.Equal(client.ServerWrite, accepted.ServerWrite) {
+		t.Fatal("双方协商出的会话密钥不同")
+	}
+	if bytes.Equal(client.ClientWrite, client.ServerWrite) || len(client.ClientWrite) != sessionKeySize {
+		t.Fatalf("会话密钥 %x / %x", client.ClientWrite, client.ServerWrite)
+	}
+
+	// 每个连接的会话密钥不同
+	again, _, err := exchange(t, server, server.SessionPublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again.ClientWrite, client.ClientWrite) {
+		t.Fatal("两次协商得到相同的会话密钥")
+	}
+
+	// 客户端配置的公钥与服务端私钥不符时协商失败
+	other := newTestCryptoManager(t)
+	if _, _, err := exchange(t, server, other.SessionPublicKey()); err == nil {
+		t.Fatal("服务端公钥不符时协商成功")
+	}
+}
+
+func TestSessionInitiatorRejectsBadKeys(t *testing.T) {
+	server := newTestCryptoManager(t)
+	key := server.SessionPublicKey()
+	for _, bad := range []string{"zz", "", key[:len(key)-2], "05" + key[2:], key[:len(key)-2] + "00"} {
+		if _, err := NewSessionInitiator(bad); err == nil {
+			t.Errorf("接受了无效的服务端公钥 %q", bad)
+		}
+	}
+
+	initiator, err := NewSessionInitiator(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, _ := initiator.PublicKeys()
+	if _, _, _, err := server.AcceptSession(public, []byte{4, 1, 2}); err == nil {
+		t.Fatal("接受了无效的客户端临时公钥")
+	}
+}
+
+var testSessionKeys = &SessionKeys{
+	ClientWrite: bytes.Repeat([]byte{1}, sessionKeySize),
+	ServerWrite: bytes.Repeat([]byte{2}, sessionKeySize),
+}
+
+func TestSessionConn(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	client, err := NewSessionConn(c, nil, testSessionKeys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewSessionConn(s, nil, testSessionKeys, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过记录上限的数据拆成多个记录
+	data := bytes.Repeat([]byte("0123456789"), maxSessionRecord/5)
+	go client.Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("解密后的数据不同")
+	}
+
+	go server.Write([]byte("pong"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(client, reply); err != nil || string(reply) != "pong" {
+		t.Fatalf("反方向: %q, %v", reply, err)
+	}
+}
+
+func TestSessionConnRejectsTampering(t *testing.T) {
+	// 截获客户端发出的一个记录
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	client, err := NewSessionConn(c, nil, testSessionKeys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Write([]byte("secret"))
+	var length uint32
+	if err := binary.Read(s, binary.BigEndian, &length); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(s, record); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(record, []byte("secret")) {
+		t.Fatal("记录中有明文")
+	}
+
+	// receive 用服务端的会话连接读取给定的记录流
+	receive := func(records ...[]byte) (*SessionConn, error) {
+		var stream bytes.Buffer
+		for _, r := range records {
+			binary.Write(&stream, binary.BigEndian, uint32(len(r)))
+			stream.Write(r)
+		}
+		return NewSessionConn(s, &stream, testSessionKeys, false)
+	}
+	buf := make([]byte, 16)
+
+	// 重放的记录序号不符
+	server, err := receive(record, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "secret" {
+		t.Fatalf("读取原记录: %q, %v", buf[:n], err)
+	}
+	if _, err := server.Read(buf); err == nil {
+		t.Fatal("重放的记录解密成功")
+	}
+
+	tampered := append([]byte(nil), record...)
+	tampered[0] ^= 1
+	if server, err = receive(tampered); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Read(buf); err == nil {
+		t.Fatal("篡改的记录解密成功")
+	}
+
+	// 长度不足认证标签的记录
+	if server, err = receive(make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Read(buf); err == nil {
+		t.Fatal("接受了过短的记录")
+	}
+}
@@ -0,0 +1,114 @@
+package security
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// 会话连接的记录格式：
+//
+//	长度(4字节) | SM4-GCM 密文 | 认证标签(16字节)
+//
+// 随机数由本方向的记录序号构成，记录被篡改、重放、删除或调换顺序都会解密失败
+const maxSessionRecord = 1 << 20
+
+// SessionConn 用 SM4 会话密钥加密的连接
+type SessionConn struct {
+	net.Conn
+	reader io.Reader
+
+	rmu     sync.Mutex
+	recv    cipher.AEAD
+	recvSeq uint64
+	pending []byte // 已解密尚未读取的数据
+
+	wmu     sync.Mutex
+	send    cipher.AEAD
+	sendSeq uint64
+}
+
+// NewSessionConn 在完成密钥协商的连接上启用会话加密。reader 为读取协商消息时使用的缓冲读取器，
+// 为空时直接读取 conn；isClient 决定两个方向各使用哪个密钥
+func NewSessionConn(conn net.Conn, reader io.Reader, keys *SessionKeys, isClient bool) (*SessionConn, error) {
+	sendKey, recvKey := keys.ServerWrite, keys.ClientWrite
+	if isClient {
+		sendKey, recvKey = keys.ClientWrite, keys.ServerWrite
+	}
+	send, err := newSM4GCM(sendKey)
+	if err != nil {
+		return nil, fmt.Errorf("初始化会话密钥失败: %w", err)
+	}
+	recv, err := newSM4GCM(recvKey)
+	if err != nil {
+		return nil, fmt.Errorf("初始化会话密钥失败: %w", err)
+	}
+	if reader == nil {
+		reader = conn
+	}
+	return &SessionConn{Conn: conn, reader: reader, send: send, recv: recv}, nil
+}
+
+// Read 读取并解密下一个记录
+func (c *SessionConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if len(c.pending) == 0 {
+		var length uint32
+		if err := binary.Read(c.reader, binary.BigEndian, &length); err != nil {
+			return 0, err
+		}
+		if length < uint32(c.recv.Overhead()) || length > maxSessionRecord+uint32(c.recv.Overhead()) {
+			return 0, fmt.Errorf("无效的会话记录长度: %d", length)
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, record); err != nil {
+			return 0, err
+		}
+		plain, err := c.recv.Open(record[:0], sessionNonce(c.recv, c.recvSeq), record, nil)
+		if err != nil {
+			return 0, fmt.Errorf("会话记录校验失败: %w", err)
+		}
+		c.recvSeq++
+		c.pending = plain
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write 加密后写入，超过记录上限的数据拆成多个记录
+func (c *SessionConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxSessionRecord {
+			chunk = chunk[:maxSessionRecord]
+		}
+		record := make([]byte, 4, 4+len(chunk)+c.send.Overhead())
+		record = c.send.Seal(record, sessionNonce(c.send, c.sendSeq), chunk, nil)
+		binary.BigEndian.PutUint32(record, uint32(len(record)-4))
+		if _, err := c.Conn.Write(record); err != nil {
+			return written, err
+		}
+		c.sendSeq++
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// sessionNonce 由记录序号构成的随机数，同一密钥下不会重复
+func sessionNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
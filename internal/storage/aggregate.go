@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 支持的聚合函数
+const (
+	AggCount = "COUNT"
+	AggSum   = "SUM"
+	AggAvg   = "AVG"
+	AggMin   = "MIN"
+	AggMax   = "MAX"
+)
+
+// Aggregate 聚合函数定义
+type Aggregate struct {
+	Func     string // COUNT/SUM/AVG/MIN/MAX
+	Field    string // "*" 仅用于 COUNT
+	Distinct bool
+	Alias    string
+}
+
+// Name 返回聚合结果的字段名：有别名时用别名，否则为 FUNC(field)
+func (a Aggregate) Name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	if a.Distinct {
+		return fmt.Sprintf("%s(DISTINCT %s)", a.Func, a.Field)
+	}
+	return fmt.Sprintf("%s(%s)", a.Func, a.Field)
+}
+
+// Validate 检查聚合函数定义是否有效
+func (a Aggregate) Validate() error {
+	switch a.Func {
+	case AggCount:
+		if a.Field == "*" && a.Distinct {
+			return fmt.Errorf("COUNT(DISTINCT *) 无效")
+		}
+	case AggSum, AggAvg, AggMin, AggMax:
+		if a.Field == "*" {
+			return fmt.Errorf("%s 不能作用于 *", a.Func)
+		}
+	default:
+		return fmt.Errorf("不支持的聚合函数: %s", a.Func)
+	}
+	return nil
+}
+
+// aggState 单个分组内某个聚合函数的累计状态
+type aggState struct {
+	agg   Aggregate
+	seen  map[string]bool // DISTINCT 去重
+	count int
+	sum   float64
+	nums  int // 参与求和的数值个数
+	best  interface{}
+	found bool
+}
+
+func newAggState(agg Aggregate) *aggState {
+	st := &aggState{agg: agg}
+	if agg.Distinct {
+		st.seen = make(map[string]bool)
+	}
+	return st
+}
+
+// add 累计一条记录
+func (st *aggState) add(record Row) {
+	if st.agg.Field == "*" {
+		st.count++
+		return
+	}
+
+	val, exists := GetPath(record, st.agg.Field)
+	if !exists || val == nil {
+		return // 与SQL一致，忽略NULL
+	}
+
+	if st.seen != nil {
+		key := valueKey(val)
+		if st.seen[key] {
+			return
+		}
+		st.seen[key] = true
+	}
+
+	st.count++
+	if f, ok := toFloat64(val); ok {
+		st.sum += f
+		st.nums++
+	}
+
+	switch st.agg.Func {
+	case AggMin:
+		if !st.found || compareSortValues(val, true, st.best, true) < 0 {
+			st.best = val
+		}
+		st.found = true
+	case AggMax:
+		if !st.found || compareSortValues(val, true, st.best, true) > 0 {
+			st.best = val
+		}
+		st.found = true
+	}
+}
+
+// result 返回聚合结果；没有可聚合的值时 SUM/AVG/MIN/MAX 返回 nil
+func (st *aggState) result() interface{} {
+	switch st.agg.Func {
+	case AggCount:
+		return float64(st.count)
+	case AggSum:
+		if st.nums == 0 {
+			return nil
+		}
+		return st.sum
+	case AggAvg:
+		if st.nums == 0 {
+			return nil
+		}
+		return st.sum / float64(st.nums)
+	default:
+		return st.best
+	}
+}
+
+// valueKey 将任意值编码为可比较的键，用于分组和去重
+func valueKey(v interface{}) string {
+	if f, ok := toFloat64(v); ok {
+		v = f // 1 和 1.0 视为相同
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	return string(data)
+}
+
+// GroupRows 按分组字段聚合记录，每个分组输出一行：分组字段加上各聚合结果。
+// 没有分组字段时整个结果集作为一个分组，即使没有记录也输出一行。
+func GroupRows(rows []Row, groupBy []string, aggs []Aggregate) ([]Row, error) {
+	for _, agg := range aggs {
+		if err := agg.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	type group struct {
+		row    Row
+		states []*aggState
+	}
+	newGroup := func(record Row) *group {
+		g := &group{row: make(Row)}
+		for _, field := range groupBy {
+			if val, ok := GetPath(record, field); ok {
+				g.row[field] = val
+			} else {
+				g.row[field] = nil
+			}
+		}
+		for _, agg := range aggs {
+			g.states = append(g.states, newAggState(agg))
+		}
+		return g
+	}
+
+	groups := make(map[string]*group)
+	var order []string // 保持分组首次出现的顺序
+
+	if len(groupBy) == 0 {
+		groups[""] = newGroup(Row{})
+		order = append(order, "")
+	}
+
+	for _, record := range rows {
+		keys := make([]string, len(groupBy))
+		for i, field := range groupBy {
+			val, _ := GetPath(record, field)
+			keys[i] = valueKey(val)
+		}
+		key := strings.Join(keys, "\x00")
+
+		g, exists := groups[key]
+		if !exists {
+			g = newGroup(record)
+			groups[key] = g
+			order = append(order, key)
+		}
+		for _, st := range g.states {
+			st.add(record)
+		}
+	}
+
+	result := make([]Row, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		for _, st := range g.states {
+			g.row[st.agg.Name()] = st.result()
+		}
+		result = append(result, g.row)
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func parseRows(t *testing.T, data string) []Row {
+	t.Helper()
+	var rows []Row
+	if err := json.Unmarshal([]byte(data), &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestGroupRows(t *testing.T) {
+	rows := parseRows(t, `[
+		{"category": "a", "likes": 1, "author": {"name": "x"}},
+		{"category": "b", "likes": 5, "author": {"name": "y"}},
+		{"category": "a", "likes": 3, "author": {"name": "x"}},
+		{"category": "a", "likes": null},
+		{"likes": 2}
+	]`)
+
+	got, err := GroupRows(rows, []string{"category"}, []Aggregate{
+		{Func: AggCount, Field: "*", Alias: "n"},
+		{Func: AggCount, Field: "likes"},
+		{Func: AggSum, Field: "likes"},
+		{Func: AggAvg, Field: "likes"},
+		{Func: AggMin, Field: "likes"},
+		{Func: AggMax, Field: "likes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 分组按首次出现的顺序输出，缺少分组字段的记录归入 null 分组，聚合时忽略 NULL
+	want := []Row{
+		{"category": "a", "n": 3.0, "COUNT(likes)": 2.0, "SUM(likes)": 4.0, "AVG(likes)": 2.0, "MIN(likes)": 1.0, "MAX(likes)": 3.0},
+		{"category": "b", "n": 1.0, "COUNT(likes)": 1.0, "SUM(likes)": 5.0, "AVG(likes)": 5.0, "MIN(likes)": 5.0, "MAX(likes)": 5.0},
+		{"category": nil, "n": 1.0, "COUNT(likes)": 1.0, "SUM(likes)": 2.0, "AVG(likes)": 2.0, "MIN(likes)": 2.0, "MAX(likes)": 2.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("分组结果 %v\n期望 %v", got, want)
+	}
+}
+
+func TestGroupRowsWithoutGroupBy(t *testing.T) {
+	aggs := []Aggregate{
+		{Func: AggCount, Field: "*"},
+		{Func: AggSum, Field: "n"},
+		{Func: AggMax, Field: "s"},
+		{Func: AggCount, Field: "n", Distinct: true},
+	}
+
+	// 没有记录时仍然输出一行，SUM/MAX 为 NULL
+	got, err := GroupRows(nil, nil, aggs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{{"COUNT(*)": 0.0, "SUM(n)": nil, "MAX(s)": nil, "COUNT(DISTINCT n)": 0.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("空结果集的聚合 %v", got)
+	}
+
+	// 整数和浮点数视为相同的值；MAX 对字符串按字典序比较
+	rows := []Row{{"n": 1, "s": "b"}, {"n": 1.0, "s": "c"}, {"n": 2.0, "s": "a"}}
+	got, err = GroupRows(rows, nil, aggs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Row{{"COUNT(*)": 3.0, "SUM(n)": 4.0, "MAX(s)": "c", "COUNT(DISTINCT n)": 2.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("聚合结果 %v", got)
+	}
+}
+
+func TestGroupRowsByNestedField(t *testing.T) {
+	rows := parseRows(t, `[{"author": {"name": "x"}}, {"author": {"name": "y"}}, {"author": {"name": "x"}}]`)
+	got, err := GroupRows(rows, []string{"author.name"}, []Aggregate{{Func: AggCount, Field: "*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{{"author.name": "x", "COUNT(*)": 2.0}, {"author.name": "y", "COUNT(*)": 1.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("分组结果 %v", got)
+	}
+}
+
+func TestAggregateValidate(t *testing.T) {
+	for _, agg := range []Aggregate{
+		{Func: AggSum, Field: "*"},
+		{Func: AggCount, Field: "*", Distinct: true},
+		{Func: "MEDIAN", Field: "a"},
+	} {
+		if _, err := GroupRows(nil, nil, []Aggregate{agg}); err == nil {
+			t.Errorf("接受了无效的聚合函数 %s", agg.Name())
+		}
+	}
+}
+
+func TestQueryRecordsGrouped(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	for _, row := range parseRows(t, `[
+		{"category": "a", "likes": 1}, {"category": "b", "likes": 5},
+		{"category": "a", "likes": 3}, {"category": "c", "likes": 2}
+	]`) {
+		if err := ms.InsertRecord("c", "d", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sum := Aggregate{Func: AggSum, Field: "likes", Alias: "total"}
+	rows, err := ms.QueryRecords("c", "d", nil, &QueryOptions{
+		GroupBy:    []string{"category"},
+		Aggregates: []Aggregate{sum},
+		Having:     map[string]interface{}{"total": op(">", 2.0)},
+		OrderBy:    []SortKey{{Field: "total", Desc: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{{"category": "b", "total": 5.0}, {"category": "a", "total": 4.0}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("分组查询结果 %v", rows)
+	}
+}
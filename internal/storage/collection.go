@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -243,6 +244,9 @@ func (cm *CollectionManager) loadCollections() error {
 		collectionPath := filepath.Join(cm.dataDir, entry.Name())
 		metaFile := filepath.Join(collectionPath, "meta.sudb")
 
+		// 旧格式加密的元数据先重新加密
+		cm.migrateMetaFiles(collectionPath)
+
 		// 读取加密数据
 		encrypted, err := os.ReadFile(metaFile)
 		if err != nil {
@@ -261,12 +265,53 @@ func (cm *CollectionManager) loadCollections() error {
 		}
 
 		collection.basePath = collectionPath
+		collection.crypto = cm.crypto
 		cm.collections[collection.Name] = &collection
 	}
 
 	return nil
 }
 
+// Reencrypt 用当前密钥重写所有集合和数据库的元数据文件
+func (cm *CollectionManager) Reencrypt() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for name, collection := range cm.collections {
+		if err := collection.save(); err != nil {
+			return fmt.Errorf("重写集合元数据失败 [%s]: %w", name, err)
+		}
+		for dbName := range collection.Databases {
+			metaFile := filepath.Join(collection.basePath, dbName, "meta.sudb")
+			if _, err := cm.crypto.ReencryptFile(metaFile); err != nil {
+				return fmt.Errorf("重写数据库元数据失败 [%s.%s]: %w", name, dbName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateMetaFiles 将集合及其数据库的元数据文件从旧的加密格式迁移到当前格式
+func (cm *CollectionManager) migrateMetaFiles(collectionPath string) {
+	files := []string{filepath.Join(collectionPath, "meta.sudb")}
+	if entries, err := os.ReadDir(collectionPath); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				files = append(files, filepath.Join(collectionPath, entry.Name(), "meta.sudb"))
+			}
+		}
+	}
+
+	for _, file := range files {
+		migrated, err := cm.crypto.MigrateFile(file)
+		if err != nil {
+			log.Printf("迁移元数据文件失败 [%s]: %v", file, err)
+		} else if migrated {
+			log.Printf("已将元数据文件重新加密为当前格式: %s", file)
+		}
+	}
+}
+
 // GetCollection 获取集合
 func (cm *CollectionManager) GetCollection(name string) (*Collection, error) {
 	cm.mu.RLock()
@@ -2,6 +2,10 @@ package storage
 
 import (
 	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 // Condition 查询条件
@@ -9,123 +13,479 @@ type Condition struct {
 	Column   string      `json:"column"`
 	Operator string      `json:"operator"`
 	Value    interface{} `json:"value"`
+
+	pattern *regexp.Regexp // LIKE/ILIKE/REGEXP 预编译的正则
 }
 
-// Conditions 多个条件的组合
+// 比较运算符。IN、LIKE、ILIKE、REGEXP、BETWEEN、CONTAINS 都可以加 "NOT " 前缀取反
+const (
+	OpEq        = "="
+	OpNe        = "!="
+	OpGt        = ">"
+	OpLt        = "<"
+	OpGte       = ">="
+	OpLte       = "<="
+	OpIn        = "IN"       // 值为数组，字段等于其中任一元素
+	OpNotIn     = "NOT IN"   // 值为数组，字段不等于其中任何元素
+	OpLike      = "LIKE"     // SQL 通配符：% 匹配任意串，_ 匹配单个字符，\ 转义
+	OpILike     = "ILIKE"    // 不区分大小写的 LIKE
+	OpRegexp    = "REGEXP"   // 正则表达式（Go RE2 语法）
+	OpBetween   = "BETWEEN"  // 值为 [下界, 上界]，两端都包含
+	OpContains  = "CONTAINS" // 字段为数组且包含该值
+	OpExists    = "EXISTS"   // 字段存在（可以为 null），不需要值
+	OpNotExists = "NOT EXISTS"
+	OpIsNull    = "IS NULL" // 字段不存在或为 null，不需要值
+	OpIsNotNull = "IS NOT NULL"
+)
+
+// negatableOps 可以加 "NOT " 前缀的运算符
+var negatableOps = map[string]bool{
+	OpIn:       true,
+	OpLike:     true,
+	OpILike:    true,
+	OpRegexp:   true,
+	OpBetween:  true,
+	OpContains: true,
+}
+
+// Conditions 条件树：叶子节点为单个条件，其余节点按 And/Or/Not 组合子条件
 type Conditions struct {
-	And []Condition
-	Or  []Condition
+	Leaf *Condition
+	And  []*Conditions
+	Or   []*Conditions
+	Not  *Conditions
+}
+
+// 过滤器中的逻辑运算符
+const (
+	OpAnd = "$and"
+	OpOr  = "$or"
+	OpNot = "$not"
+)
+
+// Match 检查记录是否满足条件树，nil 条件匹配所有记录
+func (c *Conditions) Match(record Row) bool {
+	if c == nil {
+		return true
+	}
+
+	switch {
+	case c.Leaf != nil:
+		return c.Leaf.Match(record)
+	case c.Not != nil:
+		return !c.Not.Match(record)
+	case len(c.Or) > 0:
+		for _, sub := range c.Or {
+			if sub.Match(record) {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, sub := range c.And {
+			if !sub.Match(record) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Columns 返回条件树中引用的所有字段，按首次出现的顺序去重
+func (c *Conditions) Columns() []string {
+	var columns []string
+	seen := make(map[string]bool)
+	var walk func(*Conditions)
+	walk = func(c *Conditions) {
+		if c == nil {
+			return
+		}
+		if c.Leaf != nil && !seen[c.Leaf.Column] {
+			seen[c.Leaf.Column] = true
+			columns = append(columns, c.Leaf.Column)
+		}
+		walk(c.Not)
+		for _, sub := range c.And {
+			walk(sub)
+		}
+		for _, sub := range c.Or {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return columns
 }
 
-// ParseCondition 从 map 解析条件
-func ParseCondition(data map[string]interface{}) (*Condition, error) {
+// ParseConditions 从过滤器解析条件树。
+// 同一层的多个键按 AND 组合；$and/$or 的值为过滤器数组，$not 的值为单个过滤器。
+// 字段的值为 {"operator": op, "value": v} 时表示比较条件（运算符见 OpEq 等常量），否则表示深度相等比较。
+func ParseConditions(filter map[string]interface{}) (*Conditions, error) {
 	// 处理 nil 条件（查询所有数据）
-	if data == nil {
+	if filter == nil {
 		return nil, nil
 	}
 
-	// 处理简单条件（相等比较）
-	if len(data) == 1 {
-		for k, v := range data {
-			// 如果值是 map，说明是复杂条件
-			if condMap, ok := v.(map[string]interface{}); ok {
-				operator, _ := condMap["operator"].(string)
-				value := condMap["value"]
-				if operator == "" {
-					operator = "="
-				}
-				return &Condition{
-					Column:   k,
-					Operator: operator,
-					Value:    value,
-				}, nil
+	// 按键排序，保证条件树结构稳定
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	node := &Conditions{}
+	for _, k := range keys {
+		v := filter[k]
+		switch k {
+		case OpAnd, OpOr:
+			subs, err := parseConditionList(k, v)
+			if err != nil {
+				return nil, err
+			}
+			if k == OpAnd {
+				node.And = append(node.And, subs...)
+			} else {
+				node.And = append(node.And, &Conditions{Or: subs})
+			}
+
+		case OpNot:
+			subFilter, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s 的值必须是条件对象", OpNot)
+			}
+			sub, err := ParseConditions(subFilter)
+			if err != nil {
+				return nil, err
+			}
+			node.And = append(node.And, &Conditions{Not: sub})
+
+		default:
+			if strings.HasPrefix(k, "$") {
+				return nil, fmt.Errorf("不支持的逻辑运算符: %s", k)
 			}
-			// 否则是简单的相等比较
-			return &Condition{
-				Column:   k,
-				Operator: "=",
-				Value:    v,
-			}, nil
-		}
-	}
-
-	// 处理多个条件（AND 组合）
-	conditions := make([]Condition, 0)
-	for k, v := range data {
-		if condMap, ok := v.(map[string]interface{}); ok {
-			operator, _ := condMap["operator"].(string)
-			value := condMap["value"]
-			if operator == "" {
-				operator = "="
+			leaf, err := parseLeafCondition(k, v)
+			if err != nil {
+				return nil, err
 			}
-			conditions = append(conditions, Condition{
-				Column:   k,
-				Operator: operator,
-				Value:    value,
-			})
-		} else {
-			conditions = append(conditions, Condition{
-				Column:   k,
-				Operator: "=",
-				Value:    v,
-			})
+			node.And = append(node.And, &Conditions{Leaf: leaf})
+		}
+	}
+
+	// 只有一个子条件时直接返回该子条件
+	if len(node.And) == 1 {
+		return node.And[0], nil
+	}
+	return node, nil
+}
+
+// parseConditionList 解析 $and/$or 的条件数组
+func parseConditionList(op string, v interface{}) ([]*Conditions, error) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s 的值必须是非空的条件数组", op)
+	}
+
+	subs := make([]*Conditions, 0, len(list))
+	for _, item := range list {
+		subFilter, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s 的元素必须是条件对象", op)
+		}
+		sub, err := ParseConditions(subFilter)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			sub = &Conditions{}
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// parseLeafCondition 解析单个字段的条件
+func parseLeafCondition(column string, v interface{}) (*Condition, error) {
+	// 如果值是 map，说明是复杂条件
+	if condMap, ok := v.(map[string]interface{}); ok {
+		if op, ok := condMap["operator"].(string); ok {
+			return NewCondition(column, op, condMap["value"])
+		}
+	}
+	// 否则是相等比较（包括与数组、对象的相等比较）
+	return &Condition{
+		Column:   column,
+		Operator: OpEq,
+		Value:    v,
+	}, nil
+}
+
+// NewCondition 创建单个字段的条件，运算符不区分大小写，并检查值是否符合运算符的要求
+func NewCondition(column, operator string, value interface{}) (*Condition, error) {
+	op := normalizeOperator(operator)
+	cond := &Condition{Column: column, Operator: op, Value: value}
+
+	switch baseOperator(op) {
+	case OpEq, OpNe, OpGt, OpLt, OpGte, OpLte, OpContains:
+	case OpExists, OpNotExists, OpIsNull, OpIsNotNull:
+	case OpIn:
+		if _, ok := value.([]interface{}); !ok {
+			return nil, fmt.Errorf("%s 的值必须是数组", op)
+		}
+	case OpBetween:
+		bounds, ok := value.([]interface{})
+		if !ok || len(bounds) != 2 {
+			return nil, fmt.Errorf("%s 的值必须是 [下界, 上界]", op)
+		}
+	case OpLike, OpILike, OpRegexp:
+		pattern, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s 的值必须是字符串", op)
 		}
+		re, err := compilePattern(baseOperator(op), pattern)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 %s 模式 %q: %v", op, pattern, err)
+		}
+		cond.pattern = re
+	default:
+		return nil, fmt.Errorf("不支持的运算符: %s", operator)
+	}
+	return cond, nil
+}
+
+// normalizeOperator 统一运算符的大小写和空白，并处理别名
+func normalizeOperator(op string) string {
+	op = strings.Join(strings.Fields(strings.ToUpper(op)), " ")
+	switch op {
+	case "", "==":
+		return OpEq
+	case "<>":
+		return OpNe
+	}
+	return op
+}
+
+// baseOperator 去掉可取反运算符的 "NOT " 前缀
+func baseOperator(op string) string {
+	if base := strings.TrimPrefix(op, "NOT "); base != op && negatableOps[base] {
+		return base
 	}
+	return op
+}
 
-	if len(conditions) > 0 {
-		return &conditions[0], nil
+// compilePattern 将 LIKE/ILIKE 模式或正则表达式编译为正则
+func compilePattern(op, pattern string) (*regexp.Regexp, error) {
+	if op == OpRegexp {
+		return regexp.Compile(pattern)
 	}
 
-	return nil, fmt.Errorf("无效的条件格式")
+	var b strings.Builder
+	if op == OpILike {
+		b.WriteString("(?is)^")
+	} else {
+		b.WriteString("(?s)^")
+	}
+	escaped := false
+	for _, ch := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == '%':
+			b.WriteString(".*")
+		case ch == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("模式以转义符结尾")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
 }
 
-// MatchConditions 检查记录是否匹配所有条件
+// MatchConditions 检查单条记录是否匹配过滤器，无效的过滤器不匹配任何记录。
+// 每次调用都会重新解析过滤器并编译 LIKE/REGEXP 的模式，逐行过滤时应先调用一次 ParseConditions，
+// 再对每行调用 Conditions.Match。
+//
+// Deprecated: 使用 ParseConditions 和 Conditions.Match。
 func MatchConditions(record Row, conditions map[string]interface{}) bool {
-	if conditions == nil {
-		return true
+	cond, err := ParseConditions(conditions)
+	if err != nil {
+		return false
 	}
+	return cond.Match(record)
+}
 
-	// 检查每个条件
-	for k, v := range conditions {
-		if condMap, ok := v.(map[string]interface{}); ok {
-			// 复杂条件
-			operator, _ := condMap["operator"].(string)
-			value := condMap["value"]
-			if !matchSingleCondition(record, k, operator, value) {
-				return false
+// Match 检查记录是否满足单个条件。
+// 除 NOT EXISTS 和 IS NULL 外，字段不存在时不匹配，取反的运算符也不例外。
+func (c *Condition) Match(record Row) bool {
+	op := normalizeOperator(c.Operator)
+	val, exists := GetPath(record, c.Column)
+
+	switch op {
+	case OpExists:
+		return exists
+	case OpNotExists:
+		return !exists
+	case OpIsNull:
+		return !exists || val == nil
+	case OpIsNotNull:
+		return exists && val != nil
+	}
+	if !exists {
+		return false
+	}
+
+	if base := baseOperator(op); base != op {
+		return !c.matchValue(base, val)
+	}
+	return c.matchValue(op, val)
+}
+
+// matchValue 按运算符比较字段值与条件值
+func (c *Condition) matchValue(op string, val interface{}) bool {
+	switch op {
+	case OpEq:
+		return valuesEqual(val, c.Value)
+	case OpNe:
+		return !valuesEqual(val, c.Value)
+	case OpGt, OpLt, OpGte, OpLte:
+		cmp, ok := compareOrdered(val, c.Value)
+		if !ok {
+			return false
+		}
+		switch op {
+		case OpGt:
+			return cmp > 0
+		case OpLt:
+			return cmp < 0
+		case OpGte:
+			return cmp >= 0
+		default:
+			return cmp <= 0
+		}
+	case OpIn, OpNotIn:
+		list, _ := c.Value.([]interface{})
+		found := false
+		for _, item := range list {
+			if valuesEqual(val, item) {
+				found = true
+				break
 			}
-		} else {
-			// 简单相等条件
-			if !matchSingleCondition(record, k, "=", v) {
+		}
+		return found == (op == OpIn)
+	case OpBetween:
+		bounds, ok := c.Value.([]interface{})
+		if !ok || len(bounds) != 2 {
+			return false
+		}
+		lo, ok1 := compareOrdered(val, bounds[0])
+		hi, ok2 := compareOrdered(val, bounds[1])
+		return ok1 && ok2 && lo >= 0 && hi <= 0
+	case OpLike, OpILike, OpRegexp:
+		str, ok := val.(string)
+		if !ok {
+			return false
+		}
+		re := c.pattern
+		if re == nil {
+			// 条件未经 NewCondition 创建时临时编译
+			pattern, _ := c.Value.(string)
+			var err error
+			if re, err = compilePattern(op, pattern); err != nil {
 				return false
 			}
 		}
+		return re.MatchString(str)
+	case OpContains:
+		list, ok := val.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if valuesEqual(item, c.Value) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// valuesEqual 深度比较两个值：数字按数值比较，数组逐个元素比较，对象比较所有键值
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat64(a); ok {
+		y, ok := toFloat64(b)
+		return ok && x == y
 	}
 
-	return true
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !valuesEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		return mapsEqual(x, b)
+	case Row:
+		return mapsEqual(x, b)
+	}
+	return reflect.DeepEqual(a, b)
 }
 
-// matchSingleCondition 检查单个条件
-func matchSingleCondition(record Row, column, operator string, value interface{}) bool {
-	val, exists := record[column]
-	if !exists {
+// mapsEqual 比较对象与另一个值是否深度相等
+func mapsEqual(x map[string]interface{}, b interface{}) bool {
+	var y map[string]interface{}
+	switch v := b.(type) {
+	case map[string]interface{}:
+		y = v
+	case Row:
+		y = v
+	default:
 		return false
 	}
-
-	switch operator {
-	case "=":
-		return val == value
-	case ">":
-		return compareValues(val, value) > 0
-	case "<":
-		return compareValues(val, value) < 0
-	case ">=":
-		return compareValues(val, value) >= 0
-	case "<=":
-		return compareValues(val, value) <= 0
-	case "!=":
-		return val != value
+	if len(x) != len(y) {
+		return false
+	}
+	for k, xv := range x {
+		yv, ok := y[k]
+		if !ok || !valuesEqual(xv, yv) {
+			return false
+		}
 	}
+	return true
+}
 
-	return false
+// compareOrdered 比较两个可排序的值（同为数字或同为字符串），类型不可比较时返回 false
+func compareOrdered(a, b interface{}) (int, bool) {
+	if x, ok := toFloat64(a); ok {
+		y, ok := toFloat64(b)
+		if !ok {
+			return 0, false
+		}
+		return compareValues(x, y), true
+	}
+	x, ok1 := a.(string)
+	y, ok2 := b.(string)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return compareValues(x, y), true
 }
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConditionsMatch(t *testing.T) {
+	rows := parseRows(t, `[
+		{"id": 1, "name": "alice", "age": 30, "tags": ["go", "db"], "author": {"name": "A"}},
+		{"id": 2, "name": "Bob", "age": 20, "tags": ["rust"], "author": {"name": "B"}, "note": null},
+		{"id": 3, "name": "carol", "age": 40}
+	]`)
+
+	tests := []struct {
+		name   string
+		filter map[string]interface{}
+		ids    []float64
+	}{
+		{"空条件匹配所有记录", nil, []float64{1, 2, 3}},
+		{"相等", map[string]interface{}{"name": "alice"}, []float64{1}},
+		{"数组相等", map[string]interface{}{"tags": []interface{}{"rust"}}, []float64{2}},
+		{"比较", map[string]interface{}{"age": op(">=", 30.0)}, []float64{1, 3}},
+		{"不等", map[string]interface{}{"age": op("<>", 30.0)}, []float64{2, 3}},
+		{"IN", map[string]interface{}{"id": op("IN", []interface{}{1.0, 3.0})}, []float64{1, 3}},
+		{"NOT IN 不匹配缺少字段的记录", map[string]interface{}{"tags": op("NOT IN", []interface{}{"x"})}, []float64{1, 2}},
+		{"BETWEEN", map[string]interface{}{"age": op("BETWEEN", []interface{}{25.0, 35.0})}, []float64{1}},
+		{"LIKE", map[string]interface{}{"name": op("LIKE", "%o%")}, []float64{2, 3}},
+		{"LIKE 区分大小写", map[string]interface{}{"name": op("LIKE", "b%")}, nil},
+		{"ILIKE", map[string]interface{}{"name": op("ILIKE", "b%")}, []float64{2}},
+		{"LIKE 单个字符", map[string]interface{}{"name": op("LIKE", "_ob")}, []float64{2}},
+		{"NOT LIKE", map[string]interface{}{"name": op("NOT LIKE", "a%")}, []float64{2, 3}},
+		{"REGEXP", map[string]interface{}{"name": op("REGEXP", "^[a-c]")}, []float64{1, 3}},
+		{"CONTAINS", map[string]interface{}{"tags": op("CONTAINS", "go")}, []float64{1}},
+		{"EXISTS", map[string]interface{}{"tags": op("EXISTS", nil)}, []float64{1, 2}},
+		{"NOT EXISTS", map[string]interface{}{"tags": op("NOT EXISTS", nil)}, []float64{3}},
+		{"IS NULL 包括缺少字段", map[string]interface{}{"note": op("IS NULL", nil)}, []float64{1, 2, 3}},
+		{"嵌套字段", map[string]interface{}{"author.name": "B"}, []float64{2}},
+		{"数组下标", map[string]interface{}{"tags[1]": "db"}, []float64{1}},
+		{"多个键按与合并", map[string]interface{}{"age": op(">", 10.0), "name": op("LIKE", "c%")}, []float64{3}},
+		{"$or", map[string]interface{}{OpOr: []interface{}{
+			map[string]interface{}{"id": 1.0},
+			map[string]interface{}{"id": 3.0},
+		}}, []float64{1, 3}},
+		{"$not", map[string]interface{}{OpNot: map[string]interface{}{"id": 1.0}}, []float64{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := ParseConditions(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []float64
+			for _, row := range rows {
+				if cond.Match(row) {
+					ids = append(ids, row["id"].(float64))
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Fatalf("匹配到 %v，期望 %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+func TestParseConditionsErrors(t *testing.T) {
+	for _, filter := range []map[string]interface{}{
+		{"$bad": 1.0},
+		{OpOr: []interface{}{}},
+		{OpOr: "x"},
+		{OpNot: 1.0},
+		{"a": op("~~", 1.0)},
+		{"a": op("IN", 1.0)},
+		{"a": op("BETWEEN", []interface{}{1.0})},
+		{"a": op("LIKE", 1.0)},
+		{"a": op("LIKE", `ab\`)},
+		{"a": op("REGEXP", "(")},
+	} {
+		if _, err := ParseConditions(filter); err == nil {
+			t.Errorf("过滤器 %v 解析成功", filter)
+		}
+	}
+}
+
+func TestParseConditionsCompilesPatternsOnce(t *testing.T) {
+	cond, err := ParseConditions(map[string]interface{}{"name": op("LIKE", "a%")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Leaf == nil || cond.Leaf.pattern == nil {
+		t.Fatal("LIKE 的模式没有在解析时编译")
+	}
+	pattern := cond.Leaf.pattern
+	cond.Match(Row{"name": "abc"})
+	if cond.Leaf.pattern != pattern {
+		t.Fatal("匹配时重新编译了模式")
+	}
+}
+
+func TestConditionsColumns(t *testing.T) {
+	cond, err := ParseConditions(map[string]interface{}{
+		"a": 1.0,
+		OpOr: []interface{}{
+			map[string]interface{}{"b": 1.0},
+			map[string]interface{}{OpNot: map[string]interface{}{"a": 2.0, "c.d": 3.0}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns := cond.Columns(); !reflect.DeepEqual(columns, []string{"b", "a", "c.d"}) {
+		t.Fatalf("引用的字段为 %v", columns)
+	}
+}
@@ -14,7 +14,7 @@ type Operation struct {
 	Type  OperationType
 	Table string
 	Data  Row
-	Where *Condition // 使用从 condition.go 导入的 Condition 类型
+	Where *Conditions // 使用 condition.go 中的条件树
 }
 
 // OperationType 操作类型
@@ -49,6 +49,7 @@ type Column struct {
 type Transaction struct {
 	engine     *Engine
 	operations []Operation
+	done       bool
 }
 
 // Engine 存储引擎
@@ -61,7 +62,7 @@ type Engine struct {
 	MemStore    *MemoryStore // 添加内存存储
 }
 
-func NewEngine(dataDir, builtinDir string, crypto *security.CryptoManager) (*Engine, error) {
+func NewEngine(dataDir, builtinDir string, crypto *security.CryptoManager, options ...MemoryStoreOption) (*Engine, error) {
 	cm, err := NewCollectionManager(dataDir, builtinDir, crypto)
 	if err != nil {
 		return nil, err
@@ -75,10 +76,7 @@ func NewEngine(dataDir, builtinDir string, crypto *security.CryptoManager) (*Eng
 	}
 
 	// 初始化内存存储
-	engine.MemStore = NewMemoryStore(dataDir, crypto)
-	if err := engine.MemStore.LoadFromDisk(); err != nil {
-		log.Printf("加载数据失败: %v", err)
-	}
+	engine.MemStore = NewMemoryStore(dataDir, crypto, options...)
 
 	// 初始化备份管理器
 	backupDir := filepath.Join(builtinDir, "backups")
@@ -91,6 +89,19 @@ func NewEngine(dataDir, builtinDir string, crypto *security.CryptoManager) (*Eng
 	return engine, nil
 }
 
+// Crypto 返回存储引擎使用的加密管理器
+func (e *Engine) Crypto() *security.CryptoManager {
+	return e.crypto
+}
+
+// Reencrypt 用当前密钥重新加密集合元数据和记录文件
+func (e *Engine) Reencrypt() error {
+	if err := e.collections.Reencrypt(); err != nil {
+		return err
+	}
+	return e.MemStore.Reencrypt()
+}
+
 func (e *Engine) CreateTable(name string, columns []Column) error {
 	table := &Table{
 		Name:    name,
@@ -113,27 +124,32 @@ func (e *Engine) Insert(tableName string, row Row) error {
 	if err != nil {
 		return err
 	}
+	if err := e.insertRow(table, row); err != nil {
+		return err
+	}
+	return e.saveTable(table)
+}
 
-	// 验证数据结构
+// insertRow 验证数据结构后追加到表中
+func (e *Engine) insertRow(table *Table, row Row) error {
 	if err := e.validateRow(table, row); err != nil {
 		return err
 	}
-
 	table.Rows = append(table.Rows, row)
-	return e.saveTable(table)
+	return nil
 }
 
 // 查询数据
-func (e *Engine) Select(tableName string, columns []string, where *Condition) ([]Row, error) {
+func (e *Engine) Select(tableName string, columns []string, where *Conditions) ([]Row, error) {
 	table, err := e.loadTable(tableName)
 	if err != nil {
 		return nil, err
 	}
 
-	// 如果有索引且where条件匹配索引列，使用索引查询
-	if where != nil {
-		if index, ok := table.Indexes[where.Column]; ok {
-			rowIDs, err := index.Find(where.Value)
+	// 如果有索引且where条件是索引列上的相等比较，使用索引查询
+	if where != nil && where.Leaf != nil && where.Leaf.Operator == "=" {
+		if index, ok := table.Indexes[where.Leaf.Column]; ok {
+			rowIDs, err := index.Find(where.Leaf.Value)
 			if err != nil {
 				return nil, err
 			}
@@ -146,13 +162,7 @@ func (e *Engine) Select(tableName string, columns []string, where *Condition) ([
 						if len(columns) == 0 {
 							result = append(result, row)
 						} else {
-							filteredRow := make(Row)
-							for _, col := range columns {
-								if val, ok := row[col]; ok {
-									filteredRow[col] = val
-								}
-							}
-							result = append(result, filteredRow)
+							result = append(result, ProjectRow(row, columns))
 						}
 					}
 				}
@@ -168,13 +178,7 @@ func (e *Engine) Select(tableName string, columns []string, where *Condition) ([
 			if len(columns) == 0 {
 				result = append(result, row)
 			} else {
-				filteredRow := make(Row)
-				for _, col := range columns {
-					if val, ok := row[col]; ok {
-						filteredRow[col] = val
-					}
-				}
-				result = append(result, filteredRow)
+				result = append(result, ProjectRow(row, columns))
 			}
 		}
 	}
@@ -183,39 +187,56 @@ func (e *Engine) Select(tableName string, columns []string, where *Condition) ([
 }
 
 // 更新数据
-func (e *Engine) Update(tableName string, updates Row, where *Condition) error {
+func (e *Engine) Update(tableName string, updates Row, where *Conditions) error {
 	table, err := e.loadTable(tableName)
 	if err != nil {
 		return err
 	}
+	if err := e.updateRows(table, updates, where); err != nil {
+		return err
+	}
+	return e.saveTable(table)
+}
 
+// updateRows 在副本上更新匹配的行，全部成功后才替换表中的数据
+func (e *Engine) updateRows(table *Table, updates Row, where *Conditions) error {
+	update, err := ParseUpdate(updates)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]Row, len(table.Rows))
 	for i, row := range table.Rows {
+		rows[i] = row
 		if where == nil || e.matchCondition(row, where) {
-			for k, v := range updates {
-				table.Rows[i][k] = v
+			if rows[i], _, err = update.Apply(row); err != nil {
+				return err
 			}
 		}
 	}
-
-	return e.saveTable(table)
+	table.Rows = rows
+	return nil
 }
 
 // 删除数据
-func (e *Engine) Delete(tableName string, where *Condition) error {
+func (e *Engine) Delete(tableName string, where *Conditions) error {
 	table, err := e.loadTable(tableName)
 	if err != nil {
 		return err
 	}
+	e.deleteRows(table, where)
+	return e.saveTable(table)
+}
 
+// deleteRows 删除匹配的行
+func (e *Engine) deleteRows(table *Table, where *Conditions) {
 	var newRows []Row
 	for _, row := range table.Rows {
 		if !e.matchCondition(row, where) {
 			newRows = append(newRows, row)
 		}
 	}
-
 	table.Rows = newRows
-	return e.saveTable(table)
 }
 
 // 开始事务
@@ -226,24 +247,55 @@ func (e *Engine) BeginTransaction() *Transaction {
 	}
 }
 
-// 提交事务
+// 提交事务：先在内存中对所有涉及的表依次执行操作，全部成功后再写回磁盘。
+// 任何操作失败时不会写入任何表，事务随之结束
 func (t *Transaction) Commit() error {
+	if t.done {
+		return fmt.Errorf("事务已结束")
+	}
+	t.done = true
+
+	tables := make(map[string]*Table)
+	var order []string
 	for _, op := range t.operations {
+		table, ok := tables[op.Table]
+		if !ok {
+			var err error
+			if table, err = t.engine.loadTable(op.Table); err != nil {
+				return err
+			}
+			tables[op.Table] = table
+			order = append(order, op.Table)
+		}
+
 		switch op.Type {
 		case Insert:
-			if err := t.engine.Insert(op.Table, op.Data); err != nil {
+			if err := t.engine.insertRow(table, op.Data); err != nil {
 				return err
 			}
 		case Update:
-			if err := t.engine.Update(op.Table, op.Data, op.Where); err != nil {
+			if err := t.engine.updateRows(table, op.Data, op.Where); err != nil {
 				return err
 			}
 		case Delete:
-			if err := t.engine.Delete(op.Table, op.Where); err != nil {
-				return err
-			}
+			t.engine.deleteRows(table, op.Where)
 		}
 	}
+
+	list := make([]*Table, 0, len(order))
+	for _, name := range order {
+		list = append(list, tables[name])
+	}
+	return t.engine.saveTables(list)
+}
+
+// 回滚事务：丢弃尚未提交的操作
+func (t *Transaction) Rollback() error {
+	if t.done {
+		return fmt.Errorf("事务已结束")
+	}
+	t.done = true
+	t.operations = nil
 	return nil
 }
 
@@ -273,6 +325,35 @@ func (e *Engine) saveTable(table *Table) error {
 	return os.WriteFile(filename, data, 0644)
 }
 
+// saveTables 先把所有表写入临时文件，全部成功后再依次替换正式文件
+func (e *Engine) saveTables(tables []*Table) error {
+	tmpFiles := make([]string, 0, len(tables))
+	defer func() {
+		for _, tmp := range tmpFiles {
+			os.Remove(tmp)
+		}
+	}()
+
+	for _, table := range tables {
+		data, err := json.Marshal(table)
+		if err != nil {
+			return err
+		}
+		tmp := filepath.Join(e.dataDir, table.Name+".sudb.tmp")
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		tmpFiles = append(tmpFiles, tmp)
+	}
+
+	for i, table := range tables {
+		if err := os.Rename(tmpFiles[i], filepath.Join(e.dataDir, table.Name+".sudb")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *Engine) validateRow(table *Table, row Row) error {
 	for _, col := range table.Columns {
 		val, exists := row[col.Name]
@@ -295,32 +376,8 @@ func (e *Engine) validateRow(table *Table, row Row) error {
 	return nil
 }
 
-func (e *Engine) matchCondition(row Row, cond *Condition) bool {
-	if cond == nil {
-		return true
-	}
-
-	val, exists := row[cond.Column]
-	if !exists {
-		return false
-	}
-
-	switch cond.Operator {
-	case "=":
-		return val == cond.Value
-	case ">":
-		return compareValues(val, cond.Value) > 0
-	case "<":
-		return compareValues(val, cond.Value) < 0
-	case ">=":
-		return compareValues(val, cond.Value) >= 0
-	case "<=":
-		return compareValues(val, cond.Value) <= 0
-	case "!=":
-		return val != cond.Value
-	}
-
-	return false
+func (e *Engine) matchCondition(row Row, cond *Conditions) bool {
+	return cond.Match(row)
 }
 
 func compareValues(a, b interface{}) int {
@@ -358,10 +415,14 @@ func (e *Engine) CreateIndex(tableName, columnName string, idxType IndexType) er
 		return err
 	}
 
-	// 检查列是否存在
+	// 检查列是否存在，嵌套路径（如 author.name）按顶层字段检查
+	path, err := ParsePath(columnName)
+	if err != nil {
+		return err
+	}
 	var col *Column
 	for i := range table.Columns {
-		if table.Columns[i].Name == columnName {
+		if table.Columns[i].Name == columnName || table.Columns[i].Name == path[0].Key {
 			col = &table.Columns[i]
 			break
 		}
@@ -387,7 +448,7 @@ func (e *Engine) CreateIndex(tableName, columnName string, idxType IndexType) er
 
 	// 为现有数据建立索引
 	for i, row := range table.Rows {
-		if val, ok := row[columnName]; ok {
+		if val, ok := GetPath(row, columnName); ok {
 			if err := index.Add(val, uint64(i)); err != nil {
 				return err
 			}
@@ -395,8 +456,10 @@ func (e *Engine) CreateIndex(tableName, columnName string, idxType IndexType) er
 	}
 
 	table.Indexes[columnName] = index
-	col.Indexed = true
-	col.IdxType = idxType
+	if col.Name == columnName {
+		col.Indexed = true
+		col.IdxType = idxType
+	}
 
 	return e.saveTable(table)
 }
@@ -462,7 +525,7 @@ func (t *Transaction) InsertRow(table string, data Row) {
 	})
 }
 
-func (t *Transaction) UpdateRows(table string, data Row, where *Condition) {
+func (t *Transaction) UpdateRows(table string, data Row, where *Conditions) {
 	t.AddOperation(Operation{
 		Type:  Update,
 		Table: table,
@@ -471,7 +534,7 @@ func (t *Transaction) UpdateRows(table string, data Row, where *Condition) {
 	})
 }
 
-func (t *Transaction) DeleteRows(table string, where *Condition) {
+func (t *Transaction) DeleteRows(table string, where *Conditions) {
 	t.AddOperation(Operation{
 		Type:  Delete,
 		Table: table,
@@ -481,14 +544,14 @@ func (t *Transaction) DeleteRows(table string, where *Condition) {
 
 // Shutdown 关闭引擎
 func (e *Engine) Shutdown() error {
-	// 停止定时保存
-	e.MemStore.Stop()
-
 	// 最后保存一次数据
 	if err := e.MemStore.SaveToDisk(); err != nil {
 		log.Printf("保存数据失败: %v", err)
 	}
 
+	// 停止定时保存并关闭预写日志
+	e.MemStore.Stop()
+
 	// ... 其他关闭代码 ...
 	return nil
 }
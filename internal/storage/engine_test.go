@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+	dataDir, builtinDir := filepath.Join(dir, "data"), filepath.Join(dir, "builtin")
+
+	e, err := NewEngine(dataDir, builtinDir, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateCollection("c", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CreateDatabase("c", "d", JsonStorage, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.MemStore.InsertRecord("c", "d", Row{"a": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.MemStore.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	// 这条记录只在预写日志中
+	if err := e.MemStore.InsertRecord("c", "d", Row{"a": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cm.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reencrypt(); err != nil {
+		t.Fatal(err)
+	}
+	// 停用旧密钥后，所有数据只能用新密钥读取
+	if _, err := cm.RetireKeys(); err != nil {
+		t.Fatal(err)
+	}
+	crash(e.MemStore)
+
+	e, err = NewEngine(dataDir, builtinDir, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.MemStore.Stop()
+	if _, err := e.GetCollection("c"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, e.MemStore, "c", "d", nil); n != 2 {
+		t.Fatalf("重新加密后有 %d 条记录，期望 2 条", n)
+	}
+}
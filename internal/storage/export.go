@@ -16,6 +16,9 @@ type ExportOptions struct {
 	Format        string // 导出格式（sql, json等）
 	Directory     string // 导出目录
 	Filename      string // 导出文件名（可选）
+
+	// Transform 写出前对每条记录的处理（可选），如隐藏或脱敏字段
+	Transform func(Row) Row
 }
 
 // ExportDatabase 导出数据库
@@ -83,6 +86,10 @@ func (ms *MemoryStore) ExportDatabase(collection, database string, opts ExportOp
 	// 写入数据
 	records := ms.data[collection][database]
 	for _, record := range records {
+		if opts.Transform != nil {
+			record = opts.Transform(record)
+		}
+
 		// 将记录转换为SQL语句
 		sql, err := recordToSQL(collection, database, record)
 		if err != nil {
@@ -175,7 +182,6 @@ func (ms *MemoryStore) ImportFromFile(filePath string, targetCollection string)
 		}
 	}
 
-	ms.dirty = true
 	return nil
 }
 
@@ -190,12 +196,9 @@ func (ms *MemoryStore) executeImportStatement(stmt string, targetCollection stri
 		log.Printf("使用目标集合: %s", collection)
 
 		// 创建集合
-		ms.mu.Lock()
-		if _, exists := ms.data[collection]; !exists {
-			ms.data[collection] = make(map[string][]Row)
-			log.Printf("创建新集合: %s", collection)
+		if err := ms.CreateDatabase(collection, ""); err != nil {
+			return err
 		}
-		ms.mu.Unlock()
 
 	} else if strings.HasPrefix(stmt, "CREATE DATABASE") {
 		// 处理创建数据库语句
@@ -243,15 +246,9 @@ func (ms *MemoryStore) executeImportStatement(stmt string, targetCollection stri
 		log.Printf("创建数据库: %s.%s (IF NOT EXISTS: %v)", collection, names[1], hasIfNotExists)
 
 		// 创建数据库
-		ms.mu.Lock()
-		if _, exists := ms.data[collection]; !exists {
-			ms.data[collection] = make(map[string][]Row)
-		}
-		if _, exists := ms.data[collection][names[1]]; !exists {
-			ms.data[collection][names[1]] = make([]Row, 0)
-			log.Printf("创建新数据库: %s.%s", collection, names[1])
+		if err := ms.CreateDatabase(collection, names[1]); err != nil {
+			return err
 		}
-		ms.mu.Unlock()
 
 	} else if strings.HasPrefix(stmt, "INSERT INTO") {
 		// 处理插入语句
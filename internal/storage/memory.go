@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -21,10 +20,33 @@ type MemoryStore struct {
 	saveInterval time.Duration
 	stopChan     chan struct{} // 用于停止定时保存
 	dirty        bool          // 数据是否被修改
+
+	// 预写日志：修改在返回前先写入日志，保存到数据文件后清空
+	wal         *wal
+	lsn         uint64 // 最近一条日志的序号
+	walMode     WALSyncMode
+	walInterval time.Duration
+}
+
+// MemoryStoreOption 内存存储配置选项
+type MemoryStoreOption func(*MemoryStore)
+
+// WithWALSync 设置预写日志的刷盘方式，默认每次提交都 fsync
+func WithWALSync(mode WALSyncMode) MemoryStoreOption {
+	return func(ms *MemoryStore) {
+		ms.walMode = mode
+	}
+}
+
+// WithGroupCommitInterval 设置组提交模式下的刷盘间隔
+func WithGroupCommitInterval(interval time.Duration) MemoryStoreOption {
+	return func(ms *MemoryStore) {
+		ms.walInterval = interval
+	}
 }
 
 // NewMemoryStore 创建内存存储管理器
-func NewMemoryStore(dataDir string, crypto *security.CryptoManager) *MemoryStore {
+func NewMemoryStore(dataDir string, crypto *security.CryptoManager, options ...MemoryStoreOption) *MemoryStore {
 	ms := &MemoryStore{
 		data:         make(map[string]map[string][]Row),
 		crypto:       crypto,
@@ -32,6 +54,10 @@ func NewMemoryStore(dataDir string, crypto *security.CryptoManager) *MemoryStore
 		saveInterval: time.Minute * 30, // 30分钟保存一次
 		stopChan:     make(chan struct{}),
 	}
+	for _, option := range options {
+		option(ms)
+	}
+	ms.wal = newWAL(dataDir, crypto, ms.walMode, ms.walInterval)
 
 	// 加载数据
 	if err := ms.LoadFromDisk(); err != nil {
@@ -44,25 +70,61 @@ func NewMemoryStore(dataDir string, crypto *security.CryptoManager) *MemoryStore
 	return ms
 }
 
-// InsertRecord 插入记录
+// InsertRecord 插入记录，写入预写日志后才返回
 func (ms *MemoryStore) InsertRecord(collection, database string, record Row) error {
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
+	ticket, err := ms.logEntry(collection, &walEntry{Type: walInsert, Database: database, Record: record})
+	if err == nil {
+		ms.ensureDatabase(collection, database)
+		ms.data[collection][database] = append(ms.data[collection][database], record)
+		ms.dirty = true // 标记数据已修改
+	}
+	ms.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return ms.wal.wait(ticket)
+}
+
+// CreateDatabase 创建空数据库（已存在时不做任何事），database 为空时只创建集合
+func (ms *MemoryStore) CreateDatabase(collection, database string) error {
+	ms.mu.Lock()
+	if _, exists := ms.data[collection][database]; exists || (database == "" && ms.data[collection] != nil) {
+		ms.mu.Unlock()
+		return nil
+	}
+	ticket, err := ms.logEntry(collection, &walEntry{Type: walCreate, Database: database})
+	if err == nil {
+		ms.ensureDatabase(collection, database)
+		ms.dirty = true
+	}
+	ms.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return ms.wal.wait(ticket)
+}
 
-	// 确保集合存在
+// ensureDatabase 确保集合和数据库存在，调用方需持有写锁
+func (ms *MemoryStore) ensureDatabase(collection, database string) {
 	if _, exists := ms.data[collection]; !exists {
 		ms.data[collection] = make(map[string][]Row)
 	}
-
-	// 确保数据库存在
+	if database == "" {
+		return
+	}
 	if _, exists := ms.data[collection][database]; !exists {
 		ms.data[collection][database] = make([]Row, 0)
 	}
+}
 
-	// 添加记录
-	ms.data[collection][database] = append(ms.data[collection][database], record)
-	ms.dirty = true // 标记数据已修改
-	return nil
+// logEntry 分配序号并写入预写日志，调用方需持有写锁
+func (ms *MemoryStore) logEntry(collection string, entry *walEntry) (uint64, error) {
+	ms.lsn++
+	entry.LSN = ms.lsn
+	return ms.wal.append(collection, entry)
 }
 
 // autoSave 定时自动保存
@@ -73,15 +135,13 @@ func (ms *MemoryStore) autoSave() {
 	for {
 		select {
 		case <-ticker.C:
-			ms.mu.RLock()
+			ms.mu.Lock()
 			if ms.dirty {
-				if err := ms.SaveToDisk(); err != nil {
+				if err := ms.saveLocked(); err != nil {
 					log.Printf("自动保存失败: %v", err)
-				} else {
-					ms.dirty = false
 				}
 			}
-			ms.mu.RUnlock()
+			ms.mu.Unlock()
 		case <-ms.stopChan:
 			return
 		}
@@ -92,16 +152,17 @@ func (ms *MemoryStore) autoSave() {
 func (ms *MemoryStore) Stop() {
 	ms.mu.Lock()
 	if ms.dirty {
-		if err := ms.SaveToDisk(); err != nil {
+		if err := ms.saveLocked(); err != nil {
 			log.Printf("最终保存失败: %v", err)
 		}
 	}
+	ms.wal.close()
 	ms.mu.Unlock()
 	close(ms.stopChan)
 }
 
-// QueryRecords 查询记录
-func (ms *MemoryStore) QueryRecords(collection, database string, filter map[string]interface{}) ([]Row, error) {
+// QueryRecords 查询记录，opts 为 nil 时按存储顺序返回全部匹配记录
+func (ms *MemoryStore) QueryRecords(collection, database string, filter map[string]interface{}, opts *QueryOptions) ([]Row, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
@@ -113,75 +174,135 @@ func (ms *MemoryStore) QueryRecords(collection, database string, filter map[stri
 		return []Row{}, nil
 	}
 
-	records := ms.data[collection][database]
-	if filter == nil {
-		// 返回所有记录的副本
-		result := make([]Row, len(records))
-		copy(result, records)
-		return result, nil
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return nil, err
 	}
+	return queryRows(ms.data[collection][database], cond, opts)
+}
 
-	// 过滤记录
-	var result []Row
+// queryRows 过滤记录并应用查询选项（结果切片是副本，排序不会影响存储顺序）
+func queryRows(records []Row, cond *Conditions, opts *QueryOptions) ([]Row, error) {
+	result := make([]Row, 0, len(records))
 	for _, record := range records {
-		if MatchConditions(record, filter) {
+		if cond.Match(record) {
 			result = append(result, record)
 		}
 	}
-	return result, nil
+	return applyQueryOptions(result, opts)
 }
 
-// SaveToDisk 保存数据到磁盘
+// SaveToDisk 保存数据到磁盘（检查点），成功保存的集合会清空其预写日志
 func (ms *MemoryStore) SaveToDisk() error {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.saveLocked()
+}
 
+// saveLocked 保存所有集合，调用方需持有写锁。
+// 保存期间不会有新的修改，因此集合的数据文件全部写入成功后可以安全地清空该集合的日志。
+// 数据文件或日志任一写入失败都返回错误并保留修改标记
+func (ms *MemoryStore) saveLocked() error {
+	failed := 0
 	for collection, databases := range ms.data {
 		// 创建集合目录
 		collectionPath := filepath.Join(ms.dataDir, collection)
 		if err := os.MkdirAll(collectionPath, 0755); err != nil {
 			log.Printf("创建集合目录失败: %v", err)
+			failed++
 			continue
 		}
 
+		saved := true
+
 		for database, records := range databases {
 			// 创建数据库目录
 			dbPath := filepath.Join(collectionPath, database)
 			if err := os.MkdirAll(dbPath, 0755); err != nil {
 				log.Printf("创建数据库目录失败: %v", err)
+				saved = false
 				continue
 			}
 
-			// 序列化数据
+			// 序列化并加密数据
 			dataPath := filepath.Join(dbPath, "data.sudb")
-			data, err := json.MarshalIndent(records, "", "  ")
+			data, err := encodeRecordFile(ms.crypto, records, ms.lsn)
 			if err != nil {
-				log.Printf("序列化数据失败: %v", err)
+				log.Printf("编码数据失败: %v", err)
+				saved = false
 				continue
 			}
 
-			// 先创建备份
-			if _, err := os.Stat(dataPath); err == nil {
-				if err := os.Rename(dataPath, dataPath+".bak"); err != nil {
-					log.Printf("创建备份失败: %v", err)
-				}
+			// 先把当前的数据文件复制为备份，数据文件本身在新内容刷盘前保持不动
+			if err := backupRecordFile(dataPath); err != nil {
+				log.Printf("创建备份失败: %v", err)
 			}
 
-			// 使用临时文件保存
-			tempPath := dataPath + ".tmp"
-			if err := os.WriteFile(tempPath, data, 0644); err != nil {
-				log.Printf("写入临时文件失败: %v", err)
+			// 使用临时文件保存，返回时新内容已经刷盘
+			if err := security.WriteFileAtomic(dataPath, data, 0644); err != nil {
+				log.Printf("保存数据失败: %v", err)
+				saved = false
 				continue
 			}
 
-			// 重命名临时文件
-			if err := os.Rename(tempPath, dataPath); err != nil {
-				os.Remove(tempPath)
-				log.Printf("重命名文件失败: %v", err)
-				continue
+			log.Printf("保存数据成功: %s (%d 条记录)", dataPath, len(records))
+		}
+
+		// 新建的数据库目录也要持久化，之后才能清空日志
+		if saved {
+			if err := syncCollectionDirs(ms.dataDir, collection); err != nil {
+				log.Printf("刷新集合目录失败 [%s]: %v", collection, err)
+				saved = false
 			}
+		}
+		if !saved {
+			failed++
+			continue
+		}
+		// 清空失败时日志中的条目会因数据文件的检查点 LSN 在重放时被跳过，但仍算作保存失败，下次继续尝试
+		if err := ms.wal.reset(collection, ms.lsn); err != nil {
+			log.Printf("清空预写日志失败 [%s]: %v", collection, err)
+			failed++
+		}
+	}
 
-			log.Printf("保存数据成功: %s (%d 条记录)", dataPath, len(records))
+	if failed > 0 {
+		return fmt.Errorf("%d 个集合保存失败，对应的预写日志已保留", failed)
+	}
+	ms.lastSave = time.Now()
+	ms.dirty = false
+	return nil
+}
+
+// Reencrypt 用当前密钥重写所有记录文件及其备份，并清空预写日志（日志中是旧密钥加密的条目）
+func (ms *MemoryStore) Reencrypt() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for collection, databases := range ms.data {
+		for database, records := range databases {
+			dbPath := filepath.Join(ms.dataDir, collection, database)
+			if err := os.MkdirAll(dbPath, 0755); err != nil {
+				return fmt.Errorf("创建数据库目录失败: %w", err)
+			}
+			data, err := encodeRecordFile(ms.crypto, records, ms.lsn)
+			if err != nil {
+				return err
+			}
+			dataPath := filepath.Join(dbPath, "data.sudb")
+			if err := security.WriteFileAtomic(dataPath, data, 0644); err != nil {
+				return fmt.Errorf("重写数据文件失败 [%s.%s]: %w", collection, database, err)
+			}
+			if err := security.WriteFileAtomic(dataPath+".bak", data, 0644); err != nil {
+				return fmt.Errorf("重写备份文件失败 [%s.%s]: %w", collection, database, err)
+			}
+		}
+		// 数据文件都已刷盘后才清空日志
+		if err := syncCollectionDirs(ms.dataDir, collection); err != nil {
+			return fmt.Errorf("刷新集合目录失败 [%s]: %w", collection, err)
+		}
+		if err := ms.wal.reset(collection, ms.lsn); err != nil {
+			return fmt.Errorf("清空预写日志失败 [%s]: %w", collection, err)
 		}
 	}
 
@@ -190,13 +311,37 @@ func (ms *MemoryStore) SaveToDisk() error {
 	return nil
 }
 
+// backupRecordFile 把数据文件当前的内容复制为 .bak，数据文件不存在时不做任何事
+func backupRecordFile(dataPath string) error {
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return security.WriteFileAtomic(dataPath+".bak", data, 0644)
+}
+
+// syncCollectionDirs 刷新集合目录和数据目录，使新建的数据库目录和集合目录持久化
+func syncCollectionDirs(dataDir, collection string) error {
+	if err := security.SyncDir(filepath.Join(dataDir, collection)); err != nil {
+		return err
+	}
+	return security.SyncDir(dataDir)
+}
+
 // LoadFromDisk 从磁盘加载数据
 func (ms *MemoryStore) LoadFromDisk() error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	// 清空现有数据
+	// 清空现有数据，重新读取日志前先关闭已打开的日志文件
 	ms.data = make(map[string]map[string][]Row)
+	ms.wal.closeFiles()
+
+	// 各数据文件的检查点 LSN，重放时跳过已保存的修改
+	saved := make(map[string]map[string]uint64)
 
 	// 遍历所有集合
 	collections, err := os.ReadDir(ms.dataDir)
@@ -223,83 +368,343 @@ func (ms *MemoryStore) LoadFromDisk() error {
 				continue
 			}
 
-			// 读取数据文件（.sudb 后缀）
+			// 读取数据文件（.sudb 后缀），兼容旧版本的明文文件
 			dataPath := filepath.Join(collectionPath, db.Name(), "data.sudb")
-			data, err := os.ReadFile(dataPath)
+			file, err := readRecordFile(ms.crypto, dataPath)
 			if err != nil {
-				if !os.IsNotExist(err) {
-					log.Printf("读取数据文件失败: %v", err)
+				if os.IsNotExist(err) {
+					continue
 				}
-				continue
-			}
 
-			// 尝试从备份文件恢复
-			if err := json.Unmarshal(data, &[]Row{}); err != nil {
+				// 尝试从备份文件恢复
 				log.Printf("数据文件损坏，尝试从备份恢复: %v", err)
-				backupPath := dataPath + ".bak"
-				if backupData, err := os.ReadFile(backupPath); err == nil {
-					data = backupData
-				} else {
+				if file, err = readRecordFile(ms.crypto, dataPath+".bak"); err != nil {
 					log.Printf("备份文件不存在或损坏，跳过加载: %v", err)
 					continue
 				}
 			}
 
-			// 解析JSON数据
-			var records []Row
-			if err := json.Unmarshal(data, &records); err != nil {
-				log.Printf("解析数据失败: %v", err)
-				continue
-			}
-
 			// 保存到内存
 			if _, exists := ms.data[col.Name()]; !exists {
 				ms.data[col.Name()] = make(map[string][]Row)
+				saved[col.Name()] = make(map[string]uint64)
+			}
+			ms.data[col.Name()][db.Name()] = file.records
+			saved[col.Name()][db.Name()] = file.lsn
+			if file.lsn > ms.lsn {
+				ms.lsn = file.lsn
 			}
-			ms.data[col.Name()][db.Name()] = records
-			log.Printf("加载数据成功: %s (%d 条记录)", dataPath, len(records))
+			log.Printf("加载数据成功: %s (%d 条记录)", dataPath, len(file.records))
 
-			// 创建备份
-			if err := os.WriteFile(dataPath+".bak", data, 0644); err != nil {
+			// 创建加密的备份
+			data, err := encodeRecordFile(ms.crypto, file.records, file.lsn)
+			if err != nil {
+				log.Printf("编码数据失败: %v", err)
+				continue
+			}
+			if err := security.WriteFileAtomic(dataPath+".bak", data, 0644); err != nil {
 				log.Printf("创建备份失败: %v", err)
 			}
+
+			// 旧格式的文件立即改写为当前格式
+			if file.legacy {
+				if err := security.WriteFileAtomic(dataPath, data, 0644); err != nil {
+					log.Printf("加密旧数据文件失败: %v", err)
+				} else {
+					log.Printf("已将旧格式的数据文件转换为当前格式: %s", dataPath)
+				}
+			}
 		}
 	}
 
-	ms.dirty = false
+	// 重放预写日志中检查点之后的修改
+	pending, err := ms.replayWAL(collections, saved)
+	if err != nil {
+		return err
+	}
+
+	// 日志中有检查点之后的条目时标记为已修改，下次保存时生成新的检查点
+	ms.dirty = pending > 0
 	return nil
 }
 
-// UpdateRecords 更新记录
-func (ms *MemoryStore) UpdateRecords(collection, database string, updates map[string]interface{}, filter map[string]interface{}) error {
+// replayWAL 重放各集合的预写日志，返回日志中检查点之后的条目数（含因数据文件已保存而跳过的条目），
+// 不为 0 时需要再做一次检查点来清空日志。
+// saved 为各数据文件的检查点 LSN，不大于它的条目已包含在数据文件中，不再重放。
+// 跨集合的事务只有在所有相关集合的日志中都存在（或相关集合已在该事务之后做过检查点）时才重放，
+// 以免崩溃时只写了一部分日志的事务被部分恢复；任一集合中有中止记录的事务不重放
+func (ms *MemoryStore) replayWAL(collections []os.DirEntry, saved map[string]map[string]uint64) (int, error) {
+	checkpoints := make(map[string]uint64)
+	covered := make(map[string]uint64) // 集合的所有数据文件都已包含的 LSN
+	logs := make(map[string][]*walEntry)
+	txSeen := make(map[string]map[uint64]bool)
+	aborted := make(map[uint64]bool)
+
+	for _, col := range collections {
+		if !col.IsDir() {
+			continue
+		}
+		checkpoint, entries, err := readWAL(ms.crypto, filepath.Join(ms.dataDir, col.Name(), walFileName))
+		if err != nil {
+			return 0, fmt.Errorf("读取预写日志失败 [%s]: %w", col.Name(), err)
+		}
+		checkpoints[col.Name()] = checkpoint
+		// 保存成功但清空日志失败时日志中可能没有检查点，以数据文件中最小的检查点 LSN 判断事务是否已保存
+		covered[col.Name()] = checkpoint
+		if fileCheckpoint := minLSN(saved[col.Name()]); fileCheckpoint > checkpoint {
+			covered[col.Name()] = fileCheckpoint
+		}
+		logs[col.Name()] = entries
+		txSeen[col.Name()] = make(map[uint64]bool)
+		for _, entry := range entries {
+			switch entry.Type {
+			case walTx:
+				txSeen[col.Name()][entry.LSN] = true
+			case walAbort:
+				aborted[entry.LSN] = true
+			}
+		}
+		if covered[col.Name()] > ms.lsn {
+			ms.lsn = covered[col.Name()]
+		}
+	}
+
+	pending := 0
+	for collection, entries := range logs {
+		replayed := 0
+		for _, entry := range entries {
+			if entry.LSN > ms.lsn {
+				ms.lsn = entry.LSN
+			}
+			if entry.LSN <= checkpoints[collection] {
+				continue
+			}
+			pending++
+			if entry.Type == walAbort {
+				continue
+			}
+
+			ops := []*walEntry{entry}
+			if entry.Type == walTx {
+				if aborted[entry.LSN] {
+					log.Printf("跳过已中止的事务日志 [%s] LSN=%d", collection, entry.LSN)
+					continue
+				}
+				complete := true
+				for _, other := range entry.Participants {
+					if other != collection && !txSeen[other][entry.LSN] && covered[other] < entry.LSN {
+						complete = false
+						break
+					}
+				}
+				if !complete {
+					log.Printf("跳过未完整写入的事务日志 [%s] LSN=%d", collection, entry.LSN)
+					continue
+				}
+				ops = entry.Ops
+			}
+
+			applied := false
+			for _, op := range ops {
+				if entry.LSN <= saved[collection][op.Database] {
+					continue
+				}
+				if err := ms.applyWALEntry(collection, op); err != nil {
+					log.Printf("重放预写日志失败 [%s] LSN=%d: %v", collection, entry.LSN, err)
+				}
+				applied = true
+			}
+			if applied {
+				replayed++
+			}
+		}
+		if replayed > 0 {
+			log.Printf("重放预写日志: %s (%d 条)", collection, replayed)
+		}
+	}
+	return pending, nil
+}
+
+// minLSN 返回最小的检查点 LSN，没有数据文件时为 0
+func minLSN(lsns map[string]uint64) uint64 {
+	var lowest uint64
+	first := true
+	for _, lsn := range lsns {
+		if first || lsn < lowest {
+			lowest = lsn
+			first = false
+		}
+	}
+	return lowest
+}
+
+// applyWALEntry 将一条日志应用到内存数据，调用方需持有写锁
+func (ms *MemoryStore) applyWALEntry(collection string, entry *walEntry) error {
+	switch entry.Type {
+	case walCreate:
+		ms.ensureDatabase(collection, entry.Database)
+
+	case walInsert:
+		ms.ensureDatabase(collection, entry.Database)
+		ms.data[collection][entry.Database] = append(ms.data[collection][entry.Database], entry.Record)
+
+	case walUpdate:
+		if err := checkDatabase(ms.data, collection, entry.Database); err != nil {
+			return err
+		}
+		cond, err := ParseConditions(entry.Filter)
+		if err != nil {
+			return err
+		}
+		update, err := ParseUpdate(entry.Update)
+		if err != nil {
+			return err
+		}
+		records, _, err := updateRows(ms.data[collection][entry.Database], cond, update)
+		if err != nil {
+			return err
+		}
+		ms.data[collection][entry.Database] = records
+
+	case walDelete:
+		if err := checkDatabase(ms.data, collection, entry.Database); err != nil {
+			return err
+		}
+		cond, err := ParseConditions(entry.Filter)
+		if err != nil {
+			return err
+		}
+		ms.data[collection][entry.Database], _ = deleteRows(ms.data[collection][entry.Database], cond)
+
+	default:
+		return fmt.Errorf("未知的日志类型: %s", entry.Type)
+	}
+	return nil
+}
+
+// UpdateRecords 按更新文档（见 ParseUpdate）更新匹配的记录，返回匹配和实际修改的记录数。
+// 所有记录都在副本上更新，任何一条失败时不修改数据
+func (ms *MemoryStore) UpdateRecords(collection, database string, updates map[string]interface{}, filter map[string]interface{}) (UpdateResult, error) {
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
+	result, ticket, err := ms.updateLocked(collection, database, updates, filter)
+	ms.mu.Unlock()
 
-	// 检查集合和数据库是否存在
-	if _, exists := ms.data[collection]; !exists {
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return result, ms.wal.wait(ticket)
+}
+
+func (ms *MemoryStore) updateLocked(collection, database string, updates map[string]interface{}, filter map[string]interface{}) (UpdateResult, uint64, error) {
+	if err := checkDatabase(ms.data, collection, database); err != nil {
+		return UpdateResult{}, 0, err
+	}
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return UpdateResult{}, 0, err
+	}
+	update, err := ParseUpdate(updates)
+	if err != nil {
+		return UpdateResult{}, 0, err
+	}
+
+	records, result, err := updateRows(ms.data[collection][database], cond, update)
+	if err != nil || result.Modified == 0 {
+		return result, 0, err
+	}
+
+	ticket, err := ms.logEntry(collection, &walEntry{Type: walUpdate, Database: database, Update: updates, Filter: filter})
+	if err != nil {
+		return UpdateResult{}, 0, err
+	}
+	ms.data[collection][database] = records
+	ms.dirty = true
+	return result, ticket, nil
+}
+
+// DeleteRecords 删除匹配条件的记录，返回删除的记录数
+func (ms *MemoryStore) DeleteRecords(collection, database string, filter map[string]interface{}) (int, error) {
+	ms.mu.Lock()
+	deleted, ticket, err := ms.deleteLocked(collection, database, filter)
+	ms.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	return deleted, ms.wal.wait(ticket)
+}
+
+func (ms *MemoryStore) deleteLocked(collection, database string, filter map[string]interface{}) (int, uint64, error) {
+	if err := checkDatabase(ms.data, collection, database); err != nil {
+		return 0, 0, err
+	}
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	records, deleted := deleteRows(ms.data[collection][database], cond)
+	if deleted == 0 {
+		return 0, 0, nil
+	}
+
+	ticket, err := ms.logEntry(collection, &walEntry{Type: walDelete, Database: database, Filter: filter})
+	if err != nil {
+		return 0, 0, err
+	}
+	ms.data[collection][database] = records
+	ms.dirty = true
+	return deleted, ticket, nil
+}
+
+// checkDatabase 检查集合和数据库是否存在
+func checkDatabase(data map[string]map[string][]Row, collection, database string) error {
+	if _, exists := data[collection]; !exists {
 		return fmt.Errorf("集合不存在: %s", collection)
 	}
-	if _, exists := ms.data[collection][database]; !exists {
+	if _, exists := data[collection][database]; !exists {
 		return fmt.Errorf("数据库不存在: %s", database)
 	}
+	return nil
+}
 
-	// 更新匹配的记录
-	records := ms.data[collection][database]
-	updated := false
-
+// updateRows 在副本上更新匹配的记录，全部成功后返回新的记录切片，原切片不受影响
+func updateRows(records []Row, cond *Conditions, update *UpdateDoc) ([]Row, UpdateResult, error) {
+	var result UpdateResult
+	var updatedRows []Row
 	for i, record := range records {
-		if MatchConditions(record, filter) {
-			// 更新记录
-			for key, value := range updates {
-				records[i][key] = value
-			}
-			updated = true
+		if !cond.Match(record) {
+			continue
+		}
+		result.Matched++
+
+		updated, modified, err := update.Apply(record)
+		if err != nil {
+			return nil, UpdateResult{}, err
+		}
+		if !modified {
+			continue
+		}
+		if updatedRows == nil {
+			updatedRows = append([]Row(nil), records...)
 		}
+		updatedRows[i] = updated
+		result.Modified++
 	}
 
-	if updated {
-		ms.dirty = true
+	if updatedRows == nil {
+		return records, result, nil
 	}
+	return updatedRows, result, nil
+}
 
-	return nil
+// deleteRows 返回删除匹配记录后的新切片和删除的记录数
+func deleteRows(records []Row, cond *Conditions) ([]Row, int) {
+	kept := make([]Row, 0, len(records))
+	for _, record := range records {
+		if !cond.Match(record) {
+			kept = append(kept, record)
+		}
+	}
+	return kept, len(records) - len(kept)
 }
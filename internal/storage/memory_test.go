@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"testing"
+
+	"sudatas/internal/security"
+)
+
+func newTestCrypto(t *testing.T) *security.CryptoManager {
+	t.Helper()
+	cm, err := security.NewCryptoManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func op(operator string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"operator": operator, "value": value}
+}
+
+func countRows(t *testing.T, ms *MemoryStore, collection, database string, filter map[string]interface{}) int {
+	t.Helper()
+	rows, err := ms.QueryRecords(collection, database, filter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(rows)
+}
+
+func TestDeleteRecords(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	for i := 0; i < 5; i++ {
+		if err := ms.InsertRecord("c", "d", Row{"i": float64(i), "even": i%2 == 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ms.DeleteRecords("c", "missing", nil); err == nil {
+		t.Fatal("删除不存在的数据库没有报错")
+	}
+	if _, err := ms.DeleteRecords("c", "d", map[string]interface{}{"i": op("~~", 1.0)}); err == nil {
+		t.Fatal("无效的条件没有报错")
+	}
+
+	deleted, err := ms.DeleteRecords("c", "d", map[string]interface{}{"even": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Fatalf("删除了 %d 条记录，期望 3 条", deleted)
+	}
+	if deleted, err := ms.DeleteRecords("c", "d", map[string]interface{}{"even": true}); err != nil || deleted != 0 {
+		t.Fatalf("重复删除返回 %d, %v", deleted, err)
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 2 {
+		t.Fatalf("删除后剩余 %d 条记录，期望 2 条", n)
+	}
+
+	// 删除结果写入磁盘后仍然有效
+	if err := ms.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	ms.Stop()
+	ms = NewMemoryStore(dir, cm)
+	if n := countRows(t, ms, "c", "d", map[string]interface{}{"even": true}); n != 0 {
+		t.Fatalf("重新加载后仍有 %d 条已删除的记录", n)
+	}
+
+	// 没有条件时删除全部记录
+	if deleted, err := ms.DeleteRecords("c", "d", nil); err != nil || deleted != 2 {
+		t.Fatalf("删除全部记录返回 %d, %v", deleted, err)
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 0 {
+		t.Fatalf("删除全部后剩余 %d 条记录", n)
+	}
+}
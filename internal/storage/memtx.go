@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// RecordStore 记录读写接口，MemoryStore 和 MemTx 都实现了该接口
+type RecordStore interface {
+	InsertRecord(collection, database string, record Row) error
+	QueryRecords(collection, database string, filter map[string]interface{}, opts *QueryOptions) ([]Row, error)
+	UpdateRecords(collection, database string, updates map[string]interface{}, filter map[string]interface{}) (UpdateResult, error)
+	DeleteRecords(collection, database string, filter map[string]interface{}) (int, error)
+}
+
+// MemTx 内存存储上的事务。
+// 写操作先记录在事务内并作用于事务私有的数据副本，其他会话看不到；
+// 提交时在存储锁内按顺序重新应用到最新数据的副本上，全部成功后一次性替换，任何一步失败都不修改数据。
+type MemTx struct {
+	ms     *MemoryStore
+	staged map[string]map[string][]Row // 本事务写过的数据库：已提交数据的副本加上本事务的修改
+	ops    []txOp
+	closed bool
+}
+
+// txOp 事务中记录的写操作
+type txOp struct {
+	typ        OperationType
+	collection string
+	database   string
+	record     Row
+	cond       *Conditions
+	update     *UpdateDoc
+
+	// 原始的过滤条件和更新文档，提交时写入预写日志
+	filter  map[string]interface{}
+	updates map[string]interface{}
+}
+
+// Begin 开始一个事务
+func (ms *MemoryStore) Begin() *MemTx {
+	return &MemTx{
+		ms:     ms,
+		staged: make(map[string]map[string][]Row),
+	}
+}
+
+// stage 返回事务内某个数据库的私有副本，首次访问时从已提交数据复制
+func (tx *MemTx) stage(collection, database string, create bool) ([]Row, error) {
+	if rows, ok := tx.staged[collection][database]; ok {
+		return rows, nil
+	}
+
+	tx.ms.mu.RLock()
+	committed, exists := tx.ms.data[collection][database]
+	var rows []Row
+	if exists {
+		rows = append(make([]Row, 0, len(committed)), committed...)
+	}
+	err := checkDatabase(tx.ms.data, collection, database)
+	tx.ms.mu.RUnlock()
+
+	if !exists {
+		if !create {
+			return nil, err
+		}
+		rows = make([]Row, 0)
+	}
+	tx.setStaged(collection, database, rows)
+	return rows, nil
+}
+
+func (tx *MemTx) setStaged(collection, database string, rows []Row) {
+	if tx.staged[collection] == nil {
+		tx.staged[collection] = make(map[string][]Row)
+	}
+	tx.staged[collection][database] = rows
+}
+
+func (tx *MemTx) check() error {
+	if tx.closed {
+		return fmt.Errorf("事务已结束")
+	}
+	return nil
+}
+
+// InsertRecord 在事务中插入记录
+func (tx *MemTx) InsertRecord(collection, database string, record Row) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	rows, err := tx.stage(collection, database, true)
+	if err != nil {
+		return err
+	}
+
+	record = CloneRow(record)
+	tx.setStaged(collection, database, append(rows, record))
+	tx.ops = append(tx.ops, txOp{typ: Insert, collection: collection, database: database, record: record})
+	return nil
+}
+
+// QueryRecords 在事务中查询：本事务写过的数据库读取事务内的数据，其余读取已提交的数据
+func (tx *MemTx) QueryRecords(collection, database string, filter map[string]interface{}, opts *QueryOptions) ([]Row, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	rows, ok := tx.staged[collection][database]
+	if !ok {
+		return tx.ms.QueryRecords(collection, database, filter, opts)
+	}
+
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+	return queryRows(rows, cond, opts)
+}
+
+// UpdateRecords 在事务中更新记录
+func (tx *MemTx) UpdateRecords(collection, database string, updates map[string]interface{}, filter map[string]interface{}) (UpdateResult, error) {
+	if err := tx.check(); err != nil {
+		return UpdateResult{}, err
+	}
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	update, err := ParseUpdate(updates)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	rows, err := tx.stage(collection, database, false)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	rows, result, err := updateRows(rows, cond, update)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	tx.setStaged(collection, database, rows)
+	tx.ops = append(tx.ops, txOp{typ: Update, collection: collection, database: database, cond: cond, update: update, filter: filter, updates: updates})
+	return result, nil
+}
+
+// DeleteRecords 在事务中删除记录
+func (tx *MemTx) DeleteRecords(collection, database string, filter map[string]interface{}) (int, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	cond, err := ParseConditions(filter)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.stage(collection, database, false)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, deleted := deleteRows(rows, cond)
+	tx.setStaged(collection, database, rows)
+	tx.ops = append(tx.ops, txOp{typ: Delete, collection: collection, database: database, cond: cond, filter: filter})
+	return deleted, nil
+}
+
+// Commit 提交事务。无论成功与否，事务都会结束
+func (tx *MemTx) Commit() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	tx.closed = true
+	defer func() { tx.staged = nil }()
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	ms := tx.ms
+	ms.mu.Lock()
+	ticket, err := tx.apply()
+	ms.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return ms.wal.wait(ticket)
+}
+
+// apply 在存储锁内重放事务操作、写入预写日志并替换数据，调用方需持有写锁
+func (tx *MemTx) apply() (uint64, error) {
+	ms := tx.ms
+
+	// 在最新数据的副本上重放所有操作
+	work := make(map[string]map[string][]Row)
+	get := func(collection, database string, create bool) ([]Row, error) {
+		if rows, ok := work[collection][database]; ok {
+			return rows, nil
+		}
+		if committed, ok := ms.data[collection][database]; ok {
+			return append(make([]Row, 0, len(committed)), committed...), nil
+		}
+		if !create {
+			return nil, checkDatabase(ms.data, collection, database)
+		}
+		return make([]Row, 0), nil
+	}
+
+	for _, op := range tx.ops {
+		rows, err := get(op.collection, op.database, op.typ == Insert)
+		if err != nil {
+			return 0, fmt.Errorf("提交事务失败，已回滚: %w", err)
+		}
+		switch op.typ {
+		case Insert:
+			rows = append(rows, op.record)
+		case Update:
+			if rows, _, err = updateRows(rows, op.cond, op.update); err != nil {
+				return 0, fmt.Errorf("提交事务失败，已回滚: %w", err)
+			}
+		case Delete:
+			rows, _ = deleteRows(rows, op.cond)
+		}
+		if work[op.collection] == nil {
+			work[op.collection] = make(map[string][]Row)
+		}
+		work[op.collection][op.database] = rows
+	}
+
+	// 每个涉及的集合写入一条事务日志，共用一个序号；任何一条写入失败都不修改数据
+	ticket, err := tx.log()
+	if err != nil {
+		return 0, fmt.Errorf("提交事务失败，已回滚: %w", err)
+	}
+
+	// 全部成功后一次性替换
+	for collection, dbs := range work {
+		if ms.data[collection] == nil {
+			ms.data[collection] = make(map[string][]Row)
+		}
+		for database, rows := range dbs {
+			ms.data[collection][database] = rows
+		}
+	}
+	ms.dirty = true
+	return ticket, nil
+}
+
+// log 按集合写入事务日志，返回最后一条日志的等待序号
+func (tx *MemTx) log() (uint64, error) {
+	byCollection := make(map[string][]*walEntry)
+	for _, op := range tx.ops {
+		entry := &walEntry{Database: op.database}
+		switch op.typ {
+		case Insert:
+			entry.Type = walInsert
+			entry.Record = op.record
+		case Update:
+			entry.Type = walUpdate
+			entry.Update = op.updates
+			entry.Filter = op.filter
+		case Delete:
+			entry.Type = walDelete
+			entry.Filter = op.filter
+		}
+		byCollection[op.collection] = append(byCollection[op.collection], entry)
+	}
+
+	participants := make([]string, 0, len(byCollection))
+	for collection := range byCollection {
+		participants = append(participants, collection)
+	}
+	sort.Strings(participants)
+
+	ms := tx.ms
+	ms.lsn++
+	var ticket uint64
+	sizes := make(map[string]int64, len(participants))
+	for _, collection := range participants {
+		size, err := ms.wal.size(collection)
+		if err != nil {
+			return 0, err
+		}
+		sizes[collection] = size
+	}
+	for _, collection := range participants {
+		t, err := ms.wal.append(collection, &walEntry{
+			LSN:          ms.lsn,
+			Type:         walTx,
+			Ops:          byCollection[collection],
+			Participants: participants,
+		})
+		if err != nil {
+			tx.abortLog(participants, sizes)
+			return 0, err
+		}
+		if t > ticket {
+			ticket = t
+		}
+	}
+	return ticket, nil
+}
+
+// abortLog 撤销已写入的事务日志：截回写入前的长度，截断失败时追加一条中止记录，
+// 以免其他集合做过检查点后这个没有提交的事务在重放时被当作完整的事务
+func (tx *MemTx) abortLog(participants []string, sizes map[string]int64) {
+	ms := tx.ms
+	for _, collection := range participants {
+		err := ms.wal.truncate(collection, sizes[collection])
+		if err == nil {
+			continue
+		}
+		log.Printf("撤销事务日志失败 [%s] LSN=%d: %v", collection, ms.lsn, err)
+		if _, err := ms.wal.append(collection, &walEntry{LSN: ms.lsn, Type: walAbort}); err != nil {
+			log.Printf("写入事务中止记录失败 [%s] LSN=%d: %v", collection, ms.lsn, err)
+		}
+	}
+}
+
+// Rollback 回滚事务，丢弃所有未提交的修改
+func (tx *MemTx) Rollback() error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	tx.closed = true
+	tx.staged = nil
+	tx.ops = nil
+	return nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemTxIsolationAndCommit(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	if err := ms.InsertRecord("c", "d", Row{"id": 1.0, "n": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := ms.Begin()
+	if err := tx.InsertRecord("c", "d", Row{"id": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateRecords("c", "d", map[string]interface{}{"$inc": map[string]interface{}{"n": 1.0}}, map[string]interface{}{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未提交的修改只在事务内可见
+	if rows, _ := tx.QueryRecords("c", "d", nil, nil); len(rows) != 2 {
+		t.Fatalf("事务内看到 %d 条记录，期望 2 条", len(rows))
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 1 {
+		t.Fatalf("事务外看到 %d 条记录，期望 1 条", n)
+	}
+
+	// 其他会话在提交前写入的数据不会被覆盖
+	if err := ms.InsertRecord("c", "d", Row{"id": 3.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 3 {
+		t.Fatalf("提交后有 %d 条记录，期望 3 条", n)
+	}
+	if n := countRows(t, ms, "c", "d", map[string]interface{}{"n": 2.0}); n != 1 {
+		t.Fatal("事务中的更新没有生效")
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("已结束的事务可以再次提交")
+	}
+}
+
+func TestMemTxRollback(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	if err := ms.InsertRecord("c", "d", Row{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := ms.Begin()
+	if _, err := tx.DeleteRecords("c", "d", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 1 {
+		t.Fatalf("回滚后有 %d 条记录，期望 1 条", n)
+	}
+	if _, err := tx.QueryRecords("c", "d", nil, nil); err == nil {
+		t.Fatal("已回滚的事务仍可查询")
+	}
+}
+
+func TestMemTxCommitConflict(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	if err := ms.InsertRecord("c", "d", Row{"id": 1.0, "n": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := ms.Begin()
+	if err := tx.InsertRecord("c", "d", Row{"id": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateRecords("c", "d", map[string]interface{}{"$inc": map[string]interface{}{"n": 1.0}}, map[string]interface{}{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	// 提交前另一个会话把字段改成了字符串，提交时重新应用 $inc 失败
+	if _, err := ms.UpdateRecords("c", "d", map[string]interface{}{"n": "x"}, map[string]interface{}{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("冲突的事务提交成功")
+	}
+	if n := countRows(t, ms, "c", "d", nil); n != 1 {
+		t.Fatalf("提交失败后有 %d 条记录，期望 1 条", n)
+	}
+}
+
+func TestMemTxLogFailureUndoesEntries(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+	ms := NewMemoryStore(dir, cm)
+	if err := ms.InsertRecord("a", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.InsertRecord("b", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	pathA := filepath.Join(dir, "a", walFileName)
+	before, err := os.ReadFile(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b 的日志改为只读打开，事务日志写入 a 之后在 b 上失败
+	ms.mu.Lock()
+	ms.wal.files["b"].Close()
+	readOnly, err := os.Open(filepath.Join(dir, "b", walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.wal.files["b"] = readOnly
+	ms.mu.Unlock()
+
+	tx := ms.Begin()
+	tx.InsertRecord("a", "d", Row{"i": 2.0})
+	tx.InsertRecord("b", "d", Row{"i": 2.0})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("日志写入失败时事务提交成功")
+	}
+	if countRows(t, ms, "a", "d", nil) != 1 || countRows(t, ms, "b", "d", nil) != 1 {
+		t.Fatal("日志写入失败后数据被修改")
+	}
+
+	// 已写入 a 的事务日志被撤销
+	after, err := os.ReadFile(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("a 的日志长度为 %d，期望截回 %d", len(after), len(before))
+	}
+	crash(ms)
+
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if countRows(t, ms, "a", "d", nil) != 1 || countRows(t, ms, "b", "d", nil) != 1 {
+		t.Fatal("写入失败的事务被重放")
+	}
+}
+
+func TestReplaySkipsAbortedTransaction(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	// a 中有事务日志和中止记录，b 已在该事务之后做过检查点
+	for collection, entries := range map[string][]*walEntry{
+		"a": {
+			{LSN: 1, Type: walTx, Participants: []string{"a", "b"}, Ops: []*walEntry{{Type: walInsert, Database: "d", Record: Row{"i": 1.0}}}},
+			{LSN: 1, Type: walAbort},
+		},
+		"b": {
+			{LSN: 2, Type: walCheckpoint},
+		},
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, collection), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(filepath.Join(dir, collection, walFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if err := writeWALEntry(cm, f, entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+
+	ms := NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "a", "d", nil); n != 0 {
+		t.Fatalf("已中止的事务被重放，a 中有 %d 条记录", n)
+	}
+	if ms.lsn != 2 {
+		t.Fatalf("LSN 为 %d，期望 2", ms.lsn)
+	}
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathSegment 字段路径中的一段：对象的键或数组下标
+type PathSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Path 解析后的字段路径，如 author.name、tags[0]、stats.likes
+type Path []PathSegment
+
+// ParsePath 解析字段路径：键之间用 . 分隔，数组下标写在 [] 中
+func ParsePath(s string) (Path, error) {
+	var path Path
+	i := 0
+	for i < len(s) {
+		switch {
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("字段路径 %s 中的 [ 没有闭合", s)
+			}
+			index, err := strconv.Atoi(s[i+1 : i+end])
+			if err != nil || index < 0 || s[i+1] == '+' {
+				return nil, fmt.Errorf("字段路径 %s 中的数组下标无效: %s", s, s[i+1:i+end])
+			}
+			if len(path) == 0 {
+				return nil, fmt.Errorf("字段路径 %s 必须以字段名开头", s)
+			}
+			path = append(path, PathSegment{Index: index, IsIndex: true})
+			i += end + 1
+
+		case s[i] == '.' && len(path) > 0:
+			i++
+			fallthrough
+
+		default:
+			end := i
+			for end < len(s) && s[end] != '.' && s[end] != '[' {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("字段路径 %s 中有空的字段名", s)
+			}
+			path = append(path, PathSegment{Key: s[i:end]})
+			i = end
+		}
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("字段路径不能为空")
+	}
+	return path, nil
+}
+
+// String 返回路径的规范写法
+func (p Path) String() string {
+	var b strings.Builder
+	for i, seg := range p {
+		if seg.IsIndex {
+			fmt.Fprintf(&b, "[%d]", seg.Index)
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(seg.Key)
+	}
+	return b.String()
+}
+
+// Get 按路径取值，路径中任何一段不存在或类型不符时返回 false
+func (p Path) Get(record Row) (interface{}, bool) {
+	var node interface{} = map[string]interface{}(record)
+	for _, seg := range p {
+		if seg.IsIndex {
+			arr, ok := node.([]interface{})
+			if !ok || seg.Index >= len(arr) {
+				return nil, false
+			}
+			node = arr[seg.Index]
+			continue
+		}
+		obj, ok := asObject(node)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = obj[seg.Key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// Set 按路径赋值。缺失的中间对象会自动创建；数组下标可以等于数组长度，表示追加一个元素
+func (p Path) Set(record Row, value interface{}) error {
+	if record == nil {
+		return fmt.Errorf("记录为空")
+	}
+	_, err := setIn(map[string]interface{}(record), p, value, p)
+	return err
+}
+
+// Delete 删除路径指向的字段或数组元素（后面的元素前移），返回是否删除了内容
+func (p Path) Delete(record Row) bool {
+	parent, ok := Path(p[:len(p)-1]).Get(record)
+	if !ok {
+		return false
+	}
+
+	last := p[len(p)-1]
+	if !last.IsIndex {
+		obj, ok := asObject(parent)
+		if !ok {
+			return false
+		}
+		if _, exists := obj[last.Key]; !exists {
+			return false
+		}
+		delete(obj, last.Key)
+		return true
+	}
+
+	arr, ok := parent.([]interface{})
+	if !ok || last.Index >= len(arr) {
+		return false
+	}
+	arr = append(arr[:last.Index:last.Index], arr[last.Index+1:]...)
+	if err := Path(p[:len(p)-1]).Set(record, arr); err != nil {
+		return false
+	}
+	return true
+}
+
+// setIn 在 node 中按剩余路径赋值，返回更新后的节点（数组追加元素时切片会变化）
+func setIn(node interface{}, rest Path, value interface{}, full Path) (interface{}, error) {
+	if len(rest) == 0 {
+		return value, nil
+	}
+
+	seg := rest[0]
+	if seg.IsIndex {
+		arr, ok := node.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("字段路径 %s: 下标 [%d] 前的值不是数组", full, seg.Index)
+		}
+		if seg.Index > len(arr) {
+			return nil, fmt.Errorf("字段路径 %s: 数组下标 %d 越界（长度 %d）", full, seg.Index, len(arr))
+		}
+		var child interface{}
+		if seg.Index < len(arr) {
+			child = arr[seg.Index]
+		}
+		v, err := setIn(child, rest[1:], value, full)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Index == len(arr) {
+			return append(arr, v), nil
+		}
+		arr[seg.Index] = v
+		return arr, nil
+	}
+
+	if node == nil {
+		node = make(map[string]interface{})
+	}
+	obj, ok := asObject(node)
+	if !ok {
+		return nil, fmt.Errorf("字段路径 %s: %s 前的值不是对象", full, seg.Key)
+	}
+	v, err := setIn(obj[seg.Key], rest[1:], value, full)
+	if err != nil {
+		return nil, err
+	}
+	obj[seg.Key] = v
+	return obj, nil
+}
+
+// asObject 将对象类型的值统一为 map[string]interface{}
+func asObject(v interface{}) (map[string]interface{}, bool) {
+	switch obj := v.(type) {
+	case map[string]interface{}:
+		return obj, true
+	case Row:
+		return obj, true
+	}
+	return nil, false
+}
+
+// isSimplePath 路径是否只是一个顶层字段名
+func isSimplePath(path string) bool {
+	return !strings.ContainsAny(path, ".[")
+}
+
+// GetPath 按字段路径取值。顶层存在同名字段（字段名本身含有 . 或 [）时优先返回该字段
+func GetPath(record Row, path string) (interface{}, bool) {
+	if v, ok := record[path]; ok || isSimplePath(path) {
+		return v, ok
+	}
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	return p.Get(record)
+}
+
+// SetPath 按字段路径赋值，规则与 GetPath 一致
+func SetPath(record Row, path string, value interface{}) error {
+	if _, ok := record[path]; ok || isSimplePath(path) {
+		record[path] = value
+		return nil
+	}
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	return p.Set(record, value)
+}
+
+// DeletePath 按字段路径删除字段，规则与 GetPath 一致
+func DeletePath(record Row, path string) bool {
+	if _, ok := record[path]; ok || isSimplePath(path) {
+		_, existed := record[path]
+		delete(record, path)
+		return existed
+	}
+	p, err := ParsePath(path)
+	if err != nil {
+		return false
+	}
+	return p.Delete(record)
+}
+
+// PathsOverlap 两个字段路径是否相同或一个包含另一个
+func PathsOverlap(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if a == b {
+		return true
+	}
+	return strings.HasPrefix(b, a) && (b[len(a)] == '.' || b[len(a)] == '[')
+}
+
+// PathWithin 字段路径 path 是否为 parent 本身或它的子字段
+func PathWithin(path, parent string) bool {
+	return len(path) >= len(parent) && PathsOverlap(path, parent)
+}
+
+// ProjectRow 按字段路径投影记录，结果以路径原文为键，不存在的字段不输出
+func ProjectRow(record Row, columns []string) Row {
+	row := make(Row, len(columns))
+	for _, col := range columns {
+		if val, ok := GetPath(record, col); ok {
+			row[col] = val
+		}
+	}
+	return row
+}
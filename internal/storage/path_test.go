@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath("a.b[0].c[12]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Path{{Key: "a"}, {Key: "b"}, {Index: 0, IsIndex: true}, {Key: "c"}, {Index: 12, IsIndex: true}}
+	if !reflect.DeepEqual(path, want) {
+		t.Fatalf("解析结果 %+v", path)
+	}
+	if path.String() != "a.b[0].c[12]" {
+		t.Fatalf("规范写法为 %s", path)
+	}
+
+	for _, s := range []string{"", "a[", "[0]", "a..b", "a.", "a[-1]", "a[+1]", "a[x]"} {
+		if _, err := ParsePath(s); err == nil {
+			t.Errorf("接受了无效的路径 %q", s)
+		}
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	rows := parseRows(t, `[{"author": {"name": "A"}, "tags": ["go", {"k": 1}], "a.b": 7, "a": {"b": 8}, "s": "x"}]`)
+	record := rows[0]
+
+	tests := []struct {
+		path   string
+		want   interface{}
+		exists bool
+	}{
+		{"author.name", "A", true},
+		{"tags[0]", "go", true},
+		{"tags[1].k", 1.0, true},
+		{"tags[2]", nil, false},
+		{"author.age", nil, false},
+		{"s.x", nil, false},
+		{"s[0]", nil, false},
+		{"missing", nil, false},
+		// 顶层存在同名字段时优先返回该字段
+		{"a.b", 7.0, true},
+	}
+	for _, tt := range tests {
+		got, ok := GetPath(record, tt.path)
+		if ok != tt.exists || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 得到 %v, %v", tt.path, got, ok)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	record := parseRows(t, `[{"author": {"name": "A"}, "tags": ["go"], "s": "x"}]`)[0]
+
+	for path, value := range map[string]interface{}{
+		"author.name":    "Z",
+		"stats.new.deep": 1.0,
+		"tags[0]":        "rust",
+		"tags[1]":        "db", // 下标等于长度时追加
+	} {
+		if err := SetPath(record, path, value); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	want := Row{
+		"author": map[string]interface{}{"name": "Z"},
+		"stats":  map[string]interface{}{"new": map[string]interface{}{"deep": 1.0}},
+		"tags":   []interface{}{"rust", "db"},
+		"s":      "x",
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Fatalf("赋值结果 %v", record)
+	}
+
+	for _, path := range []string{"tags[5]", "s.x", "author[0]", "a..b"} {
+		if err := SetPath(record, path, 1.0); err == nil {
+			t.Errorf("%s: 期望赋值失败", path)
+		}
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Fatalf("赋值失败后记录被修改: %v", record)
+	}
+}
+
+func TestDeletePath(t *testing.T) {
+	record := parseRows(t, `[{"author": {"name": "A", "age": 3}, "tags": ["a", "b", "c"], "x": 1}]`)[0]
+
+	for _, tt := range []struct {
+		path    string
+		deleted bool
+	}{
+		{"author.age", true},
+		{"author.age", false},
+		{"tags[1]", true},
+		{"tags[5]", false},
+		{"x", true},
+		{"x.y", false},
+	} {
+		if got := DeletePath(record, tt.path); got != tt.deleted {
+			t.Errorf("删除 %s 返回 %v", tt.path, got)
+		}
+	}
+	want := Row{"author": map[string]interface{}{"name": "A"}, "tags": []interface{}{"a", "c"}}
+	if !reflect.DeepEqual(record, want) {
+		t.Fatalf("删除结果 %v", record)
+	}
+}
+
+func TestPathsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		overlap bool
+		within  bool
+	}{
+		{"a", "a", true, true},
+		{"a.b", "a", true, true},
+		{"a[0]", "a", true, true},
+		{"a", "a.b", true, false},
+		{"ab", "a", false, false},
+		{"a.b", "a.c", false, false},
+	}
+	for _, tt := range tests {
+		if got := PathsOverlap(tt.a, tt.b); got != tt.overlap {
+			t.Errorf("PathsOverlap(%s, %s) = %v", tt.a, tt.b, got)
+		}
+		if got := PathWithin(tt.a, tt.b); got != tt.within {
+			t.Errorf("PathWithin(%s, %s) = %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestProjectRow(t *testing.T) {
+	record := parseRows(t, `[{"id": 1, "author": {"name": "A", "age": 3}, "tags": ["go"]}]`)[0]
+	got := ProjectRow(record, []string{"id", "author.name", "tags[0]", "missing"})
+	want := Row{"id": 1.0, "author.name": "A", "tags[0]": "go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("投影结果 %v", got)
+	}
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/security"
+)
+
+// loadPermissions 加载加密保存的自定义角色、用户角色和直接权限，文件不存在时返回 false
+func (um *UserManager) loadPermissions() (bool, error) {
+	data, err := os.ReadFile(um.permFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取权限数据失败: %w", err)
+	}
+
+	decrypted, err := um.crypto.DecryptSM4(data)
+	if err != nil {
+		return false, fmt.Errorf("解密权限数据失败: %w", err)
+	}
+	var state auth.PermissionState
+	if err := json.Unmarshal(decrypted, &state); err != nil {
+		return false, fmt.Errorf("解析权限数据失败: %w", err)
+	}
+	if err := um.permMgr.LoadState(&state); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rebuildPermissions 旧版本没有保存权限数据，按用户数据中的角色重建并保存
+func (um *UserManager) rebuildPermissions() error {
+	for username, user := range um.users {
+		for _, role := range user.Roles {
+			if err := um.permMgr.AssignRole(username, role); err != nil {
+				log.Printf("恢复用户 %s 的角色失败: %v", username, err)
+			}
+		}
+		user.Roles = um.permMgr.UserRoles(username)
+	}
+	return um.savePermissions()
+}
+
+// savePermissions 加密保存权限数据，调用方需持有写锁
+func (um *UserManager) savePermissions() error {
+	data, err := json.MarshalIndent(um.permMgr.State(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化权限数据失败: %w", err)
+	}
+
+	encrypted, err := um.crypto.EncryptSM4(data)
+	if err != nil {
+		return fmt.Errorf("加密权限数据失败: %w", err)
+	}
+
+	if err := security.WriteFileAtomic(um.permFile, encrypted, 0600); err != nil {
+		return fmt.Errorf("保存权限数据失败: %w", err)
+	}
+	return nil
+}
+
+// CreateRole 创建自定义角色
+func (um *UserManager) CreateRole(name, description string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if err := um.permMgr.CreateRole(&auth.Role{Name: name, Description: description}); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// DropRole 删除自定义角色，并收回所有用户的该角色
+func (um *UserManager) DropRole(name string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	affected, err := um.permMgr.DropRole(name)
+	if err != nil {
+		return err
+	}
+	if err := um.savePermissions(); err != nil {
+		return err
+	}
+
+	if len(affected) == 0 {
+		return nil
+	}
+	for _, username := range affected {
+		if user, exists := um.users[username]; exists {
+			user.Roles = um.permMgr.UserRoles(username)
+		}
+	}
+	return um.Save()
+}
+
+// RoleExists 角色是否存在
+func (um *UserManager) RoleExists(name string) bool {
+	return um.permMgr.RoleExists(name)
+}
+
+// UserRoles 返回用户的角色
+func (um *UserManager) UserRoles(username string) []string {
+	return um.permMgr.UserRoles(username)
+}
+
+// GrantRoles 为用户分配角色
+func (um *UserManager) GrantRoles(username string, roles []string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	for _, role := range roles {
+		if !um.permMgr.RoleExists(role) {
+			return fmt.Errorf("角色不存在: %s", role)
+		}
+	}
+	for _, role := range roles {
+		if err := um.permMgr.AssignRole(username, role); err != nil {
+			return err
+		}
+	}
+
+	user.Roles = um.permMgr.UserRoles(username)
+	if err := um.Save(); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// RevokeRoles 收回用户的角色
+func (um *UserManager) RevokeRoles(username string, roles []string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	for _, role := range roles {
+		um.permMgr.RevokeRole(username, role)
+	}
+
+	user.Roles = um.permMgr.UserRoles(username)
+	if err := um.Save(); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// GrantPermission 为用户直接授予权限
+func (um *UserManager) GrantPermission(username string, rule auth.PermissionRule) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if _, exists := um.users[username]; !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	if err := um.permMgr.GrantPermission(username, rule); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// AddPermission 为用户直接授予权限，已有相同权限和资源的规则时报错
+func (um *UserManager) AddPermission(username string, rule auth.PermissionRule) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if _, exists := um.users[username]; !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	if err := um.permMgr.AddPermission(username, rule); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// RevokePermission 收回用户直接拥有的权限，返回是否收回
+func (um *UserManager) RevokePermission(username string, perm auth.Permission, res auth.Resource) (bool, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if _, exists := um.users[username]; !exists {
+		return false, fmt.Errorf("用户不存在")
+	}
+	if !um.permMgr.RevokePermission(username, perm, res) {
+		return false, nil
+	}
+	return true, um.savePermissions()
+}
+
+// GrantRolePermission 为自定义角色增加权限
+func (um *UserManager) GrantRolePermission(role string, rule auth.PermissionRule) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if err := um.permMgr.GrantRolePermission(role, rule); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// AddRolePermission 为自定义角色增加权限，已有相同权限和资源的规则时报错
+func (um *UserManager) AddRolePermission(role string, rule auth.PermissionRule) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if err := um.permMgr.AddRolePermission(role, rule); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
+// RevokeRolePermission 收回自定义角色的权限，返回是否收回
+func (um *UserManager) RevokeRolePermission(role string, perm auth.Permission, res auth.Resource) (bool, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	removed, err := um.permMgr.RevokeRolePermission(role, perm, res)
+	if err != nil || !removed {
+		return false, err
+	}
+	return true, um.savePermissions()
+}
+
+// CanGrant 用户是否可以把特定权限转授给他人，并返回转授时必须附加的行级条件
+func (um *UserManager) CanGrant(username string, perm auth.Permission, res auth.Resource) ([]string, bool) {
+	um.mu.RLock()
+	user, exists := um.users[username]
+	active := exists && user.Status == "active"
+	um.mu.RUnlock()
+
+	if !active {
+		return nil, false
+	}
+	return um.permMgr.CanGrant(username, perm, res)
+}
+
+// RowConditions 返回用户在资源上某个权限的行级安全条件，root 和 admin 不受限制
+func (um *UserManager) RowConditions(username string, perm auth.Permission, res auth.Resource) ([]string, bool) {
+	if um.unrestricted(username) {
+		return nil, false
+	}
+	return um.permMgr.RowConditions(username, perm, res)
+}
+
+// RowRestrictedInCollection 用户在集合中任一数据库上的 perm 权限是否带行级条件，root 和 admin 不受限制
+func (um *UserManager) RowRestrictedInCollection(username string, perm auth.Permission, collection string) bool {
+	if um.unrestricted(username) {
+		return false
+	}
+	return um.permMgr.RowRestrictedInCollection(username, perm, collection)
+}
+
+// ColumnPolicy 返回用户在资源上某个权限的列级访问控制，没有限制时返回 nil，root 和 admin 不受限制
+func (um *UserManager) ColumnPolicy(username string, perm auth.Permission, res auth.Resource) *auth.ColumnPolicy {
+	if um.unrestricted(username) {
+		return nil
+	}
+	return um.permMgr.ColumnPolicy(username, perm, res)
+}
+
+// unrestricted root 和 admin 角色的用户不受行级和列级限制
+func (um *UserManager) unrestricted(username string) bool {
+	if username == "root" {
+		return true
+	}
+	for _, role := range um.permMgr.UserRoles(username) {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
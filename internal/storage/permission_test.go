@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"sudatas/internal/auth"
+)
+
+func TestPermissionsPersist(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := um.BootstrapRoot("Admin-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := um.CreateRole("analyst", "分析"); err != nil {
+		t.Fatal(err)
+	}
+	if err := um.CreateUser("bob", "Secret-123", []string{"analyst"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := um.GrantRoles("bob", []string{"readonly"}); err != nil {
+		t.Fatal(err)
+	}
+	orders := auth.Resource{Type: auth.ResDatabase, Name: "c.d"}
+	if err := um.GrantPermission("bob", auth.PermissionRule{Permission: auth.PermInsert, Resource: orders}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := reloaded.users["bob"].Roles
+	sort.Strings(roles)
+	if !reloaded.RoleExists("analyst") || !reflect.DeepEqual(roles, []string{"analyst", "readonly"}) {
+		t.Fatalf("重新加载后 bob 的角色 %v", roles)
+	}
+	if !reloaded.CheckPermission("bob", auth.PermInsert, orders) {
+		t.Fatal("重新加载后直接授权丢失")
+	}
+	if !reloaded.CheckPermission("root", auth.PermCreateRole, auth.Resource{Type: auth.ResRole}) {
+		t.Fatal("重新加载后 root 没有管理员权限")
+	}
+
+	// 删除角色同时收回用户的该角色
+	if err := reloaded.DropRole("readonly"); err == nil {
+		t.Fatal("删除预定义角色成功")
+	}
+	if err := reloaded.DropRole("analyst"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.RoleExists("analyst") || !reflect.DeepEqual(again.users["bob"].Roles, []string{"readonly"}) {
+		t.Fatalf("删除角色后 bob 的角色 %v", again.users["bob"].Roles)
+	}
+}
+
+func TestPermissionsRebuiltFromLegacyUsers(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	writeLegacyUsers(t, filename, cm, map[string]*User{
+		"root": {Username: "root", Password: "123456", Roles: []string{"admin"}, Status: "active"},
+		"bob":  {Username: "bob", Password: "pw", Roles: []string{"developer", "gone"}, Status: "active"},
+	})
+
+	// 旧版本没有权限数据，按用户数据中的角色重建，不存在的角色被忽略
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(um.users["bob"].Roles, []string{"developer"}) {
+		t.Fatalf("重建的角色 %v", um.users["bob"].Roles)
+	}
+	if !um.CheckPermission("root", auth.PermCreateUser, auth.Resource{Type: auth.ResUser}) {
+		t.Fatal("重建后 root 没有管理员权限")
+	}
+	if _, err := os.Stat(um.permFile); err != nil {
+		t.Fatalf("没有保存重建的权限数据: %v", err)
+	}
+
+	// 权限数据损坏时不能当作没有授权继续启动
+	if err := os.WriteFile(um.permFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewUserManager(filename, cm); err == nil {
+		t.Fatal("权限数据损坏时启动成功")
+	}
+}
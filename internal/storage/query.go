@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SortKey 排序键
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// QueryOptions 查询选项
+type QueryOptions struct {
+	GroupBy    []string
+	Aggregates []Aggregate
+	Having     map[string]interface{} // 作用于分组结果的过滤条件
+	OrderBy    []SortKey
+	Limit      int // 小于等于0表示不限制
+	Offset     int
+}
+
+// Grouped 是否为分组/聚合查询
+func (opts *QueryOptions) Grouped() bool {
+	return opts != nil && (len(opts.GroupBy) > 0 || len(opts.Aggregates) > 0)
+}
+
+// 排序时不同类型值的先后顺序：缺失 < null < 布尔 < 数字 < 字符串 < 数组 < 对象
+const (
+	rankMissing = iota
+	rankNull
+	rankBool
+	rankNumber
+	rankString
+	rankArray
+	rankObject
+)
+
+// typeRank 返回值在排序中的类型序号
+func typeRank(v interface{}, exists bool) int {
+	if !exists {
+		return rankMissing
+	}
+	switch v.(type) {
+	case nil:
+		return rankNull
+	case bool:
+		return rankBool
+	case string:
+		return rankString
+	case []interface{}:
+		return rankArray
+	case map[string]interface{}, Row:
+		return rankObject
+	}
+	if _, ok := toFloat64(v); ok {
+		return rankNumber
+	}
+	return rankObject
+}
+
+// toFloat64 将数值类型统一转换为 float64
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareSortValues 按类型序号和值比较两个字段，用于排序
+func compareSortValues(a interface{}, aExists bool, b interface{}, bExists bool) int {
+	ra, rb := typeRank(a, aExists), typeRank(b, bExists)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch ra {
+	case rankBool:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case rankNumber:
+		x, _ := toFloat64(a)
+		y, _ := toFloat64(b)
+		return compareValues(x, y)
+	case rankString:
+		return compareValues(a, b)
+	case rankArray:
+		x, y := a.([]interface{}), b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareSortValues(x[i], true, y[i], true); c != 0 {
+				return c
+			}
+		}
+		return compareValues(float64(len(x)), float64(len(y)))
+	case rankObject:
+		// 对象没有自然顺序，按JSON编码比较以保证结果稳定
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		return compareValues(string(x), string(y))
+	}
+	return 0
+}
+
+// SortRows 按排序键对记录进行稳定排序
+func SortRows(rows []Row, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			a, aExists := GetPath(rows[i], key.Field)
+			b, bExists := GetPath(rows[j], key.Field)
+			c := compareSortValues(a, aExists, b, bExists)
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// applyQueryOptions 对过滤后的记录依次执行分组聚合、HAVING、排序、偏移和数量限制
+func applyQueryOptions(rows []Row, opts *QueryOptions) ([]Row, error) {
+	if opts == nil {
+		return rows, nil
+	}
+
+	if opts.Grouped() {
+		having, err := ParseConditions(opts.Having)
+		if err != nil {
+			return nil, err
+		}
+		grouped, err := GroupRows(rows, opts.GroupBy, opts.Aggregates)
+		if err != nil {
+			return nil, err
+		}
+		rows = grouped[:0]
+		for _, row := range grouped {
+			if having.Match(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	SortRows(rows, opts.OrderBy)
+
+	if opts.Offset > 0 {
+		if opts.Offset >= len(rows) {
+			return []Row{}, nil
+		}
+		rows = rows[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(rows) {
+		rows = rows[:opts.Limit]
+	}
+	return rows, nil
+}
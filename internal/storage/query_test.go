@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func ids(rows []Row) []interface{} {
+	out := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row["id"])
+	}
+	return out
+}
+
+func TestSortRowsMixedTypes(t *testing.T) {
+	rows := []Row{
+		{"id": "string", "a": "x"},
+		{"id": "number", "a": 2.0},
+		{"id": "missing"},
+		{"id": "null", "a": nil},
+		{"id": "bool", "a": true},
+		{"id": "int", "a": 1},
+		{"id": "array", "a": []interface{}{1.0}},
+		{"id": "object", "a": map[string]interface{}{}},
+	}
+
+	// 缺失 < null < 布尔 < 数字 < 字符串 < 数组 < 对象，不同数值类型按数值比较
+	SortRows(rows, []SortKey{{Field: "a"}})
+	want := []interface{}{"missing", "null", "bool", "int", "number", "string", "array", "object"}
+	if got := ids(rows); !reflect.DeepEqual(got, want) {
+		t.Fatalf("升序结果 %v", got)
+	}
+
+	SortRows(rows, []SortKey{{Field: "a", Desc: true}})
+	want = []interface{}{"object", "array", "string", "number", "int", "bool", "null", "missing"}
+	if got := ids(rows); !reflect.DeepEqual(got, want) {
+		t.Fatalf("降序结果 %v", got)
+	}
+}
+
+func TestSortRowsMultipleKeys(t *testing.T) {
+	rows := []Row{
+		{"id": 1.0, "g": "b", "n": 1.0},
+		{"id": 2.0, "g": "a", "n": 1.0},
+		{"id": 3.0, "g": "b", "n": 2.0},
+		{"id": 4.0, "g": "a", "n": 2.0},
+		{"id": 5.0, "g": "a", "n": 2.0},
+	}
+	SortRows(rows, []SortKey{{Field: "g"}, {Field: "n", Desc: true}})
+	// 排序稳定，相同键的记录保持原来的顺序
+	if got := ids(rows); !reflect.DeepEqual(got, []interface{}{4.0, 5.0, 2.0, 3.0, 1.0}) {
+		t.Fatalf("排序结果 %v", got)
+	}
+}
+
+func TestApplyQueryOptionsPaging(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit, offset int
+		want          []interface{}
+	}{
+		{"不限制", 0, 0, []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}},
+		{"LIMIT", 2, 0, []interface{}{1.0, 2.0}},
+		{"OFFSET", 0, 3, []interface{}{4.0, 5.0}},
+		{"LIMIT 和 OFFSET", 2, 1, []interface{}{2.0, 3.0}},
+		{"LIMIT 超过剩余记录数", 10, 4, []interface{}{5.0}},
+		{"OFFSET 超过记录数", 2, 5, []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := []Row{{"id": 3.0}, {"id": 1.0}, {"id": 5.0}, {"id": 2.0}, {"id": 4.0}}
+			out, err := applyQueryOptions(rows, &QueryOptions{
+				OrderBy: []SortKey{{Field: "id"}},
+				Limit:   tt.limit,
+				Offset:  tt.offset,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(out); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("结果 %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryRecordsWithOptions(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	for _, age := range []float64{30, 20, 40, 10} {
+		if err := ms.InsertRecord("c", "d", Row{"id": age / 10, "age": age}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := ms.QueryRecords("c", "d", map[string]interface{}{"age": op(">", 10.0)}, &QueryOptions{
+		OrderBy: []SortKey{{Field: "age", Desc: true}},
+		Limit:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(rows); !reflect.DeepEqual(got, []interface{}{4.0, 3.0}) {
+		t.Fatalf("查询结果 %v", got)
+	}
+}
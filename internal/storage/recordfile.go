@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sudatas/internal/security"
+)
+
+// 记录文件（data.sudb 及其 .bak）格式：
+//
+//	"SUDB" | 格式版本(1字节) | 检查点 LSN(8字节) | 内容
+//
+// 内容为 CryptoManager.SealSM4（SM4-GCM）加密的 JSON 记录数组，内容之前的文件头作为附加数据参与认证，
+// 篡改格式版本或检查点 LSN 都会导致解密失败。检查点 LSN 是写入时最近一条预写日志的序号，
+// 重放日志时跳过不大于它的条目，即使保存后清空日志失败也不会重复应用。
+// 没有文件头的明文 JSON 是旧版本写入的，只用于读取，加载后会改写为当前格式。
+const (
+	recordFileMagic = "SUDB"
+
+	recordFormatSM4GCM byte = 1 // SM4-GCM，文件头带检查点 LSN
+
+	recordHeaderSize = len(recordFileMagic) + 1 + 8 // 文件头：魔数、格式版本和检查点 LSN
+)
+
+// encodeRecordFile 将记录编码为加密的记录文件内容，lsn 为记录对应的检查点
+func encodeRecordFile(crypto *security.CryptoManager, records []Row, lsn uint64) ([]byte, error) {
+	if records == nil {
+		records = []Row{}
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("序列化数据失败: %w", err)
+	}
+
+	header := make([]byte, recordHeaderSize)
+	copy(header, recordFileMagic)
+	header[len(recordFileMagic)] = recordFormatSM4GCM
+	binary.BigEndian.PutUint64(header[len(recordFileMagic)+1:], lsn)
+	encrypted, err := crypto.SealSM4(data, header)
+	if err != nil {
+		return nil, fmt.Errorf("加密数据失败: %w", err)
+	}
+	return append(header, encrypted...), nil
+}
+
+// recordFile 解码后的记录文件
+type recordFile struct {
+	records []Row
+	lsn     uint64 // 检查点 LSN，旧格式的文件为 0
+	legacy  bool   // 文件是旧格式，需要重新写入
+}
+
+// decodeRecordFile 解码记录文件内容，同时支持当前格式和旧版本的明文格式
+func decodeRecordFile(crypto *security.CryptoManager, data []byte) (*recordFile, error) {
+	if !bytes.HasPrefix(data, []byte(recordFileMagic)) {
+		var records []Row
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("解析数据失败: %w", err)
+		}
+		return &recordFile{records: records, legacy: true}, nil
+	}
+
+	if len(data) == len(recordFileMagic) {
+		return nil, fmt.Errorf("记录文件缺少格式版本")
+	}
+	if format := data[len(recordFileMagic)]; format != recordFormatSM4GCM {
+		return nil, fmt.Errorf("不支持的记录文件格式版本: %d", format)
+	}
+	if len(data) < recordHeaderSize {
+		return nil, fmt.Errorf("记录文件头不完整")
+	}
+
+	file := &recordFile{lsn: binary.BigEndian.Uint64(data[len(recordFileMagic)+1 : recordHeaderSize])}
+	plain, err := crypto.OpenSM4(data[recordHeaderSize:], data[:recordHeaderSize])
+	if err != nil {
+		return nil, fmt.Errorf("解密数据失败: %w", err)
+	}
+	if err := json.Unmarshal(plain, &file.records); err != nil {
+		return nil, fmt.Errorf("解析数据失败: %w", err)
+	}
+	return file, nil
+}
+
+// readRecordFile 读取并解码记录文件
+func readRecordFile(crypto *security.CryptoManager, path string) (*recordFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecordFile(crypto, data)
+}
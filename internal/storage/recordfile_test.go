@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRecordFileRoundTrip(t *testing.T) {
+	cm := newTestCrypto(t)
+	records := []Row{{"name": "a", "n": 1.0}, {"name": "b", "n": 2.0}}
+
+	data, err := encodeRecordFile(cm, records, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := decodeRecordFile(cm, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.lsn != 42 || file.legacy || !reflect.DeepEqual(file.records, records) {
+		t.Fatalf("解码结果 %+v", file)
+	}
+
+	// 文件头参与认证，篡改检查点 LSN 会被发现
+	tampered := append([]byte(nil), data...)
+	tampered[recordHeaderSize-1] ^= 1
+	if _, err := decodeRecordFile(cm, tampered); err == nil {
+		t.Fatal("篡改检查点 LSN 后的记录文件解码成功")
+	}
+
+	// 篡改密文会被发现
+	data[len(data)-1] ^= 1
+	if _, err := decodeRecordFile(cm, data); err == nil {
+		t.Fatal("篡改后的记录文件解码成功")
+	}
+	if _, err := decodeRecordFile(cm, []byte(recordFileMagic+"\x01\x00")); err == nil {
+		t.Fatal("文件头不完整的记录文件解码成功")
+	}
+}
+
+func TestRecordFileLegacyFormat(t *testing.T) {
+	cm := newTestCrypto(t)
+	records := []Row{{"name": "a"}}
+	plain, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有文件头的明文 JSON
+	file, err := decodeRecordFile(cm, plain)
+	if err != nil || !file.legacy || file.lsn != 0 || !reflect.DeepEqual(file.records, records) {
+		t.Fatalf("明文格式解码结果 %+v, %v", file, err)
+	}
+
+	if _, err := decodeRecordFile(cm, []byte(recordFileMagic+"\x09")); err == nil {
+		t.Fatal("未知格式版本解码成功")
+	}
+}
+
+func TestStoreFilesEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+	ms := NewMemoryStore(dir, cm)
+	if err := ms.InsertRecord("c", "d", Row{"ssn": "123-45-6789"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	// 第二次保存产生 .bak，修改写入预写日志
+	if err := ms.InsertRecord("c", "d", Row{"ssn": "987-65-4321"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.InsertRecord("c", "d", Row{"ssn": "555-55-5555"}); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+
+	for _, name := range []string{"d/data.sudb", "d/data.sudb.bak", walFileName} {
+		data, err := os.ReadFile(filepath.Join(dir, "c", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"123-45-6789", "987-65-4321", "555-55-5555", "ssn"} {
+			if bytes.Contains(data, []byte(plain)) {
+				t.Fatalf("%s 中有明文 %q", name, plain)
+			}
+		}
+	}
+
+	// 使用其他密钥时无法读取
+	other := NewMemoryStore(dir, newTestCrypto(t))
+	if n := len(other.data["c"]["d"]); n != 0 {
+		t.Fatalf("用其他密钥读出了 %d 条记录", n)
+	}
+	other.Stop()
+}
+
+func TestLoadPlaintextRecordFile(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+	dataPath := filepath.Join(dir, "c", "d", "data.sudb")
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := json.MarshalIndent([]Row{{"name": "a"}, {"name": "b"}}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dataPath, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧版本的明文文件可以读取，加载后改写为加密格式
+	ms := NewMemoryStore(dir, cm)
+	if n := countRows(t, ms, "c", "d", nil); n != 2 {
+		t.Fatalf("读取明文文件得到 %d 条记录", n)
+	}
+	ms.Stop()
+	for _, path := range []string{dataPath, dataPath + ".bak"} {
+		file, err := readRecordFile(cm, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.legacy || len(file.records) != 2 {
+			t.Fatalf("%s 没有改写为当前格式: %+v", path, file)
+		}
+	}
+}
+
+func TestLoadFallsBackToBackup(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+	ms := NewMemoryStore(dir, cm)
+	for i := 0; i < 3; i++ {
+		if err := ms.InsertRecord("c", "d", Row{"i": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms.Stop()
+
+	// 数据文件损坏时从加载时生成的备份恢复
+	ms = NewMemoryStore(dir, cm)
+	ms.Stop()
+	dataPath := filepath.Join(dir, "c", "d", "data.sudb")
+	if err := os.WriteFile(dataPath, []byte(recordFileMagic+"garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "c", "d", nil); n != 3 {
+		t.Fatalf("从备份恢复了 %d 条记录", n)
+	}
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sudatas/internal/auth"
+	"sudatas/internal/security"
+)
+
+// 访问令牌的明文形式为 sdt_<ID>_<密钥>，只在签发时返回一次。
+// 服务端按 ID 查找令牌，只保存密钥的 SM3 摘要
+const (
+	tokenPrefix     = "sdt_"
+	tokenIDSize     = 8
+	tokenSecretSize = 32
+)
+
+// APIToken 用户的访问令牌
+type APIToken struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	User      string                `json:"user"`
+	Hash      []byte                `json:"hash"`            // 令牌密钥的 SM3 摘要
+	Scope     []auth.PermissionRule `json:"scope,omitempty"` // 令牌可以使用的权限，为空表示用户的全部权限
+	CreatedAt time.Time             `json:"created_at"`
+	ExpiresAt time.Time             `json:"expires_at"` // 零值表示不过期
+	LastUsed  time.Time             `json:"last_used"`
+}
+
+// Expired 令牌是否已过期
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Allows 令牌的权限范围是否包含 res 上的 perm 权限
+func (t *APIToken) Allows(perm auth.Permission, res auth.Resource) bool {
+	if len(t.Scope) == 0 {
+		return true
+	}
+	for _, rule := range t.Scope {
+		if rule.Permission != perm || rule.Resource.Type != res.Type {
+			continue
+		}
+		if rule.Resource.Name == "" || auth.MatchWildcard(rule.Resource.Name, res.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenInfo 令牌的公开信息，不含摘要
+type TokenInfo struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	User      string                `json:"user"`
+	Scope     []auth.PermissionRule `json:"scope,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+	ExpiresAt time.Time             `json:"expires_at"`
+	LastUsed  time.Time             `json:"last_used"`
+	Expired   bool                  `json:"expired"`
+}
+
+// loadTokens 加载加密保存的访问令牌，文件不存在时没有令牌
+func (um *UserManager) loadTokens() error {
+	data, err := os.ReadFile(um.tokenFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取令牌数据失败: %w", err)
+	}
+
+	decrypted, err := um.crypto.DecryptSM4(data)
+	if err != nil {
+		return fmt.Errorf("解密令牌数据失败: %w", err)
+	}
+	var tokens []*APIToken
+	if err := json.Unmarshal(decrypted, &tokens); err != nil {
+		return fmt.Errorf("解析令牌数据失败: %w", err)
+	}
+	for _, token := range tokens {
+		um.tokens[token.ID] = token
+	}
+	return nil
+}
+
+// saveTokens 加密保存访问令牌，调用方需持有写锁
+func (um *UserManager) saveTokens() error {
+	tokens := make([]*APIToken, 0, len(um.tokens))
+	for _, token := range um.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化令牌数据失败: %w", err)
+	}
+	encrypted, err := um.crypto.EncryptSM4(data)
+	if err != nil {
+		return fmt.Errorf("加密令牌数据失败: %w", err)
+	}
+	if err := security.WriteFileAtomic(um.tokenFile, encrypted, 0600); err != nil {
+		return fmt.Errorf("保存令牌数据失败: %w", err)
+	}
+	return nil
+}
+
+// CreateToken 为用户签发访问令牌，返回只出现这一次的令牌明文。ttl 为 0 表示不过期
+func (um *UserManager) CreateToken(username, name string, scope []auth.PermissionRule, ttl time.Duration) (string, *TokenInfo, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if _, exists := um.users[username]; !exists {
+		return "", nil, fmt.Errorf("用户不存在")
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("令牌名称不能为空")
+	}
+	if um.findTokenLocked(username, name) != nil {
+		return "", nil, fmt.Errorf("用户 %s 已有名为 %s 的令牌", username, name)
+	}
+
+	idBytes, err := security.RandomBytes(tokenIDSize)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := security.RandomBytes(tokenSecretSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	token := &APIToken{
+		ID:        hex.EncodeToString(idBytes),
+		Name:      name,
+		User:      username,
+		Hash:      tokenHash(secret),
+		Scope:     scope,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		token.ExpiresAt = now.Add(ttl)
+	}
+
+	um.tokens[token.ID] = token
+	if err := um.saveTokens(); err != nil {
+		delete(um.tokens, token.ID)
+		return "", nil, err
+	}
+
+	plain := tokenPrefix + token.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return plain, token.info(now), nil
+}
+
+// ListTokens 列出用户的访问令牌，username 为空时列出所有用户的令牌
+func (um *UserManager) ListTokens(username string) []*TokenInfo {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	now := time.Now()
+	var infos []*TokenInfo
+	for _, token := range um.tokens {
+		if username == "" || token.User == username {
+			infos = append(infos, token.info(now))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].User != infos[j].User {
+			return infos[i].User < infos[j].User
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// RevokeToken 吊销用户名为 name 的令牌
+func (um *UserManager) RevokeToken(username, name string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	token := um.findTokenLocked(username, name)
+	if token == nil {
+		return fmt.Errorf("令牌不存在: %s", name)
+	}
+	delete(um.tokens, token.ID)
+	return um.saveTokens()
+}
+
+// TokenExists 用户是否有名为 name 的令牌
+func (um *UserManager) TokenExists(username, name string) bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return um.findTokenLocked(username, name) != nil
+}
+
+// ValidateToken 校验令牌明文，返回令牌。令牌不存在、已过期或所属用户不能登录时返回错误
+func (um *UserManager) ValidateToken(plain string) (*APIToken, error) {
+	id, secret, ok := parseToken(plain)
+	if !ok {
+		return nil, fmt.Errorf("无效的令牌格式")
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	token, exists := um.tokens[id]
+	if !exists || subtle.ConstantTimeCompare(tokenHash(secret), token.Hash) != 1 {
+		return nil, fmt.Errorf("令牌无效")
+	}
+	now := time.Now()
+	if err := um.checkTokenLocked(token, now); err != nil {
+		return nil, err
+	}
+
+	// 最后使用时间只在内存中更新，随下一次保存令牌数据写入
+	token.LastUsed = now
+	copied := *token
+	return &copied, nil
+}
+
+// CheckToken 检查已登录会话使用的令牌是否仍然有效：没有被吊销、没有过期，所属用户仍然可以登录
+func (um *UserManager) CheckToken(id string) error {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	token, exists := um.tokens[id]
+	if !exists {
+		return fmt.Errorf("令牌已被吊销")
+	}
+	return um.checkTokenLocked(token, time.Now())
+}
+
+func (um *UserManager) checkTokenLocked(token *APIToken, now time.Time) error {
+	if token.Expired(now) {
+		return fmt.Errorf("令牌已过期")
+	}
+	user, exists := um.users[token.User]
+	if !exists || user.Status != "active" {
+		return fmt.Errorf("令牌所属用户不能登录")
+	}
+	return nil
+}
+
+// removeUserTokensLocked 删除用户的全部令牌，返回是否有删除，调用方需持有写锁
+func (um *UserManager) removeUserTokensLocked(username string) bool {
+	removed := false
+	for id, token := range um.tokens {
+		if token.User == username {
+			delete(um.tokens, id)
+			removed = true
+		}
+	}
+	return removed
+}
+
+func (um *UserManager) findTokenLocked(username, name string) *APIToken {
+	for _, token := range um.tokens {
+		if token.User == username && token.Name == name {
+			return token
+		}
+	}
+	return nil
+}
+
+func (t *APIToken) info(now time.Time) *TokenInfo {
+	return &TokenInfo{
+		ID:        t.ID,
+		Name:      t.Name,
+		User:      t.User,
+		Scope:     t.Scope,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		LastUsed:  t.LastUsed,
+		Expired:   t.Expired(now),
+	}
+}
+
+// IsToken 凭据是否为访问令牌的明文形式
+func IsToken(credential string) bool {
+	return strings.HasPrefix(credential, tokenPrefix)
+}
+
+// parseToken 拆分令牌明文中的 ID 和密钥
+func parseToken(plain string) (id string, secret []byte, ok bool) {
+	if !IsToken(plain) {
+		return "", nil, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(plain, tokenPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[0]) != tokenIDSize*2 {
+		return "", nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(secret) != tokenSecretSize {
+		return "", nil, false
+	}
+	return parts[0], secret, true
+}
+
+// tokenHash 令牌密钥是高熵的随机数，直接保存 SM3 摘要即可
+func tokenHash(secret []byte) []byte {
+	return security.SM3Sum(secret)
+}
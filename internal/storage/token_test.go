@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sudatas/internal/auth"
+)
+
+func newTokenUsers(t *testing.T) (*UserManager, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	um, err := NewUserManager(filename, newTestCrypto(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := um.CreateUser("bob", "Secret-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	return um, filename
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	um, filename := newTokenUsers(t)
+	scope := []auth.PermissionRule{{Permission: auth.PermSelect, Resource: auth.Resource{Type: auth.ResDatabase, Name: "c.*"}}}
+
+	plain, info, err := um.CreateToken("bob", "ci", scope, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsToken(plain) || info.User != "bob" || info.ExpiresAt.IsZero() || info.Expired {
+		t.Fatalf("签发的令牌 %s %+v", plain, info)
+	}
+	if _, _, err := um.CreateToken("bob", "ci", nil, 0); err == nil {
+		t.Fatal("同名令牌签发成功")
+	}
+	if _, _, err := um.CreateToken("ghost", "ci", nil, 0); err == nil {
+		t.Fatal("为不存在的用户签发了令牌")
+	}
+
+	// 令牌数据中只有摘要
+	data, err := os.ReadFile(um.tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := um.crypto.DecryptSM4(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := plain[strings.LastIndex(plain, "_")+1:]
+	if strings.Contains(string(decrypted), secret) {
+		t.Fatal("令牌数据中保存了令牌明文")
+	}
+
+	// 重新加载后仍可使用
+	reloaded, err := NewUserManager(filename, um.crypto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := reloaded.ValidateToken(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.User != "bob" || token.Name != "ci" || len(token.Scope) != 1 {
+		t.Fatalf("令牌 %+v", token)
+	}
+	if infos := reloaded.ListTokens("bob"); len(infos) != 1 || infos[0].LastUsed.IsZero() {
+		t.Fatalf("令牌列表 %+v", infos)
+	}
+
+	if err := reloaded.RevokeToken("bob", "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.ValidateToken(plain); err == nil {
+		t.Fatal("吊销的令牌校验成功")
+	}
+	if err := reloaded.CheckToken(token.ID); err == nil {
+		t.Fatal("吊销的令牌仍然有效")
+	}
+	if err := reloaded.RevokeToken("bob", "ci"); err == nil {
+		t.Fatal("重复吊销成功")
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	um, _ := newTokenUsers(t)
+	plain, _, err := um.CreateToken("bob", "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := plain[len(tokenPrefix) : len(tokenPrefix)+tokenIDSize*2]
+	for _, bad := range []string{
+		"",
+		"Secret-1",
+		plain + "x",
+		plain[:len(plain)-2] + "AA",
+		tokenPrefix + id,
+		strings.Replace(plain, id, strings.Repeat("0", len(id)), 1),
+	} {
+		if _, err := um.ValidateToken(bad); err == nil {
+			t.Errorf("接受了无效的令牌 %q", bad)
+		}
+	}
+
+	// 过期的令牌和被锁定用户的令牌
+	expired, _, err := um.CreateToken("bob", "old", nil, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := um.ValidateToken(expired); err == nil {
+		t.Fatal("过期的令牌校验成功")
+	}
+	if err := um.LockUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := um.ValidateToken(plain); err == nil {
+		t.Fatal("被锁定用户的令牌校验成功")
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	db := func(name string) auth.Resource { return auth.Resource{Type: auth.ResDatabase, Name: name} }
+	token := &APIToken{Scope: []auth.PermissionRule{
+		{Permission: auth.PermSelect, Resource: db("c.*")},
+		{Permission: auth.PermInsert, Resource: db("c.log")},
+	}}
+	tests := []struct {
+		perm  auth.Permission
+		res   auth.Resource
+		allow bool
+	}{
+		{auth.PermSelect, db("c.a"), true},
+		{auth.PermSelect, db("d.a"), false},
+		{auth.PermInsert, db("c.log"), true},
+		{auth.PermInsert, db("c.a"), false},
+		{auth.PermDelete, db("c.log"), false},
+		{auth.PermSelect, auth.Resource{Type: auth.ResUser, Name: "c.a"}, false},
+	}
+	for _, tt := range tests {
+		if got := token.Allows(tt.perm, tt.res); got != tt.allow {
+			t.Errorf("%s %s: %v", tt.perm, tt.res.Name, got)
+		}
+	}
+	if !(&APIToken{}).Allows(auth.PermDelete, db("x.y")) {
+		t.Fatal("没有范围的令牌应有用户的全部权限")
+	}
+}
+
+func TestDropUserRemovesTokens(t *testing.T) {
+	um, _ := newTokenUsers(t)
+	plain, _, err := um.CreateToken("bob", "ci", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := um.DropUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if len(um.ListTokens("")) != 0 {
+		t.Fatal("删除用户后令牌仍然存在")
+	}
+	if _, err := um.ValidateToken(plain); err == nil {
+		t.Fatal("已删除用户的令牌校验成功")
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 更新运算符。更新文档中不以 $ 开头的键等同于 $set
+const (
+	UpdSet          = "$set"          // 设置字段值
+	UpdSetIfMissing = "$setIfMissing" // 仅在字段不存在或为 null 时设置
+	UpdInc          = "$inc"          // 数值加上给定值，字段不存在时视为 0
+	UpdMul          = "$mul"          // 数值乘以给定值，字段不存在时视为 0
+	UpdUnset        = "$unset"        // 删除字段
+	UpdPush         = "$push"         // 向数组末尾追加元素，字段不存在时创建数组
+	UpdPull         = "$pull"         // 从数组中删除所有与给定值相等的元素
+)
+
+var updateOps = map[string]bool{
+	UpdSet:          true,
+	UpdSetIfMissing: true,
+	UpdInc:          true,
+	UpdMul:          true,
+	UpdUnset:        true,
+	UpdPush:         true,
+	UpdPull:         true,
+}
+
+// UpdateOp 作用于单个字段的更新操作
+type UpdateOp struct {
+	Op    string
+	Field string
+	Value interface{}
+}
+
+// UpdateDoc 解析后的更新文档
+type UpdateDoc struct {
+	Ops []UpdateOp
+}
+
+// UpdateResult 更新结果
+type UpdateResult struct {
+	Matched  int `json:"matched"`  // 满足过滤条件的记录数
+	Modified int `json:"modified"` // 内容实际发生变化的记录数
+}
+
+// ParseUpdate 解析更新文档，例如 {"title": "x", "$inc": {"likes": 1}, "$unset": {"draft": true}}。
+// 同一字段（或存在包含关系的字段）只能出现在一个操作中
+func ParseUpdate(doc map[string]interface{}) (*UpdateDoc, error) {
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("更新内容不能为空")
+	}
+
+	u := &UpdateDoc{}
+	for key, value := range doc {
+		if !strings.HasPrefix(key, "$") {
+			u.Ops = append(u.Ops, UpdateOp{Op: UpdSet, Field: key, Value: value})
+			continue
+		}
+		if !updateOps[key] {
+			return nil, fmt.Errorf("不支持的更新运算符: %s", key)
+		}
+		fields, ok := value.(map[string]interface{})
+		if !ok || len(fields) == 0 {
+			return nil, fmt.Errorf("%s 的值必须是非空的 {字段: 值} 对象", key)
+		}
+		for field, v := range fields {
+			if (key == UpdInc || key == UpdMul) && !isNumber(v) {
+				return nil, fmt.Errorf("%s 的值必须是数字: %s", key, field)
+			}
+			u.Ops = append(u.Ops, UpdateOp{Op: key, Field: field, Value: v})
+		}
+	}
+
+	// 按字段排序，保证应用顺序稳定
+	sort.Slice(u.Ops, func(i, j int) bool {
+		return u.Ops[i].Field < u.Ops[j].Field
+	})
+	for i, op := range u.Ops {
+		if _, err := ParsePath(op.Field); err != nil {
+			return nil, err
+		}
+		for _, prev := range u.Ops[:i] {
+			if PathsOverlap(prev.Field, op.Field) {
+				return nil, fmt.Errorf("字段 %s 与 %s 不能在同一次更新中同时修改", prev.Field, op.Field)
+			}
+		}
+	}
+	return u, nil
+}
+
+// Touches 更新是否会修改指定字段（包括其子字段或包含它的字段）
+func (u *UpdateDoc) Touches(field string) bool {
+	for _, op := range u.Ops {
+		if PathsOverlap(op.Field, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumber 值是否为数字
+func isNumber(v interface{}) bool {
+	_, ok := toFloat64(v)
+	return ok
+}
+
+// Apply 将更新应用到记录的副本上，返回新记录和内容是否发生变化；出错时原记录不受影响
+func (u *UpdateDoc) Apply(record Row) (Row, bool, error) {
+	updated := CloneRow(record)
+	modified := false
+
+	for _, op := range u.Ops {
+		old, exists := GetPath(updated, op.Field)
+
+		var value interface{}
+		switch op.Op {
+		case UpdSet:
+			value = CloneValue(op.Value)
+
+		case UpdSetIfMissing:
+			if exists && old != nil {
+				continue
+			}
+			value = CloneValue(op.Value)
+
+		case UpdInc, UpdMul:
+			delta, _ := toFloat64(op.Value)
+			current := 0.0
+			if exists {
+				f, ok := toFloat64(old)
+				if !ok {
+					return nil, false, fmt.Errorf("字段 %s 不是数字，不能执行 %s", op.Field, op.Op)
+				}
+				current = f
+			}
+			if op.Op == UpdInc {
+				value = current + delta
+			} else {
+				value = current * delta
+			}
+
+		case UpdUnset:
+			if DeletePath(updated, op.Field) {
+				modified = true
+			}
+			continue
+
+		case UpdPush:
+			var arr []interface{}
+			if exists {
+				a, ok := old.([]interface{})
+				if !ok {
+					return nil, false, fmt.Errorf("字段 %s 不是数组，不能执行 %s", op.Field, op.Op)
+				}
+				arr = a
+			}
+			value = append(arr, CloneValue(op.Value))
+
+		case UpdPull:
+			if !exists {
+				continue
+			}
+			arr, ok := old.([]interface{})
+			if !ok {
+				return nil, false, fmt.Errorf("字段 %s 不是数组，不能执行 %s", op.Field, op.Op)
+			}
+			kept := make([]interface{}, 0, len(arr))
+			for _, item := range arr {
+				if !valuesEqual(item, op.Value) {
+					kept = append(kept, item)
+				}
+			}
+			value = kept
+		}
+
+		if exists && valuesEqual(old, value) {
+			continue
+		}
+		if err := SetPath(updated, op.Field, value); err != nil {
+			return nil, false, err
+		}
+		modified = true
+	}
+
+	return updated, modified, nil
+}
+
+// CloneRow 深拷贝记录
+func CloneRow(record Row) Row {
+	if record == nil {
+		return nil
+	}
+	clone := make(Row, len(record))
+	for k, v := range record {
+		clone[k] = CloneValue(v)
+	}
+	return clone
+}
+
+// CloneValue 深拷贝JSON值（对象和数组）
+func CloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			clone[k] = CloneValue(item)
+		}
+		return clone
+	case Row:
+		return CloneRow(val)
+	case []interface{}:
+		clone := make([]interface{}, len(val))
+		for i, item := range val {
+			clone[i] = CloneValue(item)
+		}
+		return clone
+	}
+	return v
+}
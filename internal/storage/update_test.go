@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      map[string]interface{}
+		record   string
+		want     string
+		modified bool
+	}{
+		{"直接赋值", map[string]interface{}{"likes": 5.0, "ok": true, "n": nil},
+			`{"likes": 3}`, `{"likes": 5, "ok": true, "n": null}`, true},
+		{"$set 嵌套字段", map[string]interface{}{UpdSet: map[string]interface{}{"author.name": "Z", "stats.views": 1.0}},
+			`{"author": {"name": "A"}}`, `{"author": {"name": "Z"}, "stats": {"views": 1}}`, true},
+		{"$inc 缺少的字段视为 0", map[string]interface{}{UpdInc: map[string]interface{}{"likes": 2.0, "neg": -3.0}},
+			`{"likes": 3}`, `{"likes": 5, "neg": -3}`, true},
+		{"$mul", map[string]interface{}{UpdMul: map[string]interface{}{"score": 1.5, "none": 2.0}},
+			`{"score": 2}`, `{"score": 3, "none": 0}`, true},
+		{"$unset", map[string]interface{}{UpdUnset: map[string]interface{}{"draft": 1.0, "author.name": 1.0}},
+			`{"draft": true, "author": {"name": "A", "age": 3}}`, `{"author": {"age": 3}}`, true},
+		{"$push", map[string]interface{}{UpdPush: map[string]interface{}{"tags": "x", "list": "y"}},
+			`{"tags": ["a"]}`, `{"tags": ["a", "x"], "list": ["y"]}`, true},
+		{"$pull 删除所有相等的元素", map[string]interface{}{UpdPull: map[string]interface{}{"old": 1.0, "missing": 1.0}},
+			`{"old": [1, 2, 1]}`, `{"old": [2]}`, true},
+		{"$setIfMissing 只设置缺失或为 null 的字段", map[string]interface{}{UpdSetIfMissing: map[string]interface{}{"d": "def", "likes": 0.0, "e": 1.0}},
+			`{"d": null, "likes": 3}`, `{"d": "def", "likes": 3, "e": 1}`, true},
+		{"值相同时不算修改", map[string]interface{}{"likes": 3.0, UpdPull: map[string]interface{}{"tags": "zz"}},
+			`{"likes": 3, "tags": ["a"]}`, `{"likes": 3, "tags": ["a"]}`, false},
+		{"删除不存在的字段不算修改", map[string]interface{}{UpdUnset: map[string]interface{}{"missing": 1.0}},
+			`{"likes": 3}`, `{"likes": 3}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := ParseUpdate(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record := parseRows(t, "["+tt.record+"]")[0]
+			got, modified, err := u.Apply(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if modified != tt.modified {
+				t.Fatalf("modified 为 %v", modified)
+			}
+			if want := parseRows(t, "["+tt.want+"]")[0]; !reflect.DeepEqual(got, want) {
+				t.Fatalf("更新结果 %v\n期望 %v", got, want)
+			}
+			if !reflect.DeepEqual(record, parseRows(t, "["+tt.record+"]")[0]) {
+				t.Fatal("Apply 修改了原记录")
+			}
+		})
+	}
+}
+
+func TestParseUpdateErrors(t *testing.T) {
+	for _, doc := range []map[string]interface{}{
+		nil,
+		{"$bogus": map[string]interface{}{"a": 1.0}},
+		{UpdInc: map[string]interface{}{"a": "x"}},
+		{UpdMul: map[string]interface{}{"a": true}},
+		{UpdInc: 1.0},
+		{UpdPush: map[string]interface{}{}},
+		{"a": 1.0, UpdUnset: map[string]interface{}{"a.b": 1.0}},
+		{"a": 1.0, UpdInc: map[string]interface{}{"a": 1.0}},
+		{"a..b": 1.0},
+	} {
+		if _, err := ParseUpdate(doc); err == nil {
+			t.Errorf("接受了无效的更新文档 %v", doc)
+		}
+	}
+}
+
+func TestUpdateApplyTypeErrors(t *testing.T) {
+	record := Row{"s": "x", "n": 1.0}
+	for _, doc := range []map[string]interface{}{
+		{UpdInc: map[string]interface{}{"s": 1.0}},
+		{UpdPush: map[string]interface{}{"n": 1.0}},
+		{UpdPull: map[string]interface{}{"s": "x"}},
+		{UpdSet: map[string]interface{}{"s.x": 1.0}},
+	} {
+		u, err := ParseUpdate(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := u.Apply(record); err == nil {
+			t.Errorf("%v: 期望类型错误", doc)
+		}
+	}
+	if !reflect.DeepEqual(record, Row{"s": "x", "n": 1.0}) {
+		t.Fatalf("失败的更新修改了记录: %v", record)
+	}
+}
+
+func TestUpdateRecordsResult(t *testing.T) {
+	ms := NewMemoryStore(t.TempDir(), newTestCrypto(t))
+	defer ms.Stop()
+	for _, row := range []Row{{"id": 1.0, "n": 1.0}, {"id": 2.0, "n": 5.0}, {"id": 3.0, "n": "x"}} {
+		if err := ms.InsertRecord("c", "d", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 满足条件的两条记录中只有一条的值发生变化
+	result, err := ms.UpdateRecords("c", "d", map[string]interface{}{"n": 5.0}, map[string]interface{}{"id": op("<=", 2.0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (UpdateResult{Matched: 2, Modified: 1}) {
+		t.Fatalf("更新结果 %+v", result)
+	}
+
+	// 任何一条记录更新失败时整个操作不生效
+	if _, err := ms.UpdateRecords("c", "d", map[string]interface{}{UpdInc: map[string]interface{}{"n": 1.0}}, nil); err == nil {
+		t.Fatal("对字符串执行 $inc 没有报错")
+	}
+	if n := countRows(t, ms, "c", "d", map[string]interface{}{"n": 5.0}); n != 2 {
+		t.Fatalf("失败的更新修改了记录，n = 5 的记录有 %d 条", n)
+	}
+}
@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"sudatas/internal/auth"
 	"sudatas/internal/security"
@@ -17,16 +20,26 @@ type UserManager struct {
 	users    map[string]*User
 	crypto   *security.CryptoManager
 	filename string
+	permFile string // 角色和授权数据，与用户数据放在同一目录
 	permMgr  *auth.PermissionManager
+	policy   security.PasswordPolicy
+
+	tokenFile string               // 访问令牌数据，与用户数据放在同一目录
+	tokens    map[string]*APIToken // 令牌 ID -> 令牌
 }
 
 // User 用户信息
 type User struct {
-	Username    string   `json:"username"`
-	Password    string   `json:"password"` // SM4加密存储
-	Permissions []string `json:"permissions"`
-	Roles       []string `json:"roles"`  // 新增
-	Status      string   `json:"status"` // 新增：active/locked/disabled
+	Username    string                 `json:"username"`
+	Password    string                 `json:"password,omitempty"` // 旧版本保存的明文口令，下次登录成功后升级为 Credential
+	Credential  *security.PasswordHash `json:"credential,omitempty"`
+	Permissions []string               `json:"permissions"`
+	Roles       []string               `json:"roles"`  // 权限数据中用户角色的副本
+	Status      string                 `json:"status"` // 新增：active/locked/disabled
+
+	PasswordChangedAt  time.Time                `json:"password_changed_at"`
+	MustChangePassword bool                     `json:"must_change_password,omitempty"` // 下次登录后必须先修改口令
+	PasswordHistory    []*security.PasswordHash `json:"password_history,omitempty"`     // 最近使用过的口令凭据，不含当前口令
 }
 
 // NewUserManager 创建用户管理器
@@ -35,54 +48,101 @@ func NewUserManager(filename string, crypto *security.CryptoManager) (*UserManag
 		users:    make(map[string]*User),
 		crypto:   crypto,
 		filename: filename,
+		permFile: filepath.Join(filepath.Dir(filename), "permission.sudb"),
 		permMgr:  auth.NewPermissionManager(),
+		policy:   security.DefaultPasswordPolicy(),
+
+		tokenFile: filepath.Join(filepath.Dir(filename), "token.sudb"),
+		tokens:    make(map[string]*APIToken),
 	}
 
-	// 如果文件不存在，创建默认用户
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		// 创建默认管理员用户
-		if err := um.CreateUser("root", "123456", []string{"admin"}); err != nil {
-			return nil, err
-		}
-		return um, nil
+	// 旧格式加密的用户数据先重新加密，避免解密失败后被当作损坏文件重建。
+	// 无法恢复时停止启动，由管理员从备份恢复或删除文件后重新初始化 root 用户
+	if migrated, err := crypto.MigrateFile(filename); err != nil {
+		return nil, fmt.Errorf("迁移用户数据失败，请从备份恢复 %s，或删除该文件后重新初始化 root 用户: %w", filename, err)
+	} else if migrated {
+		log.Printf("已将用户数据重新加密为当前格式: %s", filename)
 	}
 
-	// 读取并解密用户数据
-	data, err := os.ReadFile(filename)
+	// 加载角色和授权，解密失败时不能当作没有授权继续运行
+	permLoaded, err := um.loadPermissions()
 	if err != nil {
-		return nil, fmt.Errorf("读取用户数据失败: %w", err)
+		return nil, err
 	}
 
-	// 如果文件为空，创建默认用户
-	if len(data) == 0 {
-		if err := um.CreateUser("root", "123456", []string{"admin"}); err != nil {
-			return nil, err
-		}
+	if err := um.loadTokens(); err != nil {
+		return nil, err
+	}
+
+	// 文件不存在或为空时为首次启动，由 BootstrapRoot 创建 root 用户
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
 		return um, nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("读取用户数据失败: %w", err)
+	}
 
-	// 解密数据
+	// 解密失败时不能当作首次启动重建用户数据
 	decrypted, err := crypto.DecryptSM4(data)
 	if err != nil {
-		// 如果解密失败，重新创建用户文件
-		if err := um.CreateUser("root", "123456", []string{"admin"}); err != nil {
+		return nil, fmt.Errorf("解密用户数据失败: %w", err)
+	}
+	if err := json.Unmarshal(decrypted, &um.users); err != nil {
+		return nil, fmt.Errorf("解析用户数据失败: %w", err)
+	}
+	if um.users == nil {
+		um.users = make(map[string]*User)
+	}
+
+	// 旧版本没有记录口令修改时间，从现在开始计算有效期
+	migrated := false
+	for _, user := range um.users {
+		if user.PasswordChangedAt.IsZero() {
+			user.PasswordChangedAt = time.Now()
+			migrated = true
+		}
+	}
+	if migrated {
+		if err := um.Save(); err != nil {
 			return nil, err
 		}
-		return um, nil
 	}
 
-	// 解析用户数据
-	if err := json.Unmarshal(decrypted, &um.users); err != nil {
-		// 如果解析失败，重新创建用户文件
-		if err := um.CreateUser("root", "123456", []string{"admin"}); err != nil {
-			return nil, err
+	// 用户数据中的角色只是副本，以权限数据为准
+	if permLoaded {
+		for username, user := range um.users {
+			user.Roles = um.permMgr.UserRoles(username)
 		}
-		return um, nil
+	} else if err := um.rebuildPermissions(); err != nil {
+		return nil, err
 	}
 
 	return um, nil
 }
 
+// SetPasswordPolicy 设置口令策略
+func (um *UserManager) SetPasswordPolicy(policy security.PasswordPolicy) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.policy = policy
+}
+
+// NeedsBootstrap 是否为首次启动，还没有任何用户
+func (um *UserManager) NeedsBootstrap() bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return len(um.users) == 0
+}
+
+// BootstrapRoot 首次启动时用给定的口令创建 root 管理员
+func (um *UserManager) BootstrapRoot(password string) error {
+	if !um.NeedsBootstrap() {
+		return fmt.Errorf("已经存在用户，不能重新初始化 root")
+	}
+	return um.CreateUser("root", password, []string{"admin"})
+}
+
 // CreateUser 创建用户
 func (um *UserManager) CreateUser(username, password string, roles []string) error {
 	um.mu.Lock()
@@ -91,13 +151,26 @@ func (um *UserManager) CreateUser(username, password string, roles []string) err
 	if _, exists := um.users[username]; exists {
 		return fmt.Errorf("用户已存在")
 	}
+	if err := um.policy.Validate(username, password); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if !um.permMgr.RoleExists(role) {
+			return fmt.Errorf("角色不存在: %s", role)
+		}
+	}
 
-	// 直接存储密码（暂时不加密）
+	// 只保存加盐迭代的口令凭据
+	credential, err := security.NewPasswordHash(password)
+	if err != nil {
+		return err
+	}
 	user := &User{
-		Username: username,
-		Password: password,
-		Roles:    roles,
-		Status:   "active",
+		Username:          username,
+		Credential:        credential,
+		Roles:             roles,
+		Status:            "active",
+		PasswordChangedAt: time.Now(),
 	}
 
 	um.users[username] = user
@@ -109,21 +182,79 @@ func (um *UserManager) CreateUser(username, password string, roles []string) err
 		}
 	}
 
-	return um.Save()
+	if err := um.Save(); err != nil {
+		return err
+	}
+	return um.savePermissions()
 }
 
-// ValidateUser 验证用户
+// ValidateUser 验证用户，旧版本保存的明文口令验证成功后升级为口令凭据
 func (um *UserManager) ValidateUser(username, password string) bool {
+	um.mu.RLock()
+	user, exists := um.users[username]
+	if !exists || user.Status != "active" {
+		um.mu.RUnlock()
+		return false
+	}
+	credential, legacy := user.Credential, user.Credential == nil
+	legacyPassword := user.Password
+	um.mu.RUnlock()
+
+	if !legacy {
+		return credential.Verify(password)
+	}
+	if legacyPassword == "" || subtle.ConstantTimeCompare([]byte(legacyPassword), []byte(password)) != 1 {
+		return false
+	}
+	if credential, err := security.NewPasswordHash(password); err == nil {
+		if err := um.UpgradePassword(username, credential); err != nil {
+			log.Printf("升级用户 %s 的口令凭据失败: %v", username, err)
+		}
+	}
+	return true
+}
+
+// PasswordCredential 返回可以登录的用户的口令凭据，用于挑战-应答认证。
+// 旧版本保存明文口令的用户会临时生成凭据并返回 legacy 为 true，登录成功后应调用 UpgradePassword 保存
+func (um *UserManager) PasswordCredential(username string) (credential *security.PasswordHash, legacy bool, ok bool) {
 	um.mu.RLock()
 	defer um.mu.RUnlock()
 
 	user, exists := um.users[username]
 	if !exists || user.Status != "active" {
-		return false
+		return nil, false, false
+	}
+	if user.Credential != nil {
+		return user.Credential, false, true
+	}
+	if user.Password == "" {
+		return nil, false, false
 	}
 
-	// 直接比较密码（暂时不加密）
-	return user.Password == password
+	credential, err := security.NewPasswordHash(user.Password)
+	if err != nil {
+		log.Printf("生成用户 %s 的口令凭据失败: %v", username, err)
+		return nil, false, false
+	}
+	return credential, true, true
+}
+
+// UpgradePassword 将旧版本保存的明文口令替换为口令凭据
+func (um *UserManager) UpgradePassword(username string, credential *security.PasswordHash) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	if user.Credential != nil {
+		return nil
+	}
+
+	user.Credential = credential
+	user.Password = ""
+	return um.Save()
 }
 
 // Save 保存用户信息
@@ -153,6 +284,19 @@ func (um *UserManager) Save() error {
 	return nil
 }
 
+// Reencrypt 用当前密钥重写用户数据、权限数据和令牌数据文件
+func (um *UserManager) Reencrypt() error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	if err := um.Save(); err != nil {
+		return err
+	}
+	if err := um.savePermissions(); err != nil {
+		return err
+	}
+	return um.saveTokens()
+}
+
 // Load 加载用户信息
 func (um *UserManager) Load() error {
 	data, err := os.ReadFile(um.filename)
@@ -185,7 +329,7 @@ func (um *UserManager) CheckPermission(username string, perm auth.Permission, re
 	}
 
 	// 检查用户角色中是否包含 admin
-	for _, role := range user.Roles {
+	for _, role := range um.permMgr.UserRoles(username) {
 		if role == "admin" {
 			return true
 		}
@@ -194,6 +338,121 @@ func (um *UserManager) CheckPermission(username string, perm auth.Permission, re
 	return um.permMgr.CheckPermission(username, perm, res)
 }
 
+// UserExists 用户是否存在
+func (um *UserManager) UserExists(username string) bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	_, exists := um.users[username]
+	return exists
+}
+
+// ChangePassword 修改用户口令。新口令需满足口令策略，且不能与当前口令和最近使用过的口令相同
+func (um *UserManager) ChangePassword(username, password string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	if err := um.policy.Validate(username, password); err != nil {
+		return err
+	}
+	if um.passwordReused(user, password) {
+		return fmt.Errorf("新口令不能与最近使用过的 %d 个口令相同", um.policy.HistorySize)
+	}
+
+	credential, err := security.NewPasswordHash(password)
+	if err != nil {
+		return err
+	}
+
+	// 当前口令进入历史记录，只保留策略要求的个数
+	if user.Credential != nil && um.policy.HistorySize > 0 {
+		user.PasswordHistory = append([]*security.PasswordHash{user.Credential}, user.PasswordHistory...)
+	}
+	if len(user.PasswordHistory) > um.policy.HistorySize {
+		user.PasswordHistory = user.PasswordHistory[:um.policy.HistorySize]
+	}
+
+	user.Credential = credential
+	user.Password = ""
+	user.PasswordChangedAt = time.Now()
+	user.MustChangePassword = false
+	return um.Save()
+}
+
+// passwordReused 新口令是否与当前口令或历史记录中的口令相同，调用方需持有锁
+func (um *UserManager) passwordReused(user *User, password string) bool {
+	if um.policy.HistorySize <= 0 {
+		return false
+	}
+	if user.Credential != nil && user.Credential.Verify(password) {
+		return true
+	}
+	if user.Credential == nil && user.Password != "" &&
+		subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+		return true
+	}
+	for i, old := range user.PasswordHistory {
+		if i >= um.policy.HistorySize {
+			break
+		}
+		if old.Verify(password) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpirePassword 使用户的口令立即过期，下次登录后必须先修改口令
+func (um *UserManager) ExpirePassword(username string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在")
+	}
+	user.MustChangePassword = true
+	return um.Save()
+}
+
+// PasswordExpired 用户的口令是否已过期或被要求修改
+func (um *UserManager) PasswordExpired(username string) bool {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	user, exists := um.users[username]
+	if !exists {
+		return false
+	}
+	return user.MustChangePassword || um.policy.Expired(user.PasswordChangedAt, time.Now())
+}
+
+// DropUser 删除用户及其角色和直接权限
+func (um *UserManager) DropUser(username string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if _, exists := um.users[username]; !exists {
+		return fmt.Errorf("用户不存在")
+	}
+
+	delete(um.users, username)
+	um.permMgr.RemoveUser(username)
+	if um.removeUserTokensLocked(username) {
+		if err := um.saveTokens(); err != nil {
+			return err
+		}
+	}
+	if err := um.Save(); err != nil {
+		return err
+	}
+	return um.savePermissions()
+}
+
 // LockUser 锁定用户
 func (um *UserManager) LockUser(username string) error {
 	um.mu.Lock()
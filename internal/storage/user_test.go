@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sudatas/internal/security"
+)
+
+// writeLegacyUsers 按旧版本的格式写入保存明文口令的用户数据
+func writeLegacyUsers(t *testing.T, filename string, crypto *security.CryptoManager, users map[string]*User) {
+	t.Helper()
+	data, err := json.Marshal(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.EncryptSM4(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateUserStoresCredential(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := um.BootstrapRoot("Admin-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := cm.DecryptSM4(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(plain), "Admin-pass-1") || strings.Contains(string(plain), `"password"`) {
+		t.Fatalf("用户数据中保存了口令: %s", plain)
+	}
+
+	reloaded, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.ValidateUser("root", "Admin-pass-1") || reloaded.ValidateUser("root", "admin-pass-1") {
+		t.Fatal("重新加载后口令校验结果错误")
+	}
+}
+
+func TestLegacyPasswordUpgrade(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	writeLegacyUsers(t, filename, cm, map[string]*User{
+		"root":  {Username: "root", Password: "123456", Roles: []string{"admin"}, Status: "active"},
+		"alice": {Username: "alice", Password: "alice-pw", Roles: []string{"readonly"}, Status: "active"},
+	})
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 挑战-应答登录：临时生成凭据，登录成功后保存
+	credential, legacy, ok := um.PasswordCredential("root")
+	if !ok || !legacy || !credential.Verify("123456") {
+		t.Fatalf("旧用户的凭据 %+v, legacy=%v, ok=%v", credential, legacy, ok)
+	}
+	if err := um.UpgradePassword("root", credential); err != nil {
+		t.Fatal(err)
+	}
+
+	// 口令校验失败时不升级，成功后升级
+	if um.ValidateUser("alice", "wrong") {
+		t.Fatal("错误的口令校验成功")
+	}
+	if _, legacy, _ := um.PasswordCredential("alice"); !legacy {
+		t.Fatal("校验失败后升级了口令")
+	}
+	if !um.ValidateUser("alice", "alice-pw") {
+		t.Fatal("旧用户的口令校验失败")
+	}
+
+	reloaded, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, password := range map[string]string{"root": "123456", "alice": "alice-pw"} {
+		user := reloaded.users[name]
+		if user.Password != "" || user.Credential == nil {
+			t.Fatalf("用户 %s 没有升级: %+v", name, user)
+		}
+		if _, legacy, ok := reloaded.PasswordCredential(name); !ok || legacy {
+			t.Fatalf("用户 %s 仍按旧口令处理", name)
+		}
+		if !reloaded.ValidateUser(name, password) {
+			t.Fatalf("用户 %s 升级后口令校验失败", name)
+		}
+	}
+}
+
+func TestPasswordCredentialUnavailable(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	writeLegacyUsers(t, filename, cm, map[string]*User{
+		"locked": {Username: "locked", Password: "pw", Status: "locked"},
+		"empty":  {Username: "empty", Status: "active"},
+	})
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"locked", "empty", "missing"} {
+		if _, _, ok := um.PasswordCredential(name); ok {
+			t.Errorf("用户 %s 可以登录", name)
+		}
+	}
+	if um.ValidateUser("locked", "pw") || um.ValidateUser("empty", "") {
+		t.Fatal("不能登录的用户校验成功")
+	}
+}
+
+func TestChangePasswordHistory(t *testing.T) {
+	um, err := NewUserManager(filepath.Join(t.TempDir(), "user.sudb"), newTestCrypto(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := security.DefaultPasswordPolicy()
+	policy.HistorySize = 2
+	um.SetPasswordPolicy(policy)
+	if err := um.CreateUser("bob", "short", nil); err == nil {
+		t.Fatal("创建用户时接受了不满足策略的口令")
+	}
+	if err := um.CreateUser("bob", "Secret-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		password string
+		ok       bool
+	}{
+		{"Secret-1", false}, // 当前口令
+		{"weak", false},
+		{"Secret-2", true},
+		{"Secret-3", true},
+		{"Secret-1", false}, // 仍在最近 2 个旧口令中
+		{"Secret-2", false},
+		{"Secret-4", true},
+		{"Secret-1", true}, // 已超出历史记录
+	}
+	for i, step := range steps {
+		err := um.ChangePassword("bob", step.password)
+		if (err == nil) != step.ok {
+			t.Fatalf("第 %d 步修改为 %s: %v", i+1, step.password, err)
+		}
+	}
+	if !um.ValidateUser("bob", "Secret-1") || len(um.users["bob"].PasswordHistory) != 2 {
+		t.Fatalf("修改后的口令历史 %d 个", len(um.users["bob"].PasswordHistory))
+	}
+}
+
+func TestPasswordExpiry(t *testing.T) {
+	cm := newTestCrypto(t)
+	filename := filepath.Join(t.TempDir(), "user.sudb")
+	um, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := um.BootstrapRoot("Admin-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := um.BootstrapRoot("Admin-pass-2"); err == nil {
+		t.Fatal("重复初始化 root 成功")
+	}
+	if err := um.CreateUser("bob", "Secret-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if um.PasswordExpired("bob") {
+		t.Fatal("新口令已过期")
+	}
+
+	// 管理员要求修改口令，重新加载后仍然有效，修改后解除
+	if err := um.ExpirePassword("bob"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewUserManager(filename, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.PasswordExpired("bob") {
+		t.Fatal("重新加载后口令没有过期")
+	}
+	if err := reloaded.ChangePassword("bob", "Secret-2"); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.PasswordExpired("bob") {
+		t.Fatal("修改后口令仍然过期")
+	}
+
+	// 超过有效期
+	reloaded.users["bob"].PasswordChangedAt = time.Now().Add(-security.DefaultPasswordPolicy().MaxAge - time.Hour)
+	if !reloaded.PasswordExpired("bob") {
+		t.Fatal("超过有效期的口令没有过期")
+	}
+	if err := reloaded.ExpirePassword("missing"); err == nil {
+		t.Fatal("不存在的用户口令过期成功")
+	}
+}
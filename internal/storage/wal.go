@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sudatas/internal/security"
+)
+
+// WALSyncMode 预写日志的刷盘方式
+type WALSyncMode int
+
+const (
+	// WALSyncAlways 每次提交都 fsync 后才返回
+	WALSyncAlways WALSyncMode = iota
+	// WALSyncGroup 组提交：写入后等待后台定时 fsync，多个并发提交合并为一次 fsync
+	WALSyncGroup
+)
+
+const (
+	walFileName = "wal.log"
+
+	// 默认的组提交间隔
+	defaultGroupCommitInterval = 10 * time.Millisecond
+
+	// 单条日志的长度上限，超过视为日志损坏
+	maxWALEntrySize = 256 << 20
+
+	// 日志内容的格式：首字节为格式版本，其余部分是加密的 JSON
+	walFormatSM4GCM byte = 1 // CryptoManager.EncryptSM4（SM4-GCM）
+)
+
+// 日志条目类型
+const (
+	walCheckpoint = "checkpoint" // 检查点：此前的修改都已保存到数据文件
+	walCreate     = "create"     // 创建空数据库（Database 为空时只创建集合）
+	walInsert     = "insert"
+	walUpdate     = "update"
+	walDelete     = "delete"
+	walTx         = "tx"    // 事务在本集合上的全部操作
+	walAbort      = "abort" // 同一序号的事务日志没有全部写入，重放时跳过
+)
+
+// walEntry 预写日志条目
+type walEntry struct {
+	LSN          uint64                 `json:"lsn"`
+	Type         string                 `json:"type"`
+	Database     string                 `json:"db,omitempty"`
+	Record       Row                    `json:"record,omitempty"`
+	Update       map[string]interface{} `json:"update,omitempty"`
+	Filter       map[string]interface{} `json:"filter,omitempty"`
+	Ops          []*walEntry            `json:"ops,omitempty"`          // walTx: 本集合上的操作
+	Participants []string               `json:"participants,omitempty"` // walTx: 事务涉及的所有集合
+}
+
+// wal 按集合划分的预写日志。
+// 每条日志为 4 字节长度 + 4 字节 CRC32 + 加密的 JSON 内容，末尾写了一半的条目在恢复时丢弃。
+type wal struct {
+	dataDir  string
+	crypto   *security.CryptoManager
+	mode     WALSyncMode
+	interval time.Duration
+	files    map[string]*os.File // 按集合打开的日志文件
+
+	// 组提交状态
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written uint64 // 已写入的条目序号
+	synced  uint64 // 已刷盘的条目序号
+	pending map[*os.File]bool
+	syncErr error
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func newWAL(dataDir string, crypto *security.CryptoManager, mode WALSyncMode, interval time.Duration) *wal {
+	if interval <= 0 {
+		interval = defaultGroupCommitInterval
+	}
+	w := &wal{
+		dataDir:  dataDir,
+		crypto:   crypto,
+		mode:     mode,
+		interval: interval,
+		files:    make(map[string]*os.File),
+		pending:  make(map[*os.File]bool),
+		stop:     make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	if mode == WALSyncGroup {
+		go w.flushLoop()
+	}
+	return w
+}
+
+// readWAL 读取集合的日志，返回检查点 LSN 和之后的条目。
+// 末尾不完整或校验失败的条目会被截掉，避免之后追加的日志跟在损坏数据后面
+func readWAL(crypto *security.CryptoManager, path string) (uint64, []*walEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, nil
+		}
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	var checkpoint uint64
+	var entries []*walEntry
+	var offset int64
+	reader := bufio.NewReader(f)
+	header := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF {
+				log.Printf("预写日志 %s 末尾不完整，已丢弃: %v", path, err)
+			}
+			break
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		sum := binary.BigEndian.Uint32(header[4:])
+		if size > maxWALEntrySize {
+			log.Printf("预写日志 %s 在偏移 %d 处损坏，已丢弃之后的内容", path, offset)
+			break
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			log.Printf("预写日志 %s 末尾不完整，已丢弃: %v", path, err)
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			log.Printf("预写日志 %s 在偏移 %d 处校验失败，已丢弃之后的内容", path, offset)
+			break
+		}
+
+		entry, err := decodeWALEntry(crypto, payload)
+		if err != nil {
+			log.Printf("预写日志 %s 在偏移 %d 处解析失败，已丢弃之后的内容: %v", path, offset, err)
+			break
+		}
+		offset += int64(len(header) + len(payload))
+
+		if entry.Type == walCheckpoint {
+			checkpoint = entry.LSN
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return 0, nil, fmt.Errorf("截断预写日志失败: %w", err)
+	}
+	return checkpoint, entries, nil
+}
+
+// open 打开集合的日志文件用于追加
+func (w *wal) open(collection string) (*os.File, error) {
+	if f, ok := w.files[collection]; ok {
+		return f, nil
+	}
+
+	dir := filepath.Join(w.dataDir, collection)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建集合目录失败: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开预写日志失败: %w", err)
+	}
+	// 日志文件可能是新建的，刷新目录后追加的条目才不会随文件项一起丢失
+	if err := syncCollectionDirs(w.dataDir, collection); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("刷新集合目录失败: %w", err)
+	}
+	w.files[collection] = f
+	return f, nil
+}
+
+// append 追加一条日志，返回用于 wait 的序号。调用方需持有 MemoryStore 的写锁
+func (w *wal) append(collection string, entry *walEntry) (uint64, error) {
+	f, err := w.open(collection)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeWALEntry(w.crypto, f, entry); err != nil {
+		return 0, err
+	}
+
+	if w.mode == WALSyncAlways {
+		if err := f.Sync(); err != nil {
+			return 0, fmt.Errorf("预写日志刷盘失败: %w", err)
+		}
+		return 0, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written++
+	w.pending[f] = true
+	return w.written, nil
+}
+
+// size 返回集合日志的当前长度，追加失败时用于回退。调用方需持有 MemoryStore 的写锁
+func (w *wal) size(collection string) (int64, error) {
+	f, err := w.open(collection)
+	if err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("读取预写日志失败: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// truncate 将集合的日志截回 size，撤销之后追加的条目。调用方需持有 MemoryStore 的写锁
+func (w *wal) truncate(collection string, size int64) error {
+	f, err := w.open(collection)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("截断预写日志失败: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("预写日志刷盘失败: %w", err)
+	}
+	return nil
+}
+
+// writeWALEntry 编码、加密并写入一条日志
+func writeWALEntry(crypto *security.CryptoManager, f *os.File, entry *walEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化预写日志失败: %w", err)
+	}
+	encrypted, err := crypto.EncryptSM4(data)
+	if err != nil {
+		return fmt.Errorf("加密预写日志失败: %w", err)
+	}
+	payload := append([]byte{walFormatSM4GCM}, encrypted...)
+
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[8:], payload)
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("写入预写日志失败: %w", err)
+	}
+	return nil
+}
+
+// decodeWALEntry 解密并解析一条日志
+func decodeWALEntry(crypto *security.CryptoManager, payload []byte) (*walEntry, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("日志内容为空")
+	}
+	if payload[0] != walFormatSM4GCM {
+		return nil, fmt.Errorf("不支持的日志格式版本: %d", payload[0])
+	}
+	data, err := crypto.DecryptSM4(payload[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var entry walEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// wait 等待序号对应的日志刷盘。调用方不能持有 MemoryStore 的锁，以便多个提交合并刷盘
+func (w *wal) wait(ticket uint64) error {
+	if ticket == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.synced < ticket && w.syncErr == nil {
+		w.cond.Wait()
+	}
+	return w.syncErr
+}
+
+// flushLoop 组提交模式下定时刷盘
+func (w *wal) flushLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.stop:
+			w.flush()
+			return
+		}
+	}
+}
+
+func (w *wal) flush() {
+	w.mu.Lock()
+	target := w.written
+	files := w.pending
+	w.pending = make(map[*os.File]bool)
+	w.mu.Unlock()
+
+	if len(files) == 0 {
+		return
+	}
+
+	var syncErr error
+	for f := range files {
+		if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+			syncErr = fmt.Errorf("预写日志刷盘失败: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	if syncErr != nil {
+		w.syncErr = syncErr
+	}
+	if target > w.synced {
+		w.synced = target
+	}
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// reset 检查点之后清空集合的日志，只保留一条检查点记录。调用方需持有 MemoryStore 的写锁
+func (w *wal) reset(collection string, lsn uint64) error {
+	f, err := w.open(collection)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("截断预写日志失败: %w", err)
+	}
+	if err := writeWALEntry(w.crypto, f, &walEntry{LSN: lsn, Type: walCheckpoint}); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("预写日志刷盘失败: %w", err)
+	}
+	return nil
+}
+
+// closeFiles 刷盘并关闭已打开的日志文件，之后追加时会重新打开。调用方需持有 MemoryStore 的写锁
+func (w *wal) closeFiles() {
+	w.flush()
+	for collection, f := range w.files {
+		if err := f.Sync(); err != nil {
+			log.Printf("预写日志刷盘失败 [%s]: %v", collection, err)
+		}
+		f.Close()
+	}
+	w.files = make(map[string]*os.File)
+}
+
+// close 停止组提交并关闭所有日志文件
+func (w *wal) close() {
+	w.once.Do(func() {
+		if w.mode == WALSyncGroup {
+			close(w.stop)
+		}
+		w.closeFiles()
+	})
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// crash 模拟进程崩溃：不做检查点，只关闭日志文件
+func crash(ms *MemoryStore) {
+	ms.mu.Lock()
+	ms.wal.closeFiles()
+	ms.mu.Unlock()
+}
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	for _, mode := range []WALSyncMode{WALSyncAlways, WALSyncGroup} {
+		dir := t.TempDir()
+		cm := newTestCrypto(t)
+
+		ms := NewMemoryStore(dir, cm, WithWALSync(mode))
+		for i := 0; i < 5; i++ {
+			if err := ms.InsertRecord("c", "d", Row{"i": float64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := ms.UpdateRecords("c", "d", map[string]interface{}{"$inc": map[string]interface{}{"i": 10}}, map[string]interface{}{"i": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ms.DeleteRecords("c", "d", map[string]interface{}{"i": 2}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ms.CreateDatabase("e", "empty"); err != nil {
+			t.Fatal(err)
+		}
+		crash(ms)
+
+		ms = NewMemoryStore(dir, cm, WithWALSync(mode))
+		if n := countRows(t, ms, "c", "d", nil); n != 4 {
+			t.Fatalf("模式 %d: 重放后有 %d 条记录，期望 4 条", mode, n)
+		}
+		if n := countRows(t, ms, "c", "d", map[string]interface{}{"i": 11}); n != 1 {
+			t.Fatalf("模式 %d: 更新没有重放", mode)
+		}
+		if _, exists := ms.data["e"]["empty"]; !exists {
+			t.Fatalf("模式 %d: 创建的空数据库没有重放", mode)
+		}
+		ms.Stop()
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	for i := 0; i < 3; i++ {
+		if err := ms.InsertRecord("c", "d", Row{"i": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if _, entries, err := readWAL(cm, filepath.Join(dir, "c", walFileName)); err != nil || len(entries) != 0 {
+		t.Fatalf("检查点后日志中还有 %d 条: %v", len(entries), err)
+	}
+
+	file, err := readRecordFile(cm, filepath.Join(dir, "c", "d", "data.sudb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.lsn != ms.lsn || file.legacy {
+		t.Fatalf("数据文件的检查点 LSN 为 %d，期望 %d", file.lsn, ms.lsn)
+	}
+
+	if err := ms.InsertRecord("c", "d", Row{"i": 3.0}); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "c", "d", nil); n != 4 {
+		t.Fatalf("重放后有 %d 条记录，期望 4 条", n)
+	}
+}
+
+func TestWALResetFailure(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	for i := 0; i < 3; i++ {
+		if err := ms.InsertRecord("c", "d", Row{"i": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 数据文件写入成功，但清空日志失败
+	ms.mu.Lock()
+	ms.wal.files["c"].Close()
+	err := ms.saveLocked()
+	dirty := ms.dirty
+	ms.mu.Unlock()
+	if err == nil {
+		t.Fatal("清空日志失败时保存返回成功")
+	}
+	if !dirty {
+		t.Fatal("清空日志失败后修改标记被清除")
+	}
+	crash(ms)
+
+	// 日志中的条目已包含在数据文件中，重放时不能重复应用
+	ms = NewMemoryStore(dir, cm)
+	if n := countRows(t, ms, "c", "d", nil); n != 3 {
+		t.Fatalf("重放后有 %d 条记录，期望 3 条", n)
+	}
+	if !ms.dirty {
+		t.Fatal("日志中有未清空的条目时没有标记为已修改")
+	}
+
+	// 之后的修改照常重放
+	if err := ms.InsertRecord("c", "d", Row{"i": 3.0}); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "c", "d", nil); n != 4 {
+		t.Fatalf("重放后有 %d 条记录，期望 4 条", n)
+	}
+}
+
+func TestSaveFailureKeepsDataFile(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	if err := ms.InsertRecord("c", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.InsertRecord("c", "d", Row{"i": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 临时文件的位置被目录占用，新的数据文件写不进去
+	dataPath := filepath.Join(dir, "c", "d", "data.sudb")
+	if err := os.Mkdir(dataPath+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SaveToDisk(); err == nil {
+		t.Fatal("写入数据文件失败时保存返回成功")
+	}
+	crash(ms)
+
+	// 原来的数据文件仍在原处，日志没有被清空
+	file, err := readRecordFile(cm, dataPath)
+	if err != nil {
+		t.Fatalf("保存失败后数据文件不可读: %v", err)
+	}
+	if len(file.records) != 1 {
+		t.Fatalf("数据文件有 %d 条记录，期望 1 条", len(file.records))
+	}
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "c", "d", nil); n != 2 {
+		t.Fatalf("重放后有 %d 条记录，期望 2 条", n)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	if err := ms.InsertRecord("c", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+
+	// 末尾写了一半的条目
+	f, err := os.OpenFile(filepath.Join(dir, "c", walFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 50, 1, 2})
+	f.Close()
+
+	ms = NewMemoryStore(dir, cm)
+	if n := countRows(t, ms, "c", "d", nil); n != 1 {
+		t.Fatalf("重放后有 %d 条记录，期望 1 条", n)
+	}
+	// 损坏的尾部已被截掉，之后追加的条目可以读到
+	if err := ms.InsertRecord("c", "d", Row{"i": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if n := countRows(t, ms, "c", "d", nil); n != 2 {
+		t.Fatalf("重放后有 %d 条记录，期望 2 条", n)
+	}
+}
+
+func TestWALPartialTransaction(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCrypto(t)
+
+	ms := NewMemoryStore(dir, cm)
+	if err := ms.InsertRecord("a", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.InsertRecord("b", "d", Row{"i": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	tx := ms.Begin()
+	tx.InsertRecord("a", "d", Row{"i": 2.0})
+	tx.InsertRecord("b", "d", Row{"i": 2.0})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	crash(ms)
+
+	// 去掉 b 日志中的事务条目，模拟崩溃时事务只写入了 a
+	path := filepath.Join(dir, "b", walFileName)
+	_, entries, err := readWAL(cm, path)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("读取到 %d 条日志: %v", len(entries), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeWALEntry(cm, f, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ms = NewMemoryStore(dir, cm)
+	defer ms.Stop()
+	if countRows(t, ms, "a", "d", nil) != 1 || countRows(t, ms, "b", "d", nil) != 1 {
+		t.Fatal("只写入了一部分的事务被重放")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"log"
 	"net"
@@ -22,6 +23,34 @@ var (
 	dataDir    = flag.String("data", "./data", "用户数据目录")
 	builtinDir = "./builtin" // 系统文件目录
 	maxClient  = flag.Int("max-clients", 1000, "最大客户端连接数")
+	walSync    = flag.String("wal-sync", "always", "预写日志刷盘方式: always 每次提交刷盘, group 组提交")
+	walGroup   = flag.Duration("wal-group-interval", 10*time.Millisecond, "组提交的刷盘间隔")
+	masterFile = flag.String("master-key-file", "", "主密钥文件，应放在与数据目录分开的挂载点上")
+	masterEnv  = flag.String("master-key-env", security.DefaultMasterKeyEnv, "保存主密钥的环境变量")
+	masterAsk  = flag.Bool("master-passphrase", false, "启动时从终端读取主密钥口令")
+
+	// 登录失败锁定策略
+	lockoutUser     = flag.Int("lockout-user-failures", 5, "同一用户连续登录失败多少次后临时锁定，0 表示不锁定")
+	lockoutIP       = flag.Int("lockout-ip-failures", 20, "同一来源 IP 连续登录失败多少次后临时锁定，0 表示不锁定")
+	lockoutWindow   = flag.Duration("lockout-window", 15*time.Minute, "登录失败次数的统计窗口")
+	lockoutDuration = flag.Duration("lockout-duration", time.Minute, "第一次锁定的时长，之后每次锁定翻倍")
+	lockoutMax      = flag.Duration("lockout-max-duration", time.Hour, "锁定时长的上限")
+
+	// 口令策略
+	passMinLength  = flag.Int("password-min-length", 8, "口令的最小长度")
+	passMinClasses = flag.Int("password-min-classes", 3, "口令至少包含的字符类别数（小写、大写、数字、其他）")
+	passMaxAge     = flag.Duration("password-max-age", 90*24*time.Hour, "口令有效期，过期后必须修改，0 表示不过期")
+	passHistory    = flag.Int("password-history", 5, "新口令不能与最近多少个口令相同")
+
+	// 首次启动时 root 口令的来源
+	rootPassFile = flag.String("root-password-file", "", "首次启动时读取 root 口令的文件")
+	rootPassEnv  = flag.String("root-password-env", security.DefaultRootPasswordEnv, "首次启动时提供 root 口令的环境变量")
+	rootPassAsk  = flag.Bool("root-password-prompt", false, "首次启动时从终端读取 root 口令")
+
+	// 传输加密
+	tlsCert    = flag.String("tls-cert", "", "TLS 证书文件，与 -tls-key 同时设置时监听器只接受 TLS 连接")
+	tlsKey     = flag.String("tls-key", "", "TLS 私钥文件")
+	requireEnc = flag.Bool("require-encryption", false, "拒绝未使用 TLS 或国密会话模式的连接")
 )
 
 func main() {
@@ -43,20 +72,75 @@ func main() {
 		log.Fatalf("初始化加密管理器失败: %v", err)
 	}
 
+	// 读取主密钥，用于解密数据密钥
+	masterKey := security.MasterKeySource{File: *masterFile, Env: *masterEnv}
+	if *masterAsk {
+		masterKey.Prompt = os.Stdin
+	}
+	masterSecret, err := masterKey.Secret()
+	if err != nil {
+		log.Fatalf("读取主密钥失败: %v", err)
+	}
+
 	// 加载或创建密钥
 	keyFile := filepath.Join(builtinDir, "key.sudb")
-	if err := crypto.LoadKeys(keyFile); err != nil {
+	if err := crypto.LoadKeys(keyFile, masterSecret); err != nil {
 		log.Fatalf("加载密钥失败: %v", err)
 	}
 
+	// 预写日志配置
+	var storeOptions []storage.MemoryStoreOption
+	switch *walSync {
+	case "always":
+	case "group":
+		storeOptions = append(storeOptions,
+			storage.WithWALSync(storage.WALSyncGroup),
+			storage.WithGroupCommitInterval(*walGroup))
+	default:
+		log.Fatalf("无效的预写日志刷盘方式: %s", *walSync)
+	}
+
 	// 初始化存储引擎
-	engine, err := storage.NewEngine(*dataDir, builtinDir, crypto)
+	engine, err := storage.NewEngine(*dataDir, builtinDir, crypto, storeOptions...)
 	if err != nil {
 		log.Fatalf("初始化存储引擎失败: %v", err)
 	}
 
 	// 创建服务器
-	server, err := network.NewServer(engine, *maxClient)
+	lockout := network.LockoutPolicy{
+		MaxUserFailures: *lockoutUser,
+		MaxIPFailures:   *lockoutIP,
+		Window:          *lockoutWindow,
+		BaseDuration:    *lockoutDuration,
+		MaxDuration:     *lockoutMax,
+	}
+	passwordPolicy := security.PasswordPolicy{
+		MinLength:   *passMinLength,
+		MinClasses:  *passMinClasses,
+		MaxAge:      *passMaxAge,
+		HistorySize: *passHistory,
+	}
+	rootPassword := security.InitialPasswordSource{File: *rootPassFile, Env: *rootPassEnv}
+	if *rootPassAsk {
+		rootPassword.Prompt = os.Stdin
+	}
+	serverOptions := []network.ServerOption{
+		network.WithLockoutPolicy(lockout),
+		network.WithPasswordPolicy(passwordPolicy),
+		network.WithRootPassword(rootPassword.Password),
+		network.WithRequireEncryption(*requireEnc),
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("加载 TLS 证书失败: %v", err)
+		}
+		serverOptions = append(serverOptions, network.WithTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}))
+	}
+	server, err := network.NewServer(engine, *maxClient, serverOptions...)
 	if err != nil {
 		log.Fatalf("创建服务器失败: %v", err)
 	}